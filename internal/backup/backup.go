@@ -1,23 +1,35 @@
 package backup
 
 import (
-	"errors"
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/diogenes/omo-profiler/internal/config"
 )
 
-// BackupInfo contains information about a backup file
+// BackupInfo contains information about a backup
 type BackupInfo struct {
+	// Path is the backup's file, or for a stored backup its name inside
+	// StoreDir; read either with ReadFile.
 	Path      string
 	Timestamp time.Time
 	Name      string // filename without path
+	// Size is what the backup takes on disk: for a stored backup its
+	// compressed object, which identical snapshots share.
+	Size int64
+	// Object names a stored backup's object, so shared objects are counted
+	// once (see TotalSize); empty for plain backups.
+	Object string
+	// Operation is the write the backup was taken before, e.g. "switch
+	// work", and Source the front end that made it (SourceCLI, …); both
+	// empty for plain backups.
+	Operation string
+	Source    string
 }
 
 // timestampLayout names backups with nanosecond precision so rapid successive
@@ -25,9 +37,8 @@ type BackupInfo struct {
 //
 // Precision alone is not a uniqueness guarantee: two writers can read the same
 // wall clock (coarse clock sources repeat readings, and two omo-profiler
-// processes share no lock), and a truncating write would then destroy the
-// pre-image the other writer depends on for recovery. Uniqueness comes from
-// O_EXCL in createExclusive, not from the clock.
+// processes share no lock). Uniqueness comes from claiming names in the
+// store's index under its lock, not from the clock.
 //
 // parseLayout deliberately omits the fraction: time.Parse accepts an optional
 // fractional second after the seconds field regardless, so this one layout
@@ -45,40 +56,21 @@ const maxNameAttempts = 1000
 // now is a variable so tests can freeze the clock and force a collision.
 var now = time.Now
 
-// createExclusive claims an unused backup name at or after ts and returns the
-// open file. On collision it advances a nanosecond and retries, so the name
-// stays a plain timestamp — List, Restore and sort order need no special case.
-func createExclusive(dir, basename string, ts time.Time, perm os.FileMode) (*os.File, string, error) {
-	for i := 0; i < maxNameAttempts; i++ {
-		path := filepath.Join(dir, fmt.Sprintf("%s.bak.%s", basename, ts.Format(timestampLayout)))
-
-		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
-		if err == nil {
-			// O_CREATE applies the umask; set the mode explicitly so a 0600
-			// source stays 0600 and a 0644 one is not narrowed.
-			if err := f.Chmod(perm); err != nil {
-				// Cleanup only; the error that matters is already returned.
-				_ = f.Close()
-				_ = os.Remove(path)
-				return nil, "", err
-			}
-			return f, path, nil
-		}
-		if !errors.Is(err, fs.ErrExist) {
-			return nil, "", err
-		}
-		ts = ts.Add(time.Nanosecond)
-	}
-	return nil, "", fmt.Errorf("no free backup name for %s after %d attempts", basename, maxNameAttempts)
-}
-
 // Create creates a timestamped backup of the config file
 // Returns the backup path or error
 func Create(configPath string) (string, error) {
+	return create(configPath, "")
+}
+
+func create(configPath, operation string) (string, error) {
 	// Check if file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	info, err := os.Stat(configPath)
+	if os.IsNotExist(err) {
 		return "", fmt.Errorf("config file does not exist: %s", configPath)
 	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read config: %w", err)
+	}
 
 	// Read original
 	data, err := os.ReadFile(configPath)
@@ -86,36 +78,48 @@ func Create(configPath string) (string, error) {
 		return "", fmt.Errorf("failed to read config: %w", err)
 	}
 
-	// Inherit the source's mode: the document can hold API tokens, so a
-	// hard-coded 0644 would widen 0600 every time we back it up.
-	perm := os.FileMode(0o600)
-	if info, err := os.Stat(configPath); err == nil {
-		perm = info.Mode().Perm()
-	}
-
-	f, backupPath, err := createExclusive(config.OmoDir(), filepath.Base(configPath), now(), perm)
+	// The source's mode is recorded for a restore that recreates the file;
+	// the stored copy itself is owner-only.
+	backupPath, err := store(filepath.Base(configPath), data, info.Mode().Perm(), operation)
 	if err != nil {
 		return "", fmt.Errorf("failed to create backup: %w", err)
 	}
+	return backupPath, nil
+}
 
-	if _, err := f.Write(data); err != nil {
-		// A partial backup is worse than none: it would look like a valid
-		// pre-image. Discard it; the write error is what gets reported.
-		_ = f.Close()
-		_ = os.Remove(backupPath)
-		return "", fmt.Errorf("failed to write backup: %w", err)
+// List returns all backups of the target layer sorted by timestamp (most recent first)
+func List() ([]BackupInfo, error) {
+	backups, err := listStore()
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]bool{}
+	for _, b := range backups {
+		stored[b.Name] = true
 	}
-	if err := f.Close(); err != nil {
-		_ = os.Remove(backupPath)
-		return "", fmt.Errorf("failed to write backup: %w", err)
+	files, err := listFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range files {
+		// A file whose migration was interrupted is listed once.
+		if !stored[b.Name] {
+			backups = append(backups, b)
+		}
 	}
 
-	return backupPath, nil
+	// Sort by timestamp descending (most recent first)
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	return backups, nil
 }
 
-// List returns all backups sorted by timestamp (most recent first)
-func List() ([]BackupInfo, error) {
-	dir := config.OmoDir()
+// listFiles returns the plain backup files of the backup directory, which
+// versions before the store wrote.
+func listFiles() ([]BackupInfo, error) {
+	dir := config.BackupDir()
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -138,41 +142,133 @@ func List() ([]BackupInfo, error) {
 		if len(parts) != 2 {
 			continue
 		}
-		ts, err := time.Parse(parseLayout, parts[1])
+		// Names carry the local wall clock they were taken at.
+		ts, err := time.ParseInLocation(parseLayout, parts[1], time.Local)
 		if err != nil {
 			continue
 		}
 
+		var size int64
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+
 		backups = append(backups, BackupInfo{
 			Path:      filepath.Join(dir, name),
 			Timestamp: ts,
 			Name:      name,
+			Size:      size,
 		})
 	}
+	return backups, nil
+}
 
-	// Sort by timestamp descending (most recent first)
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Timestamp.After(backups[j].Timestamp)
-	})
+// backupBase returns the file a backup named name was taken of.
+func backupBase(name string) string {
+	base, _, _ := strings.Cut(name, ".bak.")
+	return base
+}
 
-	return backups, nil
+// Find returns the backup that ref names: its file name as List reports it, its
+// path, or its position in List, 1 being the most recent.
+func Find(ref string) (BackupInfo, error) {
+	backups, err := List()
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 1 || n > len(backups) {
+			return BackupInfo{}, fmt.Errorf("no backup #%d (%d backups)", n, len(backups))
+		}
+		return backups[n-1], nil
+	}
+	for _, b := range backups {
+		if b.Name == ref || b.Path == ref || b.Path == filepath.Clean(ref) {
+			return b, nil
+		}
+	}
+	return BackupInfo{}, fmt.Errorf("backup not found: %s", ref)
 }
 
-// Restore restores a backup to the config file
+// Restore replaces the target layer's document with the backup at
+// backupPath. Validating it against the schema is the caller's job, as for
+// every other write.
+//
+// The write is an ordinary document transaction: it takes the document lock
+// and backs up the document it replaces, so a restore is undone by restoring
+// that backup. An existing document keeps its mode; a missing one gets the
+// backup's, which is the mode the document had when it was backed up.
 func Restore(backupPath string) error {
-	// Read backup
-	data, err := os.ReadFile(backupPath)
+	data, perm, err := readBackup(backupPath)
+	if err != nil {
+		return err
+	}
+	restored, err := config.ParseDocument(data)
 	if err != nil {
-		return fmt.Errorf("failed to read backup: %w", err)
+		return fmt.Errorf("backup %s is not an omo document: %w", filepath.Base(backupPath), err)
 	}
 
-	// Write to config
-	configPath := config.OmoFile()
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	created := false
+	err = config.MutateWithPreSave("restore "+filepath.Base(backupPath), Before, func(doc *config.Document) error {
+		created = !doc.Exists
+		restored.Path, restored.Exists = doc.Path, doc.Exists
+		*doc = *restored
+		return nil
+	})
+	if !config.Saved(err) {
 		return fmt.Errorf("failed to restore config: %w", err)
 	}
+	if created {
+		if chmodErr := os.Chmod(config.DocumentFile(), perm); chmodErr != nil {
+			return chmodErr
+		}
+	}
+	return err
+}
+
+// RestoreProfile replaces profile name's block in the target layer's document
+// with the one the backup at backupPath holds, leaving every other key as it
+// is. It is a transaction like Restore.
+func RestoreProfile(backupPath, name string) error {
+	data, _, err := readBackup(backupPath)
+	if err != nil {
+		return err
+	}
+	restored, err := config.ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("backup %s is not an omo document: %w", filepath.Base(backupPath), err)
+	}
+	block, ok, err := restored.ProfileBlock(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("backup %s holds no profile %q", filepath.Base(backupPath), name)
+	}
+
+	err = config.MutateWithPreSave("restore "+name+" from "+filepath.Base(backupPath), Before, func(doc *config.Document) error {
+		doc.EnsureSchema()
+		return doc.SetProfileBlock(name, block)
+	})
+	if !config.Saved(err) {
+		return fmt.Errorf("failed to restore profile %q: %w", name, err)
+	}
+	return err
+}
 
-	return nil
+// readBackup reads a backup of the omo document and its mode. Backups of the
+// legacy config files are refused: they are not omo documents, migrate reads
+// them.
+func readBackup(backupPath string) ([]byte, os.FileMode, error) {
+	base, _, _ := strings.Cut(filepath.Base(backupPath), ".bak.")
+	if base == config.LegacyOpenagentBasename || base == config.LegacyOpencodeBasename {
+		return nil, 0, fmt.Errorf("backup %s is of legacy %s, not of the omo document", filepath.Base(backupPath), base)
+	}
+	data, perm, err := readWithMode(backupPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read backup: %w", err)
+	}
+	return data, perm, nil
 }
 
 func isBackupFile(name string) bool {
@@ -184,37 +280,59 @@ func isBackupFile(name string) bool {
 
 // Clean removes old backups, keeping only the N most recent
 func Clean(keepLast int) error {
+	_, err := Prune(keepLast)
+	return err
+}
+
+// Prune removes old backups, keeping only the keepLast most recent, and
+// returns the ones it removed.
+func Prune(keepLast int) ([]BackupInfo, error) {
 	backups, err := List()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(backups) <= keepLast {
-		return nil
+		return nil, nil
 	}
 
 	// Remove backups beyond keepLast
-	for i := keepLast; i < len(backups); i++ {
-		if err := os.Remove(backups[i].Path); err != nil {
-			return fmt.Errorf("failed to remove backup %s: %w", backups[i].Name, err)
-		}
+	removed := backups[max(keepLast, 0):]
+	if err := remove(removed); err != nil {
+		return nil, err
 	}
-
-	return nil
+	return removed, nil
 }
 
-// CreateOmoIfPresent snapshots ~/.omo/omo.json(c) before a mutating write.
+// CreateOmoIfPresent snapshots the target layer's omo.json(c) before a
+// mutating write.
 // A missing document is fine — there is nothing to back up yet.
 //
 // Every mutating entry point (CLI, TUI, web) goes through this, so "back up
 // before you write" is one rule with one implementation.
 func CreateOmoIfPresent() error {
-	path := config.OmoFile()
+	_, err := SnapshotOmo("")
+	return err
+}
+
+// Before is CreateOmoIfPresent recording operation, e.g. "set work.agents",
+// as what the backup was taken before. It is the pre-save hook
+// config.MutateWithPreSave takes.
+func Before(operation string) error {
+	_, err := SnapshotOmo(operation)
+	return err
+}
+
+// SnapshotOmo is Before returning the backup's path, "" when there is no
+// document, for callers that record which backup holds the state they
+// replace. A document identical to its most recent backup is not backed up
+// again; that backup's path is returned.
+func SnapshotOmo(operation string) (string, error) {
+	path := config.DocumentFile()
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil
+		return "", nil
 	} else if err != nil {
-		return err
+		return "", err
 	}
-	_, err := Create(path)
-	return err
+	return create(path, operation)
 }
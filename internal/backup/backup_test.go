@@ -39,13 +39,8 @@ func TestCreate(t *testing.T) {
 		t.Fatalf("Create() error = %v", err)
 	}
 
-	// Verify backup file exists
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		t.Errorf("backup file does not exist: %s", backupPath)
-	}
-
 	// Verify backup content matches original
-	backupContent, err := os.ReadFile(backupPath)
+	backupContent, err := ReadFile(backupPath)
 	if err != nil {
 		t.Fatalf("failed to read backup: %v", err)
 	}
@@ -373,7 +368,7 @@ func TestCreate_FrozenClockStillYieldsDistinctBackups(t *testing.T) {
 		}
 		paths[path] = true
 
-		got, err := os.ReadFile(path)
+		got, err := ReadFile(path)
 		if err != nil {
 			t.Fatalf("read back #%d: %v", i, err)
 		}
@@ -393,7 +388,7 @@ func TestCreate_FrozenClockStillYieldsDistinctBackups(t *testing.T) {
 	}
 	for i, b := range backups {
 		want := fmt.Sprintf(`{"gen":%d}`, writes-1-i) // List is most-recent-first
-		got, err := os.ReadFile(b.Path)
+		got, err := ReadFile(b.Path)
 		if err != nil {
 			t.Fatalf("read %s: %v", b.Name, err)
 		}
@@ -403,9 +398,9 @@ func TestCreate_FrozenClockStillYieldsDistinctBackups(t *testing.T) {
 	}
 }
 
-// The omo document can hold API tokens, so a backup must never be more
-// permissive than the file it copies. The mode is set explicitly rather than
-// left to the umask, which would narrow an 0644 source under a strict umask.
+// The omo document can hold API tokens, so a stored backup is owner-only
+// whatever the source's mode. The source's mode is recorded instead, for a
+// restore that recreates the document.
 func TestCreate_PreservesSourceMode(t *testing.T) {
 	for _, perm := range []os.FileMode{0o600, 0o644} {
 		t.Run(fmt.Sprintf("%o", perm), func(t *testing.T) {
@@ -422,13 +417,173 @@ func TestCreate_PreservesSourceMode(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Create: %v", err)
 			}
-			info, err := os.Stat(path)
+			_, got, err := readWithMode(path)
+			if err != nil {
+				t.Fatalf("read backup: %v", err)
+			}
+			if got != perm {
+				t.Fatalf("recorded mode %o, want %o — a restore would not recreate the source", got, perm)
+			}
+			objects, err := filepath.Glob(filepath.Join(StoreDir(), "objects", "*", "*"))
+			if err != nil || len(objects) != 1 {
+				t.Fatalf("objects %v (%v), want one", objects, err)
+			}
+			info, err := os.Stat(objects[0])
 			if err != nil {
-				t.Fatalf("stat backup: %v", err)
+				t.Fatalf("stat object: %v", err)
 			}
-			if got := info.Mode().Perm(); got != perm {
-				t.Fatalf("backup mode %o, want %o — a backup must not differ from its source", got, perm)
+			if got := info.Mode().Perm(); got != 0o600 {
+				t.Fatalf("object mode %o, want 600", got)
 			}
 		})
 	}
 }
+
+// A restore is a transaction like any other write: it backs up the document
+// it replaces, so restoring that backup undoes it, and it keeps the
+// document's mode rather than taking the backup's.
+func TestRestore_IsUndoable(t *testing.T) {
+	setupTestDir(t)
+	configPath := config.OmoFile()
+	original := []byte("{\n  // live\n  \"profiles\": {\"work\": {\"[opencode]\": {}}}\n}\n")
+	if err := os.WriteFile(configPath, original, 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	backupPath := filepath.Join(config.OmoDir(), config.OmoBasename+".bak.2025-01-16-120000")
+	if err := os.WriteFile(backupPath, []byte(`{"profiles": {}}`), 0o644); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+
+	if err := Restore(backupPath); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		t.Fatalf("stat config: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Errorf("restored config mode %o, want 0600", got)
+	}
+
+	backups, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("got %d backups, want the pre-restore one next to the restored one", len(backups))
+	}
+	if err := Restore(backups[0].Path); err != nil {
+		t.Fatalf("Restore(pre-restore backup) error = %v", err)
+	}
+	got, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if string(got) != string(original) {
+		t.Errorf("after undo config = %q, want %q", got, original)
+	}
+}
+
+func TestRestore_RefusesWhatIsNotADocumentBackup(t *testing.T) {
+	setupTestDir(t)
+	configPath := config.OmoFile()
+	if err := os.WriteFile(configPath, []byte(`{"original": true}`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	dir := config.OmoDir()
+	broken := filepath.Join(dir, config.OmoBasename+".bak.2025-01-16-120000")
+	if err := os.WriteFile(broken, []byte(`{"profiles": `), 0o644); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+	legacy := filepath.Join(dir, config.LegacyOpenagentBasename+".bak.2025-01-16-120000")
+	if err := os.WriteFile(legacy, []byte(`{}`), 0o644); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+
+	for _, path := range []string{broken, legacy} {
+		if err := Restore(path); err == nil {
+			t.Errorf("Restore(%s) should fail", filepath.Base(path))
+		}
+	}
+	got, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	if string(got) != `{"original": true}` {
+		t.Errorf("config changed by a failed restore: %q", got)
+	}
+	backups, err := List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("got %d backups, want no pre-restore backup from a failed restore", len(backups))
+	}
+}
+
+func TestRestoreProfile(t *testing.T) {
+	setupTestDir(t)
+	configPath := config.OmoFile()
+	if err := os.WriteFile(configPath, []byte(`{"theme": "dark", "profiles": {"work": {"[opencode]": {"theme": "new"}}, "home": {"[opencode]": {}}}}`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	backupPath := filepath.Join(config.OmoDir(), config.OmoBasename+".bak.2025-01-16-120000")
+	if err := os.WriteFile(backupPath, []byte(`{"theme": "light", "profiles": {"work": {"[opencode]": {"theme": "old"}}}}`), 0o644); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+
+	if err := RestoreProfile(backupPath, "home"); err == nil {
+		t.Fatal("RestoreProfile() of a profile the backup lacks should fail")
+	}
+	if err := RestoreProfile(backupPath, "work"); err != nil {
+		t.Fatalf("RestoreProfile() error = %v", err)
+	}
+
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument() error = %v", err)
+	}
+	work, _, _ := doc.ProfileBlock("work")
+	if string(work) != `{"[opencode]":{"theme":"old"}}` {
+		t.Errorf("work = %s, want the backed-up block", work)
+	}
+	if !doc.HasProfile("home") {
+		t.Error("home was removed by a single-profile restore")
+	}
+	if theme, _ := doc.Raw("theme"); string(theme) != `"dark"` {
+		t.Errorf("root theme = %s, want it untouched", theme)
+	}
+}
+
+func TestFind(t *testing.T) {
+	setupTestDir(t)
+	dir := config.OmoDir()
+	older := config.OmoBasename + ".bak.2025-01-15-100000"
+	newer := config.OmoBasename + ".bak.2025-01-16-100000"
+	for _, name := range []string{older, newer} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatalf("failed to create backup: %v", err)
+		}
+	}
+
+	for ref, want := range map[string]string{
+		"1":                       newer,
+		"2":                       older,
+		older:                     older,
+		filepath.Join(dir, newer): newer,
+	} {
+		got, err := Find(ref)
+		if err != nil {
+			t.Errorf("Find(%q) error = %v", ref, err)
+			continue
+		}
+		if got.Name != want {
+			t.Errorf("Find(%q) = %s, want %s", ref, got.Name, want)
+		}
+	}
+	for _, ref := range []string{"0", "3", "nope"} {
+		if _, err := Find(ref); err == nil {
+			t.Errorf("Find(%q) should fail", ref)
+		}
+	}
+}
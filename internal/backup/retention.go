@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Every mutating write leaves a snapshot of the document behind, so without
+// pruning the backup directory grows without bound. A Retention says which
+// backups to keep; the rest expire.
+//
+// The count rules combine: a backup is kept when any of them keeps it. The
+// size cap then trims what they keep, oldest first. Protected backups — the
+// most recent one, and those the caller names — are never removed, but still
+// count toward the cap.
+
+// Retention says which backups pruning keeps. The zero Retention keeps every
+// backup.
+type Retention struct {
+	// KeepLast keeps the most recent backups.
+	KeepLast int `json:"keepLast,omitempty"`
+	// KeepDaily keeps the most recent backup of each of the last KeepDaily
+	// days that have one.
+	KeepDaily int `json:"keepDaily,omitempty"`
+	// KeepWeekly keeps the most recent backup of each of the last KeepWeekly
+	// ISO weeks that have one.
+	KeepWeekly int `json:"keepWeekly,omitempty"`
+	// MaxTotalSize caps the bytes the kept backups take together; 0 is no cap.
+	MaxTotalSize int64 `json:"maxTotalSize,omitempty"`
+}
+
+// DefaultRetention applies when the settings configure none: a few weeks of
+// history without thousands of files.
+var DefaultRetention = Retention{KeepLast: 20, KeepDaily: 7, KeepWeekly: 4}
+
+// Unlimited reports whether r keeps every backup.
+func (r Retention) Unlimited() bool {
+	return r == Retention{}
+}
+
+func (r Retention) String() string {
+	if r.Unlimited() {
+		return "keep every backup"
+	}
+	var parts []string
+	for _, rule := range []struct {
+		label string
+		n     int
+	}{{"last", r.KeepLast}, {"daily", r.KeepDaily}, {"weekly", r.KeepWeekly}} {
+		if rule.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", rule.label, rule.n))
+		}
+	}
+	if r.MaxTotalSize > 0 {
+		parts = append(parts, "at most "+FormatSize(r.MaxTotalSize))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Expired returns the backups of list, most recent first as List returns
+// them, that r does not keep. The most recent backup and the names in
+// protected are always kept.
+func (r Retention) Expired(list []BackupInfo, protected map[string]bool) []BackupInfo {
+	if r.Unlimited() {
+		return nil
+	}
+	countRules := r.KeepLast > 0 || r.KeepDaily > 0 || r.KeepWeekly > 0
+	days, weeks := map[string]bool{}, map[string]bool{}
+	keep := make([]bool, len(list))
+	for i, b := range list {
+		day := b.Timestamp.Format("2006-01-02")
+		year, week := b.Timestamp.ISOWeek()
+		weekKey := fmt.Sprintf("%d-W%02d", year, week)
+
+		switch {
+		case i == 0 || protected[b.Name] || !countRules:
+			keep[i] = true
+		case i < r.KeepLast:
+			keep[i] = true
+		case !days[day] && len(days) < r.KeepDaily:
+			keep[i] = true
+		case !weeks[weekKey] && len(weeks) < r.KeepWeekly:
+			keep[i] = true
+		}
+		// A day or week counts once its most recent backup is seen, whether
+		// or not that backup was kept by another rule.
+		if len(days) < r.KeepDaily {
+			days[day] = true
+		}
+		if len(weeks) < r.KeepWeekly {
+			weeks[weekKey] = true
+		}
+	}
+
+	if r.MaxTotalSize > 0 {
+		// Protected backups stay, so their size is spent first; the rest
+		// fill what is left, most recent first. An object shared with a
+		// backup already kept costs nothing more.
+		var total int64
+		counted := map[string]bool{}
+		for i, b := range list {
+			if i == 0 || protected[b.Name] {
+				total += b.count(counted)
+			}
+		}
+		for i, b := range list {
+			if !keep[i] || i == 0 || protected[b.Name] {
+				continue
+			}
+			if b.Object == "" || !counted[b.Object] {
+				if total+b.Size > r.MaxTotalSize {
+					keep[i] = false
+					continue
+				}
+			}
+			total += b.count(counted)
+		}
+	}
+
+	var expired []BackupInfo
+	for i, b := range list {
+		if !keep[i] {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
+
+// TotalSize is what list takes on disk: each object stored backups share is
+// counted once.
+func TotalSize(list []BackupInfo) int64 {
+	var total int64
+	counted := map[string]bool{}
+	for _, b := range list {
+		total += b.count(counted)
+	}
+	return total
+}
+
+// count returns the bytes b adds to the backups already counted, and counts
+// its object.
+func (b BackupInfo) count(counted map[string]bool) int64 {
+	if b.Object == "" {
+		return b.Size
+	}
+	if counted[b.Object] {
+		return 0
+	}
+	counted[b.Object] = true
+	return b.Size
+}
+
+// Apply removes the backups r does not keep and returns them. Run it under
+// the document lock, so it cannot race the write of a new backup.
+func Apply(r Retention, protected map[string]bool) ([]BackupInfo, error) {
+	backups, err := List()
+	if err != nil {
+		return nil, err
+	}
+	expired := r.Expired(backups, protected)
+	if err := remove(expired); err != nil {
+		return nil, err
+	}
+	return expired, nil
+}
+
+// FormatSize renders a byte count for people, e.g. "3.2 KB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+// ParseSize reads a byte count such as "512", "200KB" or "1.5GB"; units are
+// powers of 1024 and case-insensitive.
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(t, unit) {
+			t = strings.TrimSpace(strings.TrimSuffix(t, unit))
+			mult = int64(1) << (10 * (i + 1))
+			break
+		}
+	}
+	t = strings.TrimSuffix(t, "B")
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 500KB, 50MB)", s)
+	}
+	return int64(n * float64(mult)), nil
+}
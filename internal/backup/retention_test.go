@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// backupsAt returns backups at the given times, most recent first as List
+// returns them, each size bytes and named by its index.
+func backupsAt(size int64, times ...time.Time) []BackupInfo {
+	list := make([]BackupInfo, len(times))
+	for i, ts := range times {
+		list[i] = BackupInfo{Name: fmt.Sprintf("b%d", i), Timestamp: ts, Size: size}
+	}
+	return list
+}
+
+func names(list []BackupInfo) []string {
+	var out []string
+	for _, b := range list {
+		out = append(out, b.Name)
+	}
+	return out
+}
+
+func TestRetentionExpired(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2025, 1, d, h, 0, 0, 0, time.UTC) }
+	// Mon 13 Jan twice, Sun 12, Sat 11, Mon 6, Sun 5, Wed 1.
+	list := backupsAt(100, day(13, 12), day(13, 9), day(12, 9), day(11, 9), day(6, 9), day(5, 9), day(1, 9))
+
+	tests := []struct {
+		name      string
+		r         Retention
+		protected map[string]bool
+		want      []string
+	}{
+		{"unlimited", Retention{}, nil, nil},
+		{"keep last", Retention{KeepLast: 3}, nil, []string{"b3", "b4", "b5", "b6"}},
+		{"daily keeps each day's newest", Retention{KeepDaily: 3}, nil, []string{"b1", "b4", "b5", "b6"}},
+		{"weekly keeps each ISO week's newest", Retention{KeepWeekly: 3}, nil, []string{"b1", "b3", "b4", "b6"}},
+		{"rules combine", Retention{KeepLast: 1, KeepWeekly: 2}, nil, []string{"b1", "b3", "b4", "b5", "b6"}},
+		{"protected are kept", Retention{KeepLast: 1}, map[string]bool{"b4": true}, []string{"b1", "b2", "b3", "b5", "b6"}},
+		{"size caps what is kept", Retention{MaxTotalSize: 250}, nil, []string{"b2", "b3", "b4", "b5", "b6"}},
+		{"size spares protected but counts them", Retention{MaxTotalSize: 250}, map[string]bool{"b6": true}, []string{"b1", "b2", "b3", "b4", "b5"}},
+		{"newest survives any cap", Retention{MaxTotalSize: 1}, nil, []string{"b1", "b2", "b3", "b4", "b5", "b6"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := names(tt.r.Expired(list, tt.protected))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionCountsSharedObjectsOnce(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 9, 0, 0, 0, time.UTC) }
+	list := backupsAt(100, day(5), day(4), day(3), day(2), day(1))
+	// b0, b2 and b3 are the same snapshot, stored once.
+	for _, i := range []int{0, 2, 3} {
+		list[i].Object = "same"
+	}
+
+	if got := TotalSize(list); got != 300 {
+		t.Errorf("TotalSize() = %d, want 300", got)
+	}
+	got := names(Retention{MaxTotalSize: 200}.Expired(list, nil))
+	if want := []string{"b4"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expired() = %v, want %v", got, want)
+	}
+}
+
+func TestParseAndFormatSize(t *testing.T) {
+	for in, want := range map[string]int64{"512": 512, "200KB": 200 << 10, "1.5gb": 3 << 29, "50 MB": 50 << 20, "10B": 10} {
+		got, err := ParseSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "lots", "-1MB"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) should fail", in)
+		}
+	}
+	for n, want := range map[int64]string{999: "999 B", 1536: "1.5 KB", 50 << 20: "50.0 MB"} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Backups live in a content-addressed store under the backup directory:
+//
+//	backups/
+//	  index.json             one entry per backup, see indexEntry
+//	  objects/ab/abcd….gz    gzip of a snapshot, named by its SHA-256
+//
+// A snapshot identical to another is stored once, and one identical to the
+// most recent backup of the same file is not recorded again at all: most
+// writes change a few lines of a document that is otherwise the same.
+//
+// A backup keeps its timestamped name, e.g. omo.json.bak.2006-01-02-150405.…,
+// and its Path is that name inside the store, so List, Find and Restore treat
+// stored and plain backups alike; ReadFile reads either. Plain `.bak.*` files
+// from earlier versions are moved into the store by the next backup.
+
+const (
+	storeDirName  = "backups"
+	indexBasename = "index.json"
+	indexVersion  = 1
+)
+
+// Sources of a backup: which front end made the write it precedes.
+const (
+	SourceCLI = "cli"
+	SourceTUI = "tui"
+	SourceWeb = "web"
+)
+
+// source is recorded with every backup; see SetSource.
+var source string
+
+// SetSource records which front end this process is, for every backup it
+// takes. The CLI, TUI and web server each set theirs once at start-up.
+func SetSource(s string) {
+	source = s
+}
+
+// Source returns the front end SetSource recorded.
+func Source() string {
+	return source
+}
+
+// indexEntry is a backup in the store's index.
+type indexEntry struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+	// Object is the SHA-256 of the snapshot, which names its object file.
+	Object string `json:"object"`
+	// Size is the snapshot's size, Stored its compressed object's.
+	Size   int64 `json:"size"`
+	Stored int64 `json:"stored"`
+	// Mode is the backed-up file's mode, which a restore that creates the
+	// file gives it.
+	Mode      os.FileMode `json:"mode"`
+	Operation string      `json:"operation,omitempty"`
+	Source    string      `json:"source,omitempty"`
+}
+
+type index struct {
+	Version int          `json:"version"`
+	Entries []indexEntry `json:"entries"`
+}
+
+// StoreDir returns the target layer's backup store.
+func StoreDir() string {
+	return filepath.Join(config.BackupDir(), storeDirName)
+}
+
+func indexFile() string {
+	return filepath.Join(StoreDir(), indexBasename)
+}
+
+func objectFile(hash string) string {
+	return filepath.Join(StoreDir(), "objects", hash[:2], hash+".gz")
+}
+
+// storeMutex serializes index updates within the process; the lock file
+// beside the index excludes other processes.
+var storeMutex sync.Mutex
+
+// withStore runs fn with the store locked, on its index; fn returns whether it
+// changed the index, which is then written. Objects no entry references any
+// more are removed after the write.
+func withStore(fn func(*index) (bool, error)) error {
+	storeMutex.Lock()
+	defer storeMutex.Unlock()
+	lock, err := config.LockFile(filepath.Join(StoreDir(), ".lock"), config.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	idx, err := readIndex()
+	if err != nil {
+		return err
+	}
+	before := map[string]bool{}
+	for _, e := range idx.Entries {
+		before[e.Object] = true
+	}
+	changed, err := fn(idx)
+	if err != nil || !changed {
+		return err
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := config.WriteFileAtomic(indexFile(), append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+
+	for _, e := range idx.Entries {
+		delete(before, e.Object)
+	}
+	for hash := range before {
+		// An orphan left behind only costs space; the next prune retries.
+		_ = os.Remove(objectFile(hash))
+	}
+	return nil
+}
+
+func readIndex() (*index, error) {
+	data, err := os.ReadFile(indexFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return &index{Version: indexVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var idx index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", indexFile(), err)
+	}
+	if idx.Version > indexVersion {
+		return nil, fmt.Errorf("%s has format %d, newer than this omo-profiler reads (%d)", indexFile(), idx.Version, indexVersion)
+	}
+	return &idx, nil
+}
+
+func (idx *index) entry(name string) (indexEntry, bool) {
+	for _, e := range idx.Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return indexEntry{}, false
+}
+
+// latest returns the most recent entry backing up basename.
+func (idx *index) latest(basename string) (indexEntry, bool) {
+	var found indexEntry
+	ok := false
+	for _, e := range idx.Entries {
+		if backupBase(e.Name) == basename && (!ok || e.Time.After(found.Time)) {
+			found, ok = e, true
+		}
+	}
+	return found, ok
+}
+
+// add stores data as a backup of basename taken at ts, advancing ts a
+// nanosecond while the name is taken, and returns its entry. A snapshot equal
+// to the most recent one of basename is not recorded again: that entry is
+// returned instead.
+func (idx *index) add(basename string, data []byte, ts time.Time, mode os.FileMode, operation string) (indexEntry, bool, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if last, ok := idx.latest(basename); ok && last.Object == hash {
+		return last, false, nil
+	}
+	stored, err := writeObject(hash, data)
+	if err != nil {
+		return indexEntry{}, false, err
+	}
+
+	for i := 0; ; i++ {
+		if i == maxNameAttempts {
+			return indexEntry{}, false, fmt.Errorf("no free backup name for %s after %d attempts", basename, maxNameAttempts)
+		}
+		name := fmt.Sprintf("%s.bak.%s", basename, ts.Format(timestampLayout))
+		if _, taken := idx.entry(name); taken {
+			ts = ts.Add(time.Nanosecond)
+			continue
+		}
+		e := indexEntry{
+			Name:      name,
+			Time:      ts,
+			Object:    hash,
+			Size:      int64(len(data)),
+			Stored:    stored,
+			Mode:      mode,
+			Operation: operation,
+			Source:    source,
+		}
+		idx.Entries = append(idx.Entries, e)
+		return e, true, nil
+	}
+}
+
+// writeObject stores data compressed under its hash unless it is there, and
+// returns the object's size.
+func writeObject(hash string, data []byte) (int64, error) {
+	path := objectFile(hash)
+	if info, err := os.Stat(path); err == nil {
+		return info.Size(), nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, err
+	}
+	// Owner-only whatever the source's mode: the document holds credentials.
+	if err := config.WriteFileAtomic(path, buf.Bytes(), 0o600); err != nil {
+		return 0, err
+	}
+	return int64(buf.Len()), nil
+}
+
+func readObject(hash string) ([]byte, error) {
+	f, err := os.Open(objectFile(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("backup object %s: %w", hash, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("backup object %s: %w", hash, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("backup object %s is corrupt", hash)
+	}
+	return data, nil
+}
+
+// ReadFile returns the content of the backup at path, stored or plain. Any
+// other existing file is read as is.
+func ReadFile(path string) ([]byte, error) {
+	data, _, err := readWithMode(path)
+	return data, err
+}
+
+// readWithMode is ReadFile also returning the mode of the file the backup was
+// taken of.
+func readWithMode(path string) ([]byte, os.FileMode, error) {
+	info, err := os.Stat(path)
+	if err == nil {
+		data, err := os.ReadFile(path)
+		return data, info.Mode().Perm(), err
+	}
+	if !errors.Is(err, fs.ErrNotExist) || filepath.Dir(filepath.Clean(path)) != StoreDir() {
+		return nil, 0, err
+	}
+	idx, ierr := readIndex()
+	if ierr != nil {
+		return nil, 0, ierr
+	}
+	e, ok := idx.entry(filepath.Base(path))
+	if !ok {
+		return nil, 0, err
+	}
+	data, err := readObject(e.Object)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, e.Mode, nil
+}
+
+// listStore returns the stored backups.
+func listStore() ([]BackupInfo, error) {
+	idx, err := readIndex()
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]BackupInfo, 0, len(idx.Entries))
+	for _, e := range idx.Entries {
+		backups = append(backups, BackupInfo{
+			Path:      filepath.Join(StoreDir(), e.Name),
+			Timestamp: e.Time,
+			Name:      e.Name,
+			Size:      e.Stored,
+			Object:    e.Object,
+			Operation: e.Operation,
+			Source:    e.Source,
+		})
+	}
+	return backups, nil
+}
+
+// remove deletes backups, stored or plain.
+func remove(backups []BackupInfo) error {
+	names := map[string]bool{}
+	for _, b := range backups {
+		if filepath.Dir(b.Path) == StoreDir() {
+			names[b.Name] = true
+			continue
+		}
+		if err := os.Remove(b.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove backup %s: %w", b.Name, err)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return withStore(func(idx *index) (bool, error) {
+		kept := idx.Entries[:0]
+		for _, e := range idx.Entries {
+			if !names[e.Name] {
+				kept = append(kept, e)
+			}
+		}
+		changed := len(kept) != len(idx.Entries)
+		idx.Entries = kept
+		return changed, nil
+	})
+}
+
+// migrate moves the plain backups of the backup directory into idx, keeping
+// their names, and returns the files to delete once idx is written.
+func migrate(idx *index) ([]string, error) {
+	files, err := listFiles()
+	if err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, b := range files {
+		if _, ok := idx.entry(b.Name); !ok {
+			info, err := os.Stat(b.Path)
+			if err != nil {
+				return nil, err
+			}
+			data, err := os.ReadFile(b.Path)
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(data)
+			hash := hex.EncodeToString(sum[:])
+			stored, err := writeObject(hash, data)
+			if err != nil {
+				return nil, err
+			}
+			idx.Entries = append(idx.Entries, indexEntry{
+				Name:      b.Name,
+				Time:      b.Timestamp,
+				Object:    hash,
+				Size:      int64(len(data)),
+				Stored:    stored,
+				Mode:      info.Mode().Perm(),
+				Operation: "migrated",
+			})
+		}
+		moved = append(moved, b.Path)
+	}
+	return moved, nil
+}
+
+// store records data as a backup of basename, first moving any plain backups
+// into the store, and returns its path.
+func store(basename string, data []byte, mode os.FileMode, operation string) (string, error) {
+	var path string
+	var moved []string
+	err := withStore(func(idx *index) (bool, error) {
+		var err error
+		if moved, err = migrate(idx); err != nil {
+			return false, err
+		}
+		e, added, err := idx.add(basename, data, now(), mode, operation)
+		if err != nil {
+			return false, err
+		}
+		path = filepath.Join(StoreDir(), e.Name)
+		return added || len(moved) > 0, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, file := range moved {
+		// The index holds them now; a file left behind is listed once.
+		_ = os.Remove(file)
+	}
+	return path, nil
+}
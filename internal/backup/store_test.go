@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func storeObjects(t *testing.T) []string {
+	t.Helper()
+	objects, err := filepath.Glob(filepath.Join(StoreDir(), "objects", "*", "*.gz"))
+	if err != nil {
+		t.Fatalf("glob objects: %v", err)
+	}
+	return objects
+}
+
+// Most writes are preceded by a backup of a document the previous backup
+// already holds; those are not stored twice. A document that returns to an
+// earlier state gets a new entry but shares that state's object.
+func TestStore_DeduplicatesSnapshots(t *testing.T) {
+	setupTestDir(t)
+	SetSource(SourceWeb)
+	t.Cleanup(func() { SetSource("") })
+	path := config.OmoFile()
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write document: %v", err)
+		}
+	}
+	write(`{"gen":1}`)
+	first, err := SnapshotOmo("save dev")
+	if err != nil {
+		t.Fatalf("SnapshotOmo: %v", err)
+	}
+	again, err := SnapshotOmo("save dev")
+	if err != nil {
+		t.Fatalf("SnapshotOmo: %v", err)
+	}
+	if again != first {
+		t.Fatalf("identical snapshot stored as %s, want the existing %s", filepath.Base(again), filepath.Base(first))
+	}
+
+	write(`{"gen":2}`)
+	if _, err := SnapshotOmo("switch dev"); err != nil {
+		t.Fatalf("SnapshotOmo: %v", err)
+	}
+	write(`{"gen":1}`)
+	if _, err := SnapshotOmo("revert"); err != nil {
+		t.Fatalf("SnapshotOmo: %v", err)
+	}
+
+	backups, err := List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(backups) != 3 {
+		t.Fatalf("got %d backups, want 3", len(backups))
+	}
+	if n := len(storeObjects(t)); n != 2 {
+		t.Fatalf("got %d objects, want 2 — equal snapshots must share one", n)
+	}
+	if b := backups[0]; b.Operation != "revert" || b.Source != SourceWeb {
+		t.Fatalf("newest backup records %q from %q, want \"revert\" from %q", b.Operation, b.Source, SourceWeb)
+	}
+	if data, err := ReadFile(backups[2].Path); err != nil || string(data) != `{"gen":1}` {
+		t.Fatalf("oldest backup reads %q (%v)", data, err)
+	}
+
+	// Dropping the entries that share an object removes it once none is left.
+	if _, err := Prune(1); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if n := len(storeObjects(t)); n != 1 {
+		t.Fatalf("got %d objects after pruning, want 1", n)
+	}
+}
+
+// Plain .bak files written before the store are moved into it by the next
+// backup, keeping their names, so List, Find and Restore see the same backups.
+func TestStore_MigratesPlainBackups(t *testing.T) {
+	setupTestDir(t)
+	old := filepath.Join(config.BackupDir(), config.OmoBasename+".bak.2025-01-15-120000")
+	if err := os.WriteFile(old, []byte(`{"gen":0}`), 0o644); err != nil {
+		t.Fatalf("seed backup: %v", err)
+	}
+	if err := os.WriteFile(config.OmoFile(), []byte(`{"gen":1}`), 0o644); err != nil {
+		t.Fatalf("write document: %v", err)
+	}
+	if _, err := Create(config.OmoFile()); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("plain backup left behind: %v", err)
+	}
+	b, err := Find(filepath.Base(old))
+	if err != nil {
+		t.Fatalf("Find migrated backup: %v", err)
+	}
+	if b.Operation != "migrated" || filepath.Dir(b.Path) != StoreDir() {
+		t.Fatalf("migrated backup %+v, want a store entry", b)
+	}
+	if err := Restore(b.Path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	if gen, _ := doc.Raw("gen"); string(gen) != "0" {
+		t.Fatalf("document after restore has gen %s, want 0", gen)
+	}
+}
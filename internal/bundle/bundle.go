@@ -0,0 +1,255 @@
+// Package bundle packs profiles, with the registered models they reference,
+// into one JSON file a teammate installs.
+//
+// A bundle holds each profile resolved against its parents, so it stands on
+// its own, and the models.RegisteredModel entries whose identity
+// (`provider/modelId`, or a bare modelId) one of its blocks names as a model
+// of an agent or category. Installing imports the profiles with a
+// profile.ConflictPolicy and registers the models they need.
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/models"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+)
+
+// FormatVersion is the bundle format this package writes and reads.
+const FormatVersion = 1
+
+// Metadata describes a bundle.
+type Metadata struct {
+	Author      string    `json:"author,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Tool is the program and version that wrote the bundle, e.g.
+	// "omo-profiler 0.1.0".
+	Tool string `json:"tool"`
+}
+
+// Bundle is the content of a bundle file.
+type Bundle struct {
+	Format   int                        `json:"omoProfilerBundle"`
+	Metadata Metadata                   `json:"metadata"`
+	Profiles map[string]json.RawMessage `json:"profiles"`
+	Models   []models.RegisteredModel   `json:"models"`
+}
+
+// InvalidProfileError is returned by Install when a bundled profile does not
+// validate against the schema. Nothing is installed.
+type InvalidProfileError struct {
+	Name   string
+	Errors []schema.ValidationError
+}
+
+func (e *InvalidProfileError) Error() string {
+	return fmt.Sprintf("bundled profile %q is invalid: %d validation error(s)", e.Name, len(e.Errors))
+}
+
+// Create bundles profiles names, every profile when names is empty, with the
+// registered models they reference. meta.CreatedAt is set when zero.
+func Create(names []string, meta Metadata) (*Bundle, error) {
+	doc, err := profile.ExportDocument(names)
+	if err != nil {
+		return nil, err
+	}
+	_, entries, err := profile.ReadImport(doc, "", config.OpenCodeKey)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := models.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	}
+	b := &Bundle{
+		Format:   FormatVersion,
+		Metadata: meta,
+		Profiles: make(map[string]json.RawMessage, len(entries)),
+		Models:   []models.RegisteredModel{},
+	}
+	var blocks []json.RawMessage
+	for _, entry := range entries {
+		b.Profiles[entry.Name] = entry.Block
+		blocks = append(blocks, entry.Block)
+	}
+	b.Models = Referenced(registry.List(), blocks...)
+	return b, nil
+}
+
+// Marshal encodes b as an indented bundle file.
+func (b *Bundle) Marshal() ([]byte, error) {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Read decodes a bundle file, refusing anything that is not a bundle of a
+// format this version reads.
+func Read(data []byte) (*Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	switch {
+	case b.Format == 0:
+		return nil, fmt.Errorf("not an omo-profiler bundle")
+	case b.Format > FormatVersion:
+		return nil, fmt.Errorf("bundle format %d is newer than this omo-profiler reads (%d)", b.Format, FormatVersion)
+	}
+	for name, block := range b.Profiles {
+		if err := profile.ValidateName(name); err != nil {
+			return nil, fmt.Errorf("bundled profile %q: %w", name, err)
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(block, &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("bundled profile %q is not a JSON object", name)
+		}
+	}
+	return &b, nil
+}
+
+// Names returns the bundled profile names, sorted.
+func (b *Bundle) Names() []string {
+	names := make([]string, 0, len(b.Profiles))
+	for name := range b.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InstallOptions controls Install.
+type InstallOptions struct {
+	// Profiles limits the install to these bundled profiles; empty installs
+	// them all.
+	Profiles []string
+	// OnConflict settles profile names that are taken.
+	OnConflict profile.ConflictPolicy
+	// OverwriteModels replaces registered models the bundle carries with a
+	// different display name; by default the registry's entry is kept.
+	OverwriteModels bool
+}
+
+// InstallResult reports what Install did.
+type InstallResult struct {
+	Profiles       []profile.ImportOutcome  `json:"profiles"`
+	Models         []models.RegisteredModel `json:"models"`
+	ModelsAdded    int                      `json:"modelsAdded"`
+	ModelsReplaced int                      `json:"modelsReplaced"`
+	ModelsKept     int                      `json:"modelsKept"`
+}
+
+// Install validates the selected profiles, imports them, then registers the
+// models they reference. The two writes are separate transactions, so an
+// install is not atomic: a failed import leaves the registry untouched, but
+// when registering fails after the import, the profiles stay installed, result
+// lists them and err says their models are missing. Such a profile still
+// applies; its models are only missing from the registry's pickers.
+func Install(b *Bundle, opts InstallOptions) (InstallResult, error) {
+	names := opts.Profiles
+	if len(names) == 0 {
+		names = b.Names()
+	}
+	validator, err := schema.GetValidator()
+	if err != nil {
+		return InstallResult{}, err
+	}
+	entries := make([]profile.ImportEntry, 0, len(names))
+	var blocks []json.RawMessage
+	for _, name := range names {
+		block, ok := b.Profiles[name]
+		if !ok {
+			return InstallResult{}, fmt.Errorf("the bundle holds no profile %q", name)
+		}
+		errs, err := validator.ValidateProfileBlockForSave(name, block)
+		if err != nil {
+			return InstallResult{}, err
+		}
+		if len(errs) > 0 {
+			return InstallResult{}, &InvalidProfileError{Name: name, Errors: errs}
+		}
+		entries = append(entries, profile.ImportEntry{Name: name, Block: block})
+		blocks = append(blocks, block)
+	}
+
+	result := InstallResult{Models: Referenced(b.Models, blocks...)}
+	// A commit or push that failed after the import (config.AfterSaveError)
+	// is reported once the models are registered too.
+	result.Profiles, err = profile.Import(entries, opts.OnConflict)
+	if !config.Saved(err) {
+		return InstallResult{}, err
+	}
+	if len(result.Models) > 0 {
+		var registerErr error
+		result.ModelsAdded, result.ModelsReplaced, result.ModelsKept, registerErr = models.Install(result.Models, opts.OverwriteModels)
+		if registerErr != nil {
+			return result, fmt.Errorf("profiles installed, but registering their models failed: %w", registerErr)
+		}
+	}
+	return result, err
+}
+
+// Referenced returns the models of list that blocks name, in list's order.
+func Referenced(list []models.RegisteredModel, blocks ...json.RawMessage) []models.RegisteredModel {
+	refs := map[string]bool{}
+	for _, block := range blocks {
+		var v any
+		if err := json.Unmarshal(block, &v); err == nil {
+			collectModelRefs(v, "", refs)
+		}
+	}
+	out := []models.RegisteredModel{}
+	for _, m := range list {
+		if refs[Ref(m)] {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Ref is how a profile names m: `provider/modelId`, or the bare modelId of a
+// model without provider.
+func Ref(m models.RegisteredModel) string {
+	if m.Provider == "" {
+		return m.ModelID
+	}
+	return m.Provider + "/" + m.ModelID
+}
+
+// modelListKeys hold a model, or a list of models as strings or as objects
+// with a "model" field.
+var modelListKeys = []string{"model", "models", "fallback_models"}
+
+func collectModelRefs(v any, key string, refs map[string]bool) {
+	switch t := v.(type) {
+	case string:
+		if slices.Contains(modelListKeys, key) {
+			refs[t] = true
+		}
+	case []any:
+		for _, item := range t {
+			collectModelRefs(item, key, refs)
+		}
+	case map[string]any:
+		for k, child := range t {
+			collectModelRefs(child, k, refs)
+		}
+	}
+}
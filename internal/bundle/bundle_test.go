@@ -0,0 +1,111 @@
+package bundle
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/models"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	gpt   = models.RegisteredModel{DisplayName: "GPT 5", ModelID: "gpt-5", Provider: "openai"}
+	opus  = models.RegisteredModel{DisplayName: "Opus", ModelID: "opus", Provider: "anthropic"}
+	local = models.RegisteredModel{DisplayName: "Local", ModelID: "local"}
+)
+
+func setupTestEnv(t *testing.T) {
+	t.Helper()
+	config.SetBaseDir(t.TempDir())
+	t.Cleanup(config.ResetBaseDir)
+	require.NoError(t, config.EnsureDirs())
+}
+
+func seedProfile(t *testing.T, name, openCode string) {
+	t.Helper()
+	require.NoError(t, profile.CreateWithOpenCodeBlock(name, json.RawMessage(openCode)))
+}
+
+func TestReferenced(t *testing.T) {
+	block := json.RawMessage(`{
+		"[opencode]": {
+			"agents": {"oracle": {"model": "openai/gpt-5"}},
+			"categories": {"quick": {"model": "local", "models": [{"model": "anthropic/opus"}], "description": "openai/gpt-5"}}
+		}
+	}`)
+	got := Referenced([]models.RegisteredModel{gpt, opus, local, {ModelID: "x", Provider: "y"}}, block)
+	assert.Equal(t, []models.RegisteredModel{gpt, opus, local}, got)
+}
+
+func TestCreateReadAndInstall(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "team", `{"agents":{"oracle":{"model":"openai/gpt-5"}}}`)
+	seedProfile(t, "solo", `{"agents":{"oracle":{"model":"local"}}}`)
+	_, _, err := models.AddMany([]models.RegisteredModel{gpt, local, opus})
+	require.NoError(t, err)
+
+	b, err := Create([]string{"team"}, Metadata{Author: "ana", Tool: "omo-profiler test"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team"}, b.Names())
+	assert.Equal(t, []models.RegisteredModel{gpt}, b.Models)
+	assert.False(t, b.Metadata.CreatedAt.IsZero())
+
+	data, err := b.Marshal()
+	require.NoError(t, err)
+	read, err := Read(data)
+	require.NoError(t, err)
+	assert.Equal(t, "ana", read.Metadata.Author)
+
+	// A fresh machine whose registry describes gpt-5 differently.
+	setupTestEnv(t)
+	require.NoError(t, models.Add(models.RegisteredModel{DisplayName: "Mine", ModelID: "gpt-5", Provider: "openai"}))
+
+	result, err := Install(read, InstallOptions{OnConflict: profile.ConflictRename})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ModelsKept)
+	require.Len(t, result.Profiles, 1)
+	assert.Equal(t, "created", result.Profiles[0].Action)
+
+	result, err = Install(read, InstallOptions{OnConflict: profile.ConflictSkip, OverwriteModels: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ModelsReplaced)
+	assert.Equal(t, "skipped", result.Profiles[0].Action)
+	reg, err := models.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "GPT 5", reg.Get("openai", "gpt-5").DisplayName)
+}
+
+func TestReadRejectsOtherFiles(t *testing.T) {
+	_, err := Read([]byte(`{"profiles":{}}`))
+	assert.Error(t, err)
+	_, err = Read([]byte(`{"omoProfilerBundle":99}`))
+	assert.Error(t, err)
+	_, err = Read([]byte(`{"omoProfilerBundle":1,"profiles":{"bad name":{}}}`))
+	assert.Error(t, err)
+}
+
+func TestInstallRejectsInvalidProfiles(t *testing.T) {
+	setupTestEnv(t)
+	b := &Bundle{Format: FormatVersion, Profiles: map[string]json.RawMessage{
+		"bad": json.RawMessage(`{"[opencode]":{"telemetry":"yes"}}`),
+	}}
+	_, err := Install(b, InstallOptions{})
+	var invalid *InvalidProfileError
+	require.ErrorAs(t, err, &invalid)
+	assert.False(t, profile.Exists("bad"))
+}
+
+func TestInstallRegistersNoModelWhenTheImportFails(t *testing.T) {
+	setupTestEnv(t)
+	require.NoError(t, os.WriteFile(config.DocumentFile(), []byte("{not json"), 0600))
+	b := &Bundle{Format: FormatVersion, Models: []models.RegisteredModel{gpt}, Profiles: map[string]json.RawMessage{
+		"team": json.RawMessage(`{"[opencode]":{"agents":{"oracle":{"model":"openai/gpt-5"}}}}`),
+	}}
+	_, err := Install(b, InstallOptions{OnConflict: profile.ConflictRename})
+	require.Error(t, err)
+	assert.False(t, models.Exists("openai", "gpt-5"))
+}
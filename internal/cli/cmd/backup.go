@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backupProfile   string
+	backupKeep      int
+	backupKeepDaily int
+	backupKeepWeek  int
+	backupMaxSize   string
+	backupDryRun    bool
+)
+
+var BackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "List, inspect and restore document backups",
+	Long: `Every write to the omo document first backs it up to the target layer's
+backup store, recording when, before what operation and from which front end
+(cli, tui or web). A document unchanged since its last backup is not backed up
+again. These commands work with those backups.
+
+A backup is named by its file name, its path, or its number in 'backup list',
+1 being the most recent.`,
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List backups, most recent first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		backups, err := backup.List()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Printf("(No backups in %s)\n", config.BackupDir())
+			return nil
+		}
+		settings, err := profile.LoadSettings()
+		if err != nil {
+			return err
+		}
+		protected, err := profile.ProtectedBackups()
+		if err != nil {
+			return err
+		}
+		for i, b := range backups {
+			mark := ""
+			switch {
+			case slices.Contains(settings.PinnedBackups, b.Name):
+				mark = "pinned"
+			case protected[b.Name]:
+				mark = "switch history"
+			}
+			line := fmt.Sprintf("%3d  %-52s %s  %9s  %-4s %-28s %s", i+1, b.Name, b.Timestamp.Format("2006-01-02 15:04:05"), backup.FormatSize(b.Size), b.Source, b.Operation, mark)
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+		fmt.Printf("\n%d backups, %s; retention: %s\n", len(backups), backup.FormatSize(backup.TotalSize(backups)), settings.BackupRetention())
+		return nil
+	},
+}
+
+var backupShowCmd = &cobra.Command{
+	Use:   "show <backup>",
+	Short: "Print a backup, or one profile block of it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := backup.Find(args[0])
+		if err != nil {
+			return err
+		}
+		data, err := backupContent(b.Path, backupProfile, false)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	},
+}
+
+var backupDiffCmd = &cobra.Command{
+	Use:   "diff <backup> [<other>]",
+	Short: "Show what restoring a backup would change",
+	Long: `Prints the lines that differ between the current document and the backup,
+the change a restore would make. With two backups, diffs the first to the
+second.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := backup.Find(args[0])
+		if err != nil {
+			return err
+		}
+		oldName, oldPath, newer := filepath.Base(config.DocumentFile()), config.DocumentFile(), b
+		if len(args) == 2 {
+			if newer, err = backup.Find(args[1]); err != nil {
+				return err
+			}
+			oldName, oldPath = b.Name, b.Path
+		}
+		// A missing document or profile diffs as empty: restoring it adds it.
+		oldData, err := backupContent(oldPath, backupProfile, true)
+		if err != nil {
+			return err
+		}
+		newData, err := backupContent(newer.Path, backupProfile, true)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(indentJSON(oldData), indentJSON(newData)) {
+			fmt.Println("No differences.")
+			return nil
+		}
+		lines, err := changedLines(oldData, newData)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--- %s\n+++ %s\n", oldName, newer.Name)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <backup>",
+	Short: "Restore the document, or one profile, from a backup",
+	Long: `Replaces the omo document with a backup after validating it. The document it
+replaces is backed up first, so 'backup restore 1' right after undoes it.
+
+--profile restores only that profile's block and leaves the rest of the
+document as it is.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := backup.Find(args[0])
+		if err != nil {
+			return err
+		}
+		errs, err := validateBackup(b.Path, backupProfile)
+		if err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: validation of backup %s failed:\n", b.Name)
+			for _, ve := range errs {
+				fmt.Fprintf(os.Stderr, "  - %s: %s\n", ve.Path, ve.Message)
+			}
+			os.Exit(2)
+		}
+
+		if backupProfile != "" {
+			err = backup.RestoreProfile(b.Path, backupProfile)
+		} else {
+			err = backup.Restore(b.Path)
+		}
+		if writeFailed(err) {
+			return err
+		}
+
+		if backupProfile != "" {
+			fmt.Printf("Restored profile %q from %s\n", backupProfile, b.Name)
+		} else {
+			fmt.Printf("Restored %s from %s\n", config.DocumentFile(), b.Name)
+		}
+		fmt.Println("Undo with: omo-profiler backup restore 1")
+		return nil
+	},
+}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the backups the retention does not keep",
+	Long: `Removes the backups the retention (see 'settings backups') does not keep. The
+most recent backup, pinned backups and those the switch history relies on are
+always kept. Backups are also pruned after every write, so this is for
+tightening the retention or for seeing what it does.
+
+--keep, --daily, --weekly and --max-size replace the configured retention for
+this run.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		retention, err := retentionFlags(cmd)
+		if err != nil {
+			return err
+		}
+		before, err := backup.List()
+		if err != nil {
+			return err
+		}
+
+		removed, err := profile.PruneBackups(retention, backupDryRun)
+		verb := "Removed"
+		if backupDryRun {
+			verb = "Would remove"
+		}
+		for _, b := range removed {
+			fmt.Printf("%s %s (%s)\n", verb, b.Name, backup.FormatSize(b.Size))
+		}
+		if err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			fmt.Println("Nothing to prune.")
+			return nil
+		}
+		// Objects the remaining backups share stay, so they free nothing.
+		kept := slices.DeleteFunc(slices.Clone(before), func(b backup.BackupInfo) bool {
+			return slices.ContainsFunc(removed, func(r backup.BackupInfo) bool { return r.Name == b.Name })
+		})
+		freed := backup.TotalSize(before) - backup.TotalSize(kept)
+		fmt.Printf("%s %d of %d backups, %s.\n", verb, len(removed), len(before), backup.FormatSize(freed))
+		return nil
+	},
+}
+
+var backupPinCmd = &cobra.Command{
+	Use:   "pin <backup>",
+	Short: "Keep a backup whatever the retention says",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pinBackup(args[0], true)
+	},
+}
+
+var backupUnpinCmd = &cobra.Command{
+	Use:   "unpin <backup>",
+	Short: "Let the retention prune a pinned backup again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pinBackup(args[0], false)
+	},
+}
+
+func pinBackup(ref string, pinned bool) error {
+	name := ref
+	b, err := backup.Find(ref)
+	switch {
+	case err == nil:
+		name = b.Name
+	case pinned:
+		return err
+	}
+	// A pin outlives a backup removed by hand; unpin takes its bare name.
+	if err := profile.PinBackup(name, pinned); writeFailed(err) {
+		return err
+	}
+	if pinned {
+		fmt.Printf("Pinned %s\n", name)
+	} else {
+		fmt.Printf("Unpinned %s\n", name)
+	}
+	return nil
+}
+
+// retentionFlags returns the retention the --keep, --daily, --weekly and
+// --max-size flags of cmd describe, nil when none is set.
+func retentionFlags(cmd *cobra.Command) (*backup.Retention, error) {
+	flags := cmd.Flags()
+	if !flags.Changed("keep") && !flags.Changed("daily") && !flags.Changed("weekly") && !flags.Changed("max-size") {
+		return nil, nil
+	}
+	r := backup.Retention{KeepLast: backupKeep, KeepDaily: backupKeepDaily, KeepWeekly: backupKeepWeek}
+	if r.KeepLast < 0 || r.KeepDaily < 0 || r.KeepWeekly < 0 {
+		return nil, fmt.Errorf("--keep, --daily and --weekly must not be negative")
+	}
+	if backupMaxSize != "" {
+		size, err := backup.ParseSize(backupMaxSize)
+		if err != nil {
+			return nil, err
+		}
+		r.MaxTotalSize = size
+	}
+	if r.Unlimited() {
+		return nil, fmt.Errorf("give --keep, --daily, --weekly or --max-size a limit above 0")
+	}
+	return &r, nil
+}
+
+// backupContent reads a backup, or the document, at path: the whole file, or
+// profile's block indented when profile is set. With missingOK a missing file
+// or profile reads as empty.
+func backupContent(path, profile string, missingOK bool) ([]byte, error) {
+	data, err := backup.ReadFile(path)
+	if missingOK && os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	if profile == "" {
+		return data, nil
+	}
+	doc, err := config.ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+	}
+	block, ok, err := doc.ProfileBlock(profile)
+	if err != nil {
+		return nil, err
+	}
+	if !ok && missingOK {
+		return nil, nil
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s holds no profile %q", filepath.Base(path), profile)
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, block, "", "  "); err != nil {
+		return nil, err
+	}
+	pretty.WriteByte('\n')
+	return pretty.Bytes(), nil
+}
+
+// validateBackup checks what restoring the backup at path, or only profile's
+// block of it, would write. What is not a document is left for the restore
+// to report.
+func validateBackup(path, profile string) ([]schema.ValidationError, error) {
+	data, err := backup.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return validateSnapshot(data, profile)
+}
+
+// validateSnapshot is validateBackup for a document already read.
+func validateSnapshot(data []byte, profile string) ([]schema.ValidationError, error) {
+	validator, err := schema.GetValidator()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := config.ParseDocument(data)
+	if err != nil {
+		return nil, nil
+	}
+	if profile == "" {
+		return validator.ValidateDocumentForSave(config.StripJSONC(data))
+	}
+	block, ok, err := doc.ProfileBlock(profile)
+	if err != nil || !ok {
+		return nil, nil
+	}
+	return validator.ValidateProfileBlockForSave(profile, block)
+}
+
+func init() {
+	backupShowCmd.Flags().StringVar(&backupProfile, "profile", "", "Show only this profile's block")
+	backupDiffCmd.Flags().StringVar(&backupProfile, "profile", "", "Diff only this profile's block")
+	backupRestoreCmd.Flags().StringVar(&backupProfile, "profile", "", "Restore only this profile's block")
+	addRetentionFlags(backupPruneCmd)
+	backupPruneCmd.Flags().BoolVar(&backupDryRun, "dry-run", false, "List what would be removed without removing it")
+
+	BackupCmd.AddCommand(backupListCmd)
+	BackupCmd.AddCommand(backupShowCmd)
+	BackupCmd.AddCommand(backupDiffCmd)
+	BackupCmd.AddCommand(backupRestoreCmd)
+	BackupCmd.AddCommand(backupPruneCmd)
+	BackupCmd.AddCommand(backupPinCmd)
+	BackupCmd.AddCommand(backupUnpinCmd)
+}
+
+func addRetentionFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&backupKeep, "keep", 0, "Keep the N most recent backups")
+	cmd.Flags().IntVar(&backupKeepDaily, "daily", 0, "Keep the newest backup of each of the last N days")
+	cmd.Flags().IntVar(&backupKeepWeek, "weekly", 0, "Keep the newest backup of each of the last N weeks")
+	cmd.Flags().StringVar(&backupMaxSize, "max-size", "", "Cap the total size of the kept backups, e.g. 50MB")
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestValidateBackup(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("EnsureDirs failed: %v", err)
+	}
+	path := filepath.Join(config.OmoDir(), config.OmoBasename+".bak.2025-01-16-120000")
+	data := `{"profiles": {"good": {"[opencode]": {}}, "bad": {"[opencode]": {"agents": {"oracle": {"model": 42}}}}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write backup: %v", err)
+	}
+
+	for _, tt := range []struct {
+		profile string
+		invalid bool
+	}{
+		{"", true},
+		{"bad", true},
+		{"good", false},
+		{"missing", false}, // left for RestoreProfile to report
+	} {
+		errs, err := validateBackup(path, tt.profile)
+		if err != nil {
+			t.Fatalf("validateBackup(%q) error = %v", tt.profile, err)
+		}
+		if got := len(errs) > 0; got != tt.invalid {
+			t.Errorf("validateBackup(%q) invalid = %v, want %v (%v)", tt.profile, got, tt.invalid, errs)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/bundle"
+	"github.com/diogenes/omo-profiler/internal/models"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleAuthor          string
+	bundleDescription     string
+	bundleForce           bool
+	bundleRedact          bool
+	bundleProfiles        []string
+	bundleOnConflict      string
+	bundleOverwriteModels bool
+)
+
+var BundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Share profiles with the models they use",
+	Long: `A bundle is one JSON file holding profiles, the registered models their agents
+and categories reference, and who made it, when and why. It is how a team
+hands its profiles to a new teammate: 'bundle create' on one machine,
+'bundle install' on the other.
+
+Bundled profiles are resolved against their parents, so they stand on their
+own.`,
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create <path> [<profile>...]",
+	Short: "Bundle profiles, every profile by default, into a file",
+	Long: `Writes the named profiles, or every profile, to a bundle file at path,
+with the registered models (see 'models list') they reference.
+
+--redact leaves out every field holding a credential. Without it, a bundle
+holding credentials is written readable by its owner only.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, names := args[0], args[1:]
+		if !bundleForce {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("destination file already exists: %s. Use --force to overwrite", path)
+			}
+		}
+
+		author := bundleAuthor
+		if author == "" {
+			if u, err := user.Current(); err == nil {
+				author = u.Username
+			}
+		}
+		b, err := bundle.Create(names, bundle.Metadata{
+			Author:      author,
+			Description: bundleDescription,
+			Tool:        "omo-profiler " + cmd.Root().Version,
+		})
+		if err != nil {
+			return err
+		}
+
+		perm := os.FileMode(0644)
+		for name, block := range b.Profiles {
+			stripped, err := redact.Strip("", block)
+			if err != nil {
+				return err
+			}
+			if bundleRedact {
+				b.Profiles[name] = stripped
+			} else if !bytes.Equal(stripped, block) {
+				perm = 0600
+			}
+		}
+		data, err := b.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, perm); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		fmt.Printf("Bundled %d profile(s) and %d model(s) into %s\n", len(b.Profiles), len(b.Models), path)
+		return nil
+	},
+}
+
+var bundleInspectCmd = &cobra.Command{
+	Use:   "inspect <path>",
+	Short: "Show what a bundle holds and what installing it would change",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := readBundle(args[0])
+		if err != nil {
+			return err
+		}
+		registry, err := models.Load()
+		if err != nil {
+			return err
+		}
+
+		meta := b.Metadata
+		fmt.Printf("Created:     %s by %s\n", meta.CreatedAt.Local().Format("2006-01-02 15:04"), orNone(meta.Author))
+		fmt.Printf("Tool:        %s\n", orNone(meta.Tool))
+		if meta.Description != "" {
+			fmt.Printf("Description: %s\n", meta.Description)
+		}
+
+		fmt.Println("\nProfiles:")
+		for _, name := range b.Names() {
+			status := "new"
+			if profile.Exists(name) {
+				status = "exists"
+			}
+			fmt.Printf("  %-24s %s\n", name, status)
+		}
+		fmt.Println("\nModels:")
+		if len(b.Models) == 0 {
+			fmt.Println("  (none)")
+		}
+		for _, m := range b.Models {
+			status := "new"
+			if existing := registry.Get(m.Provider, m.ModelID); existing != nil {
+				status = "registered"
+				if *existing != m {
+					status = fmt.Sprintf("registered as %q", existing.DisplayName)
+				}
+			}
+			fmt.Printf("  %-40s %-24s %s\n", bundle.Ref(m), m.DisplayName, status)
+		}
+		return nil
+	},
+}
+
+var bundleInstallCmd = &cobra.Command{
+	Use:   "install <path>",
+	Short: "Install a bundle's profiles and the models they use",
+	Long: `Registers the models the bundled profiles reference, then imports the
+profiles. --profiles installs only some, with just the models they need.
+
+--on-conflict says what to do with a profile whose name is taken: rename
+(import as name-1, the default), skip, or overwrite. A registered model with
+another display name is kept unless --overwrite-models.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := readBundle(args[0])
+		if err != nil {
+			return err
+		}
+		policy, err := profile.ParseConflictPolicy(bundleOnConflict)
+		if err != nil {
+			return err
+		}
+
+		result, err := bundle.Install(b, bundle.InstallOptions{
+			Profiles:        bundleProfiles,
+			OnConflict:      policy,
+			OverwriteModels: bundleOverwriteModels,
+		})
+		var invalid *bundle.InvalidProfileError
+		if errors.As(err, &invalid) {
+			fmt.Fprintf(os.Stderr, "Error: validation of bundled profile %q failed:\n", invalid.Name)
+			for _, ve := range invalid.Errors {
+				fmt.Fprintf(os.Stderr, "  - %s: %s\n", ve.Path, ve.Message)
+			}
+			os.Exit(2)
+		}
+		if writeFailed(err) {
+			return err
+		}
+
+		fmt.Printf("Models: %d added, %d replaced, %d kept\n", result.ModelsAdded, result.ModelsReplaced, result.ModelsKept)
+		for _, outcome := range result.Profiles {
+			switch outcome.Action {
+			case "renamed":
+				fmt.Printf("Profile %q exists, installed as %q\n", outcome.Name, outcome.Imported)
+			case "skipped":
+				fmt.Printf("Profile %q exists, skipped\n", outcome.Name)
+			case "overwritten":
+				fmt.Printf("Overwrote profile: %s\n", outcome.Imported)
+			default:
+				fmt.Printf("Installed profile: %s\n", outcome.Imported)
+			}
+		}
+		return nil
+	},
+}
+
+func readBundle(path string) (*bundle.Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file not found: %s", path)
+		}
+		return nil, err
+	}
+	return bundle.Read(data)
+}
+
+func orNone(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "(unknown)"
+	}
+	return s
+}
+
+func init() {
+	bundleCreateCmd.Flags().StringVar(&bundleAuthor, "author", "", "Author recorded in the bundle (default: the current user)")
+	bundleCreateCmd.Flags().StringVar(&bundleDescription, "description", "", "What the bundle is for")
+	bundleCreateCmd.Flags().BoolVarP(&bundleForce, "force", "f", false, "Overwrite destination if it exists")
+	bundleCreateCmd.Flags().BoolVar(&bundleRedact, "redact", false, "Leave out fields holding credentials")
+
+	bundleInstallCmd.Flags().StringSliceVar(&bundleProfiles, "profiles", nil, "Bundled profiles to install (default: all)")
+	bundleInstallCmd.Flags().StringVar(&bundleOnConflict, "on-conflict", "rename", "What to do when a profile exists: rename, skip or overwrite")
+	bundleInstallCmd.Flags().BoolVar(&bundleOverwriteModels, "overwrite-models", false, "Replace registered models the bundle describes differently")
+
+	BundleCmd.AddCommand(bundleCreateCmd)
+	BundleCmd.AddCommand(bundleInspectCmd)
+	BundleCmd.AddCommand(bundleInstallCmd)
+}
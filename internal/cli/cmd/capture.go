@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	captureFields []string
+	captureForce  bool
+	captureDryRun bool
+)
+
+var CaptureCmd = &cobra.Command{
+	Use:   "capture [<name>]",
+	Short: "Save the live root configuration into a profile",
+	Long: `Writes the harness blocks at the root of the document — the live
+configuration, hand edits included — into a profile. Without a name the
+profile last applied is used.
+
+An existing profile is only overwritten with --force; without it the diff is
+shown and nothing is written. --fields limits the capture to [opencode] field
+paths (agents.*.model,categories.quick), leaving the rest of the profile as
+it is. The document is backed up before the write.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		} else {
+			target, err := profile.CaptureTarget()
+			if err != nil {
+				return err
+			}
+			name = target
+		}
+
+		opts := profile.CaptureOptions{Force: captureForce, DryRun: captureDryRun}
+		if len(captureFields) > 0 {
+			opts.Fields = profile.NewBlankSelection()
+			for _, path := range captureFields {
+				opts.Fields.SetSelected(path, true)
+			}
+		}
+		validate, err := saveValidator()
+		if err != nil {
+			return err
+		}
+		opts.Validate = validate
+
+		result, err := profile.Capture(name, opts)
+		var overwrite *profile.CaptureOverwriteError
+		if errors.As(err, &overwrite) {
+			if err := printCaptureDiff(overwrite.Result); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Profile %q already exists; rerun with --force to overwrite it\n", name)
+			os.Exit(1)
+		}
+		if writeFailed(err) {
+			return fieldWriteErr(err)
+		}
+
+		switch {
+		case !result.Changed:
+			fmt.Printf("Profile %q already matches the live configuration\n", name)
+			return nil
+		case result.Existed:
+			if err := printCaptureDiff(result); err != nil {
+				return err
+			}
+		}
+		switch {
+		case captureDryRun:
+			fmt.Printf("Would capture the live configuration into profile %q (dry run)\n", name)
+		case result.Existed:
+			fmt.Printf("Updated profile %q from the live configuration\n", name)
+		default:
+			fmt.Printf("Captured the live configuration as profile %q\n", name)
+		}
+		return nil
+	},
+}
+
+func printCaptureDiff(result *profile.CaptureResult) error {
+	lines, err := changedLines(result.Before, result.After)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Changes to profile %q:\n", result.Name)
+	for _, line := range lines {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
+	return nil
+}
+
+func init() {
+	CaptureCmd.Flags().StringSliceVar(&captureFields, "fields", nil, "Only capture these [opencode] field paths (comma-separated)")
+	CaptureCmd.Flags().BoolVar(&captureForce, "force", false, "Overwrite an existing profile")
+	CaptureCmd.Flags().BoolVar(&captureDryRun, "dry-run", false, "Show what would be captured without writing")
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkoutBranch  string
+	checkoutProfile string
+)
+
+var CheckoutCmd = &cobra.Command{
+	Use:   "checkout [<revision>]",
+	Short: "Restore the document from its git history, or switch branches",
+	Long: `Restores the omo document, after validating it, from a commit of its git
+history (see 'log'): a hash, a tag, or anything git accepts, e.g. HEAD~2. The
+document it replaces is backed up and, with versioning on, the restore is
+committed like any other write.
+
+A branch name also switches the history to that branch, so later writes are
+committed there. -b <branch> starts a new branch, at <revision> when given
+(restoring it), else where the history is.
+
+--profile restores only that profile's block and leaves the rest of the
+document, and the branch, as they are.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rev := ""
+		if len(args) == 1 {
+			rev = args[0]
+		}
+		switch {
+		case checkoutBranch != "" && checkoutProfile != "":
+			return fmt.Errorf("--profile and -b exclude each other")
+		case checkoutBranch == "" && rev == "":
+			return fmt.Errorf("give a revision to check out, or -b <branch>")
+		}
+
+		if rev != "" {
+			data, err := vcs.Show(rev)
+			if err != nil {
+				return err
+			}
+			errs, err := validateSnapshot(data, checkoutProfile)
+			if err != nil {
+				return err
+			}
+			if len(errs) > 0 {
+				fmt.Fprintf(os.Stderr, "Error: validation of %s failed:\n", rev)
+				for _, ve := range errs {
+					fmt.Fprintf(os.Stderr, "  - %s: %s\n", ve.Path, ve.Message)
+				}
+				os.Exit(2)
+			}
+		}
+
+		switch {
+		case checkoutBranch != "":
+			if err := vcs.Switch(checkoutBranch, true, rev); err != nil {
+				return err
+			}
+			fmt.Printf("Switched to a new branch %q\n", checkoutBranch)
+			if rev == "" {
+				return nil
+			}
+			// A relative revision such as HEAD~1 now means something else.
+			rev = checkoutBranch
+		case checkoutProfile == "" && vcs.IsBranch(rev):
+			if err := vcs.Switch(rev, false, ""); err != nil {
+				return err
+			}
+			fmt.Printf("Switched to branch %q\n", rev)
+		}
+
+		var err error
+		if checkoutProfile != "" {
+			err = vcs.RestoreProfile(rev, checkoutProfile)
+		} else {
+			err = vcs.Restore(rev)
+		}
+		if writeFailed(err) {
+			return err
+		}
+		if checkoutProfile != "" {
+			fmt.Printf("Restored profile %q from %s\n", checkoutProfile, rev)
+		} else {
+			fmt.Printf("Restored %s from %s\n", config.DocumentFile(), rev)
+		}
+		fmt.Println("Undo with: omo-profiler backup restore 1")
+		return nil
+	},
+}
+
+func init() {
+	CheckoutCmd.Flags().StringVarP(&checkoutBranch, "branch", "b", "", "Start a new branch")
+	CheckoutCmd.Flags().StringVar(&checkoutProfile, "profile", "", "Restore only this profile's block")
+}
@@ -8,14 +8,32 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var fromTemplate string
+var (
+	fromTemplate  string
+	createExtends string
+)
 
 var CreateCmd = &cobra.Command{
 	Use:   "create [new-profile-name]",
 	Short: "Create a new profile",
-	Long:  `Create a new profile block in ~/.omo/omo.json. Use --from to create from an existing template.`,
-	Args:  cobra.MaximumNArgs(1),
+	Long: `Create a new profile block in ~/.omo/omo.json. Use --from to create from an existing template,
+or --extends to create an empty profile that inherits everything from a parent.`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		if createExtends != "" {
+			if fromTemplate != "" || len(args) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: --extends takes a new profile name and no --from")
+				os.Exit(1)
+			}
+			name := profile.SanitizeName(args[0])
+			if err := profile.CreateExtending(name, createExtends); writeFailed(err) {
+				fmt.Fprintf(os.Stderr, "Error: failed to create profile: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Created profile '%s' extending '%s'\n", name, createExtends)
+			os.Exit(0)
+		}
+
 		if fromTemplate == "" {
 			fmt.Fprintln(os.Stderr, "Error: TUI mode not implemented. Use --from to create from template.")
 			os.Exit(1)
@@ -46,7 +64,7 @@ var CreateCmd = &cobra.Command{
 
 		// Clones the whole profile block ([opencode] plus its unknown keys and
 		// sibling blocks) in one transaction.
-		if err := profile.CreateFrom(newProfileName, fromTemplate); err != nil {
+		if err := profile.CreateFrom(newProfileName, fromTemplate); writeFailed(err) {
 			fmt.Fprintf(os.Stderr, "Error: failed to create profile: %v\n", err)
 			os.Exit(1)
 		}
@@ -58,4 +76,5 @@ var CreateCmd = &cobra.Command{
 
 func init() {
 	CreateCmd.Flags().StringVarP(&fromTemplate, "from", "f", "", "Create from existing template profile")
+	CreateCmd.Flags().StringVar(&createExtends, "extends", "", "Create an empty profile inheriting from this parent")
 }
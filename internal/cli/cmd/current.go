@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/diogenes/omo-profiler/internal/profile"
 	"github.com/spf13/cobra"
@@ -11,7 +12,15 @@ import (
 var CurrentCmd = &cobra.Command{
 	Use:   "current",
 	Short: "Show the name of the active profile",
-	Long:  `Displays the profile whose configuration is currently written at the root of ~/.omo/omo.json.`,
+	Long: `Displays the profile whose configuration is currently written at the root of ~/.omo/omo.json.
+
+When several profiles match the root, the one omo-profiler last applied wins.
+If none of them was applied, "(ambiguous)" is printed and the candidates are
+listed. When the root no longer matches the profile last applied, its name is
+printed with "(drifted)". Both exit with status 1, like "(none)".
+
+A stack applied by 'switch a b c' is printed as "a + b + c", bottom overlay
+first.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		active, err := profile.GetActive()
 		if err != nil {
@@ -19,16 +28,35 @@ var CurrentCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		if active.Modified {
-			fmt.Fprintln(os.Stderr, "Warning: the root configuration matches no profile")
-			fmt.Println("(none)")
+		switch active.State {
+		case profile.ActiveAmbiguous:
+			fmt.Fprintf(os.Stderr, "Warning: the root configuration matches several profiles: %s\n", strings.Join(active.Candidates, ", "))
+			fmt.Println("(ambiguous)")
 			os.Exit(1)
-		}
-		if active.ProfileName == "" {
+		case profile.ActiveDrifted:
+			applied := active.AppliedName
+			if len(active.Stack) > 0 {
+				applied = profile.StackLabel(active.Stack)
+			}
+			if active.ProfileChanged {
+				fmt.Fprintf(os.Stderr, "Warning: profile %q was edited after it was applied\n", applied)
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: the root configuration was edited after %q was applied\n", applied)
+			}
+			fmt.Printf("%s (drifted)\n", applied)
+			os.Exit(1)
+		case profile.ActiveNone:
+			if active.Modified {
+				fmt.Fprintln(os.Stderr, "Warning: the root configuration matches no profile")
+			}
 			fmt.Println("(none)")
 			os.Exit(1)
 		}
-		fmt.Println(active.ProfileName)
+		if len(active.Stack) > 0 {
+			fmt.Println(profile.StackLabel(active.Stack))
+		} else {
+			fmt.Println(active.ProfileName)
+		}
 		os.Exit(0)
 	},
 }
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var effectiveJSON bool
+
+var EffectiveCmd = &cobra.Command{
+	Use:   "effective",
+	Short: "Show the merged user + project configuration",
+	Long: `Shows the configuration upstream runs with: the project layer
+(.omo/omo.json in the nearest enclosing directory) deep-merged over the user
+layer (~/.omo/omo.json). Every value is listed with the layer it came from.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		eff, err := config.LoadEffective()
+		if err != nil {
+			return fmt.Errorf("failed to load config layers: %w", err)
+		}
+
+		if effectiveJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(map[string]any{
+				"config":  eff.Config,
+				"sources": eff.Sources,
+				"files":   eff.Files,
+			})
+		}
+
+		for _, l := range config.Layers {
+			if path, ok := eff.Files[l]; ok {
+				fmt.Printf("%-8s %s\n", l, path)
+			} else {
+				fmt.Printf("%-8s (none)\n", l)
+			}
+		}
+		paths := eff.Paths()
+		if len(paths) == 0 {
+			fmt.Println("\n(No configuration found)")
+			return nil
+		}
+		fmt.Println()
+		for _, path := range paths {
+			fmt.Printf("[%s] %s = %s\n", eff.Sources[path], path, eff.Value(path))
+		}
+		return nil
+	},
+}
+
+func init() {
+	EffectiveCmd.Flags().BoolVar(&effectiveJSON, "json", false, "Print the merged config and provenance as JSON")
+}
@@ -1,26 +1,94 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"github.com/diogenes/omo-profiler/internal/config"
 	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/redact"
+	"github.com/diogenes/omo-profiler/internal/schema"
 	"github.com/spf13/cobra"
 )
 
-var exportForce bool
+var (
+	exportForce   bool
+	exportRedact  bool
+	exportHarness string
+	exportFull    bool
+	exportAll     bool
+)
+
+// harnessKey turns a --harness value ("senpi" or "[senpi]") into the block key
+// of a harness the document schema defines.
+func harnessKey(name string) (string, error) {
+	keys, err := schema.HarnessKeys()
+	if err != nil {
+		return "", err
+	}
+	key := config.HarnessKey(name)
+	if !slices.Contains(keys, key) {
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = config.HarnessName(k)
+		}
+		return "", fmt.Errorf("unknown harness %q (one of: %s)", name, strings.Join(names, ", "))
+	}
+	return key, nil
+}
 
 var ExportCmd = &cobra.Command{
-	Use:   "export <name> <path>",
+	Use:   "export <name> <path> | --all <path> [<name>...]",
 	Short: "Export a profile to a file",
-	Long:  `Exports the specified profile block from ~/.omo/omo.json to a flat JSON file at the given path.`,
-	Args:  cobra.ExactArgs(2),
+	Long: `Exports the specified profile block from ~/.omo/omo.json to a flat JSON file at the given path.
+
+--harness picks the harness block to export: opencode (the default), senpi or
+codex. A profile that does not configure the harness exports {}.
+
+--full exports the complete profiles.<name> block instead, every harness at
+once. --all writes an omo document holding only profiles: every profile, or
+the names given after the path. Both resolve profiles against their parents,
+and import reads either back.
+
+--redact leaves out every field holding a credential (bot tokens, secret
+gateway headers), so the file can be shared. Without it, an export holding
+credentials is written readable by its owner only.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if exportAll {
+			return cobra.MinimumNArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
-		path := args[1]
+		if exportAll && exportFull {
+			fmt.Fprintln(os.Stderr, "Error: --full and --all cannot be combined")
+			os.Exit(1)
+		}
+		if (exportAll || exportFull) && cmd.Flags().Changed("harness") {
+			fmt.Fprintln(os.Stderr, "Error: --harness exports one block; --full and --all export them all")
+			os.Exit(1)
+		}
 
-		if !profile.Exists(name) {
-			fmt.Fprintf(os.Stderr, "Error: profile not found: %s\n", name)
+		var name, path string
+		var names []string
+		if exportAll {
+			path, names = args[0], args[1:]
+		} else {
+			name, path = args[0], args[1]
+		}
+
+		for _, n := range append(names, name) {
+			if n != "" && !profile.Exists(n) {
+				fmt.Fprintf(os.Stderr, "Error: profile not found: %s\n", n)
+				os.Exit(1)
+			}
+		}
+		key, err := harnessKey(exportHarness)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 
@@ -33,22 +101,60 @@ var ExportCmd = &cobra.Command{
 
 		// Export the stored block verbatim so an export/import round-trip is
 		// lossless; marshalling the typed Config drops explicit zero values.
-		data, err := profile.ExportOpenCode(name)
+		var data []byte
+		redactPath := key
+		switch {
+		case exportAll:
+			data, err = profile.ExportDocument(names)
+			redactPath = ""
+		case exportFull:
+			data, err = profile.ExportBlock(name)
+			redactPath = ""
+		default:
+			data, err = profile.ExportHarness(name, key)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: failed to load profile: %v\n", err)
 			os.Exit(1)
 		}
 
-		if err := os.WriteFile(path, data, 0644); err != nil {
+		stripped, err := redact.Strip(redactPath, data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to redact profile: %v\n", err)
+			os.Exit(1)
+		}
+		perm := os.FileMode(0644)
+		if exportRedact {
+			data = stripped
+		} else if !bytes.Equal(stripped, data) {
+			perm = 0600
+		}
+
+		if err := os.WriteFile(path, data, perm); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: failed to write file: %v\n", err)
 			os.Exit(1)
 		}
 
-		fmt.Printf("Exported profile \"%s\" to %s\n", name, path)
+		switch {
+		case exportAll && len(names) == 0:
+			fmt.Printf("Exported all profiles to %s\n", path)
+		case exportAll:
+			fmt.Printf("Exported profiles %s to %s\n", strings.Join(names, ", "), path)
+		case exportFull:
+			fmt.Printf("Exported profile \"%s\" with every harness block to %s\n", name, path)
+		case key != config.OpenCodeKey:
+			fmt.Printf("Exported %s of profile \"%s\" to %s\n", key, name, path)
+		default:
+			fmt.Printf("Exported profile \"%s\" to %s\n", name, path)
+		}
 		os.Exit(0)
 	},
 }
 
 func init() {
 	ExportCmd.Flags().BoolVarP(&exportForce, "force", "f", false, "Overwrite destination if it exists")
+	ExportCmd.Flags().BoolVar(&exportRedact, "redact", false, "Leave out fields holding credentials")
+	ExportCmd.Flags().StringVar(&exportHarness, "harness", "opencode", "Harness block to export (opencode, senpi, codex)")
+	ExportCmd.Flags().BoolVar(&exportFull, "full", false, "Export the whole profile block, every harness included")
+	ExportCmd.Flags().BoolVar(&exportAll, "all", false, "Export a document of profiles: all, or the names after <path>")
 }
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	extendsNone bool
+	showOwn     bool
+)
+
+var ExtendsCmd = &cobra.Command{
+	Use:   "extends <profile> [<parent>]",
+	Short: "Show or set the parent a profile inherits from",
+	Long: `A profile that extends a parent stores only its overrides. Switching,
+validation, compare and export see the parent's configuration with the
+overrides merged over it: objects merge key by key, any other value replaces
+the parent's. Parents can extend parents in turn, but not in a cycle.
+
+With only a profile, prints its chain of parents. With a parent, sets it;
+--none removes it. Renaming a parent updates the profiles extending it, and a
+parent cannot be deleted while profiles extend it.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		switch {
+		case len(args) == 2 && extendsNone:
+			return fmt.Errorf("--none takes no parent")
+		case len(args) == 2:
+			if err := profile.SetExtends(name, args[1]); writeFailed(err) {
+				return err
+			}
+			fmt.Printf("Profile %q now extends %q\n", name, args[1])
+			return nil
+		case extendsNone:
+			if err := profile.SetExtends(name, ""); writeFailed(err) {
+				return err
+			}
+			fmt.Printf("Profile %q extends no profile\n", name)
+			return nil
+		}
+
+		if !profile.Exists(name) {
+			return &profile.NotFoundError{Name: name}
+		}
+		chain, err := profile.Ancestors(name)
+		if err != nil {
+			return err
+		}
+		if len(chain) == 0 {
+			fmt.Println("(none)")
+			return nil
+		}
+		fmt.Println(strings.Join(chain, " → "))
+		return nil
+	},
+}
+
+var ShowCmd = &cobra.Command{
+	Use:   "show <profile> [<overlay>...]",
+	Short: "Print a profile block",
+	Long: `Prints the profile's block as JSON. A profile that extends another is
+shown resolved, as a switch would apply it; --own shows only the fields its
+block stores.
+
+With several profiles, prints the block the stack combines into, as
+'switch <profile> <overlay>...' would apply it.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			if showOwn {
+				return fmt.Errorf("--own shows a single profile")
+			}
+			block, err := profile.StackBlock(args)
+			if err != nil {
+				return err
+			}
+			os.Stdout.Write(indentJSON(block))
+			return nil
+		}
+		name := args[0]
+		block, err := profile.ResolvedBlock(name)
+		if showOwn {
+			block, err = profile.OwnBlock(name)
+		}
+		if err != nil {
+			return err
+		}
+		if chain, err := profile.Ancestors(name); err == nil && len(chain) > 0 {
+			fmt.Fprintf(os.Stderr, "# extends %s\n", strings.Join(chain, " → "))
+		}
+		os.Stdout.Write(indentJSON(block))
+		return nil
+	},
+}
+
+func init() {
+	ExtendsCmd.Flags().BoolVar(&extendsNone, "none", false, "Remove the profile's parent")
+	ShowCmd.Flags().BoolVar(&showOwn, "own", false, "Show only the fields the profile's block stores")
+}
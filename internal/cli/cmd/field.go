@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getJSON bool
+	getOwn  bool
+	setJSON bool
+)
+
+const fieldPathHelp = `Paths are dotted keys inside the profile's [opencode] block, e.g.
+agents.oracle.model or categories.quick.temperature.`
+
+var GetCmd = &cobra.Command{
+	Use:   "get <profile> <path>",
+	Short: "Print a field of a profile",
+	Long: fieldPathHelp + ` A * segment matches every key,
+so 'get dev agents.*.model' lists the model of each agent.
+
+Strings print bare; other values print as JSON. With --json a single value is
+printed as JSON and a wildcard read as an object of path to value.
+
+A profile that extends another reports inherited values too; --own reads only
+what its block stores.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, path := args[0], args[1]
+		read := profile.GetField
+		if getOwn {
+			read = profile.GetOwnField
+		}
+		values, err := read(name, path)
+		if err != nil {
+			return err
+		}
+		wildcard := strings.Contains("."+path+".", ".*.")
+		if len(values) == 0 {
+			if wildcard {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "%s is not set in profile %q\n", path, name)
+			os.Exit(1)
+		}
+
+		switch {
+		case getJSON && wildcard:
+			out := make(map[string]json.RawMessage, len(values))
+			for _, v := range values {
+				out[v.Path] = v.Value
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(out)
+		case getJSON:
+			fmt.Println(string(values[0].Value))
+		case wildcard:
+			for _, v := range values {
+				fmt.Printf("%s = %s\n", v.Path, v.Value)
+			}
+		default:
+			fmt.Println(displayValue(values[0].Value))
+		}
+		return nil
+	},
+}
+
+var SetCmd = &cobra.Command{
+	Use:   "set <profile> <path> <value>",
+	Short: "Set a field of a profile",
+	Long: fieldPathHelp + `
+
+The value is typed by the schema: true/false and numbers become literals where
+the field takes them, [..] and {..} are parsed as JSON, and list fields also
+accept a comma-separated value. --json takes the value as raw JSON instead,
+which is also the way to set fields the schema does not know.
+
+The profile is validated before it is written, and the document is backed up.`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, path, raw := args[0], args[1], args[2]
+
+		var value json.RawMessage
+		if setJSON {
+			if !json.Valid([]byte(raw)) {
+				return fmt.Errorf("invalid JSON value: %s", raw)
+			}
+			value = json.RawMessage(raw)
+		} else {
+			parsed, err := schema.ParseValue(path, raw)
+			if err != nil {
+				return fmt.Errorf("%w (use --json to set a raw JSON value)", err)
+			}
+			value = parsed
+		}
+
+		validate, err := saveValidator()
+		if err != nil {
+			return err
+		}
+		if err := profile.SetField(name, path, value, validate); writeFailed(err) {
+			return fieldWriteErr(err)
+		}
+		fmt.Printf("Set %s.%s = %s\n", name, path, value)
+		return nil
+	},
+}
+
+var UnsetCmd = &cobra.Command{
+	Use:   "unset <profile> <path>",
+	Short: "Remove a field from a profile",
+	Long:  fieldPathHelp + ` The document is backed up before the write.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, path := args[0], args[1]
+		validate, err := saveValidator()
+		if err != nil {
+			return err
+		}
+		err = profile.UnsetField(name, path, validate)
+		if errors.Is(err, profile.ErrFieldNotSet) {
+			fmt.Fprintf(os.Stderr, "%s is not set in profile %q\n", path, name)
+			os.Exit(1)
+		}
+		if writeFailed(err) {
+			return fieldWriteErr(err)
+		}
+		fmt.Printf("Unset %s.%s\n", name, path)
+		return nil
+	},
+}
+
+// saveValidator adapts the schema's save-mode validation — the check every
+// profile write runs — to profile.ValidateFunc.
+func saveValidator() (profile.ValidateFunc, error) {
+	validator, err := schema.GetValidator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create validator: %w", err)
+	}
+	return func(openCode []byte) ([]string, error) {
+		problems, err := validator.ValidateJSONForSave(openCode)
+		if err != nil {
+			return nil, err
+		}
+		msgs := make([]string, len(problems))
+		for i, ve := range problems {
+			msgs[i] = fmt.Sprintf("%s: %s", ve.Path, ve.Message)
+		}
+		return msgs, nil
+	}, nil
+}
+
+// fieldWriteErr prints validation problems one per line and exits 2, the
+// import command's code for a payload the schema rejects.
+func fieldWriteErr(err error) error {
+	var invalid *profile.FieldValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Error: validation failed:")
+	for _, p := range invalid.Problems {
+		fmt.Fprintf(os.Stderr, "  - %s\n", p)
+	}
+	os.Exit(2)
+	return nil
+}
+
+// writeFailed reports whether err failed a write. A write that landed but
+// whose commit or push failed afterwards (config.AfterSaveError) did not: err
+// is printed as a warning and the command goes on to report the write.
+func writeFailed(err error) bool {
+	if err != nil && config.Saved(err) {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return false
+	}
+	return err != nil
+}
+
+// displayValue prints JSON strings bare, everything else as compact JSON.
+func displayValue(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func init() {
+	GetCmd.Flags().BoolVar(&getJSON, "json", false, "Print values as JSON")
+	GetCmd.Flags().BoolVar(&getOwn, "own", false, "Ignore values inherited from the profile's parents")
+	SetCmd.Flags().BoolVar(&setJSON, "json", false, "Take the value as raw JSON instead of parsing it by schema type")
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyShow    int
+	historyRestore int
+)
+
+var HistoryCmd = &cobra.Command{
+	Use:   "history <profile>",
+	Short: "Show how a profile changed over time, and restore an earlier version",
+	Long: `Walks the document backups and lists the versions of one profile, most
+recent first: when each was seen, which write replaced it, and the fields
+that changed from the version before. Writes to other profiles do not make a
+new version.
+
+--show <n> prints version n's block; --restore <n> makes it the profile's
+block again, leaving the rest of the document as it is. A restore is backed
+up like any other write, so it shows up as a version of its own.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		versions, err := profile.History(name)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case historyShow != 0:
+			v, err := pickVersion(versions, historyShow)
+			if err != nil {
+				return err
+			}
+			if !v.Exists {
+				return fmt.Errorf("profile %q did not exist in version %d", name, historyShow)
+			}
+			os.Stdout.Write(indentJSON(v.Block))
+			return nil
+
+		case historyRestore != 0:
+			v, err := pickVersion(versions, historyRestore)
+			if err != nil {
+				return err
+			}
+			if v.Exists {
+				validator, err := schema.GetValidator()
+				if err != nil {
+					return err
+				}
+				errs, err := validator.ValidateProfileBlockForSave(name, v.Block)
+				if err != nil {
+					return err
+				}
+				if len(errs) > 0 {
+					fmt.Fprintf(os.Stderr, "Error: validation of version %d of %q failed:\n", historyRestore, name)
+					for _, ve := range errs {
+						fmt.Fprintf(os.Stderr, "  - %s: %s\n", ve.Path, ve.Message)
+					}
+					os.Exit(2)
+				}
+			}
+			if err := profile.RestoreVersion(name, v); writeFailed(err) {
+				return err
+			}
+			fmt.Printf("Restored profile %q to version %d (from %s)\n", name, historyRestore, v.Backup)
+			fmt.Println("Undo with: omo-profiler history " + name + " --restore 2")
+			return nil
+		}
+
+		for i, v := range versions {
+			fmt.Println(versionHeading(i+1, v))
+			for _, c := range v.Changes {
+				fmt.Println("      " + c.String())
+			}
+		}
+		return nil
+	},
+}
+
+func pickVersion(versions []profile.Version, n int) (profile.Version, error) {
+	if n < 1 || n > len(versions) {
+		return profile.Version{}, fmt.Errorf("no version %d (%d versions)", n, len(versions))
+	}
+	return versions[n-1], nil
+}
+
+// versionHeading is a version's line in the timeline: when its backups were
+// taken, and what replaced it.
+func versionHeading(n int, v profile.Version) string {
+	const layout = "2006-01-02 15:04"
+	var when string
+	switch {
+	case v.Backups == 0:
+		when = "live"
+	case v.Since.Equal(v.Until):
+		when = v.Until.Format(layout)
+	default:
+		when = v.Since.Format(layout) + " … " + v.Until.Format(layout)
+	}
+	if v.Live && v.Backups > 0 {
+		when += " … now"
+	}
+
+	var notes []string
+	if !v.Exists {
+		notes = append(notes, "(profile absent)")
+	}
+	if v.ReplacedBy != "" {
+		by := "replaced by: " + v.ReplacedBy
+		if v.Source != "" {
+			by += " (" + v.Source + ")"
+		}
+		notes = append(notes, by)
+	}
+	if v.Live {
+		notes = append(notes, "(live)")
+	}
+	return strings.TrimRight(fmt.Sprintf("%3d  %-36s %s", n, when, strings.Join(notes, "  ")), " ")
+}
+
+func init() {
+	HistoryCmd.Flags().IntVar(&historyShow, "show", 0, "Print version n's block")
+	HistoryCmd.Flags().IntVar(&historyRestore, "restore", 0, "Restore the profile to version n")
+	HistoryCmd.MarkFlagsMutuallyExclusive("show", "restore")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/diogenes/omo-profiler/internal/config"
@@ -13,16 +14,44 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var importName string
+var (
+	importName       string
+	importHarness    string
+	importInto       string
+	importProfiles   []string
+	importOnConflict string
+)
 
 var ImportCmd = &cobra.Command{
 	Use:   "import <path>",
 	Short: "Import a profile from a JSON file",
-	Long:  `Imports a flat JSON config as a profile block in ~/.omo/omo.json. The file must conform to the omo config schema ([opencode] / flat-config shape).`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Imports a flat JSON config as a profile block in ~/.omo/omo.json. The file must conform to the omo config schema ([opencode] / flat-config shape).
+
+--harness imports the file as another harness block (senpi, codex), validated
+against that block's schema. --into stores it in an existing profile, replacing
+only that harness block, so one profile can configure every harness.
+
+A file written by export --full (a whole profile block) or export --all (an
+omo document of profiles) is recognised and imported with every harness block;
+any omo.json works as a document. --profiles picks profiles of a document.
+
+--on-conflict says what to do with a profile whose name is taken: rename
+(import as name-1, the default), skip, or overwrite.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		sourcePath := args[0]
 
+		key, err := harnessKey(importHarness)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		policy, err := profile.ParseConflictPolicy(importOnConflict)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 		data, err := os.ReadFile(sourcePath)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -33,12 +62,23 @@ var ImportCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		// Type-check the payload before storing it verbatim; the file itself
-		// is what gets written, so explicit empty values survive.
-		if err := json.Unmarshal(data, &config.Config{}); err != nil {
+		format, err := profile.DetectImport(data)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: invalid JSON: %v\n", err)
 			os.Exit(1)
 		}
+		if format != profile.ImportFlat && (cmd.Flags().Changed("harness") || importInto != "") {
+			fmt.Fprintf(os.Stderr, "Error: --harness and --into import a flat file; %s holds a %s\n", sourcePath, format)
+			os.Exit(1)
+		}
+		if format != profile.ImportDocument && len(importProfiles) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: --profiles picks profiles of a document; %s holds a %s\n", sourcePath, format)
+			os.Exit(1)
+		}
+		if format == profile.ImportDocument && importName != "" {
+			fmt.Fprintln(os.Stderr, "Error: --name does not apply to a document; its profiles keep their names")
+			os.Exit(1)
+		}
 
 		validator, err := schema.GetValidator()
 		if err != nil {
@@ -46,53 +86,148 @@ var ImportCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		validationErrors, err := validator.ValidateJSONForSave(data)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: validation failed: %v\n", err)
-			os.Exit(2)
-		}
-		if len(validationErrors) > 0 {
-			fmt.Fprintln(os.Stderr, "Error: validation failed:")
-			for _, ve := range validationErrors {
-				fmt.Fprintf(os.Stderr, "  - %s: %s\n", ve.Path, ve.Message)
+		if format == profile.ImportFlat {
+			// Type-check the payload before storing it verbatim; the file
+			// itself is what gets written, so explicit empty values survive.
+			// Only `[opencode]` has a Go type; the schema checks the other
+			// blocks.
+			var typed any = &map[string]json.RawMessage{}
+			if key == config.OpenCodeKey {
+				typed = &config.Config{}
+			}
+			if err := json.Unmarshal(data, typed); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid JSON: %v\n", err)
+				os.Exit(1)
+			}
+
+			validationErrors, err := validator.ValidateHarnessJSONForSave(key, data)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: validation failed: %v\n", err)
+				os.Exit(2)
+			}
+			exitOnValidationErrors(validationErrors)
+
+			if importInto != "" {
+				if _, err := profile.UpdateHarnessBlockIfRevision(importInto, key, data, ""); writeFailed(err) {
+					fmt.Fprintf(os.Stderr, "Error: failed to save profile: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Imported %s into profile: %s\n", key, importInto)
+				os.Exit(0)
 			}
-			os.Exit(2)
 		}
 
-		var originalName string
 		var profileName string
+		if format != profile.ImportDocument {
+			var originalName string
+			if importName != "" {
+				originalName = importName
+				profileName = profile.SanitizeName(importName)
+			} else {
+				filename := filepath.Base(sourcePath)
+				originalName = strings.TrimSuffix(filename, ".json")
+				profileName = profile.SanitizeName(originalName)
+			}
 
-		if importName != "" {
-			originalName = importName
-			profileName = profile.SanitizeName(importName)
-		} else {
-			filename := filepath.Base(sourcePath)
-			originalName = strings.TrimSuffix(filename, ".json")
-			profileName = profile.SanitizeName(originalName)
+			if profileName == "" {
+				fmt.Fprintf(os.Stderr, "Error: cannot derive valid profile name from filename %q. Use --name <name> to specify.\n", originalName)
+				os.Exit(1)
+			}
 		}
 
-		if profileName == "" {
-			fmt.Fprintf(os.Stderr, "Error: cannot derive valid profile name from filename %q. Use --name <name> to specify.\n", originalName)
+		_, entries, err := profile.ReadImport(data, profileName, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if entries, err = selectImportEntries(entries, importProfiles); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		if format != profile.ImportFlat {
+			for _, entry := range entries {
+				exitOnValidationErrors(validateImportEntry(validator, entry))
+			}
+		}
 
 		// Name selection and the write share one transaction.
-		baseName := profileName
-		profileName, hadCollision, err := profile.CreateAvailable(baseName, data)
-		if err != nil {
+		outcomes, err := profile.Import(entries, policy)
+		if writeFailed(err) {
 			fmt.Fprintf(os.Stderr, "Error: failed to save profile: %v\n", err)
 			os.Exit(1)
 		}
 
-		if hadCollision {
-			fmt.Printf("Profile %q exists, imported as %q\n", baseName, profileName)
-		} else {
-			fmt.Printf("Imported profile: %s\n", profileName)
+		for _, outcome := range outcomes {
+			switch outcome.Action {
+			case "renamed":
+				fmt.Printf("Profile %q exists, imported as %q\n", outcome.Name, outcome.Imported)
+			case "skipped":
+				fmt.Printf("Profile %q exists, skipped\n", outcome.Name)
+			case "overwritten":
+				fmt.Printf("Overwrote profile: %s\n", outcome.Imported)
+			default:
+				fmt.Printf("Imported profile: %s\n", outcome.Imported)
+			}
 		}
 		os.Exit(0)
 	},
 }
 
+// selectImportEntries keeps the entries named in names, all when it is empty.
+func selectImportEntries(entries []profile.ImportEntry, names []string) ([]profile.ImportEntry, error) {
+	if len(names) == 0 {
+		return entries, nil
+	}
+	var selected []profile.ImportEntry
+	for _, name := range names {
+		i := slices.IndexFunc(entries, func(e profile.ImportEntry) bool { return e.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("the file holds no profile %q", name)
+		}
+		selected = append(selected, entries[i])
+	}
+	return selected, nil
+}
+
+// validateImportEntry checks a whole profile block the way the document
+// schema sees it, and type-checks its `[opencode]` block.
+func validateImportEntry(validator *schema.Validator, entry profile.ImportEntry) []schema.ValidationError {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entry.Block, &fields); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: profile %q: %v\n", entry.Name, err)
+		os.Exit(1)
+	}
+	if openCode, ok := fields[config.OpenCodeKey]; ok {
+		if err := json.Unmarshal(openCode, &config.Config{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: profile %q: invalid JSON: %v\n", entry.Name, err)
+			os.Exit(1)
+		}
+	}
+	validationErrors, err := validator.ValidateProfileBlockForSave(entry.Name, entry.Block)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: validation failed: %v\n", err)
+		os.Exit(2)
+	}
+	return validationErrors
+}
+
+// exitOnValidationErrors prints validationErrors and exits 2 when there are
+// any.
+func exitOnValidationErrors(validationErrors []schema.ValidationError) {
+	if len(validationErrors) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Error: validation failed:")
+	for _, ve := range validationErrors {
+		fmt.Fprintf(os.Stderr, "  - %s: %s\n", ve.Path, ve.Message)
+	}
+	os.Exit(2)
+}
+
 func init() {
 	ImportCmd.Flags().StringVarP(&importName, "name", "n", "", "Name for the imported profile")
+	ImportCmd.Flags().StringVar(&importHarness, "harness", "opencode", "Harness block the file configures (opencode, senpi, codex)")
+	ImportCmd.Flags().StringVar(&importInto, "into", "", "Store the block in this existing profile instead of creating one")
+	ImportCmd.Flags().StringSliceVar(&importProfiles, "profiles", nil, "Profiles of a document to import (default: all)")
+	ImportCmd.Flags().StringVar(&importOnConflict, "on-conflict", "rename", "What to do when a profile exists: rename, skip or overwrite")
 }
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/diogenes/omo-profiler/internal/profile"
 	"github.com/spf13/cobra"
@@ -10,7 +12,13 @@ import (
 var ListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all profiles",
-	Long:  `Lists all available profiles in ~/.omo/omo.json. The active profile is marked with an asterisk (*).`,
+	Long: `Lists all available profiles in ~/.omo/omo.json. The active profile is marked with an asterisk (*).
+
+When the root matches several profiles and none of them was the last one
+applied, each candidate is marked with "?". When the root drifted from the
+profile last applied, that profile is marked with "~". The overlays of a
+stack are marked the same way, with their position in it. Profiles that extend
+another name their parent.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		profiles, err := profile.List()
 		if err != nil {
@@ -27,16 +35,39 @@ var ListCmd = &cobra.Command{
 			return fmt.Errorf("failed to get active profile: %w", err)
 		}
 
-		activeProfileName := ""
-		if active.ProfileName != "" {
-			activeProfileName = active.ProfileName
+		candidates := map[string]bool{}
+		if active.State == profile.ActiveAmbiguous {
+			for _, name := range active.Candidates {
+				candidates[name] = true
+			}
+		}
+		settings, err := profile.LoadSettings()
+		if err != nil {
+			return err
 		}
-
 		for _, name := range profiles {
-			if name == activeProfileName {
-				fmt.Printf("* %s (active)\n", name)
+			marker := " "
+			var notes []string
+			overlay := slices.Index(active.Stack, name)
+			switch {
+			case name == active.ProfileName:
+				marker, notes = "*", append(notes, "active")
+			case overlay >= 0 && active.State == profile.ActiveExact:
+				marker, notes = "*", append(notes, fmt.Sprintf("active, stack %d/%d", overlay+1, len(active.Stack)))
+			case overlay >= 0 && active.State == profile.ActiveDrifted:
+				marker, notes = "~", append(notes, fmt.Sprintf("applied, stack %d/%d, drifted", overlay+1, len(active.Stack)))
+			case candidates[name]:
+				marker, notes = "?", append(notes, "matches, ambiguous")
+			case active.State == profile.ActiveDrifted && name == active.AppliedName:
+				marker, notes = "~", append(notes, "applied, drifted")
+			}
+			if parent := settings.Profiles[name].Extends; parent != "" {
+				notes = append(notes, "extends "+parent)
+			}
+			if len(notes) == 0 {
+				fmt.Printf("%s %s\n", marker, name)
 			} else {
-				fmt.Printf("  %s\n", name)
+				fmt.Printf("%s %s (%s)\n", marker, name, strings.Join(notes, "; "))
 			}
 		}
 
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+	"github.com/spf13/cobra"
+)
+
+var logLimit int
+
+var LogCmd = &cobra.Command{
+	Use:   "log [<profile>]",
+	Short: "List the commits of the document's git history",
+	Long: `With git versioning on (see 'settings git'), every write to the document is
+committed to the git repository beside it, with the operation as the message
+and the profiles it changed and the front end that made it as trailers. This
+lists the commits of the checked-out branch, most recent first; with a
+profile, only those that changed it.
+
+The repository is an ordinary one: 'checkout' restores a commit or switches
+branches, and git itself works in it too.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		status, err := vcs.GetStatus()
+		if err != nil {
+			return err
+		}
+		commits, err := vcs.Log(name, logLimit)
+		if err != nil {
+			return err
+		}
+
+		header := "On branch " + status.Branch
+		if status.Branch == "" {
+			header = "Not on a branch"
+		}
+		if status.RemoteURL != "" {
+			header += fmt.Sprintf(", %s at %s", vcs.Remote, status.RemoteURL)
+			if status.Unpushed > 0 {
+				header += fmt.Sprintf(" (%d not pushed)", status.Unpushed)
+			}
+		}
+		if settings, err := profile.LoadSettings(); err == nil && !settings.Git {
+			header += " — versioning is off"
+		}
+		fmt.Println(header)
+
+		if len(commits) == 0 {
+			fmt.Println("(No commits)")
+			return nil
+		}
+		for _, c := range commits {
+			line := fmt.Sprintf("%s  %s  %s", c.Short(), c.Time.Local().Format("2006-01-02 15:04"), c.Subject)
+			if len(c.Profiles) > 0 {
+				line += "  [" + strings.Join(c.Profiles, ", ") + "]"
+			}
+			if c.Source != "" {
+				line += " (" + c.Source + ")"
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+func init() {
+	LogCmd.Flags().IntVarP(&logLimit, "max-count", "n", 0, "Show at most n commits")
+}
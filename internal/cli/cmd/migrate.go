@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateDryRun bool
+	migrateJSON   bool
+)
+
+var MigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Import legacy ~/.config/opencode profiles into omo.json",
+	Long: `Imports the pre-unification layout — every ~/.config/opencode/profiles/*.json
+and the legacy oh-my-openagent.json / oh-my-opencode.json — as profile blocks
+in the omo document, in a single transaction with one backup.
+
+Each file is validated like 'import'. Invalid files are reported and skipped;
+names that are already taken get a numeric suffix. Imported files are recorded
+in .omo-migrated.json beside the document, so running migrate again only picks
+up files that are new or have changed since.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		validate, err := saveValidator()
+		if err != nil {
+			return err
+		}
+
+		report, err := profile.Migrate(migrateDryRun, validate)
+		if writeFailed(err) {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+
+		if migrateJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+		} else {
+			printMigrationReport(report)
+		}
+
+		if report.Count(profile.MigrationInvalid) > 0 {
+			os.Exit(2)
+		}
+		return nil
+	},
+}
+
+func printMigrationReport(report *profile.MigrationReport) {
+	if len(report.Items) == 0 {
+		fmt.Printf("No legacy profiles found in %s\n", config.LegacyConfigDir())
+		return
+	}
+
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+	for _, item := range report.Items {
+		switch item.Status {
+		case profile.MigrationImported:
+			if item.Renamed() {
+				fmt.Printf("%s %s as %q (%q exists)\n", verb, item.Source, item.Profile, item.Base)
+			} else {
+				fmt.Printf("%s %s as %q\n", verb, item.Source, item.Profile)
+			}
+		case profile.MigrationSkipped:
+			fmt.Printf("Skipped %s (already migrated)\n", item.Source)
+		case profile.MigrationInvalid:
+			fmt.Fprintf(os.Stderr, "Invalid %s:\n", item.Source)
+			for _, msg := range item.Errors {
+				fmt.Fprintf(os.Stderr, "  - %s\n", msg)
+			}
+		}
+	}
+
+	imported := report.Count(profile.MigrationImported)
+	switch {
+	case report.DryRun:
+		fmt.Printf("\nDry run: %d profile(s) would be written to %s\n", imported, report.Target)
+	case imported > 0:
+		fmt.Printf("\n%d profile(s) written to %s\n", imported, report.Target)
+	default:
+		fmt.Println("\nNothing to migrate")
+	}
+}
+
+func init() {
+	MigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Report what would be imported without writing anything")
+	MigrateCmd.Flags().BoolVar(&migrateJSON, "json", false, "Print the migration report as JSON")
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var refsUnresolved bool
+
+var RefsCmd = &cobra.Command{
+	Use:   "refs <profile> [<overlay>...]",
+	Short: "List the environment and file references of a profile",
+	Long: `Profile string values can reference secrets instead of holding them:
+${env:DISCORD_TOKEN} is replaced by the environment variable and
+${file:~/.secrets/tg} by the file's content, trailing newline removed.
+Relative file paths are relative to the directory of omo.json.
+
+References are resolved only when 'switch' writes the root; export, validate
+and compare keep them, so a profile can be shared without its tokens. A switch
+fails, writing nothing, while any reference does not resolve.
+
+Lists every reference of the profile, or of the stack the profiles combine
+into, with whether it resolves now. --unresolved lists only those that do not.
+Exits with status 1 when any reference does not resolve.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refs, err := profile.References(args...)
+		if err != nil {
+			return err
+		}
+		unresolved := 0
+		for _, ref := range refs {
+			if !ref.Resolved {
+				unresolved++
+			} else if refsUnresolved {
+				continue
+			}
+			if ref.Resolved {
+				fmt.Printf("  %s  %s\n", ref.Path, ref.Ref)
+			} else {
+				fmt.Printf("! %s  %s  (%s)\n", ref.Path, ref.Ref, ref.Error)
+			}
+		}
+		if len(refs) == 0 {
+			fmt.Println("(No references)")
+		}
+		if unresolved > 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d references do not resolve\n", unresolved, len(refs))
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RefsCmd.Flags().BoolVar(&refsUnresolved, "unresolved", false, "List only the references that do not resolve")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var RevertCmd = &cobra.Command{
+	Use:   "revert",
+	Short: "Undo the last profile switch",
+	Long: `Restores the root keys the last switch overwrote to their exact previous
+values, and removes the keys it added — even when the previous configuration
+matched no profile. Each revert undoes one more switch, newest first.
+
+Edits made to those keys since the switch are overwritten; the document is
+backed up first.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		entry, err := profile.Revert()
+		if writeFailed(err) {
+			fmt.Fprintf(os.Stderr, "Error: failed to revert: %v\n", err)
+			os.Exit(1)
+		}
+		switch {
+		case len(entry.PreviousStack) > 0:
+			fmt.Printf("Reverted switch to %q; stack %s is live again in %s\n", entry.Profile, entry.Previous, config.DocumentFile())
+		case entry.Previous != "":
+			fmt.Printf("Reverted switch to %q; profile %q is live again in %s\n", entry.Profile, entry.Previous, config.DocumentFile())
+		default:
+			fmt.Printf("Reverted switch to %q; restored the previous configuration in %s\n", entry.Profile, config.DocumentFile())
+		}
+		os.Exit(0)
+	},
+}
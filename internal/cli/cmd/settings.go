@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	settingsKeepDefault    bool
+	settingsBackupsDefault bool
+	settingsBackupsOff     bool
+	settingsGitRemote      string
+)
+
+var SettingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Show or change omo-profiler settings",
+	Long: `Shows omo-profiler's own settings for the target document: which profiles
+are applied strictly, which root keys a strict apply keeps, which profile
+each child extends (see 'extends'), which backups are kept, and whether the
+document is versioned in git.
+
+They are stored beside the document in ` + config.SettingsBasename + `, since the
+omo schema leaves no room for them in a profile block.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := profile.LoadSettings()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Kept by strict apply: %s\n", strings.Join(settings.KeptKeys(), ", "))
+		var strict []string
+		for name, ps := range settings.Profiles {
+			if ps.Strict {
+				strict = append(strict, name)
+			}
+		}
+		sort.Strings(strict)
+		if len(strict) == 0 {
+			fmt.Println("Strict profiles:      (none)")
+		} else {
+			fmt.Printf("Strict profiles:      %s\n", strings.Join(strict, ", "))
+		}
+		var children []string
+		for name, ps := range settings.Profiles {
+			if ps.Extends != "" {
+				children = append(children, name+" → "+ps.Extends)
+			}
+		}
+		sort.Strings(children)
+		if len(children) > 0 {
+			fmt.Printf("Inheritance:          %s\n", strings.Join(children, ", "))
+		}
+		fmt.Printf("Backup retention:     %s\n", settings.BackupRetention())
+		if len(settings.PinnedBackups) > 0 {
+			fmt.Printf("Pinned backups:       %s\n", strings.Join(settings.PinnedBackups, ", "))
+		}
+		fmt.Printf("Git versioning:       %s\n", gitVersioningSummary(settings.Git))
+		return nil
+	},
+}
+
+var settingsStrictCmd = &cobra.Command{
+	Use:   "strict <profile> <on|off>",
+	Short: "Apply a profile strictly on every switch",
+	Long: `With strict on, every switch to the profile makes the document root exactly
+the profile block plus the kept keys: root keys the profile does not declare,
+such as a [codex] block left by the previous profile, are removed. Anything
+removed is snapshotted first. 'switch --strict' does the same for one switch.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var strict bool
+		switch args[1] {
+		case "on", "true":
+			strict = true
+		case "off", "false":
+		default:
+			return fmt.Errorf("expected on or off, got %q", args[1])
+		}
+		if err := profile.SetStrict(args[0], strict); writeFailed(err) {
+			return err
+		}
+		fmt.Printf("Strict apply %s for profile %q\n", map[bool]string{true: "on", false: "off"}[strict], args[0])
+		return nil
+	},
+}
+
+var settingsKeepCmd = &cobra.Command{
+	Use:   "keep [<key>...]",
+	Short: "Set the root keys a strict apply keeps",
+	Long: `Replaces the root keys a strict apply keeps besides $schema and profiles,
+which are always kept. With no keys nothing else is kept; --default restores
+the default (` + strings.Join(profile.DefaultKeepKeys, ", ") + `).`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys := append([]string{}, args...)
+		if settingsKeepDefault {
+			if len(args) > 0 {
+				return fmt.Errorf("--default takes no keys")
+			}
+			keys = nil
+		}
+		if err := profile.SetKeepKeys(keys); writeFailed(err) {
+			return err
+		}
+		settings, err := profile.LoadSettings()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Kept by strict apply: %s\n", strings.Join(settings.KeptKeys(), ", "))
+		return nil
+	},
+}
+
+var settingsBackupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "Set how many backups of the document are kept",
+	Long: `Sets the retention applied to the document's backups after every write. A
+backup is kept when any of --keep, --daily and --weekly keeps it; --max-size
+then caps the total, removing the oldest first. The most recent backup, pinned
+backups (see 'backup pin') and those the switch history relies on are never
+removed.
+
+With no flags, shows the retention. --off keeps every backup; --default
+restores the default (` + backup.DefaultRetention.String() + `).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		retention, err := retentionFlags(cmd)
+		if err != nil {
+			return err
+		}
+		switch {
+		case settingsBackupsOff && settingsBackupsDefault, (settingsBackupsOff || settingsBackupsDefault) && retention != nil:
+			return fmt.Errorf("--off and --default take no limits and exclude each other")
+		case settingsBackupsOff:
+			err = profile.SetBackupRetention(&backup.Retention{})
+		case settingsBackupsDefault:
+			err = profile.SetBackupRetention(nil)
+		case retention != nil:
+			err = profile.SetBackupRetention(retention)
+		}
+		if writeFailed(err) {
+			return err
+		}
+		settings, err := profile.LoadSettings()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup retention: %s\n", settings.BackupRetention())
+		return nil
+	},
+}
+
+var settingsGitCmd = &cobra.Command{
+	Use:   "git [on|off]",
+	Short: "Version the document in a git repository",
+	Long: `With git versioning on, every write to the document is also committed to a
+git repository beside it, ` + config.HistoryDirname + `, with the operation as the
+message and the profiles it changed as trailers; see 'log' and 'checkout'.
+Turning it on creates the repository and commits the document as it is.
+Turning it off stops committing and keeps the repository.
+
+Commits hold the document with its secrets masked, the values the root's
+${env:…} and ${file:…} references resolved to included, as the web UI masks
+them; 'checkout' keeps the secrets the document has. A credential the masking
+does not recognize is committed as is.
+
+--remote sets the repository's origin; each commit is then pushed to it. With
+no argument, shows the setting.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			var on bool
+			switch args[0] {
+			case "on", "true":
+				on = true
+			case "off", "false":
+				if settingsGitRemote != "" {
+					return fmt.Errorf("--remote needs versioning on")
+				}
+			default:
+				return fmt.Errorf("expected on or off, got %q", args[0])
+			}
+			err := profile.SetVersioning(on, settingsGitRemote)
+			var pushErr *vcs.PushError
+			switch {
+			case errors.As(err, &pushErr):
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", pushErr)
+			case err != nil:
+				return err
+			}
+		} else if settingsGitRemote != "" {
+			return fmt.Errorf("--remote needs on")
+		}
+		settings, err := profile.LoadSettings()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Git versioning: %s\n", gitVersioningSummary(settings.Git))
+		return nil
+	},
+}
+
+// gitVersioningSummary describes the git versioning setting on one line.
+func gitVersioningSummary(on bool) string {
+	summary := "off"
+	if on {
+		summary = "on"
+	}
+	status, err := vcs.GetStatus()
+	if err != nil {
+		return summary
+	}
+	summary += ", " + config.HistoryDir()
+	if status.Branch != "" {
+		summary += " on " + status.Branch
+	}
+	if status.RemoteURL != "" {
+		summary += fmt.Sprintf(", %s %s", vcs.Remote, status.RemoteURL)
+		if status.Unpushed > 0 {
+			summary += fmt.Sprintf(" (%d not pushed)", status.Unpushed)
+		}
+	}
+	return summary
+}
+
+func init() {
+	settingsKeepCmd.Flags().BoolVar(&settingsKeepDefault, "default", false, "Restore the default kept keys")
+	addRetentionFlags(settingsBackupsCmd)
+	settingsBackupsCmd.Flags().BoolVar(&settingsBackupsOff, "off", false, "Keep every backup")
+	settingsBackupsCmd.Flags().BoolVar(&settingsBackupsDefault, "default", false, "Restore the default retention")
+	settingsGitCmd.Flags().StringVar(&settingsGitRemote, "remote", "", "Push every commit to this git remote")
+	SettingsCmd.AddCommand(settingsStrictCmd)
+	SettingsCmd.AddCommand(settingsKeepCmd)
+	SettingsCmd.AddCommand(settingsBackupsCmd)
+	SettingsCmd.AddCommand(settingsGitCmd)
+}
@@ -1,35 +1,221 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/diff"
 	"github.com/diogenes/omo-profiler/internal/profile"
 	"github.com/spf13/cobra"
 )
 
+var (
+	switchDryRun bool
+	switchStrict bool
+)
+
 var SwitchCmd = &cobra.Command{
-	Use:   "switch <name>",
+	Use:   "switch <name|-> [<overlay>...]",
 	Short: "Apply a profile to ~/.omo/omo.json",
 	Long: `Applies a profile by writing its keys into ~/.omo/omo.json.
 
 The profile block replaces the matching keys at the document root, so the
 profile is live as soon as the command returns. If the current root
-configuration matches no profile it is saved as a new profile first.`,
-	Args: cobra.ExactArgs(1),
+configuration matches no profile it is saved as a new profile first.
+
+With --layer project the profile is read from and applied to the project
+layer (.omo/omo.json in the repository) instead.
+
+With several names the profiles are applied as a stack of ordered overlays:
+'switch base fast-models no-telemetry' applies base, then fast-models over it,
+then no-telemetry over both. Objects merge key by key; arrays are replaced,
+except the disabled_* lists, which are unioned; any other value is replaced by
+the later profile's. 'current' then reports the whole stack.
+
+'switch -' goes back to the profile or stack that was live before the last
+switch, so running it repeatedly toggles between two of them. To restore a
+previous configuration that matched no profile, use 'revert'.
+
+With --dry-run nothing is written: every root key is listed as added,
+replaced, unchanged or kept (not declared by the profile), replaced values are
+shown as a diff, and the snapshot the apply would take is named.
+
+With --strict the root becomes exactly the profile plus the kept keys (see
+'settings keep'): root keys the profile does not declare are removed after
+being snapshotted. 'settings strict <name> on' makes that the default for a
+profile.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		if len(args) > 1 && slices.Contains(args, "-") {
+			return fmt.Errorf("'-' cannot be part of a stack")
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		name := args[0]
+		if switchDryRun {
+			if err := previewSwitch(args, profile.ApplyOptions{Strict: switchStrict}); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to preview profile: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
 
-		applied, err := profile.Apply(name)
-		if err != nil {
+		var applied profile.Applied
+		var err error
+		if args[0] == "-" {
+			applied, err = profile.SwitchBackWith(profile.ApplyOptions{Strict: switchStrict})
+		} else {
+			applied, err = profile.ApplyStack(args, profile.ApplyOptions{Strict: switchStrict})
+		}
+		if writeFailed(err) {
 			fmt.Fprintf(os.Stderr, "Error: failed to apply profile: %v\n", err)
 			os.Exit(1)
 		}
 		if applied.Snapshot != "" {
 			fmt.Printf("Saved the previous configuration as profile %q\n", applied.Snapshot)
 		}
-		fmt.Printf("Applied profile %q to %s\n", applied.Name, config.OmoFile())
+		if len(applied.Stack) > 0 {
+			fmt.Printf("Applied stack %s to %s\n", applied.Name, config.DocumentFile())
+		} else {
+			fmt.Printf("Applied profile %q to %s\n", applied.Name, config.DocumentFile())
+		}
 		os.Exit(0)
 	},
 }
+
+func previewSwitch(names []string, opts profile.ApplyOptions) error {
+	if names[0] == "-" {
+		previous, err := profile.PreviousStack()
+		if err != nil {
+			return err
+		}
+		names = previous
+	}
+	preview, err := profile.PreviewApplyStack(names, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(preview.Stack) > 0 {
+		fmt.Printf("Applying stack %s to %s would change:\n\n", preview.Name, config.DocumentFile())
+	} else {
+		fmt.Printf("Applying profile %q to %s would change:\n\n", preview.Name, config.DocumentFile())
+	}
+	for _, c := range preview.Changes {
+		switch c.Kind {
+		case profile.RootAdded:
+			fmt.Printf("  + %s (added)\n", c.Key)
+		case profile.RootReplaced:
+			fmt.Printf("  ~ %s (replaced)\n", c.Key)
+			lines, err := changedLines(c.Before, c.After)
+			if err != nil {
+				return err
+			}
+			for _, line := range lines {
+				fmt.Printf("      %s\n", line)
+			}
+		case profile.RootUnchanged:
+			fmt.Printf("  = %s (unchanged)\n", c.Key)
+		case profile.RootKept:
+			fmt.Printf("    %s (kept, not declared by the profile)\n", c.Key)
+		case profile.RootRemoved:
+			fmt.Printf("  - %s (removed by strict apply)\n", c.Key)
+		}
+	}
+	fmt.Println()
+
+	if len(preview.Unresolved) > 0 {
+		fmt.Println("These references do not resolve, so the switch would fail:")
+		for _, ref := range preview.Unresolved {
+			fmt.Printf("  %s  %s  (%s)\n", ref.Path, ref.Ref, ref.Error)
+		}
+		fmt.Println()
+	}
+
+	switch {
+	case preview.Snapshot != "" && preview.Previous != "":
+		fmt.Printf("The strict apply removes keys no profile holds; %s would be saved as profile %q first.\n",
+			strings.Join(preview.SnapshotKeys, ", "), preview.Snapshot)
+	case preview.Snapshot != "":
+		fmt.Printf("The current configuration matches no profile; %s would be saved as profile %q first.\n",
+			strings.Join(preview.SnapshotKeys, ", "), preview.Snapshot)
+	case preview.Previous == preview.Name:
+		fmt.Printf("Profile %q is already applied.\n", preview.Name)
+	case preview.Previous != "":
+		fmt.Printf("No snapshot needed: the current configuration is profile %q.\n", preview.Previous)
+	default:
+		fmt.Println("No snapshot needed: the keys the profile replaces are empty.")
+	}
+	fmt.Println("Nothing was written (dry run).")
+	return nil
+}
+
+// changedLines diffs two pretty-printed JSON values line by line and returns
+// the changed lines with diffContext lines around them, "…" marking the gaps.
+func changedLines(before, after json.RawMessage) ([]string, error) {
+	res, err := diff.ComputeDiff(indentJSON(before), indentJSON(after))
+	if err != nil {
+		return nil, err
+	}
+	const diffContext = 2
+	show := make([]bool, len(res.Left))
+	for i, l := range res.Left {
+		if l.Type == diff.DiffEqual {
+			continue
+		}
+		for j := max(0, i-diffContext); j <= min(len(show)-1, i+diffContext); j++ {
+			show[j] = true
+		}
+	}
+
+	var out []string
+	skipped := false
+	for i, l := range res.Left {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if skipped && len(out) > 0 {
+			out = append(out, "…")
+		}
+		skipped = false
+		switch l.Type {
+		case diff.DiffRemoved:
+			out = append(out, "- "+l.Text)
+		case diff.DiffAdded:
+			out = append(out, "+ "+res.Right[i].Text)
+		default:
+			out = append(out, "  "+l.Text)
+		}
+	}
+	return out, nil
+}
+
+// indentJSON pretty-prints raw with sorted keys for a line diff, so two
+// values differing only in key order diff clean. Invalid JSON is returned
+// as-is.
+func indentJSON(raw json.RawMessage) []byte {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return raw
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return raw
+	}
+	return append(out, '\n')
+}
+
+func init() {
+	SwitchCmd.Flags().BoolVar(&switchDryRun, "dry-run", false, "Show what the switch would change without writing")
+	SwitchCmd.Flags().BoolVar(&switchStrict, "strict", false, "Remove root keys the profile does not declare")
+}
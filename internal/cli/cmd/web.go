@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/diogenes/omo-profiler/internal/backup"
 	"github.com/diogenes/omo-profiler/internal/web"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +17,7 @@ var WebCmd = &cobra.Command{
 	Short: "Launch the web UI for managing profiles",
 	Long:  "Starts a local web server (default http://127.0.0.1:4747) with a browser UI for managing profiles in ~/.omo/omo.json.",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		backup.SetSource(backup.SourceWeb)
 		return web.Serve(web.Options{Host: webHost, Port: webPort, Open: !webNoOpen})
 	},
 }
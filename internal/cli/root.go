@@ -4,13 +4,18 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/diogenes/omo-profiler/internal/backup"
 	"github.com/diogenes/omo-profiler/internal/cli/cmd"
+	"github.com/diogenes/omo-profiler/internal/config"
 	"github.com/diogenes/omo-profiler/internal/tui"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
 	version = "0.1.0"
+	layer   string
+	omoHome string
 )
 
 var rootCmd = &cobra.Command{
@@ -18,7 +23,29 @@ var rootCmd = &cobra.Command{
 	Short:   "TUI profile manager for ~/.omo/omo.json",
 	Long:    `omo-profiler is a TUI application for managing configuration profiles stored in ~/.omo/omo.json.`,
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Backups record the front end that made them; the TUI and web
+		// server override this.
+		backup.SetSource(backup.SourceCLI)
+
+		// Relocate the user layer first: choosing the target layer compares
+		// against it.
+		dir, err := config.ResolveOmoDir(omoHome)
+		if err != nil {
+			return err
+		}
+		if dir != "" {
+			config.SetOmoDir(dir)
+		}
+
+		l, err := config.ParseLayer(layer)
+		if err != nil {
+			return err
+		}
+		return config.SetTargetLayer(l)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
+		backup.SetSource(backup.SourceTUI)
 		if err := tui.Run(); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
@@ -32,13 +59,41 @@ func Execute() error {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&layer, "layer", string(config.LayerUser),
+		"Config layer to edit: user (~/.omo) or project (nearest .omo above the working directory)")
+	rootCmd.PersistentFlags().StringVar(&omoHome, "home", "",
+		"Use this directory instead of ~/.omo for omo.json, backups and models.json (alias --config, env "+config.OmoHomeEnv+")")
+	// --config is another name for --home, not a second flag.
+	rootCmd.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "config" {
+			name = "home"
+		}
+		return pflag.NormalizedName(name)
+	})
+
 	rootCmd.AddCommand(cmd.ListCmd)
 	rootCmd.AddCommand(cmd.CurrentCmd)
 	rootCmd.AddCommand(cmd.ExportCmd)
 	rootCmd.AddCommand(cmd.SwitchCmd)
+	rootCmd.AddCommand(cmd.RevertCmd)
+	rootCmd.AddCommand(cmd.CaptureCmd)
 	rootCmd.AddCommand(cmd.ImportCmd)
 	rootCmd.AddCommand(cmd.ModelsCmd)
 	rootCmd.AddCommand(cmd.CreateCmd)
 	rootCmd.AddCommand(cmd.SchemaCheckCmd)
 	rootCmd.AddCommand(cmd.WebCmd)
+	rootCmd.AddCommand(cmd.EffectiveCmd)
+	rootCmd.AddCommand(cmd.MigrateCmd)
+	rootCmd.AddCommand(cmd.GetCmd)
+	rootCmd.AddCommand(cmd.SetCmd)
+	rootCmd.AddCommand(cmd.UnsetCmd)
+	rootCmd.AddCommand(cmd.SettingsCmd)
+	rootCmd.AddCommand(cmd.ExtendsCmd)
+	rootCmd.AddCommand(cmd.ShowCmd)
+	rootCmd.AddCommand(cmd.RefsCmd)
+	rootCmd.AddCommand(cmd.BundleCmd)
+	rootCmd.AddCommand(cmd.BackupCmd)
+	rootCmd.AddCommand(cmd.HistoryCmd)
+	rootCmd.AddCommand(cmd.LogCmd)
+	rootCmd.AddCommand(cmd.CheckoutCmd)
 }
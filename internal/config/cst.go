@@ -0,0 +1,620 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// This file is the concrete-syntax side of Document: enough of a JSONC parser
+// to know where every member of an object starts and ends in the source, so a
+// save can splice the members that changed and copy every other byte —
+// comments, blank lines, key order, indentation — through untouched.
+//
+// Only objects are modelled. Values are opaque spans; nothing below the
+// members being edited is ever re-rendered.
+
+// jsoncObject is one object in a JSONC source, as byte offsets.
+type jsoncObject struct {
+	open, close int // offsets of '{' and '}'
+	members     []jsoncMember
+}
+
+// jsoncMember is one `"key": value` pair of a jsoncObject.
+type jsoncMember struct {
+	key                  string
+	keyStart, keyEnd     int // the quoted key token
+	valueStart, valueEnd int
+	comma                int // the comma following the value, -1 when absent
+}
+
+// textEdit replaces src[start:end] with text. Zero-width edits insert.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// objectValues is the edited state of one object: its members after the edit,
+// and which of them are renames of a source key (new key -> source key).
+type objectValues struct {
+	values  map[string]json.RawMessage
+	renamed map[string]string
+}
+
+// skipTrivia returns the offset of the first byte at or after i that is not
+// whitespace or part of a comment.
+func skipTrivia(src []byte, i int) int {
+	for i < len(src) {
+		switch c := src[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return len(src)
+			}
+			i += 2 + end + 2
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipString returns the offset just past the string token starting at i.
+func skipString(src []byte, i int) int {
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// skipValue returns the offset just past the value starting at i.
+func skipValue(src []byte, i int) int {
+	if i >= len(src) {
+		return i
+	}
+	switch src[i] {
+	case '"':
+		return skipString(src, i)
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(src); {
+			switch c := src[j]; {
+			case c == '"':
+				j = skipString(src, j)
+				continue
+			case c == '/' && j+1 < len(src) && (src[j+1] == '/' || src[j+1] == '*'):
+				j = skipTrivia(src, j)
+				continue
+			case c == '{' || c == '[':
+				depth++
+			case c == '}' || c == ']':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			}
+			j++
+		}
+		return len(src)
+	default:
+		j := i
+		for j < len(src) && !strings.ContainsRune(",}] \t\r\n/", rune(src[j])) {
+			j++
+		}
+		return j
+	}
+}
+
+// parseJSONCObject records the member layout of the object starting at i.
+func parseJSONCObject(src []byte, i int) (jsoncObject, error) {
+	if i >= len(src) || src[i] != '{' {
+		return jsoncObject{}, fmt.Errorf("offset %d: expected object", i)
+	}
+	obj := jsoncObject{open: i}
+	j := skipTrivia(src, i+1)
+	for {
+		if j >= len(src) {
+			return jsoncObject{}, fmt.Errorf("offset %d: unterminated object", obj.open)
+		}
+		if src[j] == '}' {
+			obj.close = j
+			return obj, nil
+		}
+		if src[j] != '"' {
+			return jsoncObject{}, fmt.Errorf("offset %d: expected object key", j)
+		}
+
+		m := jsoncMember{keyStart: j, keyEnd: skipString(src, j), comma: -1}
+		if err := json.Unmarshal(src[m.keyStart:m.keyEnd], &m.key); err != nil {
+			return jsoncObject{}, fmt.Errorf("offset %d: %w", j, err)
+		}
+		j = skipTrivia(src, m.keyEnd)
+		if j >= len(src) || src[j] != ':' {
+			return jsoncObject{}, fmt.Errorf("offset %d: expected ':'", j)
+		}
+		m.valueStart = skipTrivia(src, j+1)
+		m.valueEnd = skipValue(src, m.valueStart)
+		if m.valueEnd == m.valueStart {
+			return jsoncObject{}, fmt.Errorf("offset %d: expected value", m.valueStart)
+		}
+		j = skipTrivia(src, m.valueEnd)
+		if j < len(src) && src[j] == ',' {
+			m.comma = j
+			j = skipTrivia(src, j+1)
+		}
+		obj.members = append(obj.members, m)
+	}
+}
+
+// lineStart returns the offset of the first byte of the line containing i.
+func lineStart(src []byte, i int) int {
+	return bytes.LastIndexByte(src[:i], '\n') + 1
+}
+
+// lineIndent returns the leading whitespace of the line containing i, and
+// whether nothing but that whitespace precedes i on the line.
+func lineIndent(src []byte, i int) (string, bool) {
+	start := lineStart(src, i)
+	j := start
+	for j < i && (src[j] == ' ' || src[j] == '\t') {
+		j++
+	}
+	return string(src[start:j]), j == i
+}
+
+// span returns the bytes member m owns when it sits on lines of its own: the
+// comment lines directly above it (up to a blank line or the previous token,
+// which ends at prevEnd), the member itself, its comma, and a comment trailing
+// on the same line. A member sharing its line with other tokens owns only its
+// own tokens.
+func (m jsoncMember) span(src []byte, prevEnd int) (int, int) {
+	start := m.keyStart
+	if _, first := lineIndent(src, m.keyStart); first {
+		start = lineStart(src, m.keyStart)
+		comments := commentRanges(src, prevEnd, m.keyStart)
+		insideComment := func(i int) bool {
+			for _, r := range comments {
+				if r[0] < i && i < r[1] {
+					return true
+				}
+			}
+			return false
+		}
+		// Walk up through comment lines, stopping at a blank line or at the
+		// line holding the previous token. A line that begins inside a block
+		// comment is only taken together with the line the comment opens on.
+		for cand := start; cand > prevEnd; {
+			above := lineStart(src, cand-1)
+			if above <= prevEnd {
+				break
+			}
+			cand = above
+			if insideComment(above) {
+				continue
+			}
+			if len(bytes.TrimSpace(src[above:lineEnd(src, above)])) == 0 {
+				break
+			}
+			start = above
+		}
+	}
+
+	end := m.valueEnd
+	if m.comma >= 0 {
+		end = m.comma + 1
+	}
+	k := end
+	for k < len(src) {
+		switch c := src[k]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			k++
+			continue
+		case c == '/' && k+1 < len(src) && src[k+1] == '/':
+			for k < len(src) && src[k] != '\n' {
+				k++
+			}
+			continue
+		case c == '/' && k+1 < len(src) && src[k+1] == '*':
+			close := bytes.Index(src[k+2:], []byte("*/"))
+			if close >= 0 && bytes.IndexByte(src[k+2:k+2+close], '\n') < 0 {
+				k += 2 + close + 2
+				continue
+			}
+		}
+		break
+	}
+	if k < len(src) && src[k] == '\n' && start != m.keyStart {
+		end = k + 1
+	}
+	return start, end
+}
+
+// lineEnd returns the offset of the newline ending the line containing i, or
+// len(src) on the last line.
+func lineEnd(src []byte, i int) int {
+	if n := bytes.IndexByte(src[i:], '\n'); n >= 0 {
+		return i + n
+	}
+	return len(src)
+}
+
+// commentRanges returns the [start, end) offsets of the comments in the trivia
+// between from and to.
+func commentRanges(src []byte, from, to int) [][2]int {
+	var ranges [][2]int
+	for i := from; i < to; {
+		switch {
+		case src[i] == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := lineEnd(src, i)
+			ranges = append(ranges, [2]int{i, end})
+			i = end
+		case src[i] == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := len(src)
+			if n := bytes.Index(src[i+2:], []byte("*/")); n >= 0 {
+				end = i + 2 + n + 2
+			}
+			ranges = append(ranges, [2]int{i, end})
+			i = end
+		default:
+			i++
+		}
+	}
+	return ranges
+}
+
+// prevEnd returns the offset just past the token preceding member i.
+func (o jsoncObject) prevEnd(i int) int {
+	if i == 0 {
+		return o.open + 1
+	}
+	prev := o.members[i-1]
+	if prev.comma >= 0 {
+		return prev.comma + 1
+	}
+	return prev.valueEnd
+}
+
+// patchObject computes the edits that turn obj, as written in src, into the
+// members in want. Members whose value is unchanged are not touched at all;
+// changed values are re-rendered in place; removed members take their attached
+// comment lines with them; renamed members keep their position and comments.
+//
+// nested lists members whose value is itself an object to be patched member
+// by member instead of being replaced whole.
+func patchObject(src []byte, obj jsoncObject, want objectValues, nested map[string]objectValues) ([]textEdit, error) {
+	srcKeys := make(map[string]bool, len(obj.members))
+	for _, m := range obj.members {
+		srcKeys[m.key] = true
+	}
+
+	// target maps a source key to the key it is written under, for every
+	// member that survives the edit.
+	target := make(map[string]string, len(obj.members))
+	for key := range srcKeys {
+		if _, ok := want.values[key]; ok {
+			target[key] = key
+		}
+	}
+	for newKey, oldKey := range want.renamed {
+		if _, ok := want.values[newKey]; !ok || srcKeys[newKey] || !srcKeys[oldKey] {
+			continue
+		}
+		if _, kept := want.values[oldKey]; kept {
+			continue
+		}
+		target[oldKey] = newKey
+	}
+	placed := make(map[string]bool, len(target))
+	for _, key := range target {
+		placed[key] = true
+	}
+	var added []string
+	for key := range want.values {
+		if !placed[key] {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+
+	var survivors []int
+	for i, m := range obj.members {
+		if _, ok := target[m.key]; ok {
+			survivors = append(survivors, i)
+		}
+	}
+
+	objIndent, _ := lineIndent(src, obj.open)
+	multiline := bytes.IndexByte(src[obj.open:obj.close], '\n') >= 0
+	if !multiline || len(survivors) == 0 {
+		return []textEdit{rewriteObject(src, obj, target, want.values, added, objIndent, multiline)}, nil
+	}
+
+	memberIndent := objIndent + "  "
+	if indent, first := lineIndent(src, obj.members[survivors[0]].keyStart); first {
+		memberIndent = indent
+	}
+	unit := strings.TrimPrefix(memberIndent, objIndent)
+	if unit == "" || unit == memberIndent {
+		unit = "  "
+	}
+
+	var edits []textEdit
+	for i, m := range obj.members {
+		newKey, survives := target[m.key]
+		if !survives {
+			prevEnd := obj.prevEnd(i)
+			start, end := m.span(src, prevEnd)
+			// The last member also takes the blank lines separating it from
+			// the one before, which would otherwise dangle above the brace.
+			if i == len(obj.members)-1 && start == lineStart(src, start) {
+				for start > prevEnd {
+					above := lineStart(src, start-1)
+					if above <= prevEnd || len(bytes.TrimSpace(src[above:start])) > 0 {
+						break
+					}
+					start = above
+				}
+			}
+			edits = append(edits, textEdit{start: start, end: end})
+			continue
+		}
+
+		if newKey != m.key {
+			encoded, err := json.Marshal(newKey)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, textEdit{start: m.keyStart, end: m.keyEnd, text: string(encoded)})
+		}
+
+		value := want.values[newKey]
+		if sub, ok := nested[newKey]; ok && src[m.valueStart] == '{' {
+			subObj, err := parseJSONCObject(src, m.valueStart)
+			if err != nil {
+				return nil, err
+			}
+			subEdits, err := patchObject(src, subObj, sub, nil)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, subEdits...)
+			continue
+		}
+		if sameJSON(src[m.valueStart:m.valueEnd], value) {
+			continue
+		}
+		indent, first := lineIndent(src, m.keyStart)
+		if !first {
+			indent = memberIndent
+		}
+		rendered, err := formatValue(value, indent, unit)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, textEdit{start: m.valueStart, end: m.valueEnd, text: rendered})
+	}
+
+	// Keep the separator style: a source whose last member carries a comma
+	// (JSONC trailing-comma style) keeps one, strict JSON stays strict.
+	trailing := obj.members[len(obj.members)-1].comma >= 0
+	lastIdx := survivors[len(survivors)-1]
+	last := obj.members[lastIdx]
+	firstIdx := survivors[0]
+
+	// $schema conventionally leads the document; everything else is appended.
+	var front []string
+	if len(added) > 0 && added[0] == SchemaKey {
+		front, added = added[:1], added[1:]
+	}
+
+	if len(front) > 0 {
+		first := obj.members[firstIdx]
+		at, _ := first.span(src, obj.prevEnd(firstIdx))
+		var buf strings.Builder
+		for _, key := range front {
+			member, err := formatMember(key, want.values[key], memberIndent, unit)
+			if err != nil {
+				return nil, err
+			}
+			if at == first.keyStart {
+				buf.WriteString(member + ", ")
+			} else {
+				buf.WriteString(memberIndent + member + ",\n")
+			}
+		}
+		edits = append(edits, textEdit{start: at, end: at, text: buf.String()})
+	}
+
+	switch {
+	case len(added) > 0:
+		if last.comma < 0 {
+			edits = append(edits, textEdit{start: last.valueEnd, end: last.valueEnd, text: ","})
+		}
+		_, at := last.span(src, obj.prevEnd(lastIdx))
+		ownLine := at > 0 && src[at-1] == '\n'
+		lines := make([]string, 0, len(added))
+		for i, key := range added {
+			member, err := formatMember(key, want.values[key], memberIndent, unit)
+			if err != nil {
+				return nil, err
+			}
+			if i < len(added)-1 || trailing {
+				member += ","
+			}
+			lines = append(lines, memberIndent+member)
+		}
+		text := "\n" + strings.Join(lines, "\n")
+		if ownLine {
+			text = strings.Join(lines, "\n") + "\n"
+		}
+		edits = append(edits, textEdit{start: at, end: at, text: text})
+	case lastIdx != len(obj.members)-1 && last.comma >= 0 && !trailing:
+		// The old last member went away; its predecessor must not keep a
+		// comma that strict JSON would reject.
+		edits = append(edits, textEdit{start: last.comma, end: last.comma + 1})
+	}
+
+	return edits, nil
+}
+
+// rewriteObject renders the whole object anew. It is the fallback for objects
+// written on a single line — where there are no lines for comments to own —
+// and for objects whose every member goes away. Unchanged member values are
+// still copied from the source verbatim.
+func rewriteObject(src []byte, obj jsoncObject, target map[string]string, values map[string]json.RawMessage, added []string, objIndent string, multiline bool) textEdit {
+	type entry struct{ key, value string }
+	var entries []entry
+	for _, m := range obj.members {
+		newKey, ok := target[m.key]
+		if !ok {
+			continue
+		}
+		value := string(src[m.valueStart:m.valueEnd])
+		if !sameJSON(src[m.valueStart:m.valueEnd], values[newKey]) {
+			value = compactJSON(values[newKey])
+		}
+		entries = append(entries, entry{newKey, value})
+	}
+	for _, key := range added {
+		entries = append(entries, entry{key, compactJSON(values[key])})
+	}
+
+	edit := textEdit{start: obj.open, end: obj.close + 1}
+	if len(entries) == 0 {
+		edit.text = "{}"
+		return edit
+	}
+
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i, e := range entries {
+		encoded, _ := json.Marshal(e.key)
+		if multiline {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString("\n" + objIndent + "  ")
+			pretty, err := formatValue(json.RawMessage(e.value), objIndent+"  ", "  ")
+			if err == nil {
+				e.value = pretty
+			}
+		} else if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.Write(encoded)
+		buf.WriteString(": ")
+		buf.WriteString(e.value)
+	}
+	if multiline {
+		buf.WriteString("\n" + objIndent)
+	}
+	buf.WriteByte('}')
+	edit.text = buf.String()
+	return edit
+}
+
+// applyEdits splices non-overlapping edits into src.
+func applyEdits(src []byte, edits []textEdit) ([]byte, error) {
+	// Insertions sort before a replacement starting at the same offset, so
+	// text inserted after a member is not swallowed by the removal of the
+	// next one. The sort is stable to keep same-point insertions in order.
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end == edits[i].start && edits[j].end != edits[j].start
+	})
+
+	var out bytes.Buffer
+	pos := 0
+	for _, e := range edits {
+		if e.start < pos {
+			return nil, fmt.Errorf("overlapping edits at offset %d", e.start)
+		}
+		out.Write(src[pos:e.start])
+		out.WriteString(e.text)
+		pos = e.end
+	}
+	out.Write(src[pos:])
+	return out.Bytes(), nil
+}
+
+// formatMember renders `"key": value` for a member indented by indent.
+func formatMember(key string, value json.RawMessage, indent, unit string) (string, error) {
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	rendered, err := formatValue(value, indent, unit)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded) + ": " + rendered, nil
+}
+
+// formatValue renders a value for a member whose line is indented by indent,
+// nesting by unit. Scalars and empty containers stay on one line.
+func formatValue(value json.RawMessage, indent, unit string) (string, error) {
+	compact := compactJSON(value)
+	if len(compact) <= 2 || (compact[0] != '{' && compact[0] != '[') {
+		return compact, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(compact), indent, unit); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// compactJSON strips insignificant whitespace (and any JSONC comments) from a
+// value, rendering an empty value as null.
+func compactJSON(value json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, StripJSONC(value)); err != nil || buf.Len() == 0 {
+		if len(bytes.TrimSpace(value)) == 0 {
+			return "null"
+		}
+		return string(bytes.TrimSpace(value))
+	}
+	return buf.String()
+}
+
+// sameJSON reports whether a source span and a value hold the same JSON data,
+// ignoring whitespace, comments and member order. A value that merely had its
+// keys reordered (Apply copies profiles, which are stored sorted) is left as
+// the user wrote it.
+func sameJSON(source []byte, value json.RawMessage) bool {
+	a, b := compactJSON(source), compactJSON(value)
+	if a == b {
+		return true
+	}
+	x, errX := DecodeValue([]byte(a))
+	y, errY := DecodeValue([]byte(b))
+	return errX == nil && errY == nil && reflect.DeepEqual(x, y)
+}
+
+// DecodeValue decodes data generically, keeping numbers as written so values
+// compare without float rounding.
+func DecodeValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
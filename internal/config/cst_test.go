@@ -0,0 +1,243 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+const curatedJSONC = `// team omo config — keep the comments!
+{
+  "$schema": "https://example.com/omo.schema.json",
+
+  // live configuration, applied by omo-profiler
+  "[opencode]": {
+    "telemetry": false, // never phone home
+  },
+
+  "profiles": {
+    // day-to-day work
+    "dev": {"[opencode]": {"telemetry": false}},
+
+    /* release
+       builds */
+    "prod": {"[opencode]": {"telemetry": true}},
+  },
+}
+`
+
+func parseCurated(t *testing.T) *Document {
+	t.Helper()
+	doc, err := ParseDocument([]byte(curatedJSONC))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	return doc
+}
+
+func mustBytes(t *testing.T, doc *Document) string {
+	t.Helper()
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if _, err := ParseDocument(data); err != nil {
+		t.Fatalf("output does not parse: %v\n%s", err, data)
+	}
+	return string(data)
+}
+
+func TestBytes_UnchangedDocumentIsByteIdentical(t *testing.T) {
+	doc := parseCurated(t)
+	if got := mustBytes(t, doc); got != curatedJSONC {
+		t.Fatalf("untouched document was rewritten:\n%s", got)
+	}
+}
+
+func TestBytes_SetProfileBlockTouchesOnlyThatProfile(t *testing.T) {
+	doc := parseCurated(t)
+	if err := doc.SetProfileBlock("dev", json.RawMessage(`{"[opencode]":{"telemetry":true}}`)); err != nil {
+		t.Fatalf("SetProfileBlock: %v", err)
+	}
+
+	got := mustBytes(t, doc)
+	want := strings.Replace(curatedJSONC,
+		`"dev": {"[opencode]": {"telemetry": false}},`,
+		`"dev": {
+      "[opencode]": {
+        "telemetry": true
+      }
+    },`, 1)
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBytes_SemanticallyEqualValueIsLeftAlone(t *testing.T) {
+	doc := parseCurated(t)
+	doc.SetRaw(OpenCodeKey, json.RawMessage(`{"telemetry":false}`))
+	if got := mustBytes(t, doc); got != curatedJSONC {
+		t.Fatalf("equal value was re-rendered, dropping its comment:\n%s", got)
+	}
+}
+
+func TestBytes_AddProfileKeepsTrailingCommaStyle(t *testing.T) {
+	doc := parseCurated(t)
+	if err := doc.SetProfileBlock("ci", json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("SetProfileBlock: %v", err)
+	}
+
+	got := mustBytes(t, doc)
+	want := strings.Replace(curatedJSONC,
+		`"prod": {"[opencode]": {"telemetry": true}},
+`,
+		`"prod": {"[opencode]": {"telemetry": true}},
+    "ci": {},
+`, 1)
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBytes_DeleteProfileTakesItsCommentLines(t *testing.T) {
+	doc := parseCurated(t)
+	if _, err := doc.DeleteProfileBlock("prod"); err != nil {
+		t.Fatalf("DeleteProfileBlock: %v", err)
+	}
+
+	got := mustBytes(t, doc)
+	want := strings.Replace(curatedJSONC, `
+
+    /* release
+       builds */
+    "prod": {"[opencode]": {"telemetry": true}},
+`, "\n", 1)
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBytes_DeleteLastMemberKeepsStrictJSONStrict(t *testing.T) {
+	src := "{\n  \"profiles\": {\n    \"a\": {},\n    \"b\": {}\n  }\n}\n"
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	if _, err := doc.DeleteProfileBlock("b"); err != nil {
+		t.Fatalf("DeleteProfileBlock: %v", err)
+	}
+
+	got := mustBytes(t, doc)
+	want := "{\n  \"profiles\": {\n    \"a\": {}\n  }\n}\n"
+	if got != want {
+		t.Fatalf("unexpected output:\n%q\nwant:\n%q", got, want)
+	}
+	var strict map[string]any
+	if err := json.Unmarshal([]byte(got), &strict); err != nil {
+		t.Fatalf("strict JSON source became JSONC: %v", err)
+	}
+}
+
+func TestBytes_RenameKeepsPositionAndComments(t *testing.T) {
+	doc := parseCurated(t)
+	if _, err := doc.RenameProfileBlock("dev", "work"); err != nil {
+		t.Fatalf("RenameProfileBlock: %v", err)
+	}
+
+	got := mustBytes(t, doc)
+	want := strings.Replace(curatedJSONC, `"dev": {`, `"work": {`, 1)
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBytes_RenameChainResolvesToSourceName(t *testing.T) {
+	doc := parseCurated(t)
+	if _, err := doc.RenameProfileBlock("dev", "tmp"); err != nil {
+		t.Fatalf("RenameProfileBlock: %v", err)
+	}
+	if _, err := doc.RenameProfileBlock("tmp", "work"); err != nil {
+		t.Fatalf("RenameProfileBlock: %v", err)
+	}
+
+	got := mustBytes(t, doc)
+	if !strings.Contains(got, "// day-to-day work\n    \"work\": {") {
+		t.Fatalf("chained rename lost its comment:\n%s", got)
+	}
+}
+
+func TestBytes_NewSchemaKeyLeadsTheDocument(t *testing.T) {
+	src := "{\n  // root\n  \"profiles\": {}\n}\n"
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	doc.EnsureSchema()
+
+	got := mustBytes(t, doc)
+	want := "{\n  \"$schema\": \"" + DefaultSchema + "\",\n  // root\n  \"profiles\": {}\n}\n"
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestBytes_SingleLineObjectIsRewritten(t *testing.T) {
+	doc, err := ParseDocument([]byte(`{"b": 1, "a": {"x": true}}`))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	doc.SetRaw("b", json.RawMessage(`2`))
+	doc.SetRaw("c", json.RawMessage(`[1, 2]`))
+
+	if got, want := mustBytes(t, doc), `{"b": 2, "a": {"x": true}, "c": [1,2]}`; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestSave_SuccessiveSavesSpliceAgainstWhatWasWritten(t *testing.T) {
+	defer ResetBaseDir()
+	SetBaseDir(t.TempDir())
+	if err := EnsureDirs(); err != nil {
+		t.Fatalf("EnsureDirs: %v", err)
+	}
+	path := OmoDir() + "/" + OmoBasenameJSONC
+	if err := os.WriteFile(path, []byte(curatedJSONC), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	for _, name := range []string{"one", "two"} {
+		err := Mutate(func(doc *Document) error {
+			return doc.SetProfileBlock(name, json.RawMessage(`{}`))
+		})
+		if err != nil {
+			t.Fatalf("Mutate(%s): %v", name, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	got := string(data)
+	if !strings.Contains(got, "    \"one\": {},\n    \"two\": {},\n  },") {
+		t.Fatalf("profiles were not appended in order:\n%s", got)
+	}
+	if !strings.HasPrefix(got, "// team omo config") || !strings.Contains(got, "/* release\n       builds */") {
+		t.Fatalf("comments were lost across saves:\n%s", got)
+	}
+}
+
+func TestSpan_BlockCommentStartingOnPreviousLineIsNotSplit(t *testing.T) {
+	src := "{\n  \"a\": 1, /* about a,\n  continued */\n  \"b\": 2\n}\n"
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatalf("ParseDocument: %v", err)
+	}
+	delete(doc.raw, "b")
+
+	got := mustBytes(t, doc)
+	if !strings.Contains(got, "/* about a,\n  continued */") {
+		t.Fatalf("comment owned by a was split:\n%s", got)
+	}
+}
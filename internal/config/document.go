@@ -2,13 +2,17 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
 	"sync"
 )
 
@@ -23,14 +27,51 @@ const (
 	CodexKey    = "[codex]"
 )
 
+// IsHarnessKey reports whether a document key names a harness block: the
+// upstream schema writes them in brackets, as `[opencode]`.
+func IsHarnessKey(key string) bool {
+	return len(key) > 2 && strings.HasPrefix(key, "[") && strings.HasSuffix(key, "]")
+}
+
+// HarnessKey returns the block key of harness name: "senpi" → "[senpi]". A
+// key already in brackets is returned as is.
+func HarnessKey(name string) string {
+	if IsHarnessKey(name) {
+		return name
+	}
+	return "[" + name + "]"
+}
+
+// ReferencePattern matches an `${env:…}` or `${file:…}` reference in a
+// profile string; the profile package resolves them as it applies a profile.
+var ReferencePattern = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// ContainsReference reports whether s holds an `${env:…}` or `${file:…}`
+// reference.
+func ContainsReference(s string) bool {
+	return ReferencePattern.MatchString(s)
+}
+
+// HarnessName is the inverse of HarnessKey: "[senpi]" → "senpi".
+func HarnessName(key string) string {
+	if IsHarnessKey(key) {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
 // Document is a parsed omo.json/omo.jsonc file.
 //
 // It keeps every top-level key as raw JSON so that writing back preserves
 // harness blocks, shared typed keys and future schema additions that
 // omo-profiler does not model. Only the parts we edit are decoded.
 //
-// Comments in a .jsonc source are NOT preserved across a write; the file is
-// re-serialized as canonical JSON.
+// A document read from bytes also keeps those bytes. Writing it back splices
+// only the root keys and `profiles.<name>` entries that changed into the
+// original text (see cst.go), so comments, key order and blank lines in a
+// hand-curated omo.jsonc survive every save. A renamed profile keeps its
+// position and the comments attached to it. Documents created from scratch
+// are serialized as canonical JSON with sorted keys.
 type Document struct {
 	// Path is the file this document was read from (or would be written to).
 	Path string
@@ -38,25 +79,30 @@ type Document struct {
 	Exists bool
 
 	raw map[string]json.RawMessage
+	// src is the text the document was parsed from; nil for a new document.
+	src []byte
+	// renamed maps a profile's new name to the name it has in src.
+	renamed map[string]string
 }
 
-// NewDocument returns an empty document targeting the user-layer omo file.
+// NewDocument returns an empty document targeting the target layer's omo file.
 func NewDocument() *Document {
 	return &Document{
-		Path:   OmoFile(),
+		Path:   DocumentFile(),
 		Exists: false,
 		raw:    map[string]json.RawMessage{},
 	}
 }
 
-// LoadDocument reads the user-layer omo config file. A missing file yields an
-// empty document with Exists=false rather than an error, so callers can treat
-// "no config yet" as a normal state.
+// LoadDocument reads the omo config file of the target layer (the user layer
+// unless SetTargetLayer chose the project). A missing file yields an empty
+// document with Exists=false rather than an error, so callers can treat "no
+// config yet" as a normal state.
 func LoadDocument() (*Document, error) {
-	return LoadDocumentFrom(OmoFile())
+	return LoadDocumentFrom(DocumentFile())
 }
 
-// docMutex serializes read-modify-write cycles on the user-layer document.
+// docMutex serializes read-modify-write cycles on the omo documents.
 //
 // Every profile now lives in one file, so two concurrent mutations that each
 // load, edit and save would silently drop one of the two changes — the writes
@@ -64,26 +110,30 @@ func LoadDocument() (*Document, error) {
 // server handles requests on separate goroutines, which is where this actually
 // bites.
 //
-// Scope: this guards one process. Two omo-profiler processes writing at the
-// same instant can still lose an update; the pre-write backup is the recovery
-// path for that much rarer case. That path only works because backup names are
-// claimed with O_EXCL (see backup.Create) — otherwise the two processes could
-// pick the same name and the surviving snapshot would not be the lost write's
-// pre-image.
+// Scope: this guards one process. Other omo-profiler processes — `web` running
+// while a script calls `switch` — are excluded by the advisory lock on the
+// document's .omo.lock sidecar, which every transaction takes after this mutex
+// (see WithDocumentLock). The pre-write backup remains the recovery path for
+// anything that bypasses the lock; it relies on backup names being claimed
+// with O_EXCL (see backup.Create) so two writers never share a snapshot.
 var docMutex sync.Mutex
 
-// Mutate runs fn against the user-layer document as a serialized transaction:
+// Mutate runs fn against the target layer's document as a serialized transaction:
 // load, apply fn, save — with no other Mutate interleaving.
 //
 // fn must not call Mutate (the lock is not reentrant) and must not call
 // Document.Save itself; returning nil performs the save. Returning an error
 // aborts before any write, leaving the file exactly as it was.
 func Mutate(fn func(*Document) error) error {
-	return MutateWithPreSave(nil, fn)
+	return MutateWithPreSave("", nil, fn)
 }
 
-// MutateWithPreSave is Mutate with a hook that runs inside the lock, after fn
-// succeeds and immediately before the write.
+// MutateWithPreSave is Mutate for operation, e.g. "set work.agents", with a
+// hook that runs inside the lock, after fn succeeds and immediately before the
+// write. preSave and the save hook (see OnSave) are both given operation.
+//
+// When another process holds the document for longer than LockTimeout it fails
+// with *BusyError before loading anything.
 //
 // That placement is the whole point for backups: a snapshot taken by the caller
 // before Mutate races other writers. Two requests would both capture state S,
@@ -91,23 +141,22 @@ func Mutate(fn func(*Document) error) error {
 // it here makes every snapshot the exact pre-image of the write that follows.
 //
 // preSave must not call Mutate. A failing preSave aborts before any write.
-func MutateWithPreSave(preSave func() error, fn func(*Document) error) error {
-	docMutex.Lock()
-	defer docMutex.Unlock()
-
-	doc, err := LoadDocument()
-	if err != nil {
-		return err
-	}
-	if err := fn(doc); err != nil {
-		return err
-	}
-	if preSave != nil {
-		if err := preSave(); err != nil {
+func MutateWithPreSave(operation string, preSave func(operation string) error, fn func(*Document) error) error {
+	return WithDocumentLock(func() error {
+		doc, err := LoadDocument()
+		if err != nil {
 			return err
 		}
-	}
-	return doc.Save()
+		if err := fn(doc); err != nil {
+			return err
+		}
+		if preSave != nil {
+			if err := preSave(operation); err != nil {
+				return err
+			}
+		}
+		return doc.SaveFor(operation)
+	})
 }
 
 // LoadDocumentFrom reads an omo config document from an explicit path.
@@ -120,13 +169,12 @@ func LoadDocumentFrom(path string) (*Document, error) {
 		return nil, err
 	}
 
-	doc := &Document{Path: path, Exists: true, raw: map[string]json.RawMessage{}}
-	if len(bytes.TrimSpace(data)) == 0 {
-		return doc, nil
-	}
-	if err := json.Unmarshal(StripJSONC(data), &doc.raw); err != nil {
+	doc, err := ParseDocument(data)
+	if err != nil {
 		return nil, fmt.Errorf("parse %s: %w", path, err)
 	}
+	doc.Path = path
+	doc.Exists = true
 	return doc, nil
 }
 
@@ -139,6 +187,7 @@ func ParseDocument(data []byte) (*Document, error) {
 	if err := json.Unmarshal(StripJSONC(data), &doc.raw); err != nil {
 		return nil, err
 	}
+	doc.src = data
 	return doc, nil
 }
 
@@ -156,6 +205,21 @@ func (d *Document) SetRaw(key string, value json.RawMessage) {
 	d.raw[key] = value
 }
 
+// Keys returns the document's top-level keys in sorted order.
+func (d *Document) Keys() []string {
+	keys := make([]string, 0, len(d.raw))
+	for key := range d.raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DeleteRaw removes a top-level key.
+func (d *Document) DeleteRaw(key string) {
+	delete(d.raw, key)
+}
+
 // EnsureSchema sets $schema to the canonical omo schema URL when absent.
 func (d *Document) EnsureSchema() {
 	if _, ok := d.raw[SchemaKey]; ok {
@@ -241,14 +305,126 @@ func (d *Document) DeleteProfileBlock(name string) (bool, error) {
 	return true, d.setProfiles(profiles)
 }
 
+// RenameProfileBlock moves `profiles.<oldName>` to `profiles.<newName>`,
+// reporting whether oldName existed. An existing newName is replaced.
+//
+// Unlike a delete plus a set, a rename keeps the entry where it was in the
+// source text, together with the comments written above it.
+func (d *Document) RenameProfileBlock(oldName, newName string) (bool, error) {
+	profiles, err := d.profiles()
+	if err != nil {
+		return false, err
+	}
+	block, ok := profiles[oldName]
+	if !ok {
+		return false, nil
+	}
+	if oldName == newName {
+		return true, nil
+	}
+	delete(profiles, oldName)
+	profiles[newName] = block
+
+	if d.renamed == nil {
+		d.renamed = map[string]string{}
+	}
+	origin := oldName
+	if earlier, ok := d.renamed[oldName]; ok {
+		origin = earlier
+		delete(d.renamed, oldName)
+	}
+	d.renamed[newName] = origin
+	return true, d.setProfiles(profiles)
+}
+
+// Revision identifies the document text as last read or written. It is a
+// content hash, so a change made by this process, another one or a text editor
+// all yield a new value; staged but unsaved edits do not.
+func (d *Document) Revision() string {
+	return Revision(d.src)
+}
+
+// ProfileRevision returns the revision of `profiles.<name>` as currently held
+// in the document, including staged edits. It hashes the block's canonical
+// JSON, so reformatting or reordering the block in an editor does not count as
+// a change, while any change to a value does.
+func (d *Document) ProfileRevision(name string) (string, bool, error) {
+	block, ok, err := d.ProfileBlock(name)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+	v, err := DecodeValue(block)
+	if err != nil {
+		return "", false, fmt.Errorf("parse profile %q: %w", name, err)
+	}
+	canonical, err := EncodeValue(v)
+	if err != nil {
+		return "", false, err
+	}
+	return Revision(canonical), true, nil
+}
+
+// Revision returns the content hash used for document and profile revisions
+// (and, over HTTP, ETags).
+func Revision(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
 // HasProfile reports whether `profiles.<name>` exists.
 func (d *Document) HasProfile(name string) bool {
 	_, ok, err := d.ProfileBlock(name)
 	return err == nil && ok
 }
 
-// Bytes serializes the document as canonical, indented JSON with sorted keys.
+// Bytes serializes the document. A document parsed from text is written as
+// that text with only the changed members spliced in; a new one as canonical,
+// indented JSON with sorted keys.
 func (d *Document) Bytes() ([]byte, error) {
+	if len(d.src) == 0 {
+		return d.canonicalBytes()
+	}
+	return d.patchedBytes()
+}
+
+// patchedBytes splices the changes made since the document was parsed into
+// its source text.
+//
+// The result is checked against the document it is meant to encode; if the
+// splice ever disagrees, the canonical rendering is written instead. Losing
+// the user's comments is bad, but writing a different configuration than the
+// one requested is worse.
+func (d *Document) patchedBytes() ([]byte, error) {
+	root, err := parseJSONCObject(d.src, skipTrivia(d.src, 0))
+	if err != nil {
+		return d.canonicalBytes()
+	}
+
+	nested := map[string]objectValues{}
+	if profiles, err := d.profiles(); err == nil {
+		nested[ProfilesKey] = objectValues{values: profiles, renamed: d.renamed}
+	}
+	edits, err := patchObject(d.src, root, objectValues{values: d.raw}, nested)
+	if err != nil {
+		return d.canonicalBytes()
+	}
+	patched, err := applyEdits(d.src, edits)
+	if err != nil {
+		return d.canonicalBytes()
+	}
+
+	canonical, err := d.canonicalBytes()
+	if err != nil {
+		return nil, err
+	}
+	if !sameJSON(patched, canonical) {
+		return canonical, nil
+	}
+	return patched, nil
+}
+
+// canonicalBytes serializes the document as indented JSON with sorted keys.
+func (d *Document) canonicalBytes() ([]byte, error) {
 	compact, err := marshalSortedObject(d.raw)
 	if err != nil {
 		return nil, err
@@ -261,17 +437,24 @@ func (d *Document) Bytes() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// Save writes the document back to its path, creating ~/.omo if needed.
+// Save writes the document back to its path, creating its .omo directory if
+// needed.
 //
 // The write is atomic: the bytes go to a temp file in the same directory, are
 // fsynced, and are then renamed over the target. This document holds every
 // profile, so a plain truncating write that fails midway would take the whole
 // set with it.
 func (d *Document) Save() error {
+	return d.SaveFor("")
+}
+
+// SaveFor is Save for operation, which the save hook (see OnSave) is given;
+// "" when the write has no name.
+func (d *Document) SaveFor(operation string) error {
 	if d.Path == "" {
-		d.Path = OmoFile()
+		d.Path = DocumentFile()
 	}
-	if err := EnsureDirs(); err != nil {
+	if err := os.MkdirAll(filepath.Dir(d.Path), 0755); err != nil {
 		return err
 	}
 	data, err := d.Bytes()
@@ -282,9 +465,59 @@ func (d *Document) Save() error {
 		return err
 	}
 	d.Exists = true
+	// What was just written is the new baseline for the next splice.
+	d.src = data
+	d.renamed = nil
+	if saveHook == nil {
+		return nil
+	}
+	after, err := saveHook(operation)
+	if current == nil {
+		// Saved outside a transaction: there is no lock to wait for.
+		t := &transaction{}
+		t.add(after, err)
+		return t.finish()
+	}
+	current.add(after, err)
 	return nil
 }
 
+// saveHook runs after every successful Save; see OnSave.
+var saveHook func(operation string) (after func() error, err error)
+
+// OnSave sets fn to run after every successful Document.Save, inside the
+// caller's transaction, with the operation the save was for (see SaveFor).
+// Package profile uses it to prune old backups once the write the newest one
+// protects has landed, and to commit the document when it is versioned.
+//
+// fn must not take the document lock. It cannot fail the save, which has
+// already happened, and the rest of the transaction goes on; its error, and
+// that of after, which runs once the lock is released, come back from the
+// transaction as *AfterSaveError.
+func OnSave(fn func(operation string) (after func() error, err error)) {
+	saveHook = fn
+}
+
+// AfterSaveError is a transaction whose write landed but what followed the
+// save (see OnSave) failed: the document is as the caller asked, Err says
+// what was not done.
+type AfterSaveError struct {
+	Err error
+}
+
+func (e *AfterSaveError) Error() string {
+	return "saved, but " + e.Err.Error()
+}
+
+func (e *AfterSaveError) Unwrap() error { return e.Err }
+
+// Saved reports whether err leaves the transaction's write in place: it is
+// nil or an *AfterSaveError.
+func Saved(err error) bool {
+	var after *AfterSaveError
+	return err == nil || errors.As(err, &after)
+}
+
 // WriteFileAtomic replaces path with data via a same-directory temp file and a
 // rename, so a reader never observes a partially written document. The temp
 // file must share the directory: os.Rename is only atomic within a filesystem.
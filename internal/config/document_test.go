@@ -389,3 +389,39 @@ func jsonRawEqual(t *testing.T, a, b json.RawMessage) bool {
 	}
 	return reflect.DeepEqual(x, y)
 }
+
+func TestDocumentRevision_TracksSavedText(t *testing.T) {
+	defer ResetBaseDir()
+	SetBaseDir(t.TempDir())
+
+	doc, err := LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	empty := doc.Revision()
+
+	if err := doc.SetProfileBlock("dev", json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("SetProfileBlock: %v", err)
+	}
+	if doc.Revision() != empty {
+		t.Fatal("staged edit changed the revision before Save")
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(doc.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Revision() == empty || doc.Revision() != Revision(data) {
+		t.Fatalf("Revision() = %s, want hash of the written file", doc.Revision())
+	}
+
+	reloaded, err := LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	if reloaded.Revision() != doc.Revision() {
+		t.Fatal("reloading unchanged text produced a different revision")
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Effective is the configuration upstream actually runs with: the project
+// layer deep-merged over the user layer.
+//
+// Objects merge member by member; any other value — arrays included — is
+// taken whole from the highest layer that sets it. `profiles` is
+// omo-profiler's own storage and `$schema` names each file's schema, so
+// neither takes part in the merge.
+type Effective struct {
+	// Config holds the merged top-level keys.
+	Config map[string]json.RawMessage
+	// Sources maps the dotted path of every merged leaf value to the layer
+	// that supplied it. An empty object counts as a leaf.
+	Sources map[string]Layer
+	// Files maps each layer found on disk to its path.
+	Files map[Layer]string
+
+	leaves map[string]json.RawMessage
+}
+
+// LoadEffective reads both layers from disk and merges them. A missing user
+// file or an absent project layer simply contributes nothing.
+func LoadEffective() (*Effective, error) {
+	user, err := LoadDocumentFrom(OmoFile())
+	if err != nil {
+		return nil, err
+	}
+	var project *Document
+	if path := ProjectOmoFile(); path != "" {
+		if project, err = LoadDocumentFrom(path); err != nil {
+			return nil, err
+		}
+	}
+	return MergeLayers(user, project)
+}
+
+// MergeLayers merges already-loaded layer documents. Either may be nil.
+func MergeLayers(user, project *Document) (*Effective, error) {
+	eff := &Effective{
+		Config:  map[string]json.RawMessage{},
+		Sources: map[string]Layer{},
+		Files:   map[Layer]string{},
+		leaves:  map[string]json.RawMessage{},
+	}
+	merged := map[string]any{}
+	for _, layer := range []struct {
+		name Layer
+		doc  *Document
+	}{{LayerUser, user}, {LayerProject, project}} {
+		if layer.doc == nil || !layer.doc.Exists {
+			continue
+		}
+		eff.Files[layer.name] = layer.doc.Path
+
+		values := make(map[string]any, len(layer.doc.raw))
+		for key, raw := range layer.doc.raw {
+			if key == ProfilesKey || key == SchemaKey {
+				continue
+			}
+			v, err := DecodeValue(raw)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s key %q: %w", layer.doc.Path, key, err)
+			}
+			values[key] = v
+		}
+		overlay(merged, values, "", layer.name, eff.Sources)
+	}
+
+	for key, v := range merged {
+		encoded, err := EncodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		eff.Config[key] = encoded
+		if err := collectLeaves(v, key, eff.leaves); err != nil {
+			return nil, err
+		}
+	}
+	return eff, nil
+}
+
+// Value returns the merged JSON at a provenance path, nil when path is not
+// one of Paths.
+func (e *Effective) Value(path string) json.RawMessage {
+	return e.leaves[path]
+}
+
+// Paths returns the provenance paths in sorted order.
+func (e *Effective) Paths() []string {
+	paths := make([]string, 0, len(e.Sources))
+	for path := range e.Sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// overlay merges src into dst in place, recording which layer supplied each
+// leaf under prefix.
+func overlay(dst, src map[string]any, prefix string, layer Layer, sources map[string]Layer) {
+	for key, value := range src {
+		path := joinLayerPath(prefix, key)
+		srcObj, srcIsObj := value.(map[string]any)
+		if dstObj, ok := dst[key].(map[string]any); ok && srcIsObj {
+			overlay(dstObj, srcObj, path, layer, sources)
+			continue
+		}
+		dropSources(sources, path)
+		dst[key] = value
+		recordSources(value, path, layer, sources)
+	}
+}
+
+func recordSources(value any, path string, layer Layer, sources map[string]Layer) {
+	obj, ok := value.(map[string]any)
+	if !ok || len(obj) == 0 {
+		sources[path] = layer
+		return
+	}
+	for key, child := range obj {
+		recordSources(child, joinLayerPath(path, key), layer, sources)
+	}
+}
+
+// dropSources forgets path and everything beneath it, for when a higher layer
+// replaces an object with a scalar or array.
+func dropSources(sources map[string]Layer, path string) {
+	delete(sources, path)
+	prefix := path + "."
+	for p := range sources {
+		if strings.HasPrefix(p, prefix) {
+			delete(sources, p)
+		}
+	}
+}
+
+func collectLeaves(value any, path string, leaves map[string]json.RawMessage) error {
+	obj, ok := value.(map[string]any)
+	if !ok || len(obj) == 0 {
+		encoded, err := EncodeValue(value)
+		if err != nil {
+			return err
+		}
+		leaves[path] = encoded
+		return nil
+	}
+	for key, child := range obj {
+		if err := collectLeaves(child, joinLayerPath(path, key), leaves); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeValue marshals a decoded value back to compact JSON without escaping
+// HTML characters, which would mangle model prompts and URLs.
+func EncodeValue(v any) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return json.RawMessage(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+func joinLayerPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
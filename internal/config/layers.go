@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Layer names one of the omo config files upstream merges at startup: the
+// per-user document in ~/.omo and an optional per-project document in the
+// nearest `.omo` directory above the working directory.
+type Layer string
+
+const (
+	// LayerUser is ~/.omo/omo.json(c), the default edit target.
+	LayerUser Layer = "user"
+	// LayerProject is <project>/.omo/omo.json(c). Upstream merges it over the
+	// user layer, so its keys win.
+	LayerProject Layer = "project"
+)
+
+// Layers lists every layer, lowest precedence first.
+var Layers = []Layer{LayerUser, LayerProject}
+
+// ParseLayer converts a flag or request value into a Layer.
+func ParseLayer(s string) (Layer, error) {
+	switch Layer(s) {
+	case LayerUser, LayerProject:
+		return Layer(s), nil
+	}
+	return "", fmt.Errorf("unknown config layer %q (want %q or %q)", s, LayerUser, LayerProject)
+}
+
+var workDir string // empty = use os.Getwd()
+
+// SetWorkDir sets the directory project discovery starts from (for testing)
+func SetWorkDir(path string) { workDir = path }
+
+// ResetWorkDir resets project discovery to the process working directory
+func ResetWorkDir() { workDir = "" }
+
+// WorkDir returns the directory project-layer discovery starts from.
+func WorkDir() string {
+	if workDir != "" {
+		return workDir
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+// ProjectOmoDir returns the nearest `.omo` directory holding an omo.json(c),
+// searching from WorkDir up to the filesystem root, or "" when there is none.
+//
+// The user layer's own ~/.omo is skipped: from anywhere under the home
+// directory the walk would otherwise find it and treat the user file as a
+// project layer, so every edit would land in the same file twice over.
+func ProjectOmoDir() string {
+	start := WorkDir()
+	if start == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return ""
+	}
+	userDir := filepath.Clean(OmoDir())
+	for {
+		candidate := filepath.Join(dir, OmoDirname)
+		if filepath.Clean(candidate) != userDir && omoFileIn(candidate) != "" {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ProjectOmoFile returns the project-layer config file, or "" when no project
+// layer exists above the working directory. Like OmoFile it prefers omo.jsonc.
+func ProjectOmoFile() string {
+	dir := ProjectOmoDir()
+	if dir == "" {
+		return ""
+	}
+	return omoFileIn(dir)
+}
+
+// omoFileIn returns the existing omo.jsonc or omo.json in dir, else "".
+func omoFileIn(dir string) string {
+	for _, name := range []string{OmoBasenameJSONC, OmoBasename} {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// LayerFile returns the document path for a layer. A project layer that does
+// not exist yet resolves to <workdir>/.omo/omo.json, so targeting it and
+// saving creates one where the user is standing.
+func LayerFile(layer Layer) string {
+	if layer != LayerProject {
+		return OmoFile()
+	}
+	if path := ProjectOmoFile(); path != "" {
+		return path
+	}
+	return filepath.Join(WorkDir(), OmoDirname, OmoBasename)
+}
+
+var (
+	targetMu    sync.RWMutex
+	targetLayer = LayerUser
+)
+
+// SetTargetLayer selects the layer LoadDocument, Mutate and the backup helpers
+// operate on. The CLI sets it once from --layer; the web UI switches it at
+// runtime, so it waits for any in-flight Mutate: a transaction's load, pre-save
+// backup and write must all see the same file.
+//
+// Targeting the project layer fails when it would resolve to the user file —
+// i.e. the working directory is the home directory and no project exists.
+func SetTargetLayer(layer Layer) error {
+	if _, err := ParseLayer(string(layer)); err != nil {
+		return err
+	}
+	if layer == LayerProject && filepath.Clean(LayerFile(LayerProject)) == filepath.Clean(OmoFile()) {
+		return fmt.Errorf("no project layer: %s is the user config", OmoFile())
+	}
+	docMutex.Lock()
+	defer docMutex.Unlock()
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	targetLayer = layer
+	return nil
+}
+
+// ResetTargetLayer goes back to editing the user layer.
+func ResetTargetLayer() {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	targetLayer = LayerUser
+}
+
+// TargetLayer reports the layer currently being edited.
+func TargetLayer() Layer {
+	targetMu.RLock()
+	defer targetMu.RUnlock()
+	return targetLayer
+}
+
+// DocumentFile returns the config file of the target layer.
+func DocumentFile() string {
+	return LayerFile(TargetLayer())
+}
+
+// BackupDir returns where backups of the target layer live: the `.omo`
+// directory holding its document, so a project's snapshots stay with the
+// project and never mix with the user layer's.
+func BackupDir() string {
+	if TargetLayer() == LayerProject {
+		return filepath.Dir(DocumentFile())
+	}
+	return OmoDir()
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupLayers isolates both layers: a fake home and a project tree with the
+// working directory two levels below the project root.
+func setupLayers(t *testing.T) (home, project, wd string) {
+	t.Helper()
+	root := t.TempDir()
+	home = filepath.Join(root, "home")
+	project = filepath.Join(root, "repo")
+	wd = filepath.Join(project, "pkg", "sub")
+	if err := os.MkdirAll(wd, 0755); err != nil {
+		t.Fatal(err)
+	}
+	SetBaseDir(home)
+	SetWorkDir(wd)
+	t.Cleanup(func() {
+		ResetBaseDir()
+		ResetWorkDir()
+		ResetTargetLayer()
+	})
+	return home, project, wd
+}
+
+func writeLayer(t *testing.T, dir, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, OmoDirname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, OmoDirname, OmoBasename)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProjectOmoFile_FindsNearestAncestor(t *testing.T) {
+	_, project, _ := setupLayers(t)
+	if got := ProjectOmoFile(); got != "" {
+		t.Fatalf("ProjectOmoFile() = %q before any project exists", got)
+	}
+
+	want := writeLayer(t, project, `{}`)
+	if got := ProjectOmoFile(); got != want {
+		t.Fatalf("ProjectOmoFile() = %q, want %q", got, want)
+	}
+}
+
+func TestProjectOmoFile_SkipsUserLayer(t *testing.T) {
+	home, _, _ := setupLayers(t)
+	writeLayer(t, home, `{}`)
+	SetWorkDir(filepath.Join(home, "code"))
+
+	if got := ProjectOmoFile(); got != "" {
+		t.Fatalf("user layer was discovered as a project: %q", got)
+	}
+}
+
+func TestSetTargetLayer_RoutesDocumentIO(t *testing.T) {
+	_, project, wd := setupLayers(t)
+
+	if err := SetTargetLayer(LayerProject); err != nil {
+		t.Fatalf("SetTargetLayer: %v", err)
+	}
+	// No project yet: the first save creates one where the user stands.
+	if want := filepath.Join(wd, OmoDirname, OmoBasename); DocumentFile() != want {
+		t.Fatalf("DocumentFile() = %q, want %q", DocumentFile(), want)
+	}
+
+	path := writeLayer(t, project, `{"profiles": {}}`)
+	err := Mutate(func(doc *Document) error {
+		return doc.SetProfileBlock("repo", []byte(`{}`))
+	})
+	if err != nil {
+		t.Fatalf("Mutate: %v", err)
+	}
+	doc, err := LoadDocumentFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.HasProfile("repo") {
+		t.Fatalf("profile was not written to the project layer")
+	}
+	if _, err := os.Stat(OmoFile()); !os.IsNotExist(err) {
+		t.Fatalf("user layer was touched: %v", err)
+	}
+}
+
+func TestSetTargetLayer_RefusesProjectThatIsTheUserFile(t *testing.T) {
+	home, _, _ := setupLayers(t)
+	SetWorkDir(home)
+
+	if err := SetTargetLayer(LayerProject); err == nil {
+		t.Fatal("expected an error targeting the project layer from the home directory")
+	}
+	if TargetLayer() != LayerUser {
+		t.Fatalf("TargetLayer() = %q after a refused switch", TargetLayer())
+	}
+}
+
+func TestLoadEffective_ProjectWinsWithProvenance(t *testing.T) {
+	home, project, _ := setupLayers(t)
+	writeLayer(t, home, `{
+		"$schema": "user",
+		"[opencode]": {
+			"agents": {"build": {"model": "a/user", "temperature": 0.2}},
+			"disabled_mcps": ["x", "y"],
+			"telemetry": false
+		},
+		"profiles": {"dev": {}}
+	}`)
+	writeLayer(t, project, `{
+		"[opencode]": {
+			"agents": {"build": {"model": "a/project"}},
+			"disabled_mcps": ["z"]
+		}
+	}`)
+
+	eff, err := LoadEffective()
+	if err != nil {
+		t.Fatalf("LoadEffective: %v", err)
+	}
+
+	wantSources := map[string]Layer{
+		"[opencode].agents.build.model":       LayerProject,
+		"[opencode].agents.build.temperature": LayerUser,
+		"[opencode].disabled_mcps":            LayerProject,
+		"[opencode].telemetry":                LayerUser,
+	}
+	if len(eff.Sources) != len(wantSources) {
+		t.Fatalf("Sources = %v, want %v", eff.Sources, wantSources)
+	}
+	for path, layer := range wantSources {
+		if eff.Sources[path] != layer {
+			t.Errorf("Sources[%q] = %q, want %q", path, eff.Sources[path], layer)
+		}
+	}
+	if got := string(eff.Value("[opencode].disabled_mcps")); got != `["z"]` {
+		t.Errorf("arrays must be replaced, not merged: got %s", got)
+	}
+	if got := string(eff.Value("[opencode].agents.build.temperature")); got != `0.2` {
+		t.Errorf("temperature = %s, want 0.2", got)
+	}
+	if _, ok := eff.Config[ProfilesKey]; ok {
+		t.Error("profiles must not be part of the effective config")
+	}
+	if _, ok := eff.Config[SchemaKey]; ok {
+		t.Error("$schema must not be part of the effective config")
+	}
+	if len(eff.Files) != 2 {
+		t.Errorf("Files = %v, want both layers", eff.Files)
+	}
+}
+
+func TestMergeLayers_ScalarReplacesObjectSources(t *testing.T) {
+	user, err := ParseDocument([]byte(`{"tmux": {"enabled": true, "layout": "main"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.Exists = true
+	project, err := ParseDocument([]byte(`{"tmux": false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	project.Exists = true
+
+	eff, err := MergeLayers(user, project)
+	if err != nil {
+		t.Fatalf("MergeLayers: %v", err)
+	}
+	if len(eff.Sources) != 1 || eff.Sources["tmux"] != LayerProject {
+		t.Fatalf("Sources = %v, want only tmux from project", eff.Sources)
+	}
+}
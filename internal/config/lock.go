@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OmoLockBasename is the sidecar file locked around document transactions. It
+// sits next to the document it guards, so each config layer has its own.
+const OmoLockBasename = ".omo.lock"
+
+// LockTimeout bounds how long a transaction waits for another omo-profiler
+// process to finish before giving up with *BusyError.
+var LockTimeout = 10 * time.Second
+
+// lockPollInterval is how often a waiting transaction retries the lock.
+const lockPollInterval = 25 * time.Millisecond
+
+// ErrBusy is the sentinel every *BusyError unwraps to.
+var ErrBusy = errors.New("document busy")
+
+// BusyError reports that another process held a lock for longer than
+// LockTimeout. It unwraps to ErrBusy.
+type BusyError struct {
+	Path   string
+	Waited time.Duration
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("document busy: %s is locked by another omo-profiler process (waited %s)", e.Path, e.Waited)
+}
+
+func (e *BusyError) Unwrap() error { return ErrBusy }
+
+// FileLock is an exclusive advisory lock on a sidecar file, shared by every
+// omo-profiler process. The OS drops it when the holder exits, so a crashed
+// process never leaves the document locked.
+type FileLock struct {
+	f *os.File
+}
+
+// LockFile acquires an exclusive lock on path, creating the file and its
+// directory if needed, and retries until timeout before failing with
+// *BusyError.
+//
+// The lock is advisory: it only excludes other callers of LockFile. The sidecar
+// is never written or removed — removing it would let a second process lock a
+// fresh inode while the first still holds the old one.
+func LockFile(path string, timeout time.Duration) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+
+	start := time.Now()
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if ok {
+			return &FileLock{f: f}, nil
+		}
+		waited := time.Since(start)
+		if waited >= timeout {
+			_ = f.Close()
+			return nil, &BusyError{Path: path, Waited: waited.Round(time.Millisecond)}
+		}
+		time.Sleep(min(lockPollInterval, timeout-waited))
+	}
+}
+
+// Unlock releases the lock. Closing the descriptor releases it too; the
+// explicit unlock just makes the release independent of GC and finalizers.
+func (l *FileLock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlock(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
+
+// DocumentLockFile returns the lock sidecar of the target layer's document.
+func DocumentLockFile() string {
+	return filepath.Join(filepath.Dir(DocumentFile()), OmoLockBasename)
+}
+
+// WithDocumentLock runs fn holding both the in-process document mutex and the
+// cross-process lock on the target layer's sidecar. Anything that rewrites the
+// document outside Mutate — restoring a backup, say — goes through here.
+//
+// Once both locks are released it runs what the saves in fn left for after
+// them (see OnSave). When fn succeeded but anything that followed one of its
+// saves failed, it returns *AfterSaveError.
+//
+// fn must not call Mutate or WithDocumentLock: neither lock is reentrant.
+func WithDocumentLock(fn func() error) error {
+	t, err := lockedTransaction(fn)
+	if t == nil {
+		return err
+	}
+	if afterErr := t.finish(); err == nil {
+		err = afterErr
+	}
+	return err
+}
+
+// lockedTransaction runs fn as the current transaction, under both locks. It
+// returns no transaction when the locks could not be taken.
+func lockedTransaction(fn func() error) (*transaction, error) {
+	docMutex.Lock()
+	defer docMutex.Unlock()
+
+	lock, err := LockFile(DocumentLockFile(), LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	t := &transaction{}
+	current = t
+	defer func() { current = nil }()
+	return t, fn()
+}
+
+// transaction collects, for the WithDocumentLock call holding the lock, what
+// its saves leave for after the lock and what failed after them.
+type transaction struct {
+	after  []func() error
+	failed []error
+}
+
+// current is the transaction holding the lock, nil outside one; docMutex
+// guards it.
+var current *transaction
+
+// add records what a save's hook returned.
+func (t *transaction) add(after func() error, err error) {
+	if err != nil {
+		t.failed = append(t.failed, err)
+	}
+	if after != nil {
+		t.after = append(t.after, after)
+	}
+}
+
+// finish runs what the saves left for after the lock and reports every
+// failure that followed a save.
+func (t *transaction) finish() error {
+	for _, fn := range t.after {
+		if err := fn(); err != nil {
+			t.failed = append(t.failed, err)
+		}
+	}
+	if len(t.failed) == 0 {
+		return nil
+	}
+	return &AfterSaveError{Err: errors.Join(t.failed...)}
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+package config
+
+import "os"
+
+// Platforms without a file-locking primitive fall back to the in-process
+// mutex alone.
+func tryLock(*os.File) (bool, error) { return true, nil }
+
+func unlock(*os.File) error { return nil }
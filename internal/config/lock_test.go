@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func shortLockTimeout(t *testing.T) {
+	t.Helper()
+	prev := LockTimeout
+	LockTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { LockTimeout = prev })
+}
+
+func TestLockFile_SecondHolderGetsBusyError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", OmoLockBasename)
+	first, err := LockFile(path, time.Second)
+	if err != nil {
+		t.Fatalf("LockFile: %v", err)
+	}
+
+	_, err = LockFile(path, 30*time.Millisecond)
+	var busy *BusyError
+	if !errors.As(err, &busy) || !errors.Is(err, ErrBusy) {
+		t.Fatalf("second LockFile error = %v, want *BusyError", err)
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	again, err := LockFile(path, time.Second)
+	if err != nil {
+		t.Fatalf("LockFile after Unlock: %v", err)
+	}
+	_ = again.Unlock()
+}
+
+func TestMutate_FailsBusyWhileAnotherHolderHasTheDocument(t *testing.T) {
+	defer ResetBaseDir()
+	SetBaseDir(t.TempDir())
+	shortLockTimeout(t)
+
+	held, err := LockFile(DocumentLockFile(), time.Second)
+	if err != nil {
+		t.Fatalf("LockFile: %v", err)
+	}
+	defer held.Unlock()
+
+	called := false
+	err = Mutate(func(*Document) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrBusy) {
+		t.Fatalf("Mutate error = %v, want ErrBusy", err)
+	}
+	if called {
+		t.Fatal("fn ran without the lock")
+	}
+	if _, err := os.Stat(OmoFile()); !os.IsNotExist(err) {
+		t.Fatalf("document was written while busy: %v", err)
+	}
+}
+
+// TestHelperHoldLock is not a real test: TestMutate_WaitsForAnotherProcess
+// re-executes the test binary into it to hold the lock from a second process.
+func TestHelperHoldLock(t *testing.T) {
+	path := os.Getenv("OMO_TEST_HOLD_LOCK")
+	if path == "" {
+		t.Skip("helper process only")
+	}
+	lock, err := LockFile(path, time.Second)
+	if err != nil {
+		t.Fatalf("LockFile: %v", err)
+	}
+	os.Stdout.WriteString("locked\n")
+	_, _ = io.Copy(io.Discard, os.Stdin) // hold until the parent closes stdin
+	_ = lock.Unlock()
+}
+
+func TestMutate_WaitsForAnotherProcess(t *testing.T) {
+	defer ResetBaseDir()
+	SetBaseDir(t.TempDir())
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperHoldLock$")
+	cmd.Env = append(os.Environ(), "OMO_TEST_HOLD_LOCK="+DocumentLockFile())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		_ = stdin.Close()
+		t.Fatalf("helper did not take the lock: %q, %v", line, err)
+	}
+
+	shortLockTimeout(t)
+	if err := Mutate(func(*Document) error { return nil }); !errors.Is(err, ErrBusy) {
+		_ = stdin.Close()
+		t.Fatalf("Mutate error = %v, want ErrBusy while another process holds the lock", err)
+	}
+
+	// Release the other process while this one is waiting.
+	LockTimeout = 5 * time.Second
+	time.AfterFunc(100*time.Millisecond, func() { _ = stdin.Close() })
+	err = Mutate(func(doc *Document) error {
+		return doc.SetProfileBlock("after", []byte(`{}`))
+	})
+	if err != nil {
+		t.Fatalf("Mutate after release: %v", err)
+	}
+}
+
+func TestMutate_ReportsWhatFollowsTheSave(t *testing.T) {
+	defer ResetBaseDir()
+	SetBaseDir(t.TempDir())
+	prev := saveHook
+	t.Cleanup(func() { saveHook = prev })
+
+	var operations []string
+	afterLocked := true
+	OnSave(func(operation string) (func() error, error) {
+		operations = append(operations, operation)
+		after := func() error {
+			// The follow-up runs once the transaction let go of the lock.
+			if docMutex.TryLock() {
+				afterLocked = false
+				docMutex.Unlock()
+			}
+			return errors.New("push failed")
+		}
+		return after, errors.New("commit failed")
+	})
+
+	err := MutateWithPreSave("set work.agents", nil, func(doc *Document) error {
+		doc.EnsureSchema()
+		return nil
+	})
+	var after *AfterSaveError
+	if !errors.As(err, &after) || !Saved(err) {
+		t.Fatalf("Mutate error = %v, want *AfterSaveError", err)
+	}
+	if got := err.Error(); got != "saved, but commit failed\npush failed" {
+		t.Errorf("error %q, want both failures", got)
+	}
+	if len(operations) != 1 || operations[0] != "set work.agents" {
+		t.Errorf("hook given %q, want the operation", operations)
+	}
+	if afterLocked {
+		t.Error("the follow-up ran under the lock")
+	}
+	if _, err := os.Stat(OmoFile()); err != nil {
+		t.Fatalf("document not written: %v", err)
+	}
+	if Saved(errors.New("load failed")) {
+		t.Error("Saved reports a plain error as saved")
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -18,6 +19,17 @@ const (
 	LegacyOpenagentBasename = "oh-my-openagent.json"
 	// LegacyOpencodeBasename is the oldest config file name, migration-only.
 	LegacyOpencodeBasename = "oh-my-opencode.json"
+	// MigrationMarkerBasename records which legacy files `migrate` imported.
+	MigrationMarkerBasename = ".omo-migrated.json"
+	// JournalBasename is the activation journal kept beside each document.
+	JournalBasename = ".omo-journal.json"
+	// SettingsBasename holds omo-profiler's own settings for a document.
+	SettingsBasename = ".omo-profiler.json"
+	// ActivationBasename records the profile omo-profiler last applied.
+	ActivationBasename = ".omo-active.json"
+	// HistoryDirname is the git repository the document is versioned in
+	// when git versioning is on.
+	HistoryDirname = ".history"
 )
 
 var baseDir string // empty = use os.UserHomeDir()
@@ -37,8 +49,46 @@ func HomeDir() string {
 	return home
 }
 
-// OmoDir returns ~/.omo/ — the user config layer directory.
+// OmoHomeEnv names the environment variable that relocates the user layer,
+// the same as the --home flag.
+const OmoHomeEnv = "OMO_HOME"
+
+var omoDir string // empty = <home>/.omo
+
+// SetOmoDir relocates the user layer — its document, backups, lock and
+// models.json — to dir, e.g. a dotfiles checkout or a CI fixture.
+func SetOmoDir(dir string) { omoDir = dir }
+
+// ResetOmoDir goes back to <home>/.omo.
+func ResetOmoDir() { omoDir = "" }
+
+// ResolveOmoDir picks the user-layer directory from an explicit flag value,
+// falling back to $OMO_HOME. It returns "" when neither is set, meaning the
+// default <home>/.omo. The result is absolute, so later chdirs cannot move it.
+func ResolveOmoDir(flag string) (string, error) {
+	dir := flag
+	if dir == "" {
+		dir = os.Getenv(OmoHomeEnv)
+	}
+	if dir == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		return "", fmt.Errorf("omo home %s is not a directory", abs)
+	}
+	return abs, nil
+}
+
+// OmoDir returns the user config layer directory: ~/.omo/ unless relocated
+// with SetOmoDir.
 func OmoDir() string {
+	if omoDir != "" {
+		return omoDir
+	}
 	return filepath.Join(HomeDir(), OmoDirname)
 }
 
@@ -85,6 +135,36 @@ func LegacyProfilesDir() string {
 	return filepath.Join(LegacyConfigDir(), "profiles")
 }
 
+// JournalFile returns the activation journal of the target layer's document:
+// what each profile apply replaced, for `switch -` and `revert`.
+func JournalFile() string {
+	return filepath.Join(filepath.Dir(DocumentFile()), JournalBasename)
+}
+
+// SettingsFile returns omo-profiler's settings for the target layer's
+// document: per-profile options the upstream schema has no room for.
+func SettingsFile() string {
+	return filepath.Join(filepath.Dir(DocumentFile()), SettingsBasename)
+}
+
+// ActivationFile returns the activation record of the target layer's
+// document: which profile was last applied, and its content at the time.
+func ActivationFile() string {
+	return filepath.Join(filepath.Dir(DocumentFile()), ActivationBasename)
+}
+
+// HistoryDir returns the git repository that versions the target layer's
+// document, beside that document.
+func HistoryDir() string {
+	return filepath.Join(filepath.Dir(DocumentFile()), HistoryDirname)
+}
+
+// MigrationMarkerFile returns the record `migrate` keeps of the legacy files it
+// has imported into the target layer's document, beside that document.
+func MigrationMarkerFile() string {
+	return filepath.Join(filepath.Dir(DocumentFile()), MigrationMarkerBasename)
+}
+
 // EnsureDirs creates the omo config directory if it doesn't exist.
 func EnsureDirs() error {
 	return os.MkdirAll(OmoDir(), 0755)
@@ -239,6 +239,57 @@ func TestResetBaseDir(t *testing.T) {
 	}
 }
 
+func TestSetOmoDir_RelocatesUserLayer(t *testing.T) {
+	defer ResetBaseDir()
+	defer ResetOmoDir()
+	SetBaseDir(t.TempDir())
+
+	dir := filepath.Join(t.TempDir(), "dotfiles", "omo")
+	SetOmoDir(dir)
+
+	for name, got := range map[string]string{
+		"OmoDir":           OmoDir(),
+		"OmoFile":          filepath.Dir(OmoFile()),
+		"ModelsFile":       filepath.Dir(ModelsFile()),
+		"BackupDir":        BackupDir(),
+		"DocumentLockFile": filepath.Dir(DocumentLockFile()),
+	} {
+		if got != dir {
+			t.Errorf("%s resolves under %s, want %s", name, got, dir)
+		}
+	}
+
+	ResetOmoDir()
+	if want := filepath.Join(HomeDir(), OmoDirname); OmoDir() != want {
+		t.Errorf("OmoDir() after ResetOmoDir = %s, want %s", OmoDir(), want)
+	}
+}
+
+func TestResolveOmoDir(t *testing.T) {
+	flagDir, envDir := t.TempDir(), t.TempDir()
+
+	t.Setenv(OmoHomeEnv, "")
+	if got, err := ResolveOmoDir(""); err != nil || got != "" {
+		t.Errorf("ResolveOmoDir with nothing set = %q, %v; want the default", got, err)
+	}
+
+	t.Setenv(OmoHomeEnv, envDir)
+	if got, _ := ResolveOmoDir(""); got != envDir {
+		t.Errorf("ResolveOmoDir(\"\") = %q, want $%s %q", got, OmoHomeEnv, envDir)
+	}
+	if got, _ := ResolveOmoDir(flagDir); got != flagDir {
+		t.Errorf("flag must win over $%s: got %q", OmoHomeEnv, got)
+	}
+
+	file := filepath.Join(flagDir, OmoBasename)
+	if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveOmoDir(file); err == nil {
+		t.Error("expected an error for a home that is a file")
+	}
+}
+
 func TestDefaultSchema(t *testing.T) {
 	want := "https://raw.githubusercontent.com/code-yeongyu/oh-my-openagent/dev/assets/omo.schema.json"
 	if DefaultSchema != want {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -169,17 +170,29 @@ func (r *ModelsRegistry) remove(provider, modelId string) error {
 // each load, edit and save would silently drop one of the changes. The web
 // server handles requests on separate goroutines, which is where this bites.
 //
-// Scope: this guards one process, like the config document's lock.
+// Scope: this guards one process. Other processes are excluded by the advisory
+// lock on the .models.lock sidecar, taken after this mutex.
 var regMutex sync.Mutex
 
+// modelsLockBasename is the sidecar locked around registry transactions.
+const modelsLockBasename = ".models.lock"
+
 // Mutate runs fn against the registry as a serialized transaction: load, apply
-// fn, save. Returning an error aborts before any write.
+// fn, save. Returning an error aborts before any write. When another process
+// holds the registry for longer than config.LockTimeout it fails with
+// *config.BusyError.
 //
 // fn must not call Mutate (the lock is not reentrant) and must not call Save.
 func Mutate(fn func(*ModelsRegistry) error) error {
 	regMutex.Lock()
 	defer regMutex.Unlock()
 
+	lock, err := config.LockFile(filepath.Join(config.OmoDir(), modelsLockBasename), config.LockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	reg, err := Load()
 	if err != nil {
 		return err
@@ -221,6 +234,33 @@ func AddMany(list []RegisteredModel) (added, skipped int, err error) {
 	return added, skipped, nil
 }
 
+// Install registers list in one transaction, as a bundle brings it. A model
+// whose (Provider, ModelID) is taken is kept as registered, or replaced when
+// overwrite is set; an identical one counts as kept either way.
+func Install(list []RegisteredModel, overwrite bool) (added, replaced, kept int, err error) {
+	err = Mutate(func(r *ModelsRegistry) error {
+		added, replaced, kept = 0, 0, 0
+		for _, m := range list {
+			existing := r.Get(m.Provider, m.ModelID)
+			switch {
+			case existing == nil:
+				r.Models = append(r.Models, m)
+				added++
+			case overwrite && *existing != m:
+				*existing = m
+				replaced++
+			default:
+				kept++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return added, replaced, kept, nil
+}
+
 // Update replaces the model identified by (provider, modelId), optionally
 // renaming it. Lookup and write share one transaction.
 func Update(provider, modelId string, m RegisteredModel) error {
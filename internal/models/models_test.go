@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/diogenes/omo-profiler/internal/config"
 )
@@ -381,3 +383,28 @@ func TestDelete_CorrectProviderOnly(t *testing.T) {
 		t.Error("Azure model should still exist after deleting openai model")
 	}
 }
+
+func TestMutate_BusyWhileAnotherHolderHasTheRegistry(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+	prev := config.LockTimeout
+	config.LockTimeout = 50 * time.Millisecond
+	defer func() { config.LockTimeout = prev }()
+
+	held, err := config.LockFile(filepath.Join(config.OmoDir(), modelsLockBasename), time.Second)
+	if err != nil {
+		t.Fatalf("LockFile: %v", err)
+	}
+
+	err = Add(RegisteredModel{DisplayName: "A", ModelID: "a", Provider: "p"})
+	if !errors.Is(err, config.ErrBusy) {
+		t.Fatalf("Add error = %v, want config.ErrBusy", err)
+	}
+
+	if err := held.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := Add(RegisteredModel{DisplayName: "A", ModelID: "a", Provider: "p"}); err != nil {
+		t.Fatalf("Add after release: %v", err)
+	}
+}
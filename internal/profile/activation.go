@@ -0,0 +1,145 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Activation records the profile omo-profiler last made live. Matching the
+// root against stored profiles cannot tell two identical profiles apart, nor a
+// sparse profile from a fuller one that contains it, nor find a stack; the
+// record can.
+type Activation struct {
+	// Profile is the profile last applied; for a stack, its top overlay.
+	Profile string `json:"profile"`
+	// Stack lists the overlays, bottom first, when a stack of several
+	// profiles was applied.
+	Stack []string `json:"stack,omitempty"`
+	// Revision is the content hash of the block as it was applied.
+	Revision string    `json:"revision"`
+	Time     time.Time `json:"time"`
+}
+
+// names returns the overlays the record applied: Stack, or Profile alone.
+func (a *Activation) names() []string {
+	if len(a.Stack) > 0 {
+		return a.Stack
+	}
+	return []string{a.Profile}
+}
+
+// ActiveState classifies how the document root relates to the stored
+// profiles and the activation record.
+type ActiveState string
+
+const (
+	// ActiveExact: the root matches the recorded profile or stack, or
+	// exactly one profile when there is no usable record.
+	ActiveExact ActiveState = "exact"
+	// ActiveDrifted: the root matches no profile and the recorded profile or
+	// stack still exists — it was applied and then edited on either side.
+	ActiveDrifted ActiveState = "drifted"
+	// ActiveAmbiguous: the root matches several profiles and the record names
+	// none of them.
+	ActiveAmbiguous ActiveState = "ambiguous"
+	// ActiveNone: no profile matches and nothing usable was recorded.
+	ActiveNone ActiveState = "none"
+)
+
+// LastActivation returns the activation record of the target document, nil
+// when none was written.
+func LastActivation() (*Activation, error) {
+	data, err := os.ReadFile(config.ActivationFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var a Activation
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", config.ActivationFile(), err)
+	}
+	if a.Profile == "" {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// recordActivation must run under the document lock, after the save that
+// made stack live in doc.
+func recordActivation(doc *config.Document, stack []string) error {
+	revision, err := stackRevision(doc, stack)
+	if err != nil {
+		return err
+	}
+	a := Activation{
+		Profile:  stack[len(stack)-1],
+		Revision: revision,
+		Time:     time.Now().UTC(),
+	}
+	if len(stack) > 1 {
+		a.Stack = stack
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(config.ActivationFile(), append(data, '\n'), 0644)
+}
+
+// clearActivation must run under the document lock.
+func clearActivation() error {
+	err := os.Remove(config.ActivationFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// renameActivation points the record at a renamed profile. The block moves
+// unchanged, so its revision still holds. It must run under the document lock.
+func renameActivation(oldName, newName string) error {
+	a, err := LastActivation()
+	if err != nil || a == nil || !slices.Contains(a.names(), oldName) {
+		return err
+	}
+	if a.Profile == oldName {
+		a.Profile = newName
+	}
+	for i, name := range a.Stack {
+		if name == oldName {
+			a.Stack[i] = newName
+		}
+	}
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(config.ActivationFile(), append(data, '\n'), 0644)
+}
+
+// stackRevision hashes the canonical form of the block stack combines into,
+// so reformatting the document does not change it and editing a parent or an
+// overlay does.
+func stackRevision(doc *config.Document, stack []string) (string, error) {
+	in, err := newInheritance(doc)
+	if err != nil {
+		return "", err
+	}
+	block, err := in.stack(stack)
+	if err != nil {
+		return "", err
+	}
+	canon, err := canonicalJSON(block)
+	if err != nil {
+		return "", fmt.Errorf("parse profile %q: %w", StackLabel(stack), err)
+	}
+	return config.Revision(canon), nil
+}
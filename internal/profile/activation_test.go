@@ -0,0 +1,119 @@
+package profile
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestGetActive_RecordDisambiguatesIdenticalProfiles(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry":true}`)
+	seedProfile(t, "b", `{"telemetry":true}`)
+
+	if _, err := Apply("b"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	active, err := GetActive()
+	if err != nil {
+		t.Fatalf("GetActive: %v", err)
+	}
+	if active.State != ActiveExact || active.ProfileName != "b" {
+		t.Errorf("State = %q, ProfileName = %q; want exact b", active.State, active.ProfileName)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(active.Candidates, want) {
+		t.Errorf("Candidates = %v, want %v", active.Candidates, want)
+	}
+
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := ActiveName(doc); err != nil || name != "b" {
+		t.Errorf("ActiveName = %q, %v; want b", name, err)
+	}
+
+	if err := Rename("b", "c"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	active, err = GetActive()
+	if err != nil {
+		t.Fatalf("GetActive after rename: %v", err)
+	}
+	if active.ProfileName != "c" {
+		t.Errorf("ProfileName after rename = %q, want c", active.ProfileName)
+	}
+}
+
+func TestGetActive_AmbiguousWithoutRecord(t *testing.T) {
+	setupTestEnv(t)
+	seedProfileBlock(t, "sparse", json.RawMessage(`{"[opencode]":{"telemetry":true}}`))
+	seedProfileBlock(t, "full", json.RawMessage(`{"[opencode]":{"telemetry":true},"hooks":[]}`))
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true}`))
+	doc.SetRaw("hooks", json.RawMessage(`[]`))
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := GetActive()
+	if err != nil {
+		t.Fatalf("GetActive: %v", err)
+	}
+	if active.State != ActiveAmbiguous || active.ProfileName != "" || active.Modified {
+		t.Errorf("State = %q, ProfileName = %q, Modified = %v; want ambiguous", active.State, active.ProfileName, active.Modified)
+	}
+	if want := []string{"full", "sparse"}; !reflect.DeepEqual(active.Candidates, want) {
+		t.Errorf("Candidates = %v, want %v", active.Candidates, want)
+	}
+}
+
+func TestGetActive_DriftedFromApplied(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry":false}`)
+	if _, err := Apply("dev"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true}`))
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+	active, err := GetActive()
+	if err != nil {
+		t.Fatalf("GetActive: %v", err)
+	}
+	if active.State != ActiveDrifted || active.AppliedName != "dev" || active.ProfileChanged || !active.Modified {
+		t.Errorf("got State = %q, AppliedName = %q, ProfileChanged = %v, Modified = %v; want drifted dev with unchanged profile",
+			active.State, active.AppliedName, active.ProfileChanged, active.Modified)
+	}
+
+	seedProfile(t, "dev", `{"telemetry":null}`)
+	active, err = GetActive()
+	if err != nil {
+		t.Fatalf("GetActive: %v", err)
+	}
+	if active.State != ActiveDrifted || !active.ProfileChanged {
+		t.Errorf("State = %q, ProfileChanged = %v; want drifted with a changed profile", active.State, active.ProfileChanged)
+	}
+
+	if _, err := Revert(); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	active, err = GetActive()
+	if err != nil {
+		t.Fatalf("GetActive after revert: %v", err)
+	}
+	if active.AppliedName != "" || active.State != ActiveNone {
+		t.Errorf("after revert AppliedName = %q, State = %q; want no record", active.AppliedName, active.State)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
 
 	"github.com/diogenes/omo-profiler/internal/backup"
 	"github.com/diogenes/omo-profiler/internal/config"
@@ -15,129 +18,360 @@ const SnapshotBaseName = "base"
 
 // Applied reports the outcome of Apply.
 type Applied struct {
-	// Name is the profile that was applied.
+	// Name is the profile that was applied; for a stack, its StackLabel.
 	Name string
+	// Stack lists the overlays when a stack of several profiles was applied.
+	Stack []string
 	// Snapshot names the profile that captured the previous root configuration,
 	// empty when the root already matched a profile and nothing had to be saved.
 	Snapshot string
 }
 
 // Apply makes a profile live by copying every key it declares over the matching
-// document root key. Keys the profile does not declare are left untouched.
+// document root key. Keys the profile does not declare are left untouched. A
+// profile that extends another is applied resolved, see SetExtends.
 //
 // Substitution is verbatim: the profile block is the configuration, not an
 // override merged onto the root. When the current root matches no profile it is
 // first saved as a new profile, so an apply never destroys a configuration that
 // exists nowhere else.
+//
+// Every apply that changes the live profile is recorded in the activation
+// journal, which SwitchBack and Revert read.
+//
+// A profile whose settings ask for it is applied strictly, see ApplyOptions.
+// Several profiles are applied as ordered overlays with ApplyStack.
 func Apply(name string) (Applied, error) {
+	return ApplyWith(name, ApplyOptions{})
+}
+
+// ApplyOptions adjust an apply.
+type ApplyOptions struct {
+	// Strict makes the root exactly the profile block plus the settings' kept
+	// keys: root keys the profile does not declare are removed, so no harness
+	// block of the previous profile stays live. What is removed is snapshotted
+	// first. When false the profile's own Strict setting decides.
+	Strict bool
+}
+
+// ApplyWith is Apply with options.
+func ApplyWith(name string, opts ApplyOptions) (Applied, error) {
+	return applyJournaled(opts, func([]JournalEntry) ([]string, error) { return []string{name}, nil })
+}
+
+// applyJournaled applies the stack pick chooses from the journal, and records
+// the apply, in one transaction: the journal entry is written under the same
+// lock, after the document save it describes.
+func applyJournaled(opts ApplyOptions, pick func([]JournalEntry) ([]string, error)) (Applied, error) {
 	var result Applied
-	err := config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
-		block, ok, err := doc.ProfileBlock(name)
+	err := config.WithDocumentLock(func() error {
+		journal, err := readJournal()
 		if err != nil {
 			return err
 		}
-		if !ok {
-			return &NotFoundError{Name: name}
+		stack, err := pick(journal)
+		if err != nil {
+			return err
 		}
-
-		fields := map[string]json.RawMessage{}
-		if err := json.Unmarshal(block, &fields); err != nil {
-			return fmt.Errorf("parse profile %q: %w", name, err)
+		mode, err := resolveApplyMode(stack, opts)
+		if err != nil {
+			return err
 		}
-
-		current, err := ActiveName(doc)
+		doc, err := config.LoadDocument()
 		if err != nil {
 			return err
 		}
+		entry, err := applyInto(doc, stack, mode)
+		if err != nil {
+			return err
+		}
+		operation := "switch " + StackLabel(stack)
+		snapshot, err := backup.SnapshotOmo(operation)
+		if err != nil {
+			return err
+		}
+		if snapshot != "" {
+			entry.Backup = filepath.Base(snapshot)
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		result = Applied{Name: entry.Profile, Stack: entry.Stack, Snapshot: entry.Snapshot}
+		if err := recordActivation(doc, stack); err != nil {
+			return err
+		}
+		if slices.Equal(entry.previous(), stack) && len(entry.Removed) == 0 {
+			return nil // already live: nothing to go back to
+		}
+		return writeJournal(append(journal, entry))
+	})
+	if !config.Saved(err) {
+		return Applied{}, err
+	}
+	return result, err
+}
+
+// applyMode is ApplyOptions resolved against the settings.
+type applyMode struct {
+	strict bool
+	// keep holds the root keys a strict apply never removes.
+	keep map[string]bool
+	// allowUnresolved writes references that do not resolve as they are
+	// instead of failing; only a preview, which saves nothing, sets it.
+	allowUnresolved bool
+}
+
+// resolveApplyMode makes a stack strict when any of its overlays is.
+func resolveApplyMode(stack []string, opts ApplyOptions) (applyMode, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return applyMode{}, err
+	}
+	mode := applyMode{strict: opts.Strict, keep: map[string]bool{}}
+	for _, name := range stack {
+		mode.strict = mode.strict || settings.Profiles[name].Strict
+	}
+	for _, key := range settings.KeptKeys() {
+		mode.keep[key] = true
+	}
+	return mode, nil
+}
 
-		// When the root matches no profile, snapshot the root keys the profile
-		// declares and that are present and non-empty, so they are never destroyed.
-		if current == "" {
-			snapshot := map[string]json.RawMessage{}
-			for key := range fields {
-				if root, ok := doc.Raw(key); ok && len(bytes.TrimSpace(root)) > 0 {
-					snapshot[key] = root
-				}
+// applyInto substitutes the block stack combines into into doc's root and
+// returns the journal entry describing what it replaced.
+func applyInto(doc *config.Document, stack []string, mode applyMode) (JournalEntry, error) {
+	in, err := newInheritance(doc)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	block, err := in.stack(stack)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(block, &fields); err != nil {
+		return JournalEntry{}, fmt.Errorf("parse profile %q: %w", StackLabel(stack), err)
+	}
+
+	// References are resolved here, as the block is written to the root,
+	// and nowhere else; see References.
+	values := make(map[string]json.RawMessage, len(fields))
+	var unresolved []Reference
+	for key, value := range fields {
+		resolved, refs, err := resolveReferences(value, key)
+		if err != nil {
+			return JournalEntry{}, fmt.Errorf("parse profile %q: %w", StackLabel(stack), err)
+		}
+		values[key] = resolved
+		unresolved = append(unresolved, unresolvedOf(refs)...)
+	}
+	if len(unresolved) > 0 && !mode.allowUnresolved {
+		sort.SliceStable(unresolved, func(i, j int) bool { return unresolved[i].Path < unresolved[j].Path })
+		return JournalEntry{}, &UnresolvedReferencesError{Refs: unresolved}
+	}
+
+	current, err := liveStack(doc, in)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	entry := newJournalEntry(doc, stack, current, fields)
+
+	// A strict apply drops every undeclared root key that is not kept. The
+	// journal keeps their values with the replaced ones, so Revert restores
+	// them. Keys the live profile declares are safe in that profile; any
+	// other dropped key may exist nowhere else.
+	var unsaved []string
+	if mode.strict {
+		var live map[string]json.RawMessage
+		if len(current) > 0 {
+			liveBlock, err := in.stack(current)
+			if err != nil {
+				return JournalEntry{}, err
+			}
+			if err := json.Unmarshal(liveBlock, &live); err != nil {
+				return JournalEntry{}, fmt.Errorf("parse profile %q: %w", StackLabel(current), err)
+			}
+		}
+		for _, key := range doc.Keys() {
+			if _, declared := fields[key]; declared || mode.keep[key] {
+				continue
 			}
-			if len(snapshot) > 0 {
-				snapshotName := SnapshotBaseName
-				for i := 1; doc.HasProfile(snapshotName); i++ {
-					snapshotName = fmt.Sprintf("%s-%d", SnapshotBaseName, i)
-				}
-				marshalled, err := json.Marshal(snapshot)
-				if err != nil {
-					return err
-				}
-				if err := doc.SetProfileBlock(snapshotName, marshalled); err != nil {
-					return err
-				}
-				result.Snapshot = snapshotName
+			entry.Removed = append(entry.Removed, key)
+			root, _ := doc.Raw(key)
+			entry.Replaced[key] = root
+			if _, saved := live[key]; !saved {
+				unsaved = append(unsaved, key)
 			}
 		}
+	}
 
-		for key, value := range fields {
-			doc.SetRaw(key, value)
+	// When the root matches no profile, snapshot the root keys the profile
+	// declares and that are present and non-empty, so they are never
+	// destroyed. A strict apply that drops a key no profile holds snapshots
+	// the whole unkept root.
+	candidates := fields
+	if mode.strict {
+		candidates = map[string]json.RawMessage{}
+		for _, key := range doc.Keys() {
+			if !mode.keep[key] {
+				candidates[key] = nil
+			}
+		}
+	}
+	if len(current) == 0 || nonEmptyKeys(doc, unsaved) {
+		snapshot := map[string]json.RawMessage{}
+		for key := range candidates {
+			if root, ok := doc.Raw(key); ok && len(bytes.TrimSpace(root)) > 0 {
+				snapshot[key] = root
+			}
+		}
+		if len(snapshot) > 0 {
+			snapshotName := SnapshotBaseName
+			for i := 1; doc.HasProfile(snapshotName); i++ {
+				snapshotName = fmt.Sprintf("%s-%d", SnapshotBaseName, i)
+			}
+			marshalled, err := json.Marshal(snapshot)
+			if err != nil {
+				return JournalEntry{}, err
+			}
+			if err := doc.SetProfileBlock(snapshotName, marshalled); err != nil {
+				return JournalEntry{}, err
+			}
+			entry.Snapshot = snapshotName
 		}
+	}
 
-		doc.EnsureSchema()
-		return nil
-	})
-	if err != nil {
-		return Applied{}, err
+	for _, key := range entry.Removed {
+		doc.DeleteRaw(key)
 	}
-	result.Name = name
-	return result, nil
+	for key, value := range values {
+		doc.SetRaw(key, value)
+	}
+
+	doc.EnsureSchema()
+	return entry, nil
 }
 
-// ActiveName returns the profile whose every declared key equals the
-// corresponding document root key, or "" when no profile matches. Names are
-// checked in sorted order, so two identical profiles resolve deterministically
-// to the first.
+// nonEmptyKeys reports whether any of keys holds a non-empty root value.
+func nonEmptyKeys(doc *config.Document, keys []string) bool {
+	for _, key := range keys {
+		if root, ok := doc.Raw(key); ok && len(bytes.TrimSpace(root)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveName returns the profile live in doc: the recorded activation when
+// its profile still matches the root, else the first matching profile in
+// sorted order, or "" when none matches. A profile matches when every key it
+// declares equals the corresponding document root key.
 func ActiveName(doc *config.Document) (string, error) {
-	names, err := doc.ProfileNames()
+	candidates, err := MatchingProfiles(doc)
+	if err != nil || len(candidates) == 0 {
+		return "", err
+	}
+	record, err := LastActivation()
 	if err != nil {
 		return "", err
 	}
+	if record != nil && len(record.Stack) == 0 && slices.Contains(candidates, record.Profile) {
+		return record.Profile, nil
+	}
+	return candidates[0], nil
+}
+
+// liveStack returns the overlays live in doc: the recorded stack while the
+// root still matches it, else ActiveName as a stack of one, nil when no
+// profile matches.
+func liveStack(doc *config.Document, in *inheritance) ([]string, error) {
+	record, err := LastActivation()
+	if err != nil {
+		return nil, err
+	}
+	if record != nil && len(record.Stack) > 0 && stackExists(doc, record.Stack) {
+		block, err := in.stack(record.Stack)
+		if err != nil {
+			return nil, err
+		}
+		match, err := blockMatches(doc, StackLabel(record.Stack), block)
+		if err != nil || match {
+			return record.Stack, err
+		}
+	}
+	name, err := ActiveName(doc)
+	if err != nil || name == "" {
+		return nil, err
+	}
+	return []string{name}, nil
+}
+
+// MatchingProfiles returns, sorted, every non-empty profile whose declared
+// keys all equal the corresponding document root keys. A profile that extends
+// another is compared resolved.
+func MatchingProfiles(doc *config.Document) ([]string, error) {
+	names, err := doc.ProfileNames()
+	if err != nil {
+		return nil, err
+	}
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
 	for _, name := range names {
-		block, ok, err := doc.ProfileBlock(name)
+		block, ok, err := in.block(name)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		if !ok {
 			continue
 		}
-		fields := map[string]json.RawMessage{}
-		if err := json.Unmarshal(block, &fields); err != nil {
-			return "", fmt.Errorf("parse profile %q: %w", name, err)
+		match, err := blockMatches(doc, name, block)
+		if err != nil {
+			return nil, err
 		}
-		if len(fields) == 0 {
-			continue
+		if match {
+			matches = append(matches, name)
 		}
-		match := true
-		for key, value := range fields {
-			root, ok := doc.Raw(key)
-			if !ok {
-				match = false
-				break
-			}
-			canonValue, err := canonicalJSON(value)
-			if err != nil {
-				return "", fmt.Errorf("canonicalize profile %q key %q: %w", name, key, err)
-			}
-			canonRoot, err := canonicalJSON(root)
-			if err != nil {
-				return "", fmt.Errorf("canonicalize root key %q: %w", key, err)
-			}
-			if !bytes.Equal(canonValue, canonRoot) {
-				match = false
-				break
-			}
+	}
+	return matches, nil
+}
+
+// blockMatches reports whether block declares at least one key and every key
+// it declares equals the corresponding document root key, references
+// resolved. label names the block in errors.
+func blockMatches(doc *config.Document, label string, block json.RawMessage) (bool, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(block, &fields); err != nil {
+		return false, fmt.Errorf("parse profile %q: %w", label, err)
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+	for key, value := range fields {
+		root, ok := doc.Raw(key)
+		if !ok {
+			return false, nil
 		}
-		if match {
-			return name, nil
+		value, _, err := resolveReferences(value, key)
+		if err != nil {
+			return false, fmt.Errorf("parse profile %q key %q: %w", label, key, err)
+		}
+		canonValue, err := canonicalJSON(value)
+		if err != nil {
+			return false, fmt.Errorf("canonicalize profile %q key %q: %w", label, key, err)
+		}
+		canonRoot, err := canonicalJSON(root)
+		if err != nil {
+			return false, fmt.Errorf("canonicalize root key %q: %w", key, err)
+		}
+		if !bytes.Equal(canonValue, canonRoot) {
+			return false, nil
 		}
 	}
-	return "", nil
+	return true, nil
 }
 
 // canonicalJSON renders raw in a form where equal values compare equal:
@@ -164,32 +398,57 @@ func canonicalJSON(raw json.RawMessage) ([]byte, error) {
 type ActiveConfig struct {
 	// Exists reports whether an omo document is present on disk.
 	Exists bool
+	// Layer and Path identify the document that was inspected — the target
+	// layer, not the merged view (see config.LoadEffective).
+	Layer config.Layer
+	Path  string
 	// Config is the root `[opencode]` block — after substitution the root *is*
 	// the effective configuration, so nothing is merged.
 	Config config.Config
-	// ProfileName is the profile matching the root, empty when none does.
+	// State says how ProfileName was resolved.
+	State ActiveState
+	// ProfileName is the profile live at the root: set for ActiveExact only,
+	// and empty when the live configuration is a stack.
 	ProfileName string
+	// Candidates lists every profile matching the root, sorted. For
+	// ActiveAmbiguous these are the profiles the root cannot be told apart
+	// from; for ActiveExact any beyond ProfileName are identical or subsets.
+	Candidates []string
+	// AppliedName is the profile last applied according to the activation
+	// record, empty when there is none, it no longer exists, or a stack was
+	// applied.
+	AppliedName string
+	// Stack lists, bottom first, the overlays of the stack last applied
+	// according to the activation record, when all of them still exist. With
+	// ActiveExact the root matches the stack; with ActiveDrifted it left it.
+	Stack []string
+	// ProfileChanged is true when the block of AppliedName or Stack was
+	// edited after it was applied; for ActiveDrifted it tells an edited
+	// profile from an edited root.
+	ProfileChanged bool
 	// Modified is true when a root `[opencode]` block exists but matches no
 	// profile — a hand-edited or never-saved configuration.
 	Modified bool
 }
 
-// GetActive resolves the effective configuration from the document.
+// GetActive resolves the effective configuration from the target layer's
+// document.
 func GetActive() (*ActiveConfig, error) {
-	doc, err := config.LoadDocument()
+	layer := config.TargetLayer()
+	doc, err := config.LoadDocumentFrom(config.LayerFile(layer))
 	if err != nil {
 		return nil, err
 	}
 
 	result := &ActiveConfig{
 		Exists: doc.Exists,
+		Layer:  layer,
+		Path:   doc.Path,
 	}
 
-	profileName, err := ActiveName(doc)
-	if err != nil {
+	if err := resolveActive(doc, result); err != nil {
 		return nil, err
 	}
-	result.ProfileName = profileName
 
 	if raw, ok := doc.Raw(config.OpenCodeKey); ok && len(bytes.TrimSpace(raw)) > 0 {
 		var cfg config.Config
@@ -197,8 +456,73 @@ func GetActive() (*ActiveConfig, error) {
 			return nil, fmt.Errorf("parse %s block: %w", config.OpenCodeKey, err)
 		}
 		result.Config = cfg
-		result.Modified = profileName == ""
+		result.Modified = len(result.Candidates) == 0 && !(result.State == ActiveExact && len(result.Stack) > 0)
 	}
 
 	return result, nil
 }
+
+// resolveActive fills the State, ProfileName, Candidates, AppliedName, Stack
+// and ProfileChanged of result from the root and the activation record.
+func resolveActive(doc *config.Document, result *ActiveConfig) error {
+	candidates, err := MatchingProfiles(doc)
+	if err != nil {
+		return err
+	}
+	result.Candidates = candidates
+
+	record, err := LastActivation()
+	if err != nil {
+		return err
+	}
+	if record != nil && stackExists(doc, record.names()) {
+		applied := record.names()
+		revision, err := stackRevision(doc, applied)
+		if err != nil {
+			return err
+		}
+		result.ProfileChanged = revision != record.Revision
+		if len(applied) > 1 {
+			result.Stack = applied
+		} else {
+			result.AppliedName = applied[0]
+		}
+	}
+
+	// A recorded stack that still matches wins over single profiles that
+	// happen to match too, as a recorded profile does.
+	if len(result.Stack) > 0 {
+		in, err := newInheritance(doc)
+		if err != nil {
+			return err
+		}
+		block, err := in.stack(result.Stack)
+		if err != nil {
+			return err
+		}
+		match, err := blockMatches(doc, StackLabel(result.Stack), block)
+		if err != nil {
+			return err
+		}
+		if match {
+			result.State = ActiveExact
+			return nil
+		}
+	}
+
+	switch {
+	case result.AppliedName != "" && slices.Contains(candidates, result.AppliedName):
+		result.State = ActiveExact
+		result.ProfileName = result.AppliedName
+	case len(candidates) == 1:
+		result.State = ActiveExact
+		result.ProfileName = candidates[0]
+	case len(candidates) > 1:
+		result.State = ActiveAmbiguous
+	case result.AppliedName != "" || len(result.Stack) > 0:
+		result.State = ActiveDrifted
+	default:
+		result.State = ActiveNone
+	}
+	return nil
+}
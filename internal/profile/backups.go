@@ -0,0 +1,117 @@
+package profile
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Backups are pruned after every document save by the retention in the
+// settings. A backup the activation journal names is what Revert and the
+// history fall back on, so it is protected while its entry lasts, as are the
+// backups the user pins.
+
+func init() {
+	config.OnSave(func(operation string) (func() error, error) {
+		// Best effort: the save succeeded, and a backup that was not pruned
+		// now is pruned by the next save or by `backup prune`.
+		_, _ = pruneBackups(nil, false)
+		return commitVersion(operation)
+	})
+}
+
+// ProtectedBackups returns the names of the backups pruning keeps whatever
+// the retention says: the pinned ones and those the activation journal
+// names.
+func ProtectedBackups() (map[string]bool, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	journal, err := readJournal()
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]bool{}
+	for _, name := range settings.PinnedBackups {
+		protected[name] = true
+	}
+	for _, entry := range journal {
+		if entry.Backup != "" {
+			protected[entry.Backup] = true
+		}
+	}
+	return protected, nil
+}
+
+// PruneBackups removes the backups retention does not keep, sparing the
+// protected ones, and returns them; nil retention is the settings'. With
+// dryRun it only returns what it would remove.
+func PruneBackups(retention *backup.Retention, dryRun bool) ([]backup.BackupInfo, error) {
+	var removed []backup.BackupInfo
+	err := config.WithDocumentLock(func() error {
+		var err error
+		removed, err = pruneBackups(retention, dryRun)
+		return err
+	})
+	return removed, err
+}
+
+// pruneBackups is PruneBackups for callers holding the document lock.
+func pruneBackups(retention *backup.Retention, dryRun bool) ([]backup.BackupInfo, error) {
+	if retention == nil {
+		settings, err := LoadSettings()
+		if err != nil {
+			return nil, err
+		}
+		r := settings.BackupRetention()
+		retention = &r
+	}
+	if retention.Unlimited() {
+		return nil, nil
+	}
+	protected, err := ProtectedBackups()
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		backups, err := backup.List()
+		if err != nil {
+			return nil, err
+		}
+		return retention.Expired(backups, protected), nil
+	}
+	return backup.Apply(*retention, protected)
+}
+
+// SetBackupRetention replaces the retention of the document's backups; nil
+// restores backup.DefaultRetention.
+func SetBackupRetention(retention *backup.Retention) error {
+	return config.WithDocumentLock(func() error {
+		return editSettings(func(s *Settings) bool {
+			s.Backups = retention
+			return true
+		})
+	})
+}
+
+// PinBackup protects the backup named name from pruning, or lifts that.
+func PinBackup(name string, pinned bool) error {
+	return config.WithDocumentLock(func() error {
+		return editSettings(func(s *Settings) bool {
+			i := slices.Index(s.PinnedBackups, name)
+			switch {
+			case pinned && i < 0:
+				s.PinnedBackups = append(s.PinnedBackups, name)
+				sort.Strings(s.PinnedBackups)
+			case !pinned && i >= 0:
+				s.PinnedBackups = slices.Delete(s.PinnedBackups, i, i+1)
+			default:
+				return false
+			}
+			return true
+		})
+	})
+}
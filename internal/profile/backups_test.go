@@ -0,0 +1,80 @@
+package profile
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Every save prunes the backups by the retention, sparing the one the switch
+// history relies on and the pinned ones.
+func TestBackupRetention_PrunesAfterEachSaveAndProtects(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry":true}`)
+	if err := Create("b", config.Config{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := SetBackupRetention(&backup.Retention{KeepLast: 2}); err != nil {
+		t.Fatalf("SetBackupRetention: %v", err)
+	}
+	if _, err := Apply("a"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	journal, err := Journal()
+	if err != nil || len(journal) != 1 || journal[0].Backup == "" {
+		t.Fatalf("Journal = %v, %v; want one entry naming its backup", journal, err)
+	}
+	switched := journal[0].Backup
+
+	backups, err := backup.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	pinned := backups[len(backups)-1].Name
+	if pinned == switched {
+		t.Fatalf("oldest backup %s is the switch's, want Create's", pinned)
+	}
+	if err := PinBackup(pinned, true); err != nil {
+		t.Fatalf("PinBackup: %v", err)
+	}
+
+	for i := range 5 {
+		if err := Create(fmt.Sprintf("p%d", i), config.Config{}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	backups, err = backup.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	kept := map[string]bool{}
+	for _, b := range backups {
+		kept[b.Name] = true
+	}
+	if len(backups) != 4 || !kept[switched] || !kept[pinned] {
+		t.Errorf("kept %v; want the 2 newest, the switch's %s and the pinned %s", kept, switched, pinned)
+	}
+
+	// Unpinned, and with an empty retention, nothing goes.
+	if err := PinBackup(pinned, false); err != nil {
+		t.Fatalf("PinBackup: %v", err)
+	}
+	if err := SetBackupRetention(&backup.Retention{}); err != nil {
+		t.Fatalf("SetBackupRetention: %v", err)
+	}
+	if removed, err := PruneBackups(nil, false); err != nil || len(removed) != 0 {
+		t.Errorf("PruneBackups with no limits = %v, %v; want nothing removed", removed, err)
+	}
+	would, err := PruneBackups(&backup.Retention{KeepLast: 1}, true)
+	if err != nil {
+		t.Fatalf("PruneBackups dry run: %v", err)
+	}
+	if len(would) != 2 {
+		t.Errorf("dry run would remove %d backups, want 2 (all but the newest and the switch's)", len(would))
+	}
+	if after, _ := backup.List(); len(after) != 4 {
+		t.Errorf("dry run removed backups: %d left, want 4", len(after))
+	}
+}
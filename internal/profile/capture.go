@@ -0,0 +1,280 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// CaptureOptions adjust Capture.
+type CaptureOptions struct {
+	// Fields limits the capture to these `[opencode]` field paths; the rest of
+	// an existing profile is left as it is and no other block is touched. nil
+	// captures every root harness block whole.
+	Fields *FieldSelection
+	// Force allows overwriting an existing profile.
+	Force bool
+	// DryRun computes the result without writing.
+	DryRun bool
+	// Validate, when set, checks the captured `[opencode]` block before it is
+	// written.
+	Validate ValidateFunc
+}
+
+// CaptureResult describes a capture. Before is the profile block as it was,
+// nil for a new profile; After is the block the capture writes.
+type CaptureResult struct {
+	Name    string          `json:"name"`
+	Existed bool            `json:"existed"`
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after"`
+	// Changed is false when the profile already holds the captured
+	// configuration; nothing is written then.
+	Changed bool `json:"changed"`
+	// Written reports whether the document was saved.
+	Written bool `json:"written"`
+}
+
+// ErrNothingToCapture means the root holds no harness block to save.
+var ErrNothingToCapture = errors.New("the document root holds no configuration to capture")
+
+// CaptureOverwriteError is returned when Capture would replace an existing
+// profile without CaptureOptions.Force. Result carries the diff to show.
+type CaptureOverwriteError struct{ Result *CaptureResult }
+
+func (e *CaptureOverwriteError) Error() string {
+	return fmt.Sprintf("profile %q already exists; use force to overwrite it", e.Result.Name)
+}
+
+// CaptureTarget returns the profile Capture saves into when no name is given:
+// the one last applied, which a hand-edited root most likely started from. A
+// stack has no single profile to capture into.
+func CaptureTarget() (string, error) {
+	journal, err := readJournal()
+	if err != nil {
+		return "", err
+	}
+	if len(journal) == 0 {
+		return "", errors.New("no profile has been applied yet; name the profile to capture into")
+	}
+	last := journal[len(journal)-1]
+	if len(last.Stack) > 0 {
+		return "", fmt.Errorf("the last switch applied the stack %s; name the profile to capture into", last.Profile)
+	}
+	return last.Profile, nil
+}
+
+// Capture saves the live root configuration into profile name — the reverse
+// of Apply. Every root key a profile can declare is copied; `$schema`,
+// `profiles` and upstream's bookkeeping stay behind. A profile that extends
+// another keeps only what differs from its parent, and a value the profile
+// holds as a reference stays a reference while it resolves to what the root
+// has. An existing profile is only replaced with opts.Force; otherwise
+// *CaptureOverwriteError reports the diff. The write is a backed-up
+// transaction.
+func Capture(name string, opts CaptureOptions) (*CaptureResult, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	var result *CaptureResult
+	err := config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+		result, err = captureInto(doc, name, opts)
+		if err != nil {
+			return err
+		}
+		if result.Existed && result.Changed && !opts.Force {
+			return &CaptureOverwriteError{Result: result}
+		}
+		if opts.DryRun || !result.Changed {
+			return nil
+		}
+		operation := "capture " + name
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		result.Written = true
+		// When the root now matches the profile, record it as applied so an
+		// identical profile elsewhere does not make it ambiguous.
+		if matches, err := MatchingProfiles(doc); err != nil {
+			return err
+		} else if slices.Contains(matches, name) {
+			return recordActivation(doc, []string{name})
+		}
+		return nil
+	})
+	if !config.Saved(err) {
+		return nil, err
+	}
+	return result, err
+}
+
+func captureInto(doc *config.Document, name string, opts CaptureOptions) (*CaptureResult, error) {
+	result := &CaptureResult{Name: name}
+	block := map[string]json.RawMessage{}
+	if existing, ok, err := doc.ProfileBlock(name); err != nil {
+		return nil, err
+	} else if ok {
+		result.Existed = true
+		result.Before = existing
+		if opts.Fields != nil {
+			if err := json.Unmarshal(existing, &block); err != nil {
+				return nil, fmt.Errorf("parse profile %q: %w", name, err)
+			}
+		}
+	}
+
+	if opts.Fields != nil {
+		root, ok := doc.Raw(config.OpenCodeKey)
+		if !ok {
+			return nil, ErrNothingToCapture
+		}
+		openCode := block[config.OpenCodeKey]
+		if len(bytes.TrimSpace(openCode)) == 0 {
+			openCode = json.RawMessage("{}")
+		}
+		for _, path := range opts.Fields.SelectedPaths() {
+			segs, err := splitFieldPath(path, true)
+			if err != nil {
+				return nil, err
+			}
+			var values []FieldValue
+			if err := collectField(root, segs, "", &values); err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				openCode, err = setFieldIn(openCode, strings.Split(v.Path, "."), v.Value, "")
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		block[config.OpenCodeKey] = openCode
+	} else {
+		for _, key := range doc.Keys() {
+			if uncapturedKeys[key] {
+				continue
+			}
+			value, _ := doc.Raw(key)
+			if len(bytes.TrimSpace(value)) > 0 {
+				block[key] = value
+			}
+		}
+		if len(block) == 0 {
+			return nil, ErrNothingToCapture
+		}
+	}
+
+	if openCode, ok := block[config.OpenCodeKey]; ok {
+		stripped, err := withoutSchema(openCode)
+		if err != nil {
+			return nil, fmt.Errorf("parse root %s: %w", config.OpenCodeKey, err)
+		}
+		block[config.OpenCodeKey] = stripped
+	}
+
+	after, err := marshalSortedJSONObject(block)
+	if err != nil {
+		return nil, err
+	}
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, err
+	}
+	// Values the profile holds as references were resolved by the apply;
+	// store the references again, not the secrets.
+	if template, ok, err := in.block(name); err != nil {
+		return nil, err
+	} else if ok {
+		if after, err = keepReferences(template, after); err != nil {
+			return nil, err
+		}
+	}
+	// A child stores only what differs from its parent.
+	if parent := in.settings.Profiles[name].Extends; parent != "" && opts.Fields == nil {
+		inherited, ok, err := in.block(parent)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &MissingParentError{Name: name, Parent: parent}
+		}
+		own, changed, err := overridesOf(inherited, after)
+		if err != nil {
+			return nil, err
+		}
+		after = own
+		if !changed {
+			after = json.RawMessage("{}")
+		}
+	}
+	if opts.Validate != nil {
+		if _, ok := block[config.OpenCodeKey]; ok {
+			openCode, err := blockOpenCode(after)
+			if err != nil {
+				return nil, err
+			}
+			resolved, err := in.withOwnOpenCode(name, openCode)
+			if err != nil {
+				return nil, err
+			}
+			problems, err := opts.Validate(resolved)
+			if err != nil {
+				return nil, err
+			}
+			if len(problems) > 0 {
+				return nil, &FieldValidationError{Name: name, Path: config.OpenCodeKey, Problems: problems}
+			}
+		}
+	}
+	result.After = after
+	result.Changed = true
+	if result.Existed {
+		same, err := sameJSON(result.Before, after)
+		if err != nil {
+			return nil, err
+		}
+		result.Changed = !same
+	}
+	if result.Changed {
+		if err := doc.SetProfileBlock(name, after); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// uncapturedKeys are the root keys no profile block may hold.
+var uncapturedKeys = func() map[string]bool {
+	keys := map[string]bool{}
+	for _, key := range append(append([]string{}, requiredKeepKeys...), DefaultKeepKeys...) {
+		keys[key] = true
+	}
+	return keys
+}()
+
+// withoutSchema drops a `$schema` key from an object: it belongs to the
+// document root, never to a harness block.
+func withoutSchema(raw json.RawMessage) (json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		return raw, err
+	}
+	if _, ok := obj[config.SchemaKey]; !ok {
+		return raw, nil
+	}
+	delete(obj, config.SchemaKey)
+	return marshalSortedJSONObject(obj)
+}
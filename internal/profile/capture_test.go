@@ -0,0 +1,113 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestCapture_NewProfileFromRoot(t *testing.T) {
+	setupTestEnv(t)
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.EnsureSchema()
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"$schema":"x","telemetry":true}`))
+		doc.SetRaw(config.CodexKey, json.RawMessage(`{"model":"o3"}`))
+		doc.SetRaw("_migrations", json.RawMessage(`["m1"]`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Capture("tuned", CaptureOptions{})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if result.Existed || !result.Written {
+		t.Errorf("result = %+v, want a written new profile", result)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, ok, err := doc.ProfileBlock("tuned")
+	if err != nil || !ok {
+		t.Fatalf("ProfileBlock = %v, %v", ok, err)
+	}
+	if got, _ := canonicalJSON(block); string(got) != `{"[codex]":{"model":"o3"},"[opencode]":{"telemetry":true}}` {
+		t.Errorf("captured block = %s", got)
+	}
+	if name, _ := ActiveName(doc); name != "tuned" {
+		t.Errorf("ActiveName = %q, want the captured profile", name)
+	}
+}
+
+func TestCapture_RefusesOverwriteWithoutForce(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry":false}`)
+	if _, err := Apply("dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true}`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := CaptureTarget()
+	if err != nil || target != "dev" {
+		t.Fatalf("CaptureTarget = %q, %v; want dev", target, err)
+	}
+	_, err = Capture(target, CaptureOptions{})
+	var overwrite *CaptureOverwriteError
+	if !errors.As(err, &overwrite) {
+		t.Fatalf("Capture without force = %v, want *CaptureOverwriteError", err)
+	}
+	if got, _ := canonicalJSON(overwrite.Result.Before); string(got) != `{"[opencode]":{"telemetry":false}}` {
+		t.Errorf("Before = %s", got)
+	}
+
+	result, err := Capture(target, CaptureOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Capture(force): %v", err)
+	}
+	if !result.Written {
+		t.Error("forced capture did not write")
+	}
+	again, err := Capture(target, CaptureOptions{})
+	if err != nil {
+		t.Fatalf("second Capture: %v", err)
+	}
+	if again.Changed || again.Written {
+		t.Errorf("capture of an unchanged root = %+v, want a no-op", again)
+	}
+}
+
+func TestCapture_FieldsOnlyTouchSelectedPaths(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry":false,"agents":{"oracle":{"model":"a","temperature":0.1}}}`)
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true,"agents":{"oracle":{"model":"b","temperature":0.9}}}`))
+		doc.SetRaw(config.CodexKey, json.RawMessage(`{"model":"o3"}`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := NewBlankSelection()
+	fields.SetSelected("agents.*.model", true)
+	if _, err := Capture("dev", CaptureOptions{Fields: fields, Force: true}); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _, _ := doc.ProfileBlock("dev")
+	want := `{"[opencode]":{"agents":{"oracle":{"model":"b","temperature":0.1}},"telemetry":false}}`
+	if got, _ := canonicalJSON(block); string(got) != want {
+		t.Errorf("block = %s, want %s", got, want)
+	}
+}
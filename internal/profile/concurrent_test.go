@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"reflect"
 	"sync"
 	"testing"
@@ -370,7 +369,7 @@ func TestEachWriteLeavesItsOwnPreImage(t *testing.T) {
 	// The pre-images must be the distinct states 1..n, not n copies of one.
 	sizes := map[int]bool{}
 	for _, b := range backups {
-		data, err := os.ReadFile(b.Path)
+		data, err := backup.ReadFile(b.Path)
 		if err != nil {
 			t.Fatalf("read %s: %v", b.Path, err)
 		}
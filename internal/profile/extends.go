@@ -0,0 +1,401 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// A profile may extend a parent profile: its stored block then holds only the
+// overrides, and everything that reads the profile as a configuration — Apply,
+// active detection, validation, diff, export — sees the parent's resolved
+// block with the overrides deep-merged over it. Objects merge key by key at
+// every depth; any other value, arrays included, replaces the parent's.
+//
+// The parent is a setting (ProfileSettings.Extends), not a block key: the omo
+// schema allows nothing but harness keys in a profile block.
+
+// ExtendsCycleError reports a chain of parents that leads back to itself.
+type ExtendsCycleError struct{ Chain []string }
+
+func (e *ExtendsCycleError) Error() string {
+	return fmt.Sprintf("profile inheritance cycle: %s", strings.Join(e.Chain, " → "))
+}
+
+// MissingParentError reports a profile extending a profile that does not
+// exist.
+type MissingParentError struct{ Name, Parent string }
+
+func (e *MissingParentError) Error() string {
+	return fmt.Sprintf("profile %q extends missing profile %q", e.Name, e.Parent)
+}
+
+// ParentInUseError is returned when deleting a profile other profiles extend.
+type ParentInUseError struct {
+	Name     string
+	Children []string
+}
+
+func (e *ParentInUseError) Error() string {
+	return fmt.Sprintf("profile %q is extended by %s", e.Name, strings.Join(e.Children, ", "))
+}
+
+// Ancestors returns the chain of parents of profile name, nearest first.
+func Ancestors(name string) ([]string, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	return settings.ancestors(name)
+}
+
+// SetExtends makes profile name extend parent; "" removes the parent. Both
+// must exist, and the parent may not descend from name. The stored block is
+// left as it is: fields equal to the parent's simply stay as overrides.
+func SetExtends(name, parent string) error {
+	return config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+		if !doc.HasProfile(name) {
+			return &NotFoundError{Name: name}
+		}
+		if parent != "" {
+			if !doc.HasProfile(parent) {
+				return &NotFoundError{Name: parent}
+			}
+			settings, err := LoadSettings()
+			if err != nil {
+				return err
+			}
+			chain, err := settings.ancestors(parent)
+			if err != nil {
+				return err
+			}
+			chain = append([]string{name, parent}, chain...)
+			if i := slices.Index(chain[1:], name); i >= 0 {
+				return &ExtendsCycleError{Chain: chain[:i+2]}
+			}
+		}
+		return editSettings(func(s *Settings) bool {
+			ps := s.Profiles[name]
+			if ps.Extends == parent {
+				return false
+			}
+			ps.Extends = parent
+			setProfileSettings(s, name, ps)
+			return true
+		})
+	})
+}
+
+// CreateExtending creates profile name as an empty child of parent, in one
+// transaction with the settings write.
+func CreateExtending(name, parent string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	return config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+		if doc.HasProfile(name) {
+			return &ExistsError{Name: name}
+		}
+		if !doc.HasProfile(parent) {
+			return &NotFoundError{Name: parent}
+		}
+		if err := WriteOpenCodeBlockInto(doc, name, nil); err != nil {
+			return err
+		}
+		doc.EnsureSchema()
+		operation := "create " + name
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		return editSettings(func(s *Settings) bool {
+			ps := s.Profiles[name]
+			ps.Extends = parent
+			setProfileSettings(s, name, ps)
+			return true
+		})
+	})
+}
+
+// ancestors walks the Extends chain of name, nearest parent first.
+func (s Settings) ancestors(name string) ([]string, error) {
+	var chain []string
+	for current := name; ; {
+		parent := s.Profiles[current].Extends
+		if parent == "" {
+			return chain, nil
+		}
+		if parent == name || slices.Contains(chain, parent) {
+			return nil, &ExtendsCycleError{Chain: append(append([]string{name}, chain...), parent)}
+		}
+		chain = append(chain, parent)
+		current = parent
+	}
+}
+
+// children returns the profiles extending name directly, sorted.
+func (s Settings) children(name string) []string {
+	var out []string
+	for child, ps := range s.Profiles {
+		if ps.Extends == name {
+			out = append(out, child)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// inheritance resolves profile blocks of one document against one read of
+// the settings.
+type inheritance struct {
+	doc      *config.Document
+	settings Settings
+}
+
+func newInheritance(doc *config.Document) (*inheritance, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	return &inheritance{doc: doc, settings: settings}, nil
+}
+
+// block returns profile name's resolved block. ok is false when the profile
+// does not exist.
+func (in *inheritance) block(name string) (block json.RawMessage, ok bool, err error) {
+	own, ok, err := in.doc.ProfileBlock(name)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	chain, err := in.settings.ancestors(name)
+	if err != nil {
+		return nil, true, err
+	}
+	if len(chain) == 0 {
+		return own, true, nil
+	}
+	// Merge from the farthest ancestor down to name.
+	lineage := append([]string{name}, chain...)
+	var resolved json.RawMessage
+	for i := len(lineage) - 1; i >= 0; i-- {
+		layer, ok, err := in.doc.ProfileBlock(lineage[i])
+		if err != nil {
+			return nil, true, err
+		}
+		if !ok {
+			return nil, true, &MissingParentError{Name: lineage[i-1], Parent: lineage[i]}
+		}
+		if resolved == nil {
+			resolved = layer
+			continue
+		}
+		if resolved, err = mergeJSON(resolved, layer); err != nil {
+			return nil, true, fmt.Errorf("resolve profile %q: %w", lineage[i], err)
+		}
+	}
+	return resolved, true, nil
+}
+
+// withOwnOpenCode returns profile name's resolved `[opencode]` block as it
+// would be with openCode as the profile's own `[opencode]` block.
+func (in *inheritance) withOwnOpenCode(name string, openCode json.RawMessage) (json.RawMessage, error) {
+	return in.withOwnHarness(name, config.OpenCodeKey, openCode)
+}
+
+// withOwnHarness is withOwnOpenCode for harness block key.
+func (in *inheritance) withOwnHarness(name, key string, payload json.RawMessage) (json.RawMessage, error) {
+	parent := in.settings.Profiles[name].Extends
+	if parent == "" {
+		return payload, nil
+	}
+	block, ok, err := in.block(parent)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &MissingParentError{Name: name, Parent: parent}
+	}
+	inherited, err := blockHarness(block, key)
+	if err != nil {
+		return nil, fmt.Errorf("parse profile %q: %w", parent, err)
+	}
+	return mergeJSON(inherited, payload)
+}
+
+// ResolvedBlock returns profile name's block with its parents merged in.
+func ResolvedBlock(name string) (json.RawMessage, error) {
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	block, ok, err := resolvedBlock(doc, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NotFoundError{Name: name}
+	}
+	return block, nil
+}
+
+// OwnBlock returns profile name's block as stored: for a profile that
+// extends another, only its overrides.
+func OwnBlock(name string) (json.RawMessage, error) {
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	block, ok, err := doc.ProfileBlock(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NotFoundError{Name: name}
+	}
+	return block, nil
+}
+
+// ResolveOpenCode returns the `[opencode]` block profile name would resolve
+// to if openCode were its own — what a save of openCode has to validate.
+func ResolveOpenCode(name string, openCode json.RawMessage) (json.RawMessage, error) {
+	return ResolveHarness(name, config.OpenCodeKey, openCode)
+}
+
+// ResolveHarness is ResolveOpenCode for harness block key.
+func ResolveHarness(name, key string, payload json.RawMessage) (json.RawMessage, error) {
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, err
+	}
+	return in.withOwnHarness(name, key, payload)
+}
+
+// resolvedBlock is profile name's block with its parents merged in.
+func resolvedBlock(doc *config.Document, name string) (json.RawMessage, bool, error) {
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return in.block(name)
+}
+
+// blockOpenCode returns the `[opencode]` member of a profile block, `{}` when
+// absent.
+func blockOpenCode(block json.RawMessage) (json.RawMessage, error) {
+	return blockHarness(block, config.OpenCodeKey)
+}
+
+// blockHarness returns harness block key of a profile block, `{}` when absent.
+func blockHarness(block json.RawMessage, key string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(block, &fields); err != nil {
+		return nil, err
+	}
+	raw := fields[key]
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	return raw, nil
+}
+
+// mergeJSON deep-merges over onto base: two objects merge key by key, and
+// anything else is replaced by over.
+func mergeJSON(base, over json.RawMessage) (json.RawMessage, error) {
+	return mergeJSONWith(base, over, "", nil)
+}
+
+// mergeJSONWith is mergeJSON at block path path, asking merge first, when
+// set, to combine each pair of values; a pair it returns ok false for merges
+// as in mergeJSON. A stack unions some arrays this way (see unionAt).
+func mergeJSONWith(base, over json.RawMessage, path string, merge func(path string, base, over json.RawMessage) (json.RawMessage, bool, error)) (json.RawMessage, error) {
+	if merge != nil {
+		if merged, ok, err := merge(path, base, over); err != nil || ok {
+			return merged, err
+		}
+	}
+	baseObj, baseIsObj := jsonObject(base)
+	overObj, overIsObj := jsonObject(over)
+	if !baseIsObj || !overIsObj {
+		return over, nil
+	}
+	for key, value := range overObj {
+		if prev, ok := baseObj[key]; ok {
+			merged, err := mergeJSONWith(prev, value, joinFieldPath(path, key), merge)
+			if err != nil {
+				return nil, err
+			}
+			baseObj[key] = merged
+		} else {
+			baseObj[key] = value
+		}
+	}
+	return marshalSortedJSONObject(baseObj)
+}
+
+// overridesOf returns the parts of full that differ from base: object members
+// equal to base's are dropped at every depth. A member base has and full lacks
+// cannot be expressed as an override and is ignored.
+func overridesOf(base, full json.RawMessage) (json.RawMessage, bool, error) {
+	baseObj, baseIsObj := jsonObject(base)
+	fullObj, fullIsObj := jsonObject(full)
+	if !baseIsObj || !fullIsObj {
+		same, err := sameJSON(base, full)
+		if err != nil || same {
+			return nil, false, err
+		}
+		return full, true, nil
+	}
+	out := map[string]json.RawMessage{}
+	for key, value := range fullObj {
+		prev, ok := baseObj[key]
+		if !ok {
+			out[key] = value
+			continue
+		}
+		diff, changed, err := overridesOf(prev, value)
+		if err != nil {
+			return nil, false, err
+		}
+		if changed {
+			out[key] = diff
+		}
+	}
+	if len(out) == 0 {
+		return nil, false, nil
+	}
+	encoded, err := marshalSortedJSONObject(out)
+	return encoded, true, err
+}
+
+// jsonObject decodes raw when it is a JSON object.
+func jsonObject(raw json.RawMessage) (map[string]json.RawMessage, bool) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &obj); err != nil {
+		return nil, false
+	}
+	return obj, true
+}
@@ -0,0 +1,227 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func seedBaseAndChild(t *testing.T) {
+	t.Helper()
+	seedProfileBlock(t, "base", json.RawMessage(`{"[opencode]":{"telemetry":true,"agents":{"oracle":{"model":"a"},"build":{"model":"b"}}},"hooks":[1]}`))
+	seedProfileBlock(t, "child", json.RawMessage(`{"[opencode]":{"agents":{"build":{"model":"c"}}}}`))
+	if err := SetExtends("child", "base"); err != nil {
+		t.Fatalf("SetExtends: %v", err)
+	}
+}
+
+func mustCanonical(t *testing.T, raw json.RawMessage) []byte {
+	t.Helper()
+	canon, err := canonicalJSON(raw)
+	if err != nil {
+		t.Fatalf("canonicalJSON(%s): %v", raw, err)
+	}
+	return canon
+}
+
+func TestExtends_ApplyExportAndFieldsResolve(t *testing.T) {
+	setupTestEnv(t)
+	seedBaseAndChild(t)
+
+	if _, err := Apply("child"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := doc.Raw(config.OpenCodeKey)
+	want := `{"agents":{"build":{"model":"c"},"oracle":{"model":"a"}},"telemetry":true}`
+	if got, _ := canonicalJSON(root); string(got) != want {
+		t.Errorf("root %s = %s, want %s", config.OpenCodeKey, got, want)
+	}
+	if hooks, _ := doc.Raw("hooks"); string(mustCanonical(t, hooks)) != "[1]" {
+		t.Errorf("root hooks = %s, want inherited [1]", hooks)
+	}
+	active, err := GetActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.State != ActiveExact || active.ProfileName != "child" {
+		t.Errorf("active = %q (%s), want exact child", active.ProfileName, active.State)
+	}
+
+	exported, err := ExportOpenCode("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := canonicalJSON(exported); string(got) != want {
+		t.Errorf("ExportOpenCode = %s, want resolved %s", got, want)
+	}
+	own, err := ExportOpenCodeFrom(doc, "child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := canonicalJSON(own); string(got) != `{"agents":{"build":{"model":"c"}}}` {
+		t.Errorf("ExportOpenCodeFrom = %s, want own fields only", got)
+	}
+
+	values, err := GetField("child", "agents.*.model")
+	if err != nil || len(values) != 2 {
+		t.Errorf("GetField = %v, %v; want two resolved models", values, err)
+	}
+	values, err = GetOwnField("child", "agents.*.model")
+	if err != nil || len(values) != 1 || values[0].Path != "agents.build.model" {
+		t.Errorf("GetOwnField = %v, %v; want agents.build.model only", values, err)
+	}
+}
+
+func TestSetExtends_RejectsCyclesAndMissingParents(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{}`)
+	seedProfile(t, "b", `{}`)
+	seedProfile(t, "c", `{}`)
+
+	if err := SetExtends("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetExtends("b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	var cycle *ExtendsCycleError
+	if err := SetExtends("c", "a"); !errors.As(err, &cycle) {
+		t.Fatalf("SetExtends(c, a) = %v, want *ExtendsCycleError", err)
+	}
+	if want := []string{"c", "a", "b", "c"}; !reflect.DeepEqual(cycle.Chain, want) {
+		t.Errorf("Chain = %v, want %v", cycle.Chain, want)
+	}
+	if err := SetExtends("a", "a"); !errors.As(err, &cycle) {
+		t.Errorf("SetExtends(a, a) = %v, want *ExtendsCycleError", err)
+	}
+	var notFound *NotFoundError
+	if err := SetExtends("a", "missing"); !errors.As(err, &notFound) {
+		t.Errorf("SetExtends(a, missing) = %v, want *NotFoundError", err)
+	}
+
+	chain, err := Ancestors("a")
+	if err != nil || !reflect.DeepEqual(chain, []string{"b", "c"}) {
+		t.Errorf("Ancestors(a) = %v, %v; want [b c]", chain, err)
+	}
+}
+
+func TestExtends_RenameFollowsAndDeleteRefuses(t *testing.T) {
+	setupTestEnv(t)
+	seedBaseAndChild(t)
+
+	if err := Rename("base", "shared"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if chain, err := Ancestors("child"); err != nil || !reflect.DeepEqual(chain, []string{"shared"}) {
+		t.Errorf("Ancestors(child) = %v, %v; want [shared]", chain, err)
+	}
+
+	var inUse *ParentInUseError
+	if err := Delete("shared"); !errors.As(err, &inUse) {
+		t.Fatalf("Delete(shared) = %v, want *ParentInUseError", err)
+	}
+	if !Exists("shared") {
+		t.Error("refused delete removed the parent")
+	}
+
+	if err := CreateFrom("clone", "child"); err != nil {
+		t.Fatal(err)
+	}
+	if chain, _ := Ancestors("clone"); !reflect.DeepEqual(chain, []string{"shared"}) {
+		t.Errorf("Ancestors(clone) = %v, want the clone to extend shared", chain)
+	}
+}
+
+func TestCapture_ChildStoresOnlyOverrides(t *testing.T) {
+	setupTestEnv(t)
+	seedBaseAndChild(t)
+	if _, err := Apply("child"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":false,"agents":{"oracle":{"model":"a"},"build":{"model":"c"}}}`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Capture("child", CaptureOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	want := `{"[opencode]":{"agents":{"build":{"model":"c"}},"telemetry":false}}`
+	if got, _ := canonicalJSON(result.After); string(got) != want {
+		t.Errorf("captured block = %s, want %s", got, want)
+	}
+}
+
+func TestHarness_WriteExportAndInherit(t *testing.T) {
+	setupTestEnv(t)
+	seedBaseAndChild(t)
+
+	if _, err := UpdateHarnessBlockIfRevision("base", "[senpi]", []byte(`{"categories":{"quick":{"model":"a"},"deep":{"model":"b"}}}`), ""); err != nil {
+		t.Fatalf("UpdateHarnessBlockIfRevision base: %v", err)
+	}
+	if _, err := UpdateHarnessBlockIfRevision("child", "[senpi]", []byte(`{"categories":{"deep":{"model":"c"}}}`), ""); err != nil {
+		t.Fatalf("UpdateHarnessBlockIfRevision child: %v", err)
+	}
+
+	resolved, err := ExportHarness("child", "[senpi]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"categories":{"deep":{"model":"c"},"quick":{"model":"a"}}}`
+	if got := mustCanonical(t, resolved); string(got) != want {
+		t.Errorf("ExportHarness = %s, want %s", got, want)
+	}
+	opencode, err := ExportOpenCode("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCanonical(t, opencode); string(got) != `{"agents":{"build":{"model":"c"},"oracle":{"model":"a"}},"telemetry":true}` {
+		t.Errorf("ExportOpenCode = %s, want [opencode] untouched by the [senpi] write", got)
+	}
+
+	// {} removes a harness block other than [opencode].
+	if _, err := UpdateHarnessBlockIfRevision("child", "[senpi]", []byte(`{}`), ""); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _, err := doc.ProfileBlock("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := jsonObject(block); !ok || string(mustCanonical(t, block)) != `{"[opencode]":{"agents":{"build":{"model":"c"}}}}` {
+		t.Errorf("child block = %s, want [senpi] removed", block)
+	}
+}
+
+func TestCreateAvailableHarness_AddsEmptyOpenCode(t *testing.T) {
+	setupTestEnv(t)
+
+	name, collided, err := CreateAvailableHarness("codexonly", "[codex]", []byte(`{"categories":{"quick":{"model":"m"}}}`))
+	if err != nil || name != "codexonly" || collided {
+		t.Fatalf("CreateAvailableHarness = %q, %v, %v", name, collided, err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _, err := doc.ProfileBlock("codexonly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCanonical(t, block); string(got) != `{"[codex]":{"categories":{"quick":{"model":"m"}}},"[opencode]":{}}` {
+		t.Errorf("block = %s, want [codex] beside an empty [opencode]", got)
+	}
+}
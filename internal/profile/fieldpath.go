@@ -0,0 +1,270 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// FieldValue is one value found at a field path of a profile's `[opencode]`
+// block. Path is concrete: wildcards are replaced by the keys they matched.
+type FieldValue struct {
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// FieldValidationError reports that a field write would leave the profile's
+// `[opencode]` block failing validation. Nothing was written.
+type FieldValidationError struct {
+	Name     string
+	Path     string
+	Problems []string
+}
+
+func (e *FieldValidationError) Error() string {
+	return fmt.Sprintf("profile %q: %s: %s", e.Name, e.Path, strings.Join(e.Problems, "; "))
+}
+
+// ErrFieldNotSet is returned by UnsetField when there is nothing at the path.
+var ErrFieldNotSet = errors.New("field is not set")
+
+// splitFieldPath splits a dotted field path, the syntax of FieldSelection
+// (`agents.oracle.model`, `categories.*.temperature`).
+func splitFieldPath(path string, allowWildcard bool) ([]string, error) {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs {
+		if seg == "" {
+			return nil, fmt.Errorf("invalid field path %q", path)
+		}
+		if seg == "*" && !allowWildcard {
+			return nil, fmt.Errorf("field path %q: wildcards are only supported when reading", path)
+		}
+	}
+	return segs, nil
+}
+
+// GetField returns the values at path in the profile's resolved `[opencode]`
+// block, in path order: a profile that extends another reports inherited
+// values too. `*` matches every key of an object, so `agents.*.model` lists
+// the model of each agent that sets one. A path that matches nothing returns
+// an empty slice.
+func GetField(name, path string) ([]FieldValue, error) {
+	return getField(name, path, false)
+}
+
+// GetOwnField is GetField reading only the fields the profile's block stores.
+func GetOwnField(name, path string) ([]FieldValue, error) {
+	return getField(name, path, true)
+}
+
+func getField(name, path string, own bool) ([]FieldValue, error) {
+	segs, err := splitFieldPath(path, true)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	openCode, err := openCodeOf(doc, name)
+	if err != nil {
+		return nil, err
+	}
+	if !own {
+		in, err := newInheritance(doc)
+		if err != nil {
+			return nil, err
+		}
+		if openCode, err = in.withOwnOpenCode(name, openCode); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []FieldValue
+	if err := collectField(openCode, segs, "", &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func collectField(raw json.RawMessage, segs []string, prefix string, out *[]FieldValue) error {
+	if len(segs) == 0 {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return err
+		}
+		*out = append(*out, FieldValue{Path: prefix, Value: compact.Bytes()})
+		return nil
+	}
+
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil {
+		return nil // not an object: nothing below it
+	}
+	keys := []string{segs[0]}
+	if segs[0] == "*" {
+		keys = make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	for _, key := range keys {
+		child, ok := obj[key]
+		if !ok {
+			continue
+		}
+		if err := collectField(child, segs[1:], joinFieldPath(prefix, key), out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetField writes value at path in the profile's `[opencode]` block, creating
+// intermediate objects as needed. The new block, resolved against the
+// profile's parents, must pass validate; the write is a backed-up transaction
+// like every other profile save.
+func SetField(name, path string, value json.RawMessage, validate ValidateFunc) error {
+	segs, err := splitFieldPath(path, false)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(value) {
+		return fmt.Errorf("%s: invalid JSON value", path)
+	}
+	return editField(name, path, validate, func(openCode json.RawMessage) (json.RawMessage, error) {
+		return setFieldIn(openCode, segs, value, "")
+	})
+}
+
+// UnsetField removes path from the profile's `[opencode]` block. It fails
+// with ErrFieldNotSet when the block does not store it; an inherited value
+// cannot be unset, only overridden.
+func UnsetField(name, path string, validate ValidateFunc) error {
+	segs, err := splitFieldPath(path, false)
+	if err != nil {
+		return err
+	}
+	return editField(name, path, validate, func(openCode json.RawMessage) (json.RawMessage, error) {
+		return unsetFieldIn(openCode, segs)
+	})
+}
+
+func editField(name, path string, validate ValidateFunc, edit func(json.RawMessage) (json.RawMessage, error)) error {
+	return config.MutateWithPreSave("set "+name+"."+path, backup.Before, func(doc *config.Document) error {
+		openCode, err := openCodeOf(doc, name)
+		if err != nil {
+			return err
+		}
+		updated, err := edit(openCode)
+		if err != nil {
+			return err
+		}
+		if validate != nil {
+			in, err := newInheritance(doc)
+			if err != nil {
+				return err
+			}
+			resolved, err := in.withOwnOpenCode(name, updated)
+			if err != nil {
+				return err
+			}
+			problems, err := validate(resolved)
+			if err != nil {
+				return err
+			}
+			if len(problems) > 0 {
+				return &FieldValidationError{Name: name, Path: path, Problems: problems}
+			}
+		}
+		return WriteOpenCodeBlockInto(doc, name, updated)
+	})
+}
+
+func setFieldIn(raw json.RawMessage, segs []string, value json.RawMessage, prefix string) (json.RawMessage, error) {
+	obj, err := fieldObject(raw, prefix)
+	if err != nil {
+		return nil, err
+	}
+	key := segs[0]
+	if len(segs) == 1 {
+		obj[key] = value
+	} else {
+		child, err := setFieldIn(obj[key], segs[1:], value, joinFieldPath(prefix, key))
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = child
+	}
+	return marshalSortedJSONObject(obj)
+}
+
+func unsetFieldIn(raw json.RawMessage, segs []string) (json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil || obj == nil {
+		return nil, ErrFieldNotSet
+	}
+	key := segs[0]
+	child, ok := obj[key]
+	if !ok {
+		return nil, ErrFieldNotSet
+	}
+	if len(segs) == 1 {
+		delete(obj, key)
+	} else {
+		updated, err := unsetFieldIn(child, segs[1:])
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = updated
+	}
+	return marshalSortedJSONObject(obj)
+}
+
+// fieldObject decodes raw as the object to descend into; absent or null means
+// a new empty one. Anything else cannot hold a nested field.
+func fieldObject(raw json.RawMessage, prefix string) (map[string]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return map[string]json.RawMessage{}, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &obj); err != nil {
+		return nil, fmt.Errorf("%s is not an object", prefix)
+	}
+	return obj, nil
+}
+
+// openCodeOf returns the profile's `[opencode]` payload, `{}` when absent.
+func openCodeOf(doc *config.Document, name string) (json.RawMessage, error) {
+	block, ok, err := doc.ProfileBlock(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NotFoundError{Name: name}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(block, &fields); err != nil {
+		return nil, fmt.Errorf("parse profile %q: %w", name, err)
+	}
+	raw := fields[config.OpenCodeKey]
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return json.RawMessage("{}"), nil
+	}
+	return raw, nil
+}
+
+func joinFieldPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,102 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func fieldValues(t *testing.T, name, path string) map[string]string {
+	t.Helper()
+	values, err := GetField(name, path)
+	if err != nil {
+		t.Fatalf("GetField(%s): %v", path, err)
+	}
+	out := map[string]string{}
+	for _, v := range values {
+		out[v.Path] = string(v.Value)
+	}
+	return out
+}
+
+func TestGetField_Wildcard(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{
+		"agents": {"oracle": {"model": "a/b"}, "build": {"temperature": 0.2}, "plan": {"model": "c/d"}},
+		"disabled_mcps": []
+	}`)
+
+	got := fieldValues(t, "dev", "agents.*.model")
+	if len(got) != 2 || got["agents.oracle.model"] != `"a/b"` || got["agents.plan.model"] != `"c/d"` {
+		t.Fatalf("agents.*.model = %v", got)
+	}
+	if got := fieldValues(t, "dev", "disabled_mcps"); got["disabled_mcps"] != `[]` {
+		t.Fatalf("explicit empty array = %v", got)
+	}
+	if got := fieldValues(t, "dev", "agents.oracle.temperature"); len(got) != 0 {
+		t.Fatalf("unset field returned %v", got)
+	}
+	if _, err := GetField("nope", "agents"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("missing profile: %v", err)
+	}
+}
+
+func TestSetField_CreatesPathAndKeepsSiblings(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"agents": {"oracle": {"model": "a/b"}}, "disabled_mcps": []}`)
+
+	if err := SetField("dev", "agents.oracle.temperature", json.RawMessage(`0.5`), nil); err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+	if err := SetField("dev", "categories.quick.model", json.RawMessage(`"x/y"`), nil); err != nil {
+		t.Fatalf("SetField new object: %v", err)
+	}
+
+	if got := fieldValues(t, "dev", "agents.oracle"); got["agents.oracle"] != `{"model":"a/b","temperature":0.5}` {
+		t.Errorf("agents.oracle = %v", got)
+	}
+	if got := fieldValues(t, "dev", "categories.quick.model"); got["categories.quick.model"] != `"x/y"` {
+		t.Errorf("categories.quick.model = %v", got)
+	}
+	if got := fieldValues(t, "dev", "disabled_mcps"); got["disabled_mcps"] != `[]` {
+		t.Errorf("sibling explicit empty value lost: %v", got)
+	}
+
+	if err := SetField("dev", "agents.oracle.model.x", json.RawMessage(`1`), nil); err == nil {
+		t.Error("expected an error descending into a string")
+	}
+	if err := SetField("dev", "agents.*.model", json.RawMessage(`"m"`), nil); err == nil {
+		t.Error("expected wildcard writes to be refused")
+	}
+}
+
+func TestSetField_ValidationFailureWritesNothing(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{}`)
+
+	reject := func([]byte) ([]string, error) { return []string{"temperature: too hot"}, nil }
+	err := SetField("dev", "agents.oracle.temperature", json.RawMessage(`9`), reject)
+	var invalid *FieldValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 {
+		t.Fatalf("SetField = %v, want *FieldValidationError", err)
+	}
+	if got := fieldValues(t, "dev", "agents"); len(got) != 0 {
+		t.Fatalf("rejected write landed: %v", got)
+	}
+}
+
+func TestUnsetField(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"agents": {"oracle": {"model": "a/b", "temperature": 0.5}}}`)
+
+	if err := UnsetField("dev", "agents.oracle.model", nil); err != nil {
+		t.Fatalf("UnsetField: %v", err)
+	}
+	if got := fieldValues(t, "dev", "agents.oracle"); got["agents.oracle"] != `{"temperature":0.5}` {
+		t.Errorf("agents.oracle = %v", got)
+	}
+	if err := UnsetField("dev", "agents.oracle.model", nil); !errors.Is(err, ErrFieldNotSet) {
+		t.Errorf("second unset = %v, want ErrFieldNotSet", err)
+	}
+}
@@ -0,0 +1,305 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// A profile's history is read from the document backups: each holds the whole
+// document as it was before some write, so the profile's block in each of
+// them, oldest first and then in the live document, is a timeline of its
+// states. Consecutive snapshots holding the same block are one version; most
+// writes touch other profiles.
+
+// FieldChangeKind classifies how one field differs between two versions.
+type FieldChangeKind string
+
+const (
+	FieldAdded   FieldChangeKind = "added"
+	FieldRemoved FieldChangeKind = "removed"
+	FieldChanged FieldChangeKind = "changed"
+)
+
+// FieldChange is one field that differs between two versions of a profile
+// block. Path is a dotted block path, e.g. `[opencode].agents.oracle.model`;
+// objects are compared key by key, anything else whole. A profile created or
+// deleted between the versions is one change with an empty Path and no
+// values.
+type FieldChange struct {
+	Path   string          `json:"path"`
+	Kind   FieldChangeKind `json:"kind"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// String renders the change on one line, e.g.
+// `~ [opencode].agents.oracle.model: "a/x" → "a/y"`, with long values cut.
+func (c FieldChange) String() string {
+	switch {
+	case c.Path == "" && c.Kind == FieldAdded:
+		return "+ profile created"
+	case c.Path == "" && c.Kind == FieldRemoved:
+		return "- profile deleted"
+	case c.Kind == FieldAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, shortJSON(c.After))
+	case c.Kind == FieldRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, shortJSON(c.Before))
+	}
+	return fmt.Sprintf("~ %s: %s → %s", c.Path, shortJSON(c.Before), shortJSON(c.After))
+}
+
+// shortJSON renders a value on one line, cut to a length a timeline can show.
+func shortJSON(raw json.RawMessage) string {
+	const maxLen = 60
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, raw); err != nil {
+		compact.Write(raw)
+	}
+	s := []rune(compact.String())
+	if len(s) > maxLen {
+		return string(s[:maxLen-1]) + "…"
+	}
+	return string(s)
+}
+
+// Version is one state of a profile's block.
+type Version struct {
+	// Live marks the state the document holds now.
+	Live bool `json:"live"`
+	// Exists is false for a stretch in which the document held no such
+	// profile; Block is then empty.
+	Exists bool            `json:"exists"`
+	Block  json.RawMessage `json:"block,omitempty"`
+	// Backup is the most recent backup holding this state, which restoring
+	// the version reads; Backups counts the backups holding it, and Since
+	// and Until are the times of the oldest and newest of them. A live
+	// state no backup holds yet has none.
+	Backup  string    `json:"backup,omitempty"`
+	Backups int       `json:"backups"`
+	Since   time.Time `json:"since,omitzero"`
+	Until   time.Time `json:"until,omitzero"`
+	// ReplacedBy is the operation of the write that replaced this state —
+	// the one its newest backup was taken before — and Source the front end
+	// that made it. Both are empty for the live state.
+	ReplacedBy string `json:"replacedBy,omitempty"`
+	Source     string `json:"source,omitempty"`
+	// Changes lists what differs from the previous, older version; empty
+	// for the oldest.
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// History returns the versions of profile name found in the backups and the
+// live document, most recent first. Backups that are not omo documents are
+// skipped.
+func History(name string) ([]Version, error) {
+	backups, err := backup.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	var current string // canonical block of the last version, "" for none
+	add := func(block json.RawMessage, exists bool, b *backup.BackupInfo) error {
+		canonical := ""
+		if exists {
+			c, err := canonicalJSON(block)
+			if err != nil {
+				return err
+			}
+			canonical = string(c)
+		}
+		if len(versions) == 0 || canonical != current {
+			v := Version{Exists: exists}
+			if exists {
+				v.Block = block
+			}
+			if len(versions) > 0 {
+				prev := versions[len(versions)-1]
+				if v.Changes, err = diffVersions(prev, v); err != nil {
+					return err
+				}
+			}
+			versions = append(versions, v)
+			current = canonical
+		}
+		v := &versions[len(versions)-1]
+		if b == nil {
+			v.Live = true
+			v.ReplacedBy, v.Source = "", ""
+			return nil
+		}
+		if v.Backups == 0 {
+			v.Since = b.Timestamp
+		}
+		v.Backups++
+		v.Backup, v.Until = b.Name, b.Timestamp
+		v.ReplacedBy, v.Source = b.Operation, b.Source
+		return nil
+	}
+
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		doc, ok := readBackupDocument(b)
+		if !ok {
+			continue
+		}
+		block, exists, err := doc.ProfileBlock(name)
+		if err != nil {
+			continue
+		}
+		if err := add(block, exists, &b); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	block, exists, err := doc.ProfileBlock(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(block, exists, nil); err != nil {
+		return nil, err
+	}
+
+	// Leading stretches without the profile are before it was created.
+	for len(versions) > 0 && !versions[0].Exists {
+		versions = versions[1:]
+		if len(versions) > 0 {
+			versions[0].Changes = nil
+		}
+	}
+	if len(versions) == 0 {
+		return nil, &NotFoundError{Name: name}
+	}
+
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, nil
+}
+
+// readBackupDocument reads and parses a backup of the omo document; backups
+// of the legacy config files, and anything unreadable, are not.
+func readBackupDocument(b backup.BackupInfo) (*config.Document, bool) {
+	base, _, _ := strings.Cut(b.Name, ".bak.")
+	if base != config.OmoBasename && base != config.OmoBasenameJSONC {
+		return nil, false
+	}
+	data, err := backup.ReadFile(b.Path)
+	if err != nil {
+		return nil, false
+	}
+	doc, err := config.ParseDocument(data)
+	if err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// RestoreVersion makes v, a version History returned for profile name, the
+// profile's block again, leaving every other key of the document as it is.
+// Validating v.Block is the caller's job. The document is backed up first, so
+// the restore is itself a version that can be restored.
+func RestoreVersion(name string, v Version) error {
+	switch {
+	case v.Live:
+		return fmt.Errorf("profile %q is already at that version", name)
+	case !v.Exists:
+		return fmt.Errorf("profile %q did not exist in that version; delete it instead", name)
+	}
+	b, err := backup.Find(v.Backup)
+	if err != nil {
+		return err
+	}
+	return backup.RestoreProfile(b.Path, name)
+}
+
+// diffVersions lists the fields that differ from before to after.
+func diffVersions(before, after Version) ([]FieldChange, error) {
+	switch {
+	case !before.Exists:
+		return []FieldChange{{Kind: FieldAdded}}, nil
+	case !after.Exists:
+		return []FieldChange{{Kind: FieldRemoved}}, nil
+	}
+	b, err := config.DecodeValue(before.Block)
+	if err != nil {
+		return nil, err
+	}
+	a, err := config.DecodeValue(after.Block)
+	if err != nil {
+		return nil, err
+	}
+	var changes []FieldChange
+	if err := diffValues("", b, a, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func diffValues(path string, before, after any, out *[]FieldChange) error {
+	bm, bok := before.(map[string]any)
+	am, aok := after.(map[string]any)
+	if bok && aok {
+		keys := make([]string, 0, len(bm)+len(am))
+		for k := range bm {
+			keys = append(keys, k)
+		}
+		for k := range am {
+			if _, ok := bm[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			bv, inBefore := bm[k]
+			av, inAfter := am[k]
+			switch {
+			case !inBefore:
+				raw, err := config.EncodeValue(av)
+				if err != nil {
+					return err
+				}
+				*out = append(*out, FieldChange{Path: child, Kind: FieldAdded, After: raw})
+			case !inAfter:
+				raw, err := config.EncodeValue(bv)
+				if err != nil {
+					return err
+				}
+				*out = append(*out, FieldChange{Path: child, Kind: FieldRemoved, Before: raw})
+			default:
+				if err := diffValues(child, bv, av, out); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	braw, err := config.EncodeValue(before)
+	if err != nil {
+		return err
+	}
+	araw, err := config.EncodeValue(after)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(braw, araw) {
+		*out = append(*out, FieldChange{Path: path, Kind: FieldChanged, Before: braw, After: araw})
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package profile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Writes to other profiles leave a profile's version as it is; each write to
+// it starts a new one, with the fields it changed, and any version can be
+// restored without touching the rest of the document.
+func TestHistory(t *testing.T) {
+	setupTestEnv(t)
+	if err := CreateWithOpenCodeBlock("work", json.RawMessage(`{"agents":{"oracle":{"model":"a/old"}}}`)); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := SetField("work", "agents.oracle.model", json.RawMessage(`"a/new"`), nil); err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+	if err := Create("other", config.Config{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := SetField("work", "disabled_mcps", json.RawMessage(`["x"]`), nil); err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+	if err := Create("third", config.Config{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	versions, err := History("work")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("got %d versions, want 3: %+v", len(versions), versions)
+	}
+	live, middle, oldest := versions[0], versions[1], versions[2]
+	if !live.Live || live.Backups != 1 || live.ReplacedBy != "" {
+		t.Errorf("live version %+v, want live, held by the backup before creating third", live)
+	}
+	if middle.Backups != 2 || middle.ReplacedBy != "set work.disabled_mcps" {
+		t.Errorf("middle version held by %d backups, replaced by %q; want 2 and the set", middle.Backups, middle.ReplacedBy)
+	}
+	if oldest.Changes != nil || oldest.ReplacedBy != "set work.agents.oracle.model" {
+		t.Errorf("oldest version %+v, want no changes, replaced by the model set", oldest)
+	}
+
+	want := FieldChange{Path: "[opencode].agents.oracle.model", Kind: FieldChanged, Before: json.RawMessage(`"a/old"`), After: json.RawMessage(`"a/new"`)}
+	if len(middle.Changes) != 1 || !equalChange(middle.Changes[0], want) {
+		t.Errorf("middle changes %+v, want %+v", middle.Changes, want)
+	}
+	if len(live.Changes) != 1 || live.Changes[0].Path != "[opencode].disabled_mcps" || live.Changes[0].Kind != FieldAdded {
+		t.Errorf("live changes %+v, want disabled_mcps added", live.Changes)
+	}
+
+	if err := RestoreVersion("work", live); err == nil {
+		t.Error("restoring the live version succeeded")
+	}
+	if err := RestoreVersion("work", oldest); err != nil {
+		t.Fatalf("RestoreVersion: %v", err)
+	}
+	model, err := GetField("work", "agents.oracle.model")
+	if err != nil || len(model) != 1 || string(model[0].Value) != `"a/old"` {
+		t.Errorf("model after restore %v (%v), want a/old", model, err)
+	}
+	if !Exists("third") {
+		t.Error("restoring a version of work dropped another profile")
+	}
+
+	if _, err := History("missing"); err == nil {
+		t.Error("History of a profile that never existed succeeded")
+	}
+}
+
+func equalChange(a, b FieldChange) bool {
+	return a.Path == b.Path && a.Kind == b.Kind && string(a.Before) == string(b.Before) && string(a.After) == string(b.After)
+}
@@ -0,0 +1,210 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// journalLimit caps the activation journal; older entries are dropped.
+const journalLimit = 100
+
+// JournalEntry records one Apply: which profile went live and exactly what it
+// overwrote. The root values are kept verbatim, so Revert restores the
+// previous configuration even when it matched no profile.
+type JournalEntry struct {
+	Time time.Time `json:"time"`
+	// Profile is the profile that was applied; for a stack, its StackLabel.
+	Profile string `json:"profile"`
+	// Stack lists the overlays when a stack of several profiles was applied.
+	Stack []string `json:"stack,omitempty"`
+	// Previous is the profile live before the apply, "" when the root matched
+	// none; for a stack, its StackLabel.
+	Previous string `json:"previous,omitempty"`
+	// PreviousStack lists the overlays when a stack was live before.
+	PreviousStack []string `json:"previousStack,omitempty"`
+	// Snapshot is the profile Apply saved the unmatched root into, if any.
+	Snapshot string `json:"snapshot,omitempty"`
+	// Replaced holds the root value of every key the profile declares that
+	// was present before the apply, and of every key a strict apply removed.
+	Replaced map[string]json.RawMessage `json:"replaced,omitempty"`
+	// Added lists the keys the profile declares that the root did not have.
+	Added []string `json:"added,omitempty"`
+	// Removed lists the keys a strict apply removed; their values are in
+	// Replaced.
+	Removed []string `json:"removed,omitempty"`
+	// Backup names the backup of the document as it was before the apply;
+	// pruning keeps it while the entry is in the journal.
+	Backup string `json:"backup,omitempty"`
+}
+
+// ErrJournalEmpty means no apply has been recorded for the target document.
+var ErrJournalEmpty = errors.New("no profile switch recorded yet")
+
+// NoPreviousProfileError is returned by SwitchBack when the configuration
+// before the last apply matched no profile. Revert still restores it.
+type NoPreviousProfileError struct{ Applied string }
+
+func (e *NoPreviousProfileError) Error() string {
+	return fmt.Sprintf("the configuration before %q matched no profile; use revert to restore it", e.Applied)
+}
+
+func newJournalEntry(doc *config.Document, stack, previous []string, fields map[string]json.RawMessage) JournalEntry {
+	entry := JournalEntry{
+		Time:     time.Now().UTC(),
+		Profile:  StackLabel(stack),
+		Previous: StackLabel(previous),
+		Replaced: map[string]json.RawMessage{},
+	}
+	if len(stack) > 1 {
+		entry.Stack = stack
+	}
+	if len(previous) > 1 {
+		entry.PreviousStack = previous
+	}
+	for key := range fields {
+		if root, ok := doc.Raw(key); ok {
+			entry.Replaced[key] = root
+		} else {
+			entry.Added = append(entry.Added, key)
+		}
+	}
+	sort.Strings(entry.Added)
+	return entry
+}
+
+// previous returns the overlays live before the entry's apply, nil when the
+// root matched none.
+func (e JournalEntry) previous() []string {
+	switch {
+	case len(e.PreviousStack) > 0:
+		return e.PreviousStack
+	case e.Previous != "":
+		return []string{e.Previous}
+	}
+	return nil
+}
+
+// Journal returns the recorded applies of the target document, oldest first.
+func Journal() ([]JournalEntry, error) {
+	return readJournal()
+}
+
+// SwitchBack applies the profile or stack that was live before the last
+// apply — the `switch -` of a shell's `cd -`. Calling it twice toggles
+// between two profiles.
+func SwitchBack() (Applied, error) {
+	return SwitchBackWith(ApplyOptions{})
+}
+
+// SwitchBackWith is SwitchBack with apply options.
+func SwitchBackWith(opts ApplyOptions) (Applied, error) {
+	return applyJournaled(opts, previousIn)
+}
+
+// PreviousStack returns the overlays SwitchBack would apply, one for a
+// single profile.
+func PreviousStack() ([]string, error) {
+	journal, err := readJournal()
+	if err != nil {
+		return nil, err
+	}
+	return previousIn(journal)
+}
+
+func previousIn(journal []JournalEntry) ([]string, error) {
+	if len(journal) == 0 {
+		return nil, ErrJournalEmpty
+	}
+	last := journal[len(journal)-1]
+	previous := last.previous()
+	if len(previous) == 0 {
+		return nil, &NoPreviousProfileError{Applied: last.Profile}
+	}
+	return previous, nil
+}
+
+// Revert undoes the last recorded apply: every root key it replaced gets its
+// previous value back and every key it added is removed. The entry is taken
+// off the journal, so repeated reverts walk further back. Any edits made to
+// those keys since the apply are overwritten; the pre-write backup keeps them.
+func Revert() (JournalEntry, error) {
+	var reverted JournalEntry
+	err := config.WithDocumentLock(func() error {
+		journal, err := readJournal()
+		if err != nil {
+			return err
+		}
+		if len(journal) == 0 {
+			return ErrJournalEmpty
+		}
+		reverted = journal[len(journal)-1]
+
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+		for key, value := range reverted.Replaced {
+			doc.SetRaw(key, value)
+		}
+		for _, key := range reverted.Added {
+			doc.DeleteRaw(key)
+		}
+		operation := "revert"
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		if err := writeJournal(journal[:len(journal)-1]); err != nil {
+			return err
+		}
+		if previous := reverted.previous(); stackExists(doc, previous) {
+			return recordActivation(doc, previous)
+		}
+		return clearActivation()
+	})
+	if !config.Saved(err) {
+		return JournalEntry{}, err
+	}
+	return reverted, err
+}
+
+func readJournal() ([]JournalEntry, error) {
+	data, err := os.ReadFile(config.JournalFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var journal []JournalEntry
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", config.JournalFile(), err)
+	}
+	return journal, nil
+}
+
+// writeJournal must run under the document lock. The journal holds root
+// values, which can include secrets, so it is created owner-only like the
+// document.
+func writeJournal(journal []JournalEntry) error {
+	if len(journal) > journalLimit {
+		journal = journal[len(journal)-journalLimit:]
+	}
+	if journal == nil {
+		journal = []JournalEntry{}
+	}
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(config.JournalFile(), append(data, '\n'), 0600)
+}
@@ -0,0 +1,98 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestRevert_RestoresReplacedAndRemovesAddedKeys(t *testing.T) {
+	setupTestEnv(t)
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true}`))
+	if err := doc.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	seedProfileBlock(t, "senpi", json.RawMessage(`{"[opencode]":{"telemetry":false},"[senpi]":{"mode":"x"}}`))
+
+	if _, err := Apply("senpi"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	journal, err := Journal()
+	if err != nil || len(journal) != 1 {
+		t.Fatalf("Journal = %v, %v; want one entry", journal, err)
+	}
+	if got := journal[0].Added; len(got) != 1 || got[0] != config.SenpiKey {
+		t.Fatalf("Added = %v, want [%s]", got, config.SenpiKey)
+	}
+
+	entry, err := Revert()
+	if err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	if entry.Profile != "senpi" {
+		t.Errorf("reverted %q, want senpi", entry.Profile)
+	}
+	doc, err = config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := doc.Raw(config.OpenCodeKey)
+	if got, _ := canonicalJSON(root); string(got) != `{"telemetry":true}` {
+		t.Errorf("[opencode] = %s, want the pre-apply value", root)
+	}
+	if _, ok := doc.Raw(config.SenpiKey); ok {
+		t.Error("key added by the apply survived the revert")
+	}
+	if _, err := Revert(); !errors.Is(err, ErrJournalEmpty) {
+		t.Errorf("second Revert = %v, want ErrJournalEmpty", err)
+	}
+}
+
+func TestSwitchBack_Toggles(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry":true}`)
+	seedProfile(t, "b", `{"telemetry":false}`)
+
+	if _, err := SwitchBack(); !errors.Is(err, ErrJournalEmpty) {
+		t.Fatalf("SwitchBack on an empty journal = %v", err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, err := Apply(name); err != nil {
+			t.Fatalf("Apply(%s): %v", name, err)
+		}
+	}
+	// Re-applying the live profile records nothing.
+	if _, err := Apply("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"a", "b", "a"} {
+		applied, err := SwitchBack()
+		if err != nil {
+			t.Fatalf("SwitchBack: %v", err)
+		}
+		if applied.Name != want {
+			t.Fatalf("SwitchBack applied %q, want %q", applied.Name, want)
+		}
+	}
+}
+
+func TestSwitchBack_UnmatchedPreviousNeedsRevert(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry":true}`)
+
+	// An empty document matches no profile.
+	if _, err := Apply("a"); err != nil {
+		t.Fatal(err)
+	}
+	var noPrevious *NoPreviousProfileError
+	if _, err := SwitchBack(); !errors.As(err, &noPrevious) || noPrevious.Applied != "a" {
+		t.Fatalf("SwitchBack = %v, want *NoPreviousProfileError for a", err)
+	}
+}
@@ -0,0 +1,263 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// MigrationStatus is the outcome of one legacy file in a migration.
+type MigrationStatus string
+
+const (
+	// MigrationImported: the file became (or, in a dry run, would become) a
+	// profile block.
+	MigrationImported MigrationStatus = "imported"
+	// MigrationSkipped: the marker shows this exact content was migrated before.
+	MigrationSkipped MigrationStatus = "skipped"
+	// MigrationInvalid: the file failed to parse or validate. It is left out of
+	// the marker, so a later run picks it up once fixed.
+	MigrationInvalid MigrationStatus = "invalid"
+)
+
+// MigrationItem reports what happened to one legacy file.
+type MigrationItem struct {
+	Source string          `json:"source"`
+	Status MigrationStatus `json:"status"`
+	// Profile is the profile name the file was imported as. Base is the name
+	// derived from the file; they differ when Base was already taken.
+	Profile string   `json:"profile,omitempty"`
+	Base    string   `json:"base,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// Renamed reports whether the derived name collided with an existing profile.
+func (i MigrationItem) Renamed() bool {
+	return i.Status == MigrationImported && i.Profile != i.Base
+}
+
+// MigrationReport is the result of Migrate. In a dry run nothing was written
+// but every item shows what a real run would do.
+type MigrationReport struct {
+	DryRun bool            `json:"dryRun"`
+	Target string          `json:"target"`
+	Items  []MigrationItem `json:"items"`
+}
+
+// Count returns how many items ended with status.
+func (r *MigrationReport) Count(status MigrationStatus) int {
+	n := 0
+	for _, item := range r.Items {
+		if item.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// migrationMarker is the on-disk record of imported legacy files. Entries are
+// keyed by source path and content revision: a file edited after migrating is
+// imported again, one that is merely still there is not.
+type migrationMarker struct {
+	Migrated []migratedSource `json:"migrated"`
+}
+
+type migratedSource struct {
+	Source   string    `json:"source"`
+	Revision string    `json:"revision"`
+	Profile  string    `json:"profile"`
+	Document string    `json:"document"`
+	Time     time.Time `json:"time"`
+}
+
+func (m *migrationMarker) has(source, revision string) bool {
+	for _, s := range m.Migrated {
+		if s.Source == source && s.Revision == revision {
+			return true
+		}
+	}
+	return false
+}
+
+// LegacySources lists the pre-unification files migrate reads: every
+// profiles/*.json in config.LegacyProfilesDir, sorted, then the legacy flat
+// configs that exist.
+func LegacySources() ([]string, error) {
+	sources, err := filepath.Glob(filepath.Join(config.LegacyProfilesDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sources)
+	for _, name := range []string{config.LegacyOpenagentBasename, config.LegacyOpencodeBasename} {
+		path := filepath.Join(config.LegacyConfigDir(), name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			sources = append(sources, path)
+		}
+	}
+	return sources, nil
+}
+
+// Migrate imports every legacy source into `profiles.<name>` blocks of the
+// target document in a single transaction: one lock, one pre-write backup, one
+// save. Names are derived from file names and resolved like CreateAvailable,
+// so an existing profile is never overwritten.
+//
+// Each file is type-checked and passed to validate, as `import` does; invalid
+// ones are reported and skipped without failing the rest. Imported files are
+// recorded in config.MigrationMarkerFile, which makes re-running a no-op.
+//
+// With dryRun the same plan is computed against the current document and
+// returned without writing anything.
+func Migrate(dryRun bool, validate ValidateFunc) (*MigrationReport, error) {
+	sources, err := LegacySources()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{DryRun: dryRun, Target: config.DocumentFile()}
+	err = config.WithDocumentLock(func() error {
+		marker, err := loadMigrationMarker()
+		if err != nil {
+			return err
+		}
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, source := range sources {
+			item, revision := migrateSource(doc, validate, marker, source)
+			report.Items = append(report.Items, item)
+			if item.Status == MigrationImported {
+				marker.Migrated = append(marker.Migrated, migratedSource{
+					Source:   source,
+					Revision: revision,
+					Profile:  item.Profile,
+					Document: doc.Path,
+					Time:     now,
+				})
+			}
+		}
+
+		if dryRun || report.Count(MigrationImported) == 0 {
+			return nil
+		}
+		doc.EnsureSchema()
+		operation := "migrate"
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		// Written last, still under the lock: a failed save leaves the marker
+		// untouched, so nothing is recorded that did not land.
+		return saveMigrationMarker(marker)
+	})
+	if !config.Saved(err) {
+		return nil, err
+	}
+	return report, err
+}
+
+// migrateSource plans one file into doc and returns its item and content
+// revision.
+func migrateSource(doc *config.Document, validate ValidateFunc, marker *migrationMarker, source string) (MigrationItem, string) {
+	item := MigrationItem{
+		Source: source,
+		Base:   SanitizeName(strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))),
+	}
+	invalid := func(format string, args ...any) (MigrationItem, string) {
+		item.Status = MigrationInvalid
+		item.Errors = append(item.Errors, fmt.Sprintf(format, args...))
+		return item, ""
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return invalid("%v", err)
+	}
+	revision := config.Revision(data)
+	if marker.has(source, revision) {
+		item.Status = MigrationSkipped
+		return item, revision
+	}
+	if item.Base == "" {
+		return invalid("cannot derive a profile name from %q", filepath.Base(source))
+	}
+
+	openCode, err := legacyOpenCode(data)
+	if err != nil {
+		return invalid("invalid JSON: %v", err)
+	}
+	if validate != nil {
+		problems, err := validate(openCode)
+		if err != nil {
+			return invalid("validation failed: %v", err)
+		}
+		if len(problems) > 0 {
+			item.Status = MigrationInvalid
+			item.Errors = problems
+			return item, ""
+		}
+	}
+
+	item.Profile, _ = availableName(doc, item.Base)
+	if err := WriteOpenCodeBlockInto(doc, item.Profile, openCode); err != nil {
+		return invalid("%v", err)
+	}
+	item.Status = MigrationImported
+	return item, revision
+}
+
+// legacyOpenCode type-checks a legacy flat config and returns it as the
+// profile's `[opencode]` payload. Legacy files name their schema in a
+// top-level `$schema`, which belongs to the document, not to a profile, so it
+// is dropped; everything else is kept verbatim.
+func legacyOpenCode(data []byte) (json.RawMessage, error) {
+	if err := json.Unmarshal(data, &config.Config{}); err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if _, ok := obj[config.SchemaKey]; !ok {
+		return json.RawMessage(data), nil
+	}
+	delete(obj, config.SchemaKey)
+	encoded, err := marshalSortedJSONObject(obj)
+	return json.RawMessage(encoded), err
+}
+
+func loadMigrationMarker() (*migrationMarker, error) {
+	marker := &migrationMarker{}
+	data, err := os.ReadFile(config.MigrationMarkerFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return marker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, marker); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", config.MigrationMarkerFile(), err)
+	}
+	return marker, nil
+}
+
+func saveMigrationMarker(marker *migrationMarker) error {
+	data, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(config.MigrationMarkerFile(), append(data, '\n'), 0644)
+}
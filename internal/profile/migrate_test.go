@@ -0,0 +1,159 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/schema"
+)
+
+func writeLegacy(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func seedLegacyLayout(t *testing.T) {
+	t.Helper()
+	writeLegacy(t, filepath.Join(config.LegacyProfilesDir(), "dev.json"), `{"disabled_mcps": []}`)
+	writeLegacy(t, filepath.Join(config.LegacyProfilesDir(), "broken.json"), `{"agents": {"build": {"temperature": "hot"}}}`)
+	writeLegacy(t, filepath.Join(config.LegacyConfigDir(), config.LegacyOpenagentBasename),
+		`{"$schema": "https://example.com/legacy.json", "telemetry": false}`)
+}
+
+// validateForSave is the validation the migrate command wires in.
+func validateForSave(t *testing.T) ValidateFunc {
+	t.Helper()
+	v, err := schema.GetValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(openCode []byte) ([]string, error) {
+		problems, err := v.ValidateJSONForSave(openCode)
+		msgs := make([]string, len(problems))
+		for i, ve := range problems {
+			msgs[i] = ve.Error()
+		}
+		return msgs, err
+	}
+}
+
+func itemFor(t *testing.T, report *MigrationReport, base string) MigrationItem {
+	t.Helper()
+	for _, item := range report.Items {
+		if item.Base == base {
+			return item
+		}
+	}
+	t.Fatalf("no report item for %q: %+v", base, report.Items)
+	return MigrationItem{}
+}
+
+func TestMigrate_ImportsLegacyLayoutInOneSave(t *testing.T) {
+	setupTestEnv(t)
+	seedLegacyLayout(t)
+	seedProfile(t, "dev", `{}`)
+
+	report, err := Migrate(false, validateForSave(t))
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if got := report.Count(MigrationImported); got != 2 {
+		t.Fatalf("imported %d, want 2: %+v", got, report.Items)
+	}
+
+	dev := itemFor(t, report, "dev")
+	if dev.Profile != "dev-1" || !dev.Renamed() {
+		t.Errorf("dev imported as %q, want dev-1 beside the existing profile", dev.Profile)
+	}
+	if broken := itemFor(t, report, "broken"); broken.Status != MigrationInvalid || len(broken.Errors) == 0 {
+		t.Errorf("broken.json = %+v, want invalid with errors", broken)
+	}
+
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadFromDocument(doc, "dev-1")
+	if err != nil {
+		t.Fatalf("LoadFromDocument(dev-1): %v", err)
+	}
+	if !p.FieldPresence["disabled_mcps"] {
+		t.Error("explicit empty disabled_mcps was not kept verbatim")
+	}
+	legacy := itemFor(t, report, "oh-my-openagent")
+	block, ok, err := doc.ProfileBlock(legacy.Profile)
+	if err != nil || !ok {
+		t.Fatalf("ProfileBlock(%s): ok=%v err=%v", legacy.Profile, ok, err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, block); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"[opencode]":{"telemetry":false}}`; compact.String() != want {
+		t.Errorf("legacy block = %s, want %s ($schema dropped)", compact.String(), want)
+	}
+	if doc.HasProfile("broken") {
+		t.Error("invalid file was imported")
+	}
+}
+
+func TestMigrate_RerunIsNoOpUntilSourceChanges(t *testing.T) {
+	setupTestEnv(t)
+	seedLegacyLayout(t)
+
+	if _, err := Migrate(false, validateForSave(t)); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	before, err := os.ReadFile(config.OmoFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Migrate(false, validateForSave(t))
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if report.Count(MigrationImported) != 0 || report.Count(MigrationSkipped) != 2 {
+		t.Fatalf("second run = %+v, want both valid files skipped", report.Items)
+	}
+	after, _ := os.ReadFile(config.OmoFile())
+	if string(after) != string(before) {
+		t.Fatal("a no-op migration rewrote the document")
+	}
+
+	writeLegacy(t, filepath.Join(config.LegacyProfilesDir(), "dev.json"), `{"telemetry": true}`)
+	report, err = Migrate(false, validateForSave(t))
+	if err != nil {
+		t.Fatalf("third Migrate: %v", err)
+	}
+	if dev := itemFor(t, report, "dev"); dev.Status != MigrationImported || dev.Profile != "dev-1" {
+		t.Fatalf("changed dev.json = %+v, want imported as dev-1", dev)
+	}
+}
+
+func TestMigrate_DryRunWritesNothing(t *testing.T) {
+	setupTestEnv(t)
+	seedLegacyLayout(t)
+
+	report, err := Migrate(true, validateForSave(t))
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !report.DryRun || report.Count(MigrationImported) != 2 {
+		t.Fatalf("dry run = %+v", report)
+	}
+	for _, path := range []string{config.OmoFile(), config.MigrationMarkerFile()} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("dry run created %s", path)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// RootChangeKind classifies what an apply does to one document root key.
+type RootChangeKind string
+
+const (
+	// RootAdded: the profile declares the key and the root does not have it.
+	RootAdded RootChangeKind = "added"
+	// RootReplaced: the profile declares the key with a different value.
+	RootReplaced RootChangeKind = "replaced"
+	// RootUnchanged: the profile declares the key and the root already equals it.
+	RootUnchanged RootChangeKind = "unchanged"
+	// RootKept: the profile does not declare the key, so the apply leaves it.
+	RootKept RootChangeKind = "kept"
+	// RootRemoved: the profile does not declare the key and a strict apply
+	// removes it.
+	RootRemoved RootChangeKind = "removed"
+)
+
+// RootChange is the effect of an apply on one root key. Before and After are
+// only set for keys that change: After for added, Before for removed, both
+// for replaced.
+type RootChange struct {
+	Key    string          `json:"key"`
+	Kind   RootChangeKind  `json:"kind"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// ApplyPreview is what Apply would do, computed without writing anything.
+type ApplyPreview struct {
+	// Name is the profile that would be applied; for a stack, its StackLabel.
+	Name string `json:"name"`
+	// Stack lists the overlays when a stack of several profiles would be
+	// applied.
+	Stack []string `json:"stack,omitempty"`
+	// Strict reports whether the apply would be strict.
+	Strict bool `json:"strict"`
+	// Previous is the profile or stack live now, "" when the root matches
+	// none.
+	Previous string `json:"previous,omitempty"`
+	// Snapshot is the profile the unmatched root would be saved as, "" when no
+	// snapshot is needed. SnapshotKeys lists the root keys it would capture.
+	Snapshot     string   `json:"snapshot,omitempty"`
+	SnapshotKeys []string `json:"snapshotKeys,omitempty"`
+	// Changes covers every root key except `profiles` and `$schema`, in key
+	// order. After values keep the profile's references unresolved.
+	Changes []RootChange `json:"changes"`
+	// Unresolved lists the references that do not resolve now, which would
+	// make the apply fail.
+	Unresolved []Reference `json:"unresolved,omitempty"`
+}
+
+// Count returns the number of changes of the given kind.
+func (p *ApplyPreview) Count(kind RootChangeKind) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// PreviewApply runs Apply on an in-memory copy of the target document and
+// reports, per root key, what it would change and whether the current root
+// would be snapshotted first. Nothing is written.
+func PreviewApply(name string) (*ApplyPreview, error) {
+	return PreviewApplyWith(name, ApplyOptions{})
+}
+
+// PreviewApplyWith is PreviewApply for ApplyWith.
+func PreviewApplyWith(name string, opts ApplyOptions) (*ApplyPreview, error) {
+	return PreviewApplyStack([]string{name}, opts)
+}
+
+// PreviewApplyStack is PreviewApply for ApplyStack.
+func PreviewApplyStack(names []string, opts ApplyOptions) (*ApplyPreview, error) {
+	if err := validateStack(names); err != nil {
+		return nil, err
+	}
+	mode, err := resolveApplyMode(names, opts)
+	if err != nil {
+		return nil, err
+	}
+	mode.allowUnresolved = true
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, err
+	}
+	block, err := in.stack(names)
+	if err != nil {
+		return nil, err
+	}
+	declaredValues := map[string]json.RawMessage{}
+	if err := json.Unmarshal(block, &declaredValues); err != nil {
+		return nil, fmt.Errorf("parse profile %q: %w", StackLabel(names), err)
+	}
+	before := map[string]json.RawMessage{}
+	for _, key := range doc.Keys() {
+		before[key], _ = doc.Raw(key)
+	}
+
+	entry, err := applyInto(doc, names, mode)
+	if err != nil {
+		return nil, err
+	}
+	preview := &ApplyPreview{
+		Name:     entry.Profile,
+		Stack:    entry.Stack,
+		Strict:   mode.strict,
+		Previous: entry.Previous,
+		Snapshot: entry.Snapshot,
+		Changes:  []RootChange{},
+	}
+	_, refs, err := resolveReferences(block, "")
+	if err != nil {
+		return nil, err
+	}
+	preview.Unresolved = unresolvedOf(refs)
+	if entry.Snapshot != "" {
+		block, _, err := doc.ProfileBlock(entry.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		var captured map[string]json.RawMessage
+		if err := json.Unmarshal(block, &captured); err != nil {
+			return nil, err
+		}
+		for key := range captured {
+			preview.SnapshotKeys = append(preview.SnapshotKeys, key)
+		}
+		sort.Strings(preview.SnapshotKeys)
+	}
+
+	declared := map[string]bool{}
+	for key := range entry.Replaced {
+		declared[key] = true
+	}
+	for _, key := range entry.Added {
+		declared[key] = true
+	}
+
+	keys := doc.Keys()
+	for key := range before {
+		if _, ok := doc.Raw(key); !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == config.ProfilesKey || key == config.SchemaKey {
+			continue
+		}
+		change := RootChange{Key: key, Kind: RootKept}
+		if _, ok := doc.Raw(key); !ok {
+			change.Kind = RootRemoved
+			change.Before = before[key]
+		} else if declared[key] {
+			after, _ := doc.Raw(key)
+			shown := after
+			if _, refs, _ := resolveReferences(declaredValues[key], key); len(refs) > 0 {
+				shown = declaredValues[key]
+			}
+			prev, existed := before[key]
+			if !existed {
+				change.Kind = RootAdded
+				change.After = shown
+			} else {
+				same, err := sameJSON(prev, after)
+				if err != nil {
+					return nil, fmt.Errorf("compare root key %q: %w", key, err)
+				}
+				if same {
+					change.Kind = RootUnchanged
+				} else {
+					change.Kind = RootReplaced
+					change.Before = prev
+					change.After = shown
+				}
+			}
+		}
+		preview.Changes = append(preview.Changes, change)
+	}
+	return preview, nil
+}
+
+// sameJSON reports whether a and b are equal once canonicalized.
+func sameJSON(a, b json.RawMessage) (bool, error) {
+	ca, err := canonicalJSON(a)
+	if err != nil {
+		return false, err
+	}
+	cb, err := canonicalJSON(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ca, cb), nil
+}
@@ -0,0 +1,85 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestPreviewApply_ClassifiesRootKeysWithoutWriting(t *testing.T) {
+	setupTestEnv(t)
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true}`))
+	doc.SetRaw(config.CodexKey, json.RawMessage(`{"model":"o3"}`))
+	doc.SetRaw(config.SenpiKey, json.RawMessage(`{"mode":"x"}`))
+	if err := doc.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	seedProfileBlock(t, "dev", json.RawMessage(`{"[opencode]":{"telemetry":false},"[senpi]":{"mode":"x"},"hooks":[]}`))
+	before, err := os.ReadFile(config.DocumentFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := PreviewApply("dev")
+	if err != nil {
+		t.Fatalf("PreviewApply: %v", err)
+	}
+
+	kinds := map[string]RootChangeKind{}
+	for _, c := range preview.Changes {
+		kinds[c.Key] = c.Kind
+	}
+	want := map[string]RootChangeKind{
+		config.OpenCodeKey: RootReplaced,
+		config.SenpiKey:    RootUnchanged,
+		config.CodexKey:    RootKept,
+		"hooks":            RootAdded,
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("changes = %v, want %v", kinds, want)
+	}
+	if preview.Snapshot != SnapshotBaseName {
+		t.Errorf("Snapshot = %q, want %q", preview.Snapshot, SnapshotBaseName)
+	}
+	if want := []string{config.OpenCodeKey, config.SenpiKey}; !reflect.DeepEqual(preview.SnapshotKeys, want) {
+		t.Errorf("SnapshotKeys = %v, want %v", preview.SnapshotKeys, want)
+	}
+
+	after, err := os.ReadFile(config.DocumentFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Error("PreviewApply modified the document")
+	}
+	if journal, _ := Journal(); len(journal) != 0 {
+		t.Errorf("PreviewApply recorded %d journal entries", len(journal))
+	}
+}
+
+func TestPreviewApply_NoSnapshotWhenRootMatches(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry":true}`)
+	seedProfile(t, "b", `{"telemetry":false}`)
+	if _, err := Apply("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := PreviewApply("b")
+	if err != nil {
+		t.Fatalf("PreviewApply: %v", err)
+	}
+	if preview.Previous != "a" || preview.Snapshot != "" {
+		t.Errorf("Previous = %q, Snapshot = %q; want a and none", preview.Previous, preview.Snapshot)
+	}
+	if n := preview.Count(RootReplaced); n != 1 {
+		t.Errorf("replaced %d keys, want 1", n)
+	}
+}
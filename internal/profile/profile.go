@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"slices"
 	"sort"
 	"strings"
 
@@ -17,11 +18,17 @@ import (
 // Config mirrors the profile's `[opencode]` harness block — the flat
 // pre-unification config shape. Sibling keys of that block (shared typed keys,
 // `[senpi]`, `[codex]`) are not modelled here; they round-trip via
-// PreservedBlock so editing a profile never drops them.
+// PreservedBlock so editing a profile never drops them. The other harness
+// blocks are edited as raw JSON checked against their sub-schemas, through
+// ExportHarness and UpdateHarnessBlockIfRevision.
 type Profile struct {
-	Name                string
-	Config              config.Config
-	Path                string
+	Name   string
+	Config config.Config
+	Path   string
+	// Revision is the block's content hash when it was loaded (see
+	// config.Document.ProfileRevision). Pass it to the *IfRevision writers to
+	// refuse a save over changes made since.
+	Revision            string
 	PreservedUnknown    map[string]json.RawMessage `json:"-"`
 	PreservedBlock      map[string]json.RawMessage `json:"-"`
 	FieldPresence       map[string]bool            `json:"-"`
@@ -59,6 +66,11 @@ func copyRawMap(src map[string]json.RawMessage) map[string]json.RawMessage {
 	return dst
 }
 
+// ValidateFunc checks an `[opencode]` payload before it is stored and returns
+// one message per problem. The CLI passes schema.Validator.ValidateJSONForSave;
+// the profile package cannot import schema itself.
+type ValidateFunc func(openCode []byte) ([]string, error)
+
 // NotFoundError reports a missing `profiles.<name>` entry. It unwraps to
 // fs.ErrNotExist, so callers test it with errors.Is(err, fs.ErrNotExist).
 // Note os.IsNotExist does NOT work here: it predates error wrapping and only
@@ -69,6 +81,35 @@ func (e *NotFoundError) Error() string { return fmt.Sprintf("profile %q not foun
 
 func (e *NotFoundError) Unwrap() error { return fs.ErrNotExist }
 
+// RevisionMismatchError reports that a profile changed after the caller read
+// it: the stored block no longer has the revision the write was based on.
+type RevisionMismatchError struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+func (e *RevisionMismatchError) Error() string {
+	return fmt.Sprintf("profile %q was modified since revision %s (now %s)", e.Name, e.Expected, e.Actual)
+}
+
+// checkRevision fails with *NotFoundError when the profile is gone and with
+// *RevisionMismatchError when none of revisions is current. No revisions, or
+// an empty one, skip the check.
+func checkRevision(doc *config.Document, name string, revisions []string) error {
+	current, ok, err := doc.ProfileRevision(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &NotFoundError{Name: name}
+	}
+	if len(revisions) > 0 && !slices.Contains(revisions, "") && !slices.Contains(revisions, current) {
+		return &RevisionMismatchError{Name: name, Expected: strings.Join(revisions, ", "), Actual: current}
+	}
+	return nil
+}
+
 var knownConfigTags = []string{
 	"$schema",
 	"disabled_mcps",
@@ -276,7 +317,9 @@ func Load(name string) (*Profile, error) {
 	return LoadFromDocument(doc, name)
 }
 
-// LoadFromDocument extracts a profile from an already-parsed document.
+// LoadFromDocument extracts a profile from an already-parsed document. A
+// profile that extends another is loaded with its own fields only — what its
+// block stores and an editor changes; see LoadResolved.
 func LoadFromDocument(doc *config.Document, name string) (*Profile, error) {
 	block, ok, err := doc.ProfileBlock(name)
 	if err != nil {
@@ -285,7 +328,28 @@ func LoadFromDocument(doc *config.Document, name string) (*Profile, error) {
 	if !ok {
 		return nil, &NotFoundError{Name: name}
 	}
+	return profileFromBlock(doc, name, block)
+}
+
+// LoadResolved is Load with the profile's parents merged in: the
+// configuration an apply makes live. Do not Save the result over a child
+// profile, it would store every inherited field as an override.
+func LoadResolved(name string) (*Profile, error) {
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	block, ok, err := resolvedBlock(doc, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NotFoundError{Name: name}
+	}
+	return profileFromBlock(doc, name, block)
+}
 
+func profileFromBlock(doc *config.Document, name string, block json.RawMessage) (*Profile, error) {
 	blockFields := map[string]json.RawMessage{}
 	if err := json.Unmarshal(block, &blockFields); err != nil {
 		return nil, fmt.Errorf("parse profile %q: %w", name, err)
@@ -326,10 +390,16 @@ func LoadFromDocument(doc *config.Document, name string) (*Profile, error) {
 
 	hasLegacy, warning := detectLegacyFields(openCode)
 
+	revision, _, err := doc.ProfileRevision(name)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Profile{
 		Name:                name,
 		Config:              cfg,
 		Path:                doc.Path,
+		Revision:            revision,
 		PreservedUnknown:    preservedUnknown,
 		PreservedBlock:      preservedBlock,
 		FieldPresence:       fieldPresence,
@@ -345,7 +415,7 @@ func Save(p *Profile) error {
 // Save writes the profile back into `profiles.<name>` of the omo document,
 // leaving every other profile, harness block and shared key untouched.
 func (p *Profile) Save() error {
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
+	return config.MutateWithPreSave("save "+p.Name, backup.Before, func(doc *config.Document) error {
 		if err := p.WriteInto(doc); err != nil {
 			return err
 		}
@@ -402,6 +472,14 @@ func (p *Profile) WriteInto(doc *config.Document) error {
 // save, for instance, where marshalling the Config struct would drop fields the
 // user explicitly set to a zero value.
 func WriteOpenCodeBlockInto(doc *config.Document, name string, openCode json.RawMessage) error {
+	return WriteHarnessBlockInto(doc, name, config.OpenCodeKey, openCode)
+}
+
+// WriteHarnessBlockInto is WriteOpenCodeBlockInto for harness block key. An
+// empty payload stores `{}` for `[opencode]`, which every profile has, and
+// removes any other harness block: a profile that does not configure a
+// harness leaves the root's block alone when applied.
+func WriteHarnessBlockInto(doc *config.Document, name, key string, payload json.RawMessage) error {
 	block := map[string]json.RawMessage{}
 
 	existing, ok, err := doc.ProfileBlock(name)
@@ -414,10 +492,20 @@ func WriteOpenCodeBlockInto(doc *config.Document, name string, openCode json.Raw
 		}
 	}
 
-	if len(bytes.TrimSpace(openCode)) == 0 {
-		openCode = json.RawMessage("{}")
+	empty := len(bytes.TrimSpace(payload)) == 0
+	if !empty {
+		if obj, ok := jsonObject(payload); ok && len(obj) == 0 {
+			empty = true
+		}
+	}
+	switch {
+	case empty && key != config.OpenCodeKey:
+		delete(block, key)
+	case empty:
+		block[key] = json.RawMessage("{}")
+	default:
+		block[key] = payload
 	}
-	block[config.OpenCodeKey] = openCode
 
 	encoded, err := marshalSortedJSONObject(block)
 	if err != nil {
@@ -433,22 +521,49 @@ func WriteOpenCodeBlockInto(doc *config.Document, name string, openCode json.Raw
 //
 // The existence check and the write share one transaction.
 func UpdateOpenCodeBlock(name string, openCode json.RawMessage) error {
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
-		if !doc.HasProfile(name) {
-			return &NotFoundError{Name: name}
+	_, err := UpdateOpenCodeBlockIfRevision(name, openCode, "")
+	return err
+}
+
+// UpdateOpenCodeBlockIfRevision is UpdateOpenCodeBlock guarded by the
+// revision the caller's copy was loaded at: when the stored profile has changed
+// since — another tab, the TUI, a text editor — it fails with
+// *RevisionMismatchError instead of overwriting that change. Given several
+// revisions, as an If-Match list, any of them will do; an empty one skips the
+// check. It returns the profile's revision after the write.
+//
+// The check and the write share one transaction, so nothing can slip in
+// between them.
+func UpdateOpenCodeBlockIfRevision(name string, openCode json.RawMessage, revisions ...string) (string, error) {
+	return UpdateHarnessBlockIfRevision(name, config.OpenCodeKey, openCode, revisions...)
+}
+
+// UpdateHarnessBlockIfRevision is UpdateOpenCodeBlockIfRevision for harness
+// block key.
+func UpdateHarnessBlockIfRevision(name, key string, payload json.RawMessage, revisions ...string) (string, error) {
+	var updated string
+	err := config.MutateWithPreSave("save "+name, backup.Before, func(doc *config.Document) error {
+		if err := checkRevision(doc, name, revisions); err != nil {
+			return err
 		}
-		if err := WriteOpenCodeBlockInto(doc, name, openCode); err != nil {
+		if err := WriteHarnessBlockInto(doc, name, key, payload); err != nil {
 			return err
 		}
 		doc.EnsureSchema()
-		return nil
+		var err error
+		updated, _, err = doc.ProfileRevision(name)
+		return err
 	})
+	if !config.Saved(err) {
+		return "", err
+	}
+	return updated, err
 }
 
 // SaveOpenCodeBlock persists a pre-marshalled `[opencode]` payload for a
 // profile, leaving every other profile and top-level key untouched.
 func SaveOpenCodeBlock(name string, openCode json.RawMessage) error {
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
+	return config.MutateWithPreSave("save "+name, backup.Before, func(doc *config.Document) error {
 		if err := WriteOpenCodeBlockInto(doc, name, openCode); err != nil {
 			return err
 		}
@@ -488,32 +603,80 @@ func marshalSortedJSONObject(values map[string]json.RawMessage) ([]byte, error)
 
 // Delete removes `profiles.<name>` from the omo document.
 func Delete(name string) error {
-	err := config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
-		removed, err := doc.DeleteProfileBlock(name)
+	return DeleteIfRevision(name, "")
+}
+
+// DeleteIfRevision is Delete refusing with *RevisionMismatchError when the
+// profile changed since revisions (see UpdateOpenCodeBlockIfRevision). A
+// profile other profiles extend is not deleted: *ParentInUseError names them.
+func DeleteIfRevision(name string, revisions ...string) error {
+	// The refusal, the write and the settings edit share one lock, so a child
+	// created in between cannot be left extending a deleted parent.
+	return config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
 		if err != nil {
 			return err
 		}
-		if !removed {
-			return &NotFoundError{Name: name}
+		if err := checkRevision(doc, name, revisions); err != nil {
+			return err
 		}
-		return nil
+		settings, err := LoadSettings()
+		if err != nil {
+			return err
+		}
+		if children := settings.children(name); len(children) > 0 {
+			return &ParentInUseError{Name: name, Children: children}
+		}
+		if _, err := doc.DeleteProfileBlock(name); err != nil {
+			return err
+		}
+		operation := "delete " + name
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		return deleteProfileSettings(name)
 	})
-	if err != nil {
-		return err
-	}
-	return nil
 }
 
-// ExportOpenCode returns the stored `profiles.<name>.[opencode]` payload,
+// ExportOpenCode returns the `profiles.<name>.[opencode]` payload,
 // pretty-printed. It reads the raw block instead of re-marshalling a typed
 // Config, so an export reproduces what is on disk: unknown keys and explicitly
 // present zero values ("disabled_mcps": [], "default_run_agent": "") survive
-// and an export/import round-trip is lossless.
+// and an export/import round-trip is lossless. A profile that extends another
+// is exported resolved, so the export stands on its own.
 func ExportOpenCode(name string) ([]byte, error) {
+	return ExportHarness(name, config.OpenCodeKey)
+}
+
+// ExportHarness is ExportOpenCode for harness block key: `{}` when the
+// profile does not configure that harness.
+func ExportHarness(name, key string) ([]byte, error) {
 	doc, err := config.LoadDocument()
 	if err != nil {
 		return nil, err
 	}
+	block, ok, err := resolvedBlock(doc, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &NotFoundError{Name: name}
+	}
+	return exportHarnessOf(name, key, block)
+}
+
+// ExportOpenCodeFrom exports the profile's own stored payload from an
+// already-loaded document, for callers that must report the payload and its
+// revision from the same read. Inherited fields are not included.
+func ExportOpenCodeFrom(doc *config.Document, name string) ([]byte, error) {
+	return ExportHarnessFrom(doc, name, config.OpenCodeKey)
+}
+
+// ExportHarnessFrom is ExportOpenCodeFrom for harness block key.
+func ExportHarnessFrom(doc *config.Document, name, key string) ([]byte, error) {
 	block, ok, err := doc.ProfileBlock(name)
 	if err != nil {
 		return nil, err
@@ -521,12 +684,15 @@ func ExportOpenCode(name string) ([]byte, error) {
 	if !ok {
 		return nil, &NotFoundError{Name: name}
 	}
+	return exportHarnessOf(name, key, block)
+}
 
+func exportHarnessOf(name, key string, block json.RawMessage) ([]byte, error) {
 	var fields map[string]json.RawMessage
 	if err := json.Unmarshal(block, &fields); err != nil {
 		return nil, fmt.Errorf("parse profile %q: %w", name, err)
 	}
-	raw, ok := fields[config.OpenCodeKey]
+	raw, ok := fields[key]
 	if !ok || len(bytes.TrimSpace(raw)) == 0 {
 		return []byte("{}"), nil
 	}
@@ -542,7 +708,7 @@ func ExportOpenCode(name string) ([]byte, error) {
 // taken. The check and the write share one transaction, so two concurrent
 // creates cannot both succeed and clobber each other.
 func Create(name string, cfg config.Config) error {
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
+	return config.MutateWithPreSave("create "+name, backup.Before, func(doc *config.Document) error {
 		if doc.HasProfile(name) {
 			return &ExistsError{Name: name}
 		}
@@ -560,7 +726,7 @@ func Create(name string, cfg config.Config) error {
 // (`[]`, `false`, `{}`) — Create re-marshals through typed Config and
 // omitempty would drop them.
 func CreateWithOpenCodeBlock(name string, openCode json.RawMessage) error {
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
+	return config.MutateWithPreSave("create "+name, backup.Before, func(doc *config.Document) error {
 		if doc.HasProfile(name) {
 			return &ExistsError{Name: name}
 		}
@@ -585,31 +751,53 @@ func CreateWithOpenCodeBlock(name string, openCode json.RawMessage) error {
 // ("disabled_mcps": [], "default_run_agent": "") survive instead of being
 // dropped by omitempty.
 func CreateAvailable(base string, openCode json.RawMessage) (string, bool, error) {
+	return CreateAvailableHarness(base, config.OpenCodeKey, openCode)
+}
+
+// CreateAvailableHarness is CreateAvailable with payload as harness block key
+// of the new profile, whose `[opencode]` block is then empty.
+func CreateAvailableHarness(base, key string, payload json.RawMessage) (string, bool, error) {
 	var name string
 	collided := false
-	err := config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
-		name, collided = base, false
-		for i := 1; doc.HasProfile(name); i++ {
-			name = fmt.Sprintf("%s-%d", base, i)
-			collided = true
+	err := config.MutateWithPreSave("create "+base, backup.Before, func(doc *config.Document) error {
+		name, collided = availableName(doc, base)
+		if key != config.OpenCodeKey {
+			if err := WriteOpenCodeBlockInto(doc, name, nil); err != nil {
+				return err
+			}
 		}
-		if err := WriteOpenCodeBlockInto(doc, name, openCode); err != nil {
+		if err := WriteHarnessBlockInto(doc, name, key, payload); err != nil {
 			return err
 		}
 		doc.EnsureSchema()
 		return nil
 	})
-	if err != nil {
+	if !config.Saved(err) {
 		return "", false, err
 	}
-	return name, collided, nil
+	return name, collided, err
 }
 
-// CreateFrom clones fromName into name in one transaction, carrying the whole
-// profile block. Reading the source and writing the clone under a single lock
-// means the source cannot be renamed or deleted in between.
+// availableName returns base, or base-1, base-2, … when taken, and whether it
+// had to look past base.
+func availableName(doc *config.Document, base string) (string, bool) {
+	name := base
+	for i := 1; doc.HasProfile(name); i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return name, name != base
+}
+
+// CreateFrom clones fromName into name in one transaction, carrying the
+// whole profile block; a clone of a child extends the same parent. Reading the
+// source, writing the clone and copying its settings under a single lock means
+// the source cannot be renamed or deleted in between.
 func CreateFrom(name, fromName string) error {
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
+	return config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
 		if doc.HasProfile(name) {
 			return &ExistsError{Name: name}
 		}
@@ -627,7 +815,14 @@ func CreateFrom(name, fromName string) error {
 			return err
 		}
 		doc.EnsureSchema()
-		return nil
+		operation := "create " + name
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		return copyProfileSettings(fromName, name)
 	})
 }
 
@@ -640,33 +835,52 @@ func (e *ExistsError) Error() string { return fmt.Sprintf("profile %q already ex
 // document write.
 //
 // The block moves verbatim, so `[opencode]`, its unknown keys, and the sibling
-// blocks ([senpi], [codex], shared typed keys) all survive untouched. Doing the
-// add and the remove in one Document.Save — which itself writes atomically via
-// temp file + rename — means a failure leaves the document exactly as it was,
-// instead of stranding both names and making the retry collide with its own
+// blocks ([senpi], [codex], shared typed keys) all survive untouched. In the
+// file the entry keeps its position and the comments written above it. Doing
+// the move in one Document.Save — which itself writes atomically via temp file
+// + rename — means a failure leaves the document exactly as it was, instead of
+// stranding both names and making the retry collide with its own
 // half-finished result.
-// Renaming the applied profile needs no follow-up: the block content is
-// unchanged, so comparison-based detection follows the new name automatically.
+//
+// The profile's settings and the activation record follow it to the new
+// name, and profiles extending it are pointed at the new name.
 func Rename(oldName, newName string) error {
+	return RenameIfRevision(oldName, newName, "")
+}
+
+// RenameIfRevision is Rename refusing with *RevisionMismatchError when
+// `profiles.<oldName>` changed since revisions (see
+// UpdateOpenCodeBlockIfRevision). The block moves unchanged, so the revision carries over to newName,
+// and so do its settings and activation record.
+func RenameIfRevision(oldName, newName string, revisions ...string) error {
 	if oldName == newName {
 		return nil
 	}
-	return config.MutateWithPreSave(backup.CreateOmoIfPresent, func(doc *config.Document) error {
-		block, ok, err := doc.ProfileBlock(oldName)
+	return config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
 		if err != nil {
 			return err
 		}
-		if !ok {
-			return &NotFoundError{Name: oldName}
+		if err := checkRevision(doc, oldName, revisions); err != nil {
+			return err
 		}
 		if doc.HasProfile(newName) {
 			return &ExistsError{Name: newName}
 		}
-		if err := doc.SetProfileBlock(newName, block); err != nil {
+		if _, err := doc.RenameProfileBlock(oldName, newName); err != nil {
 			return err
 		}
-		_, err = doc.DeleteProfileBlock(oldName)
-		return err
+		operation := "rename " + oldName + " to " + newName
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		if err := renameProfileSettings(oldName, newName); err != nil {
+			return err
+		}
+		return renameActivation(oldName, newName)
 	})
 }
 
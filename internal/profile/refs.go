@@ -0,0 +1,201 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// A profile string value may hold references instead of secrets:
+// `${env:DISCORD_TOKEN}` is replaced by that environment variable and
+// `${file:~/.secrets/tg}` by the file's content, trailing newline removed. A
+// relative file path is relative to the omo document's directory. References
+// can sit inside a longer string, as in `Bearer ${env:GATEWAY_TOKEN}`.
+//
+// Only Apply resolves them, as it writes the root: the profile, its exports,
+// its validation and every compare keep the references, so a profile can be
+// shared without its tokens. Apply refuses a profile whose references do not
+// resolve rather than write a placeholder into the live configuration.
+// Detection resolves a profile's references before comparing it with the
+// root, and Capture puts a reference back wherever the captured value is what
+// it resolves to. config.ReferencePattern matches them.
+
+// Reference is one `${env:…}` or `${file:…}` reference in a profile block.
+type Reference struct {
+	// Path is the block path of the string holding it, keys joined with
+	// dots, array elements as [i].
+	Path string `json:"path"`
+	// Ref is the reference as written, e.g. `${env:DISCORD_TOKEN}`.
+	Ref string `json:"ref"`
+	// Kind is "env" or "file"; Target the variable name or file path.
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	// Resolved reports whether the reference resolves now; Error says why
+	// not.
+	Resolved bool   `json:"resolved"`
+	Error    string `json:"error,omitempty"`
+}
+
+// UnresolvedReferencesError is returned by Apply when references of the
+// profile do not resolve. Nothing is written.
+type UnresolvedReferencesError struct{ Refs []Reference }
+
+func (e *UnresolvedReferencesError) Error() string {
+	parts := make([]string, 0, len(e.Refs))
+	for _, ref := range e.Refs {
+		parts = append(parts, fmt.Sprintf("%s at %s (%s)", ref.Ref, ref.Path, ref.Error))
+	}
+	return "unresolved references: " + strings.Join(parts, "; ")
+}
+
+// References lists, by path, the references of profile name — or of the stack
+// names combine into — and whether each resolves now.
+func References(names ...string) ([]Reference, error) {
+	block, err := StackBlock(names)
+	if err != nil {
+		return nil, err
+	}
+	_, refs, err := resolveReferences(block, "")
+	return refs, err
+}
+
+// unresolvedOf filters refs down to those that did not resolve.
+func unresolvedOf(refs []Reference) []Reference {
+	var out []Reference
+	for _, ref := range refs {
+		if !ref.Resolved {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// resolveReferences returns raw with every reference that resolves
+// substituted, and every reference found, sorted by path. path is raw's block
+// path. References that do not resolve are left as written.
+func resolveReferences(raw json.RawMessage, path string) (json.RawMessage, []Reference, error) {
+	if !bytes.Contains(raw, []byte("${")) {
+		return raw, nil, nil
+	}
+	v, err := config.DecodeValue(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	var refs []Reference
+	v = substituteReferences(v, path, &refs)
+	if len(refs) == 0 {
+		return raw, nil, nil
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	resolved, err := config.EncodeValue(v)
+	return resolved, refs, err
+}
+
+func substituteReferences(v any, path string, refs *[]Reference) any {
+	switch t := v.(type) {
+	case string:
+		return config.ReferencePattern.ReplaceAllStringFunc(t, func(match string) string {
+			sub := config.ReferencePattern.FindStringSubmatch(match)
+			ref := Reference{Path: path, Ref: match, Kind: sub[1], Target: sub[2]}
+			value, err := lookupReference(sub[1], sub[2])
+			if err != nil {
+				ref.Error = err.Error()
+				*refs = append(*refs, ref)
+				return match
+			}
+			ref.Resolved = true
+			*refs = append(*refs, ref)
+			return value
+		})
+	case map[string]any:
+		for key, child := range t {
+			t[key] = substituteReferences(child, joinFieldPath(path, key), refs)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = substituteReferences(child, fmt.Sprintf("%s[%d]", path, i), refs)
+		}
+	}
+	return v
+}
+
+func lookupReference(kind, target string) (string, error) {
+	if kind == "env" {
+		value, ok := os.LookupEnv(target)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", target)
+		}
+		return value, nil
+	}
+	path := target
+	switch {
+	case path == "~" || strings.HasPrefix(path, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	case !filepath.IsAbs(path):
+		path = filepath.Join(filepath.Dir(config.DocumentFile()), path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// keepReferences returns captured with template's reference-holding strings
+// put back wherever captured holds exactly what they resolve to, so capturing
+// an applied profile does not write its secrets into it.
+func keepReferences(template, captured json.RawMessage) (json.RawMessage, error) {
+	if !bytes.Contains(template, []byte("${")) {
+		return captured, nil
+	}
+	var s string
+	if json.Unmarshal(template, &s) == nil {
+		resolved, refs, err := resolveReferences(template, "")
+		if err != nil || len(refs) == 0 || len(unresolvedOf(refs)) > 0 {
+			return captured, err
+		}
+		if same, err := sameJSON(resolved, captured); err != nil || !same {
+			return captured, err
+		}
+		return template, nil
+	}
+	if tmplObj, ok := jsonObject(template); ok {
+		capObj, ok := jsonObject(captured)
+		if !ok {
+			return captured, nil
+		}
+		for key, value := range capObj {
+			if tmpl, ok := tmplObj[key]; ok {
+				kept, err := keepReferences(tmpl, value)
+				if err != nil {
+					return nil, err
+				}
+				capObj[key] = kept
+			}
+		}
+		return marshalSortedJSONObject(capObj)
+	}
+	var tmplItems, capItems []json.RawMessage
+	if json.Unmarshal(template, &tmplItems) != nil || json.Unmarshal(captured, &capItems) != nil ||
+		len(tmplItems) != len(capItems) {
+		return captured, nil
+	}
+	for i := range capItems {
+		kept, err := keepReferences(tmplItems[i], capItems[i])
+		if err != nil {
+			return nil, err
+		}
+		capItems[i] = kept
+	}
+	return config.EncodeValue(capItems)
+}
@@ -0,0 +1,122 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+const refsProfile = `{"openclaw":{"replyListener":{"discordBotToken":"${env:OMO_TEST_DISCORD}","telegramBotToken":"${file:tg}"}},"headers":{"Authorization":"Bearer ${env:OMO_TEST_DISCORD}"}}`
+
+func writeSecretFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(filepath.Dir(config.DocumentFile()), "tg")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApply_ResolvesReferencesOnlyAtTheRoot(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "bot", refsProfile)
+
+	var unresolved *UnresolvedReferencesError
+	if _, err := Apply("bot"); !errors.As(err, &unresolved) || len(unresolved.Refs) != 3 {
+		t.Fatalf("Apply without secrets = %v, want *UnresolvedReferencesError with 3 references", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Raw(config.OpenCodeKey); ok {
+		t.Error("a refused apply wrote the root")
+	}
+
+	t.Setenv("OMO_TEST_DISCORD", "d-secret")
+	writeSecretFile(t, "t-secret\n")
+	preview, err := PreviewApply("bot")
+	if err != nil {
+		t.Fatalf("PreviewApply: %v", err)
+	}
+	if len(preview.Unresolved) != 0 || string(mustCanonical(t, preview.Changes[0].After)) != string(mustCanonical(t, json.RawMessage(refsProfile))) {
+		t.Errorf("preview = %+v, want references shown unresolved", preview)
+	}
+	if _, err := Apply("bot"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	doc, err = config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := doc.Raw(config.OpenCodeKey)
+	want := `{"headers":{"Authorization":"Bearer d-secret"},"openclaw":{"replyListener":{"discordBotToken":"d-secret","telegramBotToken":"t-secret"}}}`
+	if got := mustCanonical(t, root); string(got) != want {
+		t.Errorf("root = %s, want %s", got, want)
+	}
+	exported, err := ExportOpenCode("bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCanonical(t, exported); string(got) != string(mustCanonical(t, json.RawMessage(refsProfile))) {
+		t.Errorf("export = %s, want the references", got)
+	}
+	if active, _ := GetActive(); active.State != ActiveExact || active.ProfileName != "bot" {
+		t.Errorf("active = %s %q, want exact bot", active.State, active.ProfileName)
+	}
+
+	refs, err := References("bot")
+	if err != nil || len(refs) != 3 || !refs[0].Resolved || refs[0].Path != "[opencode].headers.Authorization" {
+		t.Errorf("References = %+v, %v; want three resolved, sorted by path", refs, err)
+	}
+}
+
+func TestCapture_KeepsReferences(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("OMO_TEST_DISCORD", "d-secret")
+	seedProfile(t, "bot", refsProfile)
+	writeSecretFile(t, "t-secret")
+	if _, err := Apply("bot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":false,"headers":{"Authorization":"Bearer d-secret"},"openclaw":{"replyListener":{"discordBotToken":"d-secret","telegramBotToken":"rotated"}}}`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Capture("bot", CaptureOptions{Force: true})
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	// The reference whose value changed is replaced; the others stay.
+	want := `{"[opencode]":{"headers":{"Authorization":"Bearer ${env:OMO_TEST_DISCORD}"},"openclaw":{"replyListener":{"discordBotToken":"${env:OMO_TEST_DISCORD}","telegramBotToken":"rotated"}},"telemetry":false}}`
+	if got := mustCanonical(t, result.After); string(got) != want {
+		t.Errorf("captured = %s, want %s", got, want)
+	}
+}
+
+func TestResolveReferences_KeepsPromptCharacters(t *testing.T) {
+	t.Setenv("OMO_TEST_DISCORD", "d-secret")
+	raw := json.RawMessage(`{"prompt":"<Context> & ${env:OMO_TEST_DISCORD}","items":["<a>","${env:OMO_TEST_DISCORD}"]}`)
+	resolved, _, err := resolveReferences(raw, "[opencode]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"items":["<a>","d-secret"],"prompt":"<Context> & d-secret"}`; string(resolved) != want {
+		t.Errorf("resolved = %s, want %s", resolved, want)
+	}
+
+	kept, err := keepReferences(json.RawMessage(`["<a>","${env:OMO_TEST_DISCORD}"]`), json.RawMessage(`["<a>","d-secret"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `["<a>","${env:OMO_TEST_DISCORD}"]`; string(kept) != want {
+		t.Errorf("kept = %s, want %s", kept, want)
+	}
+}
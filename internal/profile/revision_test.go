@@ -0,0 +1,106 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func mustRevision(t *testing.T, name string) string {
+	t.Helper()
+	p, err := Load(name)
+	if err != nil {
+		t.Fatalf("Load(%q): %v", name, err)
+	}
+	if p.Revision == "" {
+		t.Fatalf("Load(%q) returned no revision", name)
+	}
+	return p.Revision
+}
+
+func TestUpdateOpenCodeBlockIfRevision_RefusesStaleWrite(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry": false}`)
+	loaded := mustRevision(t, "dev")
+
+	// Someone else saves first.
+	if err := UpdateOpenCodeBlock("dev", json.RawMessage(`{"telemetry": true}`)); err != nil {
+		t.Fatalf("UpdateOpenCodeBlock: %v", err)
+	}
+
+	_, err := UpdateOpenCodeBlockIfRevision("dev", json.RawMessage(`{"default_run_agent": "x"}`), loaded)
+	var mismatch *RevisionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("stale write error = %v, want *RevisionMismatchError", err)
+	}
+	if mismatch.Actual != mustRevision(t, "dev") {
+		t.Errorf("Actual = %q, want the current revision", mismatch.Actual)
+	}
+	raw, err := ExportOpenCode("dev")
+	if err != nil {
+		t.Fatalf("ExportOpenCode: %v", err)
+	}
+	if !jsonEqual(t, string(raw), `{"telemetry": true}`) {
+		t.Fatalf("the other writer's change was clobbered: %s", raw)
+	}
+}
+
+func TestUpdateOpenCodeBlockIfRevision_ReturnsNewRevision(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry": false}`)
+
+	rev, err := UpdateOpenCodeBlockIfRevision("dev", json.RawMessage(`{"telemetry": true}`), mustRevision(t, "dev"))
+	if err != nil {
+		t.Fatalf("UpdateOpenCodeBlockIfRevision: %v", err)
+	}
+	if rev != mustRevision(t, "dev") {
+		t.Fatalf("returned revision %q does not match the stored profile", rev)
+	}
+
+	// The returned revision is good for the next save.
+	if _, err := UpdateOpenCodeBlockIfRevision("dev", json.RawMessage(`{}`), rev); err != nil {
+		t.Fatalf("chained save: %v", err)
+	}
+}
+
+func TestProfileRevision_IgnoresOtherProfilesAndFormatting(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry": false, "default_run_agent": "a"}`)
+	before := mustRevision(t, "dev")
+
+	seedProfile(t, "other", `{}`)
+	seedProfileBlock(t, "dev", json.RawMessage(`{"[opencode]": {"default_run_agent": "a",   "telemetry": false}}`))
+
+	if after := mustRevision(t, "dev"); after != before {
+		t.Fatalf("revision changed without a value change: %s -> %s", before, after)
+	}
+}
+
+func TestDeleteAndRenameIfRevision(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{}`)
+	rev := mustRevision(t, "dev")
+	stale := config.Revision([]byte("stale"))
+
+	if err := DeleteIfRevision("dev", stale); !errors.As(err, new(*RevisionMismatchError)) {
+		t.Fatalf("DeleteIfRevision(stale) = %v, want *RevisionMismatchError", err)
+	}
+	if err := RenameIfRevision("dev", "work", stale); !errors.As(err, new(*RevisionMismatchError)) {
+		t.Fatalf("RenameIfRevision(stale) = %v, want *RevisionMismatchError", err)
+	}
+
+	if err := RenameIfRevision("dev", "work", rev); err != nil {
+		t.Fatalf("RenameIfRevision: %v", err)
+	}
+	if got := mustRevision(t, "work"); got != rev {
+		t.Fatalf("rename changed the revision: %s -> %s", rev, got)
+	}
+	if err := DeleteIfRevision("work", rev); err != nil {
+		t.Fatalf("DeleteIfRevision: %v", err)
+	}
+	if Exists("work") {
+		t.Fatal("profile survived delete")
+	}
+}
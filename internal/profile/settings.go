@@ -0,0 +1,206 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// requiredKeepKeys are the root keys a strict apply never removes, whatever
+// the settings say: dropping them would lose every profile.
+var requiredKeepKeys = []string{config.SchemaKey, config.ProfilesKey}
+
+// DefaultKeepKeys are the extra root keys a strict apply keeps when the
+// settings name none: upstream's migration bookkeeping, which no profile can
+// declare.
+var DefaultKeepKeys = []string{"_migrations", "legacy_migrations"}
+
+// Settings are omo-profiler's own options for a document. The omo schema has
+// no room for them — a profile block may only hold harness keys — so they live
+// in config.SettingsFile beside the document.
+type Settings struct {
+	// KeepKeys are the root keys a strict apply keeps besides `$schema` and
+	// `profiles`. nil means DefaultKeepKeys; an empty list keeps nothing else.
+	KeepKeys []string `json:"keepKeys"`
+	// Profiles holds per-profile options by profile name.
+	Profiles map[string]ProfileSettings `json:"profiles,omitempty"`
+	// Backups is the retention of the document's backups. nil means
+	// backup.DefaultRetention; the zero Retention keeps every backup.
+	Backups *backup.Retention `json:"backups,omitempty"`
+	// PinnedBackups are backup file names pruning never removes.
+	PinnedBackups []string `json:"pinnedBackups,omitempty"`
+	// Git turns on git versioning of the document, see SetVersioning.
+	Git bool `json:"git,omitempty"`
+}
+
+// ProfileSettings are the options of one profile.
+type ProfileSettings struct {
+	// Strict makes every apply of the profile strict: root keys the profile
+	// does not declare are removed, see ApplyOptions.
+	Strict bool `json:"strict,omitempty"`
+	// Extends names the parent profile whose resolved block this profile's
+	// block is merged over, see SetExtends.
+	Extends string `json:"extends,omitempty"`
+}
+
+// KeptKeys returns the root keys a strict apply keeps, sorted.
+func (s Settings) KeptKeys() []string {
+	extra := s.KeepKeys
+	if extra == nil {
+		extra = DefaultKeepKeys
+	}
+	seen := map[string]bool{}
+	var keys []string
+	for _, key := range append(append([]string{}, requiredKeepKeys...), extra...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// BackupRetention returns the retention of the document's backups.
+func (s Settings) BackupRetention() backup.Retention {
+	if s.Backups == nil {
+		return backup.DefaultRetention
+	}
+	return *s.Backups
+}
+
+// LoadSettings reads the target document's settings; a missing file yields
+// the defaults.
+func LoadSettings() (Settings, error) {
+	data, err := os.ReadFile(config.SettingsFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, err
+	}
+	var s Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Settings{}, fmt.Errorf("parse %s: %w", config.SettingsFile(), err)
+	}
+	return s, nil
+}
+
+// SetStrict turns strict apply on or off for profile name.
+func SetStrict(name string, strict bool) error {
+	return config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+		if !doc.HasProfile(name) {
+			return &NotFoundError{Name: name}
+		}
+		return editSettings(func(s *Settings) bool {
+			ps := s.Profiles[name]
+			if ps.Strict == strict {
+				return false
+			}
+			ps.Strict = strict
+			setProfileSettings(s, name, ps)
+			return true
+		})
+	})
+}
+
+// SetKeepKeys replaces the extra root keys a strict apply keeps. nil restores
+// DefaultKeepKeys.
+func SetKeepKeys(keys []string) error {
+	if keys != nil {
+		keys = append([]string{}, keys...)
+		sort.Strings(keys)
+	}
+	return config.WithDocumentLock(func() error {
+		return editSettings(func(s *Settings) bool {
+			s.KeepKeys = keys
+			return true
+		})
+	})
+}
+
+// renameProfileSettings moves a renamed profile's settings to its new name
+// and points the profiles extending it at the new name. It must run under the
+// document lock.
+func renameProfileSettings(oldName, newName string) error {
+	return editSettings(func(s *Settings) bool {
+		changed := false
+		for _, child := range s.children(oldName) {
+			ps := s.Profiles[child]
+			ps.Extends = newName
+			s.Profiles[child] = ps
+			changed = true
+		}
+		ps, ok := s.Profiles[oldName]
+		if !ok {
+			return changed
+		}
+		delete(s.Profiles, oldName)
+		setProfileSettings(s, newName, ps)
+		return true
+	})
+}
+
+// copyProfileSettings gives a clone the parent of its source; whether it is
+// strict stays a choice of its own. It must run under the document lock.
+func copyProfileSettings(fromName, name string) error {
+	return editSettings(func(s *Settings) bool {
+		parent := s.Profiles[fromName].Extends
+		if parent == "" {
+			return false
+		}
+		ps := s.Profiles[name]
+		ps.Extends = parent
+		setProfileSettings(s, name, ps)
+		return true
+	})
+}
+
+// deleteProfileSettings drops a deleted profile's settings. It must run under
+// the document lock.
+func deleteProfileSettings(name string) error {
+	return editSettings(func(s *Settings) bool {
+		if _, ok := s.Profiles[name]; !ok {
+			return false
+		}
+		delete(s.Profiles, name)
+		return true
+	})
+}
+
+func setProfileSettings(s *Settings, name string, ps ProfileSettings) {
+	if ps == (ProfileSettings{}) {
+		delete(s.Profiles, name)
+		return
+	}
+	if s.Profiles == nil {
+		s.Profiles = map[string]ProfileSettings{}
+	}
+	s.Profiles[name] = ps
+}
+
+// editSettings must run under the document lock. edit reports whether it
+// changed anything; nothing is written when it did not.
+func editSettings(edit func(*Settings) bool) error {
+	s, err := LoadSettings()
+	if err != nil {
+		return err
+	}
+	if !edit(&s) {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return config.WriteFileAtomic(config.SettingsFile(), append(data, '\n'), 0644)
+}
@@ -0,0 +1,155 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestApplyStrict_RemovesUndeclaredKeysAndSnapshotsThem(t *testing.T) {
+	setupTestEnv(t)
+	seedProfileBlock(t, "codex", json.RawMessage(`{"[opencode]":{"telemetry":true},"[codex]":{"model":"o3"}}`))
+	seedProfile(t, "plain", `{"telemetry":false}`)
+	// Switching without --strict leaves [codex] live under "plain".
+	for _, name := range []string{"codex", "plain"} {
+		if _, err := Apply(name); err != nil {
+			t.Fatalf("Apply(%s): %v", name, err)
+		}
+	}
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw("_migrations", json.RawMessage(`["m1"]`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := ApplyWith("plain", ApplyOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ApplyWith(strict): %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Raw(config.CodexKey); ok {
+		t.Error("strict apply left [codex] from the previous profile live")
+	}
+	for _, key := range []string{"_migrations", config.SchemaKey, config.ProfilesKey} {
+		if _, ok := doc.Raw(key); !ok {
+			t.Errorf("strict apply removed kept key %s", key)
+		}
+	}
+	if applied.Snapshot == "" {
+		t.Fatal("strict apply dropped [codex] without a snapshot")
+	}
+	block, _, err := doc.ProfileBlock(applied.Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snap map[string]json.RawMessage
+	if err := json.Unmarshal(block, &snap); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := snap[config.CodexKey]; !ok {
+		t.Errorf("snapshot %s = %s, want it to hold [codex]", applied.Snapshot, block)
+	}
+
+	// Revert brings the dropped block back.
+	if _, err := Revert(); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	doc, err = config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Raw(config.CodexKey); !ok {
+		t.Error("Revert did not restore [codex]")
+	}
+}
+
+func TestApply_UsesProfileStrictSetting(t *testing.T) {
+	setupTestEnv(t)
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.SenpiKey, json.RawMessage(`{"mode":"x"}`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	seedProfile(t, "dev", `{"telemetry":false}`)
+
+	if err := SetStrict("missing", true); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("SetStrict(missing) = %v, want not found", err)
+	}
+	if err := SetStrict("dev", true); err != nil {
+		t.Fatalf("SetStrict: %v", err)
+	}
+	preview, err := PreviewApply("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !preview.Strict || preview.Count(RootRemoved) != 1 {
+		t.Errorf("preview strict=%v removed=%d, want strict with one removal", preview.Strict, preview.Count(RootRemoved))
+	}
+	if _, err := Apply("dev"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Raw(config.SenpiKey); ok {
+		t.Error("profile with strict setting left [senpi] live")
+	}
+
+	// The setting follows a rename and goes with a delete.
+	if err := Rename("dev", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !settings.Profiles["prod"].Strict || len(settings.Profiles) != 1 {
+		t.Errorf("settings after rename = %+v", settings.Profiles)
+	}
+	if err := Delete("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if settings, _ = LoadSettings(); len(settings.Profiles) != 0 {
+		t.Errorf("settings after delete = %+v", settings.Profiles)
+	}
+}
+
+func TestSettingsKeptKeys(t *testing.T) {
+	setupTestEnv(t)
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{config.SchemaKey, "_migrations", "legacy_migrations", config.ProfilesKey}
+	if got := settings.KeptKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("default KeptKeys = %v, want %v", got, want)
+	}
+
+	if err := SetKeepKeys([]string{config.CodexKey}); err != nil {
+		t.Fatal(err)
+	}
+	settings, _ = LoadSettings()
+	want = []string{config.SchemaKey, config.CodexKey, config.ProfilesKey}
+	if got := settings.KeptKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("KeptKeys = %v, want %v", got, want)
+	}
+
+	if err := SetKeepKeys([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	settings, _ = LoadSettings()
+	want = []string{config.SchemaKey, config.ProfilesKey}
+	if got := settings.KeptKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("KeptKeys with none extra = %v, want %v", got, want)
+	}
+}
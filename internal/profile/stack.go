@@ -0,0 +1,185 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// A stack applies several profiles as ordered overlays: `base`, then
+// `fast-models` over it, then `no-telemetry` over both. Each overlay is a
+// profile's resolved block (see SetExtends), and the overlays are combined
+// bottom to top by the merge that resolves a profile over its parents
+// (mergeJSON), with one addition, unionAt:
+//
+//   - two objects merge key by key, at every depth;
+//   - two arrays at one of UnionArrayPaths are unioned: the lower overlay's
+//     elements first, then each element of the upper one not already present;
+//   - any other value, arrays included, is replaced by the upper overlay's.
+//
+// The combined block is applied like a single profile's. The activation
+// record and the journal keep the overlay list, so GetActive reports the
+// whole stack and SwitchBack and Revert restore it. A stack of one profile is
+// that profile.
+
+// UnionArrayPaths are the block paths, keys joined with dots, whose arrays a
+// stack unions instead of replacing: lists of disabled things, to which every
+// overlay adds its own.
+var UnionArrayPaths = []string{
+	config.OpenCodeKey + ".disabled_agents",
+	config.OpenCodeKey + ".disabled_commands",
+	config.OpenCodeKey + ".disabled_hooks",
+	config.OpenCodeKey + ".disabled_mcps",
+	config.OpenCodeKey + ".disabled_providers",
+	config.OpenCodeKey + ".disabled_skills",
+	config.OpenCodeKey + ".disabled_tools",
+	config.OpenCodeKey + ".keyword_detector.disabled_keywords",
+}
+
+// StackSeparator joins the overlays of a stack written as one word, as in a
+// diff side "base+fast-models". Profile names cannot contain it.
+const StackSeparator = "+"
+
+// DuplicateOverlayError is returned for a stack naming a profile twice.
+type DuplicateOverlayError struct{ Name string }
+
+func (e *DuplicateOverlayError) Error() string {
+	return fmt.Sprintf("profile %q appears more than once in the stack", e.Name)
+}
+
+// StackLabel renders a stack for display: "base + fast-models".
+func StackLabel(names []string) string {
+	return strings.Join(names, " "+StackSeparator+" ")
+}
+
+// ParseStack splits a stack written as one word into its overlays.
+func ParseStack(word string) []string {
+	var names []string
+	for _, name := range strings.Split(word, StackSeparator) {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// ApplyStack applies names as ordered overlays, see the package notes on
+// stacks. A single name is ApplyWith.
+func ApplyStack(names []string, opts ApplyOptions) (Applied, error) {
+	if err := validateStack(names); err != nil {
+		return Applied{}, err
+	}
+	return applyJournaled(opts, func([]JournalEntry) ([]string, error) { return names, nil })
+}
+
+// StackBlock returns the block names combine into.
+func StackBlock(names []string) (json.RawMessage, error) {
+	if err := validateStack(names); err != nil {
+		return nil, err
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, err
+	}
+	return in.stack(names)
+}
+
+// ExportStackOpenCode is ExportOpenCode for the block names combine into.
+func ExportStackOpenCode(names []string) ([]byte, error) {
+	return ExportStackHarness(names, config.OpenCodeKey)
+}
+
+// ExportStackHarness is ExportHarness for the block names combine into.
+func ExportStackHarness(names []string, key string) ([]byte, error) {
+	block, err := StackBlock(names)
+	if err != nil {
+		return nil, err
+	}
+	return exportHarnessOf(StackLabel(names), key, block)
+}
+
+func validateStack(names []string) error {
+	if len(names) == 0 {
+		return ErrEmptyName
+	}
+	for i, name := range names {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+		if slices.Contains(names[:i], name) {
+			return &DuplicateOverlayError{Name: name}
+		}
+	}
+	return nil
+}
+
+// stack returns the block the overlays names combine into.
+func (in *inheritance) stack(names []string) (json.RawMessage, error) {
+	var combined json.RawMessage
+	for _, name := range names {
+		block, ok, err := in.block(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &NotFoundError{Name: name}
+		}
+		if combined == nil {
+			combined = block
+			continue
+		}
+		if combined, err = mergeJSONWith(combined, block, "", unionAt); err != nil {
+			return nil, fmt.Errorf("overlay profile %q: %w", name, err)
+		}
+	}
+	return combined, nil
+}
+
+// stackExists reports whether every overlay of names is a profile of doc.
+func stackExists(doc *config.Document, names []string) bool {
+	for _, name := range names {
+		if !doc.HasProfile(name) {
+			return false
+		}
+	}
+	return len(names) > 0
+}
+
+// unionAt unions two arrays at one of UnionArrayPaths (see unionArrays) and
+// leaves any other pair to mergeJSON.
+func unionAt(path string, base, over json.RawMessage) (json.RawMessage, bool, error) {
+	if !slices.Contains(UnionArrayPaths, path) {
+		return nil, false, nil
+	}
+	return unionArrays(base, over)
+}
+
+// unionArrays returns base followed by the elements of over base lacks. ok is
+// false when either is not an array.
+func unionArrays(base, over json.RawMessage) (json.RawMessage, bool, error) {
+	var baseItems, overItems []json.RawMessage
+	if json.Unmarshal(base, &baseItems) != nil || json.Unmarshal(over, &overItems) != nil ||
+		baseItems == nil || overItems == nil {
+		return nil, false, nil
+	}
+	seen := map[string]bool{}
+	union := make([]json.RawMessage, 0, len(baseItems)+len(overItems))
+	for _, item := range append(baseItems, overItems...) {
+		canon, err := canonicalJSON(item)
+		if err != nil {
+			return nil, true, err
+		}
+		if seen[string(canon)] {
+			continue
+		}
+		seen[string(canon)] = true
+		union = append(union, item)
+	}
+	encoded, err := config.EncodeValue(union)
+	return encoded, true, err
+}
@@ -0,0 +1,120 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func seedStackProfiles(t *testing.T) {
+	t.Helper()
+	seedProfileBlock(t, "base", json.RawMessage(`{"[opencode]":{"telemetry":true,"agents":{"oracle":{"model":"a"},"build":{"model":"b"}},"disabled_hooks":["x"],"experimental":{"flags":["one"]}},"hooks":[1]}`))
+	seedProfileBlock(t, "fast", json.RawMessage(`{"[opencode]":{"agents":{"oracle":{"model":"fast"}},"experimental":{"flags":["two"]}}}`))
+	seedProfileBlock(t, "quiet", json.RawMessage(`{"[opencode]":{"telemetry":false,"disabled_hooks":["telemetry","x"]}}`))
+}
+
+func TestStackBlock_MergesInOrder(t *testing.T) {
+	setupTestEnv(t)
+	seedStackProfiles(t)
+
+	block, err := StackBlock([]string{"base", "fast", "quiet"})
+	if err != nil {
+		t.Fatalf("StackBlock: %v", err)
+	}
+	// disabled_hooks is unioned; experimental.flags is replaced.
+	want := `{"[opencode]":{"agents":{"build":{"model":"b"},"oracle":{"model":"fast"}},"disabled_hooks":["x","telemetry"],"experimental":{"flags":["two"]},"telemetry":false},"hooks":[1]}`
+	if got := mustCanonical(t, block); string(got) != want {
+		t.Errorf("StackBlock = %s, want %s", got, want)
+	}
+
+	var duplicate *DuplicateOverlayError
+	if _, err := StackBlock([]string{"base", "base"}); !errors.As(err, &duplicate) {
+		t.Errorf("StackBlock(base, base) = %v, want *DuplicateOverlayError", err)
+	}
+	var notFound *NotFoundError
+	if _, err := StackBlock([]string{"base", "missing"}); !errors.As(err, &notFound) {
+		t.Errorf("StackBlock(base, missing) = %v, want *NotFoundError", err)
+	}
+}
+
+// A unioned array keeps <, > and & as written.
+func TestStackBlock_UnionKeepsHTMLCharacters(t *testing.T) {
+	setupTestEnv(t)
+	seedProfileBlock(t, "a", json.RawMessage(`{"[opencode]":{"disabled_mcps":["<a&b>"]}}`))
+	seedProfileBlock(t, "b", json.RawMessage(`{"[opencode]":{"disabled_mcps":["c>d"]}}`))
+
+	block, err := StackBlock([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("StackBlock: %v", err)
+	}
+	if !bytes.Contains(block, []byte(`["<a&b>","c>d"]`)) {
+		t.Errorf("StackBlock = %s, want the union as written", block)
+	}
+}
+
+func TestApplyStack_DetectedSwitchedBackAndReverted(t *testing.T) {
+	setupTestEnv(t)
+	seedStackProfiles(t)
+	stack := []string{"base", "fast", "quiet"}
+
+	applied, err := ApplyStack(stack, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("ApplyStack: %v", err)
+	}
+	if applied.Name != "base + fast + quiet" || !reflect.DeepEqual(applied.Stack, stack) {
+		t.Errorf("Applied = %+v, want the labelled stack", applied)
+	}
+	active, err := GetActive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active.State != ActiveExact || active.ProfileName != "" || !reflect.DeepEqual(active.Stack, stack) || active.Modified {
+		t.Errorf("active = %s %q stack %v modified %v, want exact stack", active.State, active.ProfileName, active.Stack, active.Modified)
+	}
+
+	if _, err := Apply("fast"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	journal, err := Journal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := journal[len(journal)-1]; last.Snapshot != "" || !reflect.DeepEqual(last.PreviousStack, stack) {
+		t.Errorf("entry = %+v, want the stack as previous and no snapshot", last)
+	}
+
+	if _, err := SwitchBack(); err != nil {
+		t.Fatalf("SwitchBack: %v", err)
+	}
+	if active, _ := GetActive(); !reflect.DeepEqual(active.Stack, stack) || active.State != ActiveExact {
+		t.Errorf("after SwitchBack stack = %v (%s), want %v", active.Stack, active.State, stack)
+	}
+
+	if err := Rename("quiet", "silent"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if active, _ := GetActive(); active.State != ActiveExact || active.Stack[2] != "silent" {
+		t.Errorf("after rename stack = %v (%s), want the renamed overlay", active.Stack, active.State)
+	}
+
+	if err := config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw("hooks", json.RawMessage(`[2]`))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := GetActive(); active.State != ActiveDrifted || len(active.Stack) != 3 || active.ProfileChanged {
+		t.Errorf("after edit = %s stack %v changed %v, want drifted from the stack", active.State, active.Stack, active.ProfileChanged)
+	}
+
+	if _, err := Revert(); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	if active, _ := GetActive(); active.State != ActiveExact || active.ProfileName != "fast" {
+		t.Errorf("after revert = %s %q, want exact fast", active.State, active.ProfileName)
+	}
+}
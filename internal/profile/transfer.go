@@ -0,0 +1,257 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Profiles move between machines as files of three shapes, which import tells
+// apart by their keys:
+//
+//   - flat: one harness block's payload, what `export` writes;
+//   - block: a whole `profiles.<name>` block, `[opencode]` next to `[senpi]`,
+//     `[codex]` and shared keys, what `export --full` writes;
+//   - document: an omo document whose profiles are imported, what
+//     `export --all` writes — any omo.json works too.
+//
+// Exports are resolved against parents, so a block stands on its own on a
+// machine that lacks them. Inheritance lives in the settings sidecar, not in
+// the document, and does not travel.
+
+// ImportFormat is the shape of an import file.
+type ImportFormat string
+
+const (
+	ImportFlat     ImportFormat = "flat"
+	ImportBlock    ImportFormat = "block"
+	ImportDocument ImportFormat = "document"
+)
+
+// ConflictPolicy says what an import does with a profile whose name is taken.
+type ConflictPolicy string
+
+const (
+	// ConflictRename imports it as name-1, name-2, … (the default).
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictSkip leaves the existing profile and imports nothing.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces the existing block, and drops its parent so
+	// the imported, already resolved block is what it applies.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+)
+
+// ParseConflictPolicy reads a policy name; "" is ConflictRename.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case "":
+		return ConflictRename, nil
+	case ConflictRename, ConflictSkip, ConflictOverwrite:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (one of: rename, skip, overwrite)", s)
+}
+
+// ImportEntry is one profile of an import file.
+type ImportEntry struct {
+	Name  string
+	Block json.RawMessage
+}
+
+// ImportOutcome reports what Import did with one entry.
+type ImportOutcome struct {
+	// Name is the entry's name; Imported the profile it was stored as, ""
+	// when skipped.
+	Name     string `json:"name"`
+	Imported string `json:"imported,omitempty"`
+	// Action is "created", "renamed", "overwritten" or "skipped".
+	Action string `json:"action"`
+}
+
+// DetectImport tells the shape of data: a document has an object `profiles`,
+// a block has a harness key such as `[opencode]`, anything else is flat.
+func DetectImport(data []byte) (ImportFormat, error) {
+	fields, ok := jsonObject(data)
+	if !ok {
+		return "", fmt.Errorf("import file is not a JSON object")
+	}
+	if profiles, ok := fields[config.ProfilesKey]; ok {
+		if _, ok := jsonObject(profiles); ok {
+			return ImportDocument, nil
+		}
+	}
+	for key := range fields {
+		if config.IsHarnessKey(key) {
+			return ImportBlock, nil
+		}
+	}
+	return ImportFlat, nil
+}
+
+// ReadImport returns the shape of data and the profiles it holds. A document
+// yields its profiles sorted by name; a block or flat file one entry named
+// name, a flat file becoming harness block key of an otherwise empty profile.
+func ReadImport(data []byte, name, key string) (ImportFormat, []ImportEntry, error) {
+	format, err := DetectImport(data)
+	if err != nil {
+		return "", nil, err
+	}
+	switch format {
+	case ImportDocument:
+		fields, _ := jsonObject(data)
+		profiles, _ := jsonObject(fields[config.ProfilesKey])
+		entries := make([]ImportEntry, 0, len(profiles))
+		for name, block := range profiles {
+			if _, ok := jsonObject(block); !ok {
+				return "", nil, fmt.Errorf("profile %q is not a JSON object", name)
+			}
+			entries = append(entries, ImportEntry{Name: name, Block: block})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+		return format, entries, nil
+	case ImportBlock:
+		return format, []ImportEntry{{Name: name, Block: data}}, nil
+	}
+	// As WriteHarnessBlockInto: an empty block other than `[opencode]` is
+	// not stored.
+	block := map[string]json.RawMessage{key: data}
+	if key != config.OpenCodeKey {
+		block[config.OpenCodeKey] = json.RawMessage("{}")
+		if fields, _ := jsonObject(data); len(fields) == 0 {
+			delete(block, key)
+		}
+	}
+	encoded, err := marshalSortedJSONObject(block)
+	if err != nil {
+		return "", nil, err
+	}
+	return format, []ImportEntry{{Name: name, Block: encoded}}, nil
+}
+
+// Import stores entries as profiles in one backed-up transaction, settling
+// taken names by policy. An invalid entry name fails the whole import before
+// anything is written.
+func Import(entries []ImportEntry, policy ConflictPolicy) ([]ImportOutcome, error) {
+	for _, entry := range entries {
+		if err := ValidateName(entry.Name); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", entry.Name, err)
+		}
+	}
+	var outcomes []ImportOutcome
+	var overwritten []string
+	wrote := false
+	err := config.WithDocumentLock(func() error {
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			outcome := ImportOutcome{Name: entry.Name, Imported: entry.Name, Action: "created"}
+			if doc.HasProfile(entry.Name) {
+				switch policy {
+				case ConflictSkip:
+					outcome.Imported, outcome.Action = "", "skipped"
+				case ConflictOverwrite:
+					outcome.Action = "overwritten"
+					overwritten = append(overwritten, entry.Name)
+				default:
+					outcome.Imported, _ = availableName(doc, entry.Name)
+					outcome.Action = "renamed"
+				}
+			}
+			outcomes = append(outcomes, outcome)
+			if outcome.Imported == "" {
+				continue
+			}
+			if err := doc.SetProfileBlock(outcome.Imported, entry.Block); err != nil {
+				return err
+			}
+			wrote = true
+		}
+		if !wrote {
+			return nil
+		}
+		doc.EnsureSchema()
+		operation := "import"
+		if err := backup.Before(operation); err != nil {
+			return err
+		}
+		if err := doc.SaveFor(operation); err != nil {
+			return err
+		}
+		return editSettings(func(s *Settings) bool {
+			changed := false
+			for _, name := range overwritten {
+				if ps := s.Profiles[name]; ps.Extends != "" {
+					ps.Extends = ""
+					setProfileSettings(s, name, ps)
+					changed = true
+				}
+			}
+			return changed
+		})
+	})
+	if !config.Saved(err) {
+		return nil, err
+	}
+	return outcomes, err
+}
+
+// ExportBlock returns profile name's whole block — every harness it
+// configures and the shared keys — resolved against its parents and
+// pretty-printed.
+func ExportBlock(name string) ([]byte, error) {
+	block, err := ResolvedBlock(name)
+	if err != nil {
+		return nil, err
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, block, "", "  "); err != nil {
+		return nil, fmt.Errorf("format profile %q: %w", name, err)
+	}
+	return pretty.Bytes(), nil
+}
+
+// ExportDocument returns an omo document holding only profiles, each block
+// resolved as ExportBlock does: names, or every profile when names is empty.
+func ExportDocument(names []string) ([]byte, error) {
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		if names, err = doc.ProfileNames(); err != nil {
+			return nil, err
+		}
+	}
+	in, err := newInheritance(doc)
+	if err != nil {
+		return nil, err
+	}
+	profiles := make(map[string]json.RawMessage, len(names))
+	for _, name := range names {
+		block, ok, err := in.block(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &NotFoundError{Name: name}
+		}
+		profiles[name] = block
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]any{
+		config.SchemaKey:   config.DefaultSchema,
+		config.ProfilesKey: profiles,
+	}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,100 @@
+package profile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func TestDetectImport(t *testing.T) {
+	tests := []struct {
+		data string
+		want ImportFormat
+	}{
+		{`{"telemetry":false}`, ImportFlat},
+		{`{"[opencode]":{},"[senpi]":{}}`, ImportBlock},
+		{`{"$schema":"x","profiles":{"a":{"[opencode]":{}}}}`, ImportDocument},
+	}
+	for _, tt := range tests {
+		got, err := DetectImport([]byte(tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("DetectImport(%s) = %q, %v; want %q", tt.data, got, err, tt.want)
+		}
+	}
+	if _, err := DetectImport([]byte(`[1]`)); err == nil {
+		t.Error("DetectImport([1]) succeeded, want an error")
+	}
+}
+
+func TestExportDocument_RoundTripsThroughImport(t *testing.T) {
+	setupTestEnv(t)
+	seedBaseAndChild(t)
+	if _, err := UpdateHarnessBlockIfRevision("child", "[codex]", []byte(`{"categories":{"q":{"model":"m"}}}`), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ExportDocument(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, entries, err := ReadImport(data, "", config.OpenCodeKey)
+	if err != nil || format != ImportDocument || len(entries) != 2 {
+		t.Fatalf("ReadImport = %q, %d entries, %v; want a document of 2", format, len(entries), err)
+	}
+	resolved, err := ResolvedBlock("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := mustCanonical(t, entries[1].Block), mustCanonical(t, resolved); string(got) != string(want) {
+		t.Errorf("exported child = %s, want resolved %s", got, want)
+	}
+
+	outcomes, err := Import(entries, ConflictRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportOutcome{
+		{Name: "base", Imported: "base-1", Action: "renamed"},
+		{Name: "child", Imported: "child-1", Action: "renamed"},
+	}
+	if len(outcomes) != len(want) || outcomes[0] != want[0] || outcomes[1] != want[1] {
+		t.Errorf("Import = %+v, want %+v", outcomes, want)
+	}
+}
+
+func TestImport_SkipAndOverwrite(t *testing.T) {
+	setupTestEnv(t)
+	seedBaseAndChild(t)
+	entries := []ImportEntry{{Name: "child", Block: json.RawMessage(`{"[opencode]":{"telemetry":false}}`)}}
+
+	outcomes, err := Import(entries, ConflictSkip)
+	if err != nil || len(outcomes) != 1 || outcomes[0].Action != "skipped" {
+		t.Fatalf("Import skip = %+v, %v", outcomes, err)
+	}
+	own, err := OwnBlock("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCanonical(t, own); string(got) != `{"[opencode]":{"agents":{"build":{"model":"c"}}}}` {
+		t.Errorf("skipped child = %s, want it unchanged", got)
+	}
+
+	if _, err := Import(entries, ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := ResolvedBlock("child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustCanonical(t, resolved); string(got) != `{"[opencode]":{"telemetry":false}}` {
+		t.Errorf("overwritten child = %s, want the imported block alone", got)
+	}
+	if ancestors, _ := Ancestors("child"); len(ancestors) != 0 {
+		t.Errorf("overwritten child still extends %v", ancestors)
+	}
+
+	if _, err := Import([]ImportEntry{{Name: "bad name", Block: json.RawMessage(`{}`)}}, ConflictRename); err == nil {
+		t.Error("Import of an invalid name succeeded")
+	}
+}
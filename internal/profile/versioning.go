@@ -0,0 +1,52 @@
+package profile
+
+import (
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+)
+
+// With git versioning on, every save of the document is also committed to
+// the repository in config.HistoryDir, by the same hook that prunes backups,
+// and pushed once the write's lock is released. A failed commit or push does
+// not undo the save; the transaction reports it as *config.AfterSaveError.
+
+// SetVersioning turns git versioning of the document on or off. Turning it
+// on creates the repository when needed, makes remote its origin when it is
+// not "", and commits the document as it is. Turning it off keeps the
+// repository and its history. A *vcs.PushError leaves versioning on.
+func SetVersioning(on bool, remote string) error {
+	err := config.WithDocumentLock(func() error {
+		if on {
+			if err := vcs.Init(remote); err != nil {
+				return err
+			}
+			if err := vcs.Record("start versioning"); err != nil {
+				return err
+			}
+		}
+		return editSettings(func(s *Settings) bool {
+			if s.Git == on {
+				return false
+			}
+			s.Git = on
+			return true
+		})
+	})
+	if err != nil || !on {
+		return err
+	}
+	return vcs.Push()
+}
+
+// commitVersion commits the document just saved by operation, when git
+// versioning is on, and returns the push to run once the lock is released.
+func commitVersion(operation string) (push func() error, err error) {
+	settings, err := LoadSettings()
+	if err != nil || !settings.Git {
+		return nil, err
+	}
+	if err := vcs.Record(operation); err != nil {
+		return nil, err
+	}
+	return vcs.Push, nil
+}
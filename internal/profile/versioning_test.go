@@ -0,0 +1,125 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/redact"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+)
+
+// With versioning on each write is a commit named after its operation;
+// turned off, writes are no longer committed but the history stays.
+func TestVersioning_CommitsEveryWrite(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	setupTestEnv(t)
+	if err := Create("work", config.Config{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := SetVersioning(true, ""); err != nil {
+		t.Fatalf("SetVersioning: %v", err)
+	}
+	if err := SetField("work", "disabled_mcps", json.RawMessage(`["x"]`), nil); err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+
+	commits, err := vcs.Log("", 0)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "set work.disabled_mcps" || commits[1].Subject != "start versioning" {
+		t.Fatalf("commits %+v, want the set over the initial commit", commits)
+	}
+	if p := commits[0].Profiles; len(p) != 1 || p[0] != "work" {
+		t.Errorf("profiles of the set %v, want [work]", p)
+	}
+
+	if err := SetVersioning(false, ""); err != nil {
+		t.Fatalf("SetVersioning off: %v", err)
+	}
+	if err := SetField("work", "disabled_mcps", json.RawMessage(`["y"]`), nil); err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+	if after, _ := vcs.Log("", 0); len(after) != 2 {
+		t.Errorf("%d commits after turning versioning off, want 2", len(after))
+	}
+}
+
+// A push that fails leaves the write and its commit in place and is reported
+// by the write, once its lock is released.
+func TestVersioning_ReportsAFailedPush(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	setupTestEnv(t)
+	if err := Create("work", config.Config{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.git")
+	if err := SetVersioning(true, missing); !errors.As(err, new(*vcs.PushError)) {
+		t.Fatalf("SetVersioning = %v, want *vcs.PushError", err)
+	}
+
+	err := SetField("work", "disabled_mcps", json.RawMessage(`["x"]`), nil)
+	if !errors.As(err, new(*config.AfterSaveError)) || !errors.As(err, new(*vcs.PushError)) {
+		t.Fatalf("SetField = %v, want *config.AfterSaveError for the push", err)
+	}
+	if p, _ := Load("work"); len(p.Config.DisabledMCPs) != 1 {
+		t.Errorf("disabled_mcps %v, want the write kept", p.Config.DisabledMCPs)
+	}
+	if status, _ := vcs.GetStatus(); status.Unpushed != 2 {
+		t.Errorf("status %+v, want both commits waiting for a push", status)
+	}
+}
+
+// The root holds what references resolved to; commits hold it masked, and a
+// checkout keeps the secrets the document has.
+func TestVersioning_MasksSecrets(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	setupTestEnv(t)
+	seedProfile(t, "bot", refsProfile)
+	t.Setenv("OMO_TEST_DISCORD", "d-secret")
+	writeSecretFile(t, "t-secret\n")
+	if _, err := Apply("bot"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if err := SetVersioning(true, ""); err != nil {
+		t.Fatalf("SetVersioning: %v", err)
+	}
+
+	committed, err := vcs.Show("HEAD")
+	if err != nil {
+		t.Fatalf("Show: %v", err)
+	}
+	if strings.Contains(string(committed), "-secret") || !strings.Contains(string(committed), redact.Mask) {
+		t.Errorf("commit holds the resolved secrets:\n%s", committed)
+	}
+	if !strings.Contains(string(committed), "${env:OMO_TEST_DISCORD}") {
+		t.Errorf("commit lost the profile's references:\n%s", committed)
+	}
+
+	t.Setenv("OMO_TEST_DISCORD", "d-rotated")
+	if _, err := Apply("bot"); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if err := vcs.Restore("HEAD"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _ := doc.Raw(config.OpenCodeKey)
+	if strings.Contains(string(root), redact.Mask) || !strings.Contains(string(root), "d-rotated") {
+		t.Errorf("root after the checkout %s, want the live secrets", root)
+	}
+}
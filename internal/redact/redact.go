@@ -0,0 +1,347 @@
+// Package redact masks credentials in configurations shown to a user: bot
+// tokens, API keys and the secret headers of gateways.
+//
+// A string is a secret when
+//
+//   - the schema says so: a string field of `[opencode]` whose name marks a
+//     credential (see schema.Secrets), such as
+//     openclaw.replyListener.discordBotToken;
+//   - it is a value of a header map (openclaw.gateways.*.headers, or any
+//     object called "headers") and either the header's name marks a
+//     credential (Authorization, Cookie, X-Api-Key, …), or the value starts
+//     with an authentication scheme (`Bearer …`), or it looks like a token;
+//   - outside the schema, its field's name marks a credential.
+//
+// Strings holding a `${env:…}` or `${file:…}` reference are never masked: the
+// reference is not the secret, and it is what a profile should show.
+//
+// Masking keeps the order of keys and, for an indented input, the
+// indentation, so masked configurations still diff line by line.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/schema"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+)
+
+// Mask replaces a secret.
+const Mask = "••••"
+
+var (
+	secretHeaderPattern = regexp.MustCompile(`(?i)(auth|token|secret|key|cookie|session|signature|password|credential)`)
+	authSchemePattern   = regexp.MustCompile(`(?i)^(bearer|basic|token|digest|bot)\s+\S`)
+	tokenLikePattern    = regexp.MustCompile(`^[A-Za-z0-9._~+/=:-]{20,}$`)
+	hasLetter           = regexp.MustCompile(`[A-Za-z]`)
+	hasDigit            = regexp.MustCompile(`[0-9]`)
+)
+
+func init() {
+	// The git history masks what every view of the document masks.
+	vcs.MaskSecretsWith(At, Restore)
+}
+
+// OpenCode returns data, an `[opencode]` configuration, with its secrets
+// masked.
+func OpenCode(data []byte) ([]byte, error) {
+	return At(config.OpenCodeKey, data)
+}
+
+// At returns data, the value at block path path (keys joined with dots, "" for
+// a whole block), with its secrets masked. data is returned as is when it holds
+// none.
+func At(path string, data []byte) ([]byte, error) {
+	classify, err := classifier()
+	if err != nil {
+		return nil, err
+	}
+	return rewrite(data, splitPath(path), func(path []string, s string) (string, bool) {
+		if classify(path, s) {
+			return Mask, true
+		}
+		return "", false
+	})
+}
+
+// StripOpenCode returns data, an `[opencode]` configuration, with every field
+// holding a secret removed, for an export that can be shared and imported
+// without carrying masks as values.
+func StripOpenCode(data []byte) ([]byte, error) {
+	return Strip(config.OpenCodeKey, data)
+}
+
+// Strip is StripOpenCode for the value at block path path.
+func Strip(path string, data []byte) ([]byte, error) {
+	classify, err := classifier()
+	if err != nil {
+		return nil, err
+	}
+	return rewriteWith(data, splitPath(path), true, func(path []string, s string) (string, bool) {
+		return "", classify(path, s)
+	})
+}
+
+// Restore returns edited, a configuration that was shown masked, with every
+// Mask put back to the value stored holds at the same path, so saving what a
+// user edited does not overwrite secrets they never saw. A Mask stored has no
+// string for is left as is.
+func Restore(edited, stored []byte) ([]byte, error) {
+	if !bytes.Contains(edited, []byte(Mask)) {
+		return edited, nil
+	}
+	var original any
+	if len(bytes.TrimSpace(stored)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(stored))
+		dec.UseNumber()
+		if err := dec.Decode(&original); err != nil {
+			return nil, fmt.Errorf("parse stored configuration: %w", err)
+		}
+	}
+	return rewrite(edited, nil, func(path []string, s string) (string, bool) {
+		if s != Mask {
+			return "", false
+		}
+		value, ok := lookup(original, path).(string)
+		return value, ok
+	})
+}
+
+// classifier returns the test deciding whether string s at block path path
+// is a secret.
+func classifier() (func(path []string, s string) bool, error) {
+	secrets, err := schema.Secrets()
+	if err != nil {
+		return nil, err
+	}
+	return func(path []string, s string) bool {
+		if s == "" || s == Mask || config.ContainsReference(s) || len(path) == 0 {
+			return false
+		}
+		key := path[len(path)-1]
+		parent := path[:len(path)-1]
+		if rel, ok := openCodePath(path); ok {
+			if matchAny(secrets.Values, rel) {
+				return true
+			}
+			if matchAny(secrets.HeaderMaps, rel[:len(rel)-1]) {
+				return isSecretHeader(key, s)
+			}
+		}
+		if len(parent) > 0 && strings.EqualFold(parent[len(parent)-1], "headers") {
+			return isSecretHeader(key, s)
+		}
+		return schema.IsSecretName(key)
+	}, nil
+}
+
+// isSecretHeader reports whether header name carries a credential as value.
+func isSecretHeader(name, value string) bool {
+	return secretHeaderPattern.MatchString(name) ||
+		authSchemePattern.MatchString(value) ||
+		(tokenLikePattern.MatchString(value) && hasLetter.MatchString(value) && hasDigit.MatchString(value))
+}
+
+// openCodePath returns the part of path inside an `[opencode]` block, so a
+// profile block or a whole document masks like the block itself.
+func openCodePath(path []string) ([]string, bool) {
+	i := slices.Index(path, config.OpenCodeKey)
+	if i < 0 || i == len(path)-1 {
+		return nil, false
+	}
+	return path[i+1:], true
+}
+
+// matchAny reports whether path matches one of the dotted patterns, `*`
+// matching any key.
+func matchAny(patterns []string, path []string) bool {
+	for _, pattern := range patterns {
+		segs := strings.Split(pattern, ".")
+		if len(segs) != len(path) {
+			continue
+		}
+		match := true
+		for i, seg := range segs {
+			if seg != "*" && seg != path[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits a dotted block path. `[opencode]` contains no dot, so a
+// plain split is exact for the paths callers pass.
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// lookup returns the value at path in v, array elements addressed as "[i]".
+func lookup(v any, path []string) any {
+	for _, seg := range path {
+		switch t := v.(type) {
+		case map[string]any:
+			v = t[seg]
+		case []any:
+			i, err := strconv.Atoi(strings.Trim(seg, "[]"))
+			if err != nil || i < 0 || i >= len(t) {
+				return nil
+			}
+			v = t[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// rewrite re-encodes data with every string replace changes replaced, keeping
+// key order, and indentation when data is indented. data is returned as is
+// when nothing changes.
+func rewrite(data []byte, base []string, replace func(path []string, s string) (string, bool)) ([]byte, error) {
+	return rewriteWith(data, base, false, replace)
+}
+
+// rewriteWith is rewrite; with drop, an object member whose string replace
+// changes is removed instead.
+func rewriteWith(data []byte, base []string, drop bool, replace func(path []string, s string) (string, bool)) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	w := &writer{dec: dec, replace: replace, drop: drop}
+	if err := w.value(append([]string(nil), base...)); err != nil {
+		return nil, err
+	}
+	if !w.changed {
+		return data, nil
+	}
+	if !bytes.Contains(bytes.TrimSpace(data), []byte("\n")) {
+		return w.buf.Bytes(), nil
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, w.buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		pretty.WriteByte('\n')
+	}
+	return pretty.Bytes(), nil
+}
+
+type writer struct {
+	dec     *json.Decoder
+	buf     bytes.Buffer
+	replace func(path []string, s string) (string, bool)
+	drop    bool
+	changed bool
+}
+
+func (w *writer) value(path []string) error {
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	return w.token(tok, path)
+}
+
+func (w *writer) token(tok json.Token, path []string) error {
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return w.object(path)
+		}
+		return w.array(path)
+	case string:
+		if replacement, ok := w.replace(path, t); ok {
+			t = replacement
+			w.changed = true
+		}
+		return w.string(t)
+	case json.Number:
+		w.buf.WriteString(t.String())
+	case bool:
+		w.buf.WriteString(strconv.FormatBool(t))
+	case nil:
+		w.buf.WriteString("null")
+	}
+	return nil
+}
+
+func (w *writer) object(path []string) error {
+	w.buf.WriteByte('{')
+	for written := 0; w.dec.More(); {
+		tok, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		if tok, err = w.dec.Token(); err != nil {
+			return err
+		}
+		if s, ok := tok.(string); ok && w.drop {
+			if _, ok := w.replace(append(path, key), s); ok {
+				w.changed = true
+				continue
+			}
+		}
+		if written > 0 {
+			w.buf.WriteByte(',')
+		}
+		written++
+		if err := w.string(key); err != nil {
+			return err
+		}
+		w.buf.WriteByte(':')
+		if err := w.token(tok, append(path, key)); err != nil {
+			return err
+		}
+	}
+	if _, err := w.dec.Token(); err != nil {
+		return err
+	}
+	w.buf.WriteByte('}')
+	return nil
+}
+
+func (w *writer) array(path []string) error {
+	w.buf.WriteByte('[')
+	for i := 0; w.dec.More(); i++ {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		if err := w.value(append(path, fmt.Sprintf("[%d]", i))); err != nil {
+			return err
+		}
+	}
+	if _, err := w.dec.Token(); err != nil {
+		return err
+	}
+	w.buf.WriteByte(']')
+	return nil
+}
+
+// string writes s as a JSON string without escaping HTML characters, which
+// the input did not escape either.
+func (w *writer) string(s string) error {
+	var enc bytes.Buffer
+	e := json.NewEncoder(&enc)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(s); err != nil {
+		return err
+	}
+	w.buf.Write(bytes.TrimSuffix(enc.Bytes(), []byte("\n")))
+	return nil
+}
@@ -0,0 +1,114 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const openCode = `{
+  "openclaw": {
+    "gateways": {
+      "hook": {
+        "type": "http",
+        "method": "POST",
+        "headers": {
+          "Content-Type": "application/json",
+          "Authorization": "Bearer abc",
+          "X-Trace": "a1b2c3d4e5f6a7b8c9d0e1f2"
+        }
+      }
+    },
+    "replyListener": {
+      "discordBotToken": "d-secret",
+      "telegramBotToken": "${env:TG_TOKEN}",
+      "discordChannelId": "42"
+    }
+  },
+  "agents": {
+    "oracle": {
+      "maxTokens": 4000
+    }
+  }
+}
+`
+
+func TestOpenCode_MasksSecretsAndKeepsLayout(t *testing.T) {
+	masked, err := OpenCode([]byte(openCode))
+	require.NoError(t, err)
+
+	want := `{
+  "openclaw": {
+    "gateways": {
+      "hook": {
+        "type": "http",
+        "method": "POST",
+        "headers": {
+          "Content-Type": "application/json",
+          "Authorization": "••••",
+          "X-Trace": "••••"
+        }
+      }
+    },
+    "replyListener": {
+      "discordBotToken": "••••",
+      "telegramBotToken": "${env:TG_TOKEN}",
+      "discordChannelId": "42"
+    }
+  },
+  "agents": {
+    "oracle": {
+      "maxTokens": 4000
+    }
+  }
+}
+`
+	assert.Equal(t, want, string(masked))
+
+	plain := []byte(`{"agents":{"oracle":{"model":"a"}}}`)
+	same, err := OpenCode(plain)
+	require.NoError(t, err)
+	assert.Equal(t, string(plain), string(same))
+}
+
+func TestAt_NameHeuristicOutsideTheSchema(t *testing.T) {
+	masked, err := At("", []byte(`{"[opencode]":{"mcp":{"apiKey":"k"}},"hooks":{"secret":"s","name":"n"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"[opencode]":{"mcp":{"apiKey":"••••"}},"hooks":{"secret":"••••","name":"n"}}`, string(masked))
+}
+
+func TestRestore(t *testing.T) {
+	masked, err := OpenCode([]byte(openCode))
+	require.NoError(t, err)
+
+	edited := []byte(`{"openclaw":{"replyListener":{"discordBotToken":"••••","discordChannelId":"43"},"gateways":{"hook":{"headers":{"Authorization":"Bearer new"}}}}}`)
+	restored, err := Restore(edited, []byte(openCode))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"openclaw":{"replyListener":{"discordBotToken":"d-secret","discordChannelId":"43"},"gateways":{"hook":{"headers":{"Authorization":"Bearer new"}}}}}`, string(restored))
+
+	roundTrip, err := Restore(masked, []byte(openCode))
+	require.NoError(t, err)
+	assert.JSONEq(t, openCode, string(roundTrip))
+}
+
+func TestStripOpenCode(t *testing.T) {
+	stripped, err := StripOpenCode([]byte(openCode))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "openclaw": {
+    "gateways": {"hook": {"type": "http", "method": "POST", "headers": {"Content-Type": "application/json"}}},
+    "replyListener": {"telegramBotToken": "${env:TG_TOKEN}", "discordChannelId": "42"}
+  },
+  "agents": {"oracle": {"maxTokens": 4000}}
+}`, string(stripped))
+}
+
+func TestStrip_Document(t *testing.T) {
+	doc := `{"profiles":{"bot":{"[opencode]":` + openCode + `}}}`
+	stripped, err := Strip("", []byte(doc))
+	require.NoError(t, err)
+	assert.NotContains(t, string(stripped), "d-secret")
+	assert.NotContains(t, string(stripped), "Bearer abc")
+	assert.Contains(t, string(stripped), "discordChannelId")
+}
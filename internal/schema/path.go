@@ -0,0 +1,168 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	openCodeTreeOnce sync.Once
+	openCodeTree     map[string]any
+	openCodeTreeErr  error
+)
+
+// openCodeNode returns the decoded `[opencode]` sub-schema.
+func openCodeNode() (map[string]any, error) {
+	openCodeTreeOnce.Do(func() {
+		data, err := GetOpenCodeSchema()
+		if err != nil {
+			openCodeTreeErr = err
+			return
+		}
+		openCodeTreeErr = json.Unmarshal(data, &openCodeTree)
+	})
+	return openCodeTree, openCodeTreeErr
+}
+
+// TypesAt returns the JSON types ("string", "number", "array", …) the
+// `[opencode]` sub-schema allows at a dotted field path — the syntax of
+// profile.FieldSelection, where `*` stands for any key. Alternatives from
+// anyOf / oneOf are merged. An unknown path yields no types and no error.
+func TypesAt(path string) ([]string, error) {
+	root, err := openCodeNode()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []map[string]any{root}
+	for _, seg := range strings.Split(path, ".") {
+		nodes = childNodes(nodes, seg)
+		if len(nodes) == 0 {
+			return nil, nil
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, n := range expandAlternatives(nodes) {
+		switch t := n["type"].(type) {
+		case string:
+			seen[t] = true
+		case []any:
+			for _, v := range t {
+				if s, ok := v.(string); ok {
+					seen[s] = true
+				}
+			}
+		}
+	}
+	types := make([]string, 0, len(seen))
+	for t := range seen {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types, nil
+}
+
+// childNodes returns the schemas that may describe key seg of an object
+// matching any of nodes.
+func childNodes(nodes []map[string]any, seg string) []map[string]any {
+	var out []map[string]any
+	for _, n := range expandAlternatives(nodes) {
+		props, _ := n["properties"].(map[string]any)
+		if seg == "*" {
+			for _, p := range props {
+				if child, ok := p.(map[string]any); ok {
+					out = append(out, child)
+				}
+			}
+		} else if child, ok := props[seg].(map[string]any); ok {
+			out = append(out, child)
+			continue
+		}
+		if extra, ok := n["additionalProperties"].(map[string]any); ok {
+			out = append(out, extra)
+		}
+	}
+	return out
+}
+
+// expandAlternatives flattens anyOf / oneOf / allOf branches into the list.
+func expandAlternatives(nodes []map[string]any) []map[string]any {
+	var out []map[string]any
+	for _, n := range nodes {
+		out = append(out, n)
+		for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+			branches, _ := n[key].([]any)
+			for _, b := range branches {
+				if branch, ok := b.(map[string]any); ok {
+					out = append(out, expandAlternatives([]map[string]any{branch})...)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// ParseValue converts a command-line value for path into JSON, guided by the
+// types the schema allows there. `true`/`false`, numbers and `null` become
+// literals where the field accepts them, `[…]` / `{…}` are parsed as JSON for
+// array and object fields, a string field takes the text as-is, and an array
+// field that accepts no string also takes a comma-separated list.
+//
+// Paths the schema does not know are refused; callers that mean it can pass
+// raw JSON instead. The result is not validated — run it through
+// Validator.ValidateJSONForSave as part of the whole payload.
+func ParseValue(path, raw string) (json.RawMessage, error) {
+	types, err := TypesAt(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("unknown field %q", path)
+	}
+	allows := map[string]bool{}
+	for _, t := range types {
+		allows[t] = true
+	}
+
+	trimmed := strings.TrimSpace(raw)
+	if (allows["array"] && strings.HasPrefix(trimmed, "[")) || (allows["object"] && strings.HasPrefix(trimmed, "{")) {
+		if !json.Valid([]byte(trimmed)) {
+			return nil, fmt.Errorf("%s: invalid JSON value %s", path, trimmed)
+		}
+		return json.RawMessage(trimmed), nil
+	}
+	if allows["boolean"] && (trimmed == "true" || trimmed == "false") {
+		return json.RawMessage(trimmed), nil
+	}
+	if allows["integer"] {
+		if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return json.RawMessage(strconv.FormatInt(n, 10)), nil
+		}
+	}
+	if allows["number"] {
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return json.RawMessage(strconv.FormatFloat(f, 'f', -1, 64)), nil
+		}
+	}
+	if allows["null"] && trimmed == "null" {
+		return json.RawMessage("null"), nil
+	}
+	if allows["string"] {
+		return json.Marshal(raw)
+	}
+	if allows["array"] {
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return json.Marshal(items)
+	}
+	return nil, fmt.Errorf("%s: cannot use %q as %s", path, raw, strings.Join(types, " or "))
+}
@@ -0,0 +1,55 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypesAt(t *testing.T) {
+	types, err := TypesAt("agents.oracle.temperature")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"number"}, types)
+
+	// Categories are additionalProperties, reached by any name.
+	types, err = TypesAt("categories.my-own.temperature")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"number"}, types)
+
+	// anyOf alternatives are merged.
+	types, err = TypesAt("agents.*.fallback_models")
+	require.NoError(t, err)
+	assert.Contains(t, types, "string")
+	assert.Contains(t, types, "array")
+
+	types, err = TypesAt("agents.oracle.no_such_field")
+	require.NoError(t, err)
+	assert.Empty(t, types)
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		path, raw, want string
+	}{
+		{"agents.oracle.model", "openai/gpt-5", `"openai/gpt-5"`},
+		{"agents.oracle.model", "true", `"true"`},
+		{"agents.oracle.temperature", "0.30", `0.3`},
+		{"tmux.enabled", "false", `false`},
+		{"disabled_mcps", "a, b,,c", `["a","b","c"]`},
+		{"disabled_mcps", `["x"]`, `["x"]`},
+		{"agents.oracle.fallback_models", "a,b", `"a,b"`},
+	}
+	for _, tc := range tests {
+		got, err := ParseValue(tc.path, tc.raw)
+		require.NoError(t, err, "%s=%s", tc.path, tc.raw)
+		assert.JSONEq(t, tc.want, string(got), "%s=%s", tc.path, tc.raw)
+	}
+
+	_, err := ParseValue("agents.oracle.temperature", "hot")
+	assert.Error(t, err)
+	_, err = ParseValue("agents.oracle.modle", "x")
+	assert.ErrorContains(t, err, "unknown field")
+	_, err = ParseValue("disabled_mcps", "[broken")
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package schema
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// secretNamePattern matches field names that hold credentials: discordBotToken,
+// api_key, clientSecret, password. Counts such as maxTokens are not strings
+// and never reach it as secrets.
+var secretNamePattern = regexp.MustCompile(`(?i)(token|secret|password|passwd|api_?key|access_?key|private_?key|credential)s?$`)
+
+// IsSecretName reports whether a field called name conventionally holds a
+// credential.
+func IsSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+// SecretFields lists where the `[opencode]` sub-schema keeps credentials, as
+// dotted paths in the syntax of TypesAt, `*` standing for any key.
+type SecretFields struct {
+	// Values are string fields whose name says they hold a credential, e.g.
+	// openclaw.replyListener.discordBotToken.
+	Values []string
+	// HeaderMaps are objects of HTTP headers, e.g. openclaw.gateways.*.headers;
+	// which of their values are credentials depends on the header.
+	HeaderMaps []string
+}
+
+var (
+	secretFieldsOnce sync.Once
+	secretFields     SecretFields
+	secretFieldsErr  error
+)
+
+// Secrets returns the credential fields of the `[opencode]` sub-schema. The
+// walk runs once.
+func Secrets() (SecretFields, error) {
+	secretFieldsOnce.Do(func() {
+		root, err := openCodeNode()
+		if err != nil {
+			secretFieldsErr = err
+			return
+		}
+		values, headers := map[string]bool{}, map[string]bool{}
+		collectSecrets(root, "", values, headers)
+		secretFields = SecretFields{Values: sortedKeys(values), HeaderMaps: sortedKeys(headers)}
+	})
+	return secretFields, secretFieldsErr
+}
+
+func collectSecrets(node map[string]any, path string, values, headers map[string]bool) {
+	for _, n := range expandAlternatives([]map[string]any{node}) {
+		props, _ := n["properties"].(map[string]any)
+		for key, p := range props {
+			child, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			childPath := joinPath(path, key)
+			switch {
+			case key == "headers" && allowsType(child, "object"):
+				headers[childPath] = true
+			case IsSecretName(key) && allowsType(child, "string"):
+				values[childPath] = true
+			}
+			collectSecrets(child, childPath, values, headers)
+		}
+		if extra, ok := n["additionalProperties"].(map[string]any); ok {
+			collectSecrets(extra, joinPath(path, "*"), values, headers)
+		}
+	}
+}
+
+// allowsType reports whether node, or one of its alternatives, allows JSON
+// type t.
+func allowsType(node map[string]any, t string) bool {
+	for _, n := range expandAlternatives([]map[string]any{node}) {
+		switch v := n["type"].(type) {
+		case string:
+			if v == t {
+				return true
+			}
+		case []any:
+			for _, item := range v {
+				if item == t {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
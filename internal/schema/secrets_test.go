@@ -0,0 +1,28 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecrets(t *testing.T) {
+	secrets, err := Secrets()
+	require.NoError(t, err)
+	assert.Contains(t, secrets.Values, "openclaw.replyListener.discordBotToken")
+	assert.Contains(t, secrets.Values, "openclaw.replyListener.telegramBotToken")
+	assert.Contains(t, secrets.HeaderMaps, "openclaw.gateways.*.headers")
+	for _, path := range secrets.Values {
+		assert.NotContains(t, path, "maxTokens", "a number is never a secret")
+	}
+}
+
+func TestIsSecretName(t *testing.T) {
+	for _, name := range []string{"discordBotToken", "api_key", "apiKey", "clientSecret", "password", "credentials"} {
+		assert.True(t, IsSecretName(name), name)
+	}
+	for _, name := range []string{"discordChannelId", "model", "keyword_detector", "tokenizer"} {
+		assert.False(t, IsSecretName(name), name)
+	}
+}
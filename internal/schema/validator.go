@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -22,6 +23,12 @@ var (
 	// openCodeSchemaJSON is the `[opencode]` sub-schema carved out of the omo
 	// document schema. Populated by GetValidator.
 	openCodeSchemaJSON []byte
+
+	// harnessSchemaJSON holds the sub-schema of every harness block of the
+	// document schema, keyed by block key; harnessKeys lists those keys,
+	// `[opencode]` first. Populated by GetValidator.
+	harnessSchemaJSON map[string][]byte
+	harnessKeys       []string
 )
 
 // ValidationError represents a single validation error
@@ -34,12 +41,14 @@ func (e ValidationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Path, e.Message)
 }
 
-// Validator validates omo documents and the OpenCode harness blocks inside them.
+// Validator validates omo documents and the harness blocks inside them.
 type Validator struct {
 	// schema validates a flat `[opencode]` config, i.e. a config.Config.
 	schema *gojsonschema.Schema
 	// documentSchema validates a whole omo.json document.
 	documentSchema *gojsonschema.Schema
+	// harnesses validates each harness block, keyed by block key.
+	harnesses map[string]*gojsonschema.Schema
 }
 
 // GetEmbeddedSchema returns the raw embedded omo document schema.
@@ -57,6 +66,62 @@ func GetOpenCodeSchema() ([]byte, error) {
 	return openCodeSchemaJSON, nil
 }
 
+// HarnessKeys lists the harness blocks the document schema defines —
+// `[opencode]`, `[senpi]`, `[codex]` — `[opencode]` first, then by key.
+func HarnessKeys() ([]string, error) {
+	if _, err := GetValidator(); err != nil {
+		return nil, err
+	}
+	return harnessKeys, nil
+}
+
+// GetHarnessSchema returns the sub-schema of harness block key, self-contained
+// like GetOpenCodeSchema.
+func GetHarnessSchema(key string) ([]byte, error) {
+	if _, err := GetValidator(); err != nil {
+		return nil, err
+	}
+	data, ok := harnessSchemaJSON[key]
+	if !ok {
+		return nil, &UnknownHarnessError{Key: key}
+	}
+	return data, nil
+}
+
+// UnknownHarnessError is returned for a block key the document schema does not
+// define as a harness.
+type UnknownHarnessError struct{ Key string }
+
+func (e *UnknownHarnessError) Error() string {
+	return fmt.Sprintf("unknown harness %q", e.Key)
+}
+
+// extractHarnessSchemas pulls every harness block — a property named
+// `[name]` — out of the document schema.
+func extractHarnessSchemas(document []byte) (map[string][]byte, []string, error) {
+	var root struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(document, &root); err != nil {
+		return nil, nil, fmt.Errorf("parse embedded schema: %w", err)
+	}
+	schemas := map[string][]byte{}
+	var keys []string
+	for key, sub := range root.Properties {
+		if config.IsHarnessKey(key) {
+			schemas[key] = sub
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == config.OpenCodeKey) != (keys[j] == config.OpenCodeKey) {
+			return keys[i] == config.OpenCodeKey
+		}
+		return keys[i] < keys[j]
+	})
+	return schemas, keys, nil
+}
+
 // extractOpenCodeSchema pulls properties["[opencode]"] out of the document schema.
 func extractOpenCodeSchema(document []byte) ([]byte, error) {
 	var root struct {
@@ -94,7 +159,23 @@ func GetValidator() (*Validator, error) {
 			return
 		}
 
-		validatorInstance = &Validator{schema: openCodeSchema, documentSchema: documentSchema}
+		harnessSchemaJSON, harnessKeys, err = extractHarnessSchemas(schemaJSON)
+		if err != nil {
+			validatorErr = err
+			return
+		}
+		harnesses := map[string]*gojsonschema.Schema{config.OpenCodeKey: openCodeSchema}
+		for _, key := range harnessKeys {
+			if key == config.OpenCodeKey {
+				continue
+			}
+			if harnesses[key], err = gojsonschema.NewSchema(gojsonschema.NewBytesLoader(harnessSchemaJSON[key])); err != nil {
+				validatorErr = fmt.Errorf("compile %s schema: %w", key, err)
+				return
+			}
+		}
+
+		validatorInstance = &Validator{schema: openCodeSchema, documentSchema: documentSchema, harnesses: harnesses}
 	})
 	return validatorInstance, validatorErr
 }
@@ -157,6 +238,28 @@ func (v *Validator) ValidateJSONForSave(data []byte) ([]ValidationError, error)
 	return validateBytesForSave(v.schema, data)
 }
 
+// ValidateHarnessJSONForSave validates the raw config of harness block key
+// for the save path, as ValidateJSONForSave does for `[opencode]`.
+func (v *Validator) ValidateHarnessJSONForSave(key string, data []byte) ([]ValidationError, error) {
+	s, ok := v.harnesses[key]
+	if !ok {
+		return nil, &UnknownHarnessError{Key: key}
+	}
+	return validateBytesForSave(s, data)
+}
+
+// ValidateProfileBlockForSave validates block as profiles.<name> of a
+// document, in save mode: every harness block and shared key it holds.
+func (v *Validator) ValidateProfileBlockForSave(name string, block []byte) ([]ValidationError, error) {
+	doc, err := json.Marshal(map[string]any{
+		config.ProfilesKey: map[string]json.RawMessage{name: block},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.ValidateDocumentForSave(doc)
+}
+
 // ValidateDocument validates a whole omo.json document.
 func (v *Validator) ValidateDocument(data []byte) ([]ValidationError, error) {
 	return validateBytes(v.documentSchema, data)
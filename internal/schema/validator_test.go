@@ -438,3 +438,29 @@ func mustMarshalSparseJSON(t *testing.T, cfg *config.Config, selectedPaths ...st
 	require.NoError(t, err)
 	return data
 }
+
+func TestHarnessKeys_OpenCodeFirst(t *testing.T) {
+	keys, err := HarnessKeys()
+	require.NoError(t, err)
+	require.NotEmpty(t, keys)
+	assert.Equal(t, config.OpenCodeKey, keys[0])
+	assert.Contains(t, keys, "[senpi]")
+	assert.Contains(t, keys, "[codex]")
+}
+
+func TestValidateHarnessJSONForSave(t *testing.T) {
+	v, err := GetValidator()
+	require.NoError(t, err)
+
+	errs, err := v.ValidateHarnessJSONForSave("[senpi]", []byte(`{"categories":{"quick":{"model":"openai/gpt-5"}}}`))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+
+	errs, err = v.ValidateHarnessJSONForSave("[senpi]", []byte(`{"categories":{"quick":{"model":42}}}`))
+	require.NoError(t, err)
+	assert.NotEmpty(t, errs)
+
+	_, err = v.ValidateHarnessJSONForSave("[nope]", []byte(`{}`))
+	var unknown *UnknownHarnessError
+	require.ErrorAs(t, err, &unknown)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/diogenes/omo-profiler/internal/schema"
 	"github.com/diogenes/omo-profiler/internal/tui/layout"
 	"github.com/diogenes/omo-profiler/internal/tui/views"
+	"github.com/diogenes/omo-profiler/internal/watch"
 )
 
 type appState int
@@ -33,6 +34,7 @@ const (
 	stateModelImport
 	stateTemplateSelect
 	stateSchemaCheck
+	stateHistory
 )
 
 // Toast message types
@@ -98,6 +100,9 @@ type App struct {
 
 	belowMinSize bool
 
+	// changes delivers on-disk config changes; nil when not watching.
+	changes <-chan watch.Event
+
 	// Views
 	dashboard      views.Dashboard
 	list           views.List
@@ -109,6 +114,7 @@ type App struct {
 	exportView     views.Export
 	templateSelect views.TemplateSelect
 	schemaCheck    views.SchemaCheck
+	history        views.History
 }
 
 func NewApp() App {
@@ -136,9 +142,26 @@ func (a App) Init() tea.Cmd {
 	return tea.Batch(
 		a.dashboard.Init(),
 		a.spinner.Tick,
+		a.waitForChange(),
 	)
 }
 
+// waitForChange turns the next watcher event into a views.ConfigChangedMsg.
+// Update re-arms it after each one, so at most one wait is in flight.
+func (a App) waitForChange() tea.Cmd {
+	if a.changes == nil {
+		return nil
+	}
+	changes := a.changes
+	return func() tea.Msg {
+		ev, ok := <-changes
+		if !ok {
+			return nil
+		}
+		return views.ConfigChangedMsg{Path: ev.Path}
+	}
+}
+
 func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
@@ -197,13 +220,13 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a, nil
 		case key.Matches(msg, Keys.Back):
 			// Don't intercept Esc if a view handles it internally
-			if a.state == stateWizard || a.state == stateDiff || a.state == stateModels || a.state == stateModelImport {
+			if a.state == stateWizard || a.state == stateDiff || a.state == stateModels || a.state == stateModelImport || a.state == stateHistory {
 				// Let the view handle it
 				break
 			}
 			// While the profile list filter is capturing text, let the list
 			// handle Esc natively so it cancels the filter instead of leaving.
-			if a.state == stateList && a.list.IsFiltering() {
+			if a.state == stateList && (a.list.IsFiltering() || a.list.IsConfirmingSwitch()) {
 				break
 			}
 			if a.state != stateDashboard {
@@ -230,6 +253,7 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.importView.SetSize(msg.Width, a.contentHeight())
 		a.exportView.SetSize(msg.Width, a.contentHeight())
 		a.schemaCheck.SetSize(msg.Width, a.contentHeight())
+		a.history.SetSize(msg.Width, a.contentHeight())
 
 	case spinner.TickMsg:
 		if a.loading {
@@ -237,6 +261,12 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 
+	case views.ConfigChangedMsg:
+		// Only the dashboard and list show on-disk state; the wizard and the
+		// other views keep what the user is editing. Either reloads itself
+		// when navigated to, so the inactive one needs no nudge.
+		cmds = append(cmds, a.waitForChange())
+
 	case clearToastMsg:
 		a.toast = ""
 		a.toastActive = false
@@ -329,7 +359,7 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case importProfileDoneMsg:
 		a.loading = false
-		if msg.err != nil {
+		if !config.Saved(msg.err) {
 			return a, a.showToast("Import failed: "+msg.err.Error(), toastError, 3*time.Second)
 		}
 		var toastText string
@@ -339,7 +369,7 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			toastText = fmt.Sprintf("Imported profile: %s", msg.profileName)
 		}
 		return a, tea.Batch(
-			a.showToast(toastText, toastSuccess, 3*time.Second),
+			a.savedToast(toastText, msg.err),
 			func() tea.Msg { return views.NavigateToDashboardMsg{} },
 		)
 
@@ -375,6 +405,19 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case views.ModelRegistryBackMsg:
 		return a.navigateTo(stateDashboard)
 
+	case views.ToggleLayerMsg:
+		next := config.LayerProject
+		if config.TargetLayer() == config.LayerProject {
+			next = config.LayerUser
+		}
+		if err := config.SetTargetLayer(next); err != nil {
+			return a, a.showToast(err.Error(), toastError, 3*time.Second)
+		}
+		return a, tea.Batch(
+			a.showToast("Editing "+config.DocumentFile(), toastInfo, 3*time.Second),
+			a.dashboard.Refresh(),
+		)
+
 	case views.NavToSchemaCheckMsg:
 		a.schemaCheck = views.NewSchemaCheck()
 		a.schemaCheck.SetSize(a.width, a.contentHeight())
@@ -434,13 +477,13 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case switchProfileDoneMsg:
 		a.loading = false
-		if msg.err != nil {
+		if !config.Saved(msg.err) {
 			return a, a.showToast("Switch failed: "+msg.err.Error(), toastError, 3*time.Second)
 		}
 		if msg.snapshot != "" {
-			cmds = append(cmds, a.showToast("Applied "+msg.name+" (previous config saved as "+msg.snapshot+")", toastSuccess, 3*time.Second))
+			cmds = append(cmds, a.savedToast("Applied "+msg.name+" (previous config saved as "+msg.snapshot+")", msg.err))
 		} else {
-			cmds = append(cmds, a.showToast("Applied "+msg.name, toastSuccess, 3*time.Second))
+			cmds = append(cmds, a.savedToast("Applied "+msg.name, msg.err))
 		}
 		a.dashboard = views.NewDashboard()
 		a.dashboard.SetSize(a.width, a.contentHeight())
@@ -458,6 +501,16 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		a.wizard.SetSize(a.width, a.contentHeight())
 		return a.navigateTo(stateWizard)
 
+	case views.ShowHistoryMsg:
+		a.history = views.NewHistory(msg.Name)
+		a.history.SetSize(a.width, a.contentHeight())
+		return a.navigateTo(stateHistory)
+
+	case views.HistoryBackMsg:
+		a.list = views.NewList()
+		a.list.SetSize(a.width, a.contentHeight())
+		return a.navigateTo(stateList)
+
 	case views.DeleteProfileMsg:
 		a.loading = true
 		a.loadingMsg = "Deleting profile"
@@ -468,10 +521,10 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case deleteProfileDoneMsg:
 		a.loading = false
-		if msg.err != nil {
+		if !config.Saved(msg.err) {
 			return a, a.showToast("Delete failed: "+msg.err.Error(), toastError, 3*time.Second)
 		}
-		cmds = append(cmds, a.showToast("Deleted: "+msg.name, toastSuccess, 3*time.Second))
+		cmds = append(cmds, a.savedToast("Deleted: "+msg.name, msg.err))
 		// Refresh list
 		a.list = views.NewList()
 		a.list.SetSize(a.width, a.contentHeight())
@@ -480,7 +533,7 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// Wizard messages
 	case views.WizardSaveMsg:
-		cmds = append(cmds, a.showToast("Profile saved!", toastSuccess, 3*time.Second))
+		cmds = append(cmds, a.savedToast("Profile saved!", msg.Warning))
 		a.dashboard = views.NewDashboard()
 		a.dashboard.SetSize(a.width, a.contentHeight())
 		cmds = append(cmds, a.dashboard.Init())
@@ -530,6 +583,10 @@ func (a App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case stateSchemaCheck:
 		a.schemaCheck, cmd = a.schemaCheck.Update(msg)
 		cmds = append(cmds, cmd)
+
+	case stateHistory:
+		a.history, cmd = a.history.Update(msg)
+		cmds = append(cmds, cmd)
 	}
 
 	return a, tea.Batch(cmds...)
@@ -571,6 +628,9 @@ func (a App) navigateTo(state appState) (App, tea.Cmd) {
 	case stateSchemaCheck:
 		a.schemaCheck.SetSize(a.width, a.contentHeight())
 		cmd = a.schemaCheck.Init()
+	case stateHistory:
+		a.history.SetSize(a.width, a.contentHeight())
+		cmd = a.history.Init()
 	}
 
 	return a, cmd
@@ -661,6 +721,15 @@ func (a App) showToast(text string, typ toastType, duration time.Duration) tea.C
 	}
 }
 
+// savedToast reports a write that landed: text, with what failed after the
+// save (a commit or push, see config.AfterSaveError) when err is not nil.
+func (a App) savedToast(text string, err error) tea.Cmd {
+	if err != nil {
+		return a.showToast(text+"; "+err.Error(), toastError, 5*time.Second)
+	}
+	return a.showToast(text, toastSuccess, 3*time.Second)
+}
+
 func (a App) contentHeight() int {
 	return a.height - layout.HelpBarHeight(a.height)
 }
@@ -718,6 +787,8 @@ func (a App) View() string {
 			content = a.templateSelect.View()
 		case stateSchemaCheck:
 			content = a.schemaCheck.View()
+		case stateHistory:
+			content = a.history.View()
 		default:
 			content = "Unknown state"
 		}
@@ -766,9 +837,13 @@ func (a App) renderShortHelp() string {
 
 	switch a.state {
 	case stateDashboard:
-		hints = []string{"[↑↓] navigate", "[Enter] select", "[i] import", "[e] export", "[?] help", "[q] quit"}
+		hints = []string{"[↑↓] navigate", "[Enter] select", "[i] import", "[e] export", "[L] layer", "[?] help", "[q] quit"}
 	case stateList:
-		hints = []string{"[Enter] switch", "[e] edit", "[d] delete", "[n] new", "[/] search", "[Esc] back"}
+		if a.list.IsConfirmingSwitch() {
+			hints = []string{"[y/Enter] apply", "[n/Esc] cancel"}
+		} else {
+			hints = []string{"[Enter] switch", "[e] edit", "[d] delete", "[n] new", "[v] history", "[/] search", "[Esc] back"}
+		}
 	case stateWizard:
 		if a.wizard.IsReviewStep() {
 			hints = []string{"[Enter] save", "[Shift+Tab] back", "[Ctrl+C] cancel"}
@@ -793,6 +868,12 @@ func (a App) renderShortHelp() string {
 		}
 	case stateTemplateSelect:
 		hints = []string{"[↑↓] navigate", "[Enter] select", "[Esc] cancel"}
+	case stateHistory:
+		if a.history.IsConfirming() {
+			hints = []string{"[y] restore", "[n/Esc] cancel"}
+		} else {
+			hints = []string{"[↑↓] navigate", "[r] restore", "[Esc] back"}
+		}
 	default:
 		hints = []string{"[?] help", "[q] quit"}
 	}
@@ -842,6 +923,7 @@ func (a App) renderFullHelp() string {
 		lines = append(lines, HelpStyle.Render("  enter      Select menu item"))
 		lines = append(lines, HelpStyle.Render("  i          Import profile"))
 		lines = append(lines, HelpStyle.Render("  e          Export profile"))
+		lines = append(lines, HelpStyle.Render("  L          Toggle user/project layer"))
 
 	case stateList:
 		lines = append(lines, AccentStyle.Render("Profile List:"))
@@ -851,6 +933,7 @@ func (a App) renderFullHelp() string {
 		lines = append(lines, HelpStyle.Render("  e          Edit profile"))
 		lines = append(lines, HelpStyle.Render("  d          Delete profile"))
 		lines = append(lines, HelpStyle.Render("  n          New profile"))
+		lines = append(lines, HelpStyle.Render("  v          Profile history"))
 		lines = append(lines, HelpStyle.Render("  /          Search profiles"))
 
 	case stateWizard:
@@ -911,6 +994,13 @@ func (a App) renderFullHelp() string {
 		lines = append(lines, HelpStyle.Render("  enter      Confirm / Save"))
 		lines = append(lines, HelpStyle.Render("  r          Retry"))
 		lines = append(lines, HelpStyle.Render("  esc        Back"))
+
+	case stateHistory:
+		lines = append(lines, AccentStyle.Render("Profile History:"))
+		lines = append(lines, HelpStyle.Render("  ↑/k        Newer version"))
+		lines = append(lines, HelpStyle.Render("  ↓/j        Older version"))
+		lines = append(lines, HelpStyle.Render("  r          Restore selected version"))
+		lines = append(lines, HelpStyle.Render("  esc        Back to profiles"))
 	}
 
 	if !short {
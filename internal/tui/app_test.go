@@ -6,6 +6,9 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/diogenes/omo-profiler/internal/tui/views"
+	"github.com/diogenes/omo-profiler/internal/watch"
 )
 
 func TestJoinWithSeparator(t *testing.T) {
@@ -480,3 +483,32 @@ func TestDoDeleteProfile(t *testing.T) {
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestConfigChangedMsgRearmsWatch(t *testing.T) {
+	changes := make(chan watch.Event, 1)
+	app := NewApp()
+	app.changes = changes
+
+	changes <- watch.Event{Path: "/tmp/omo.json"}
+	msg := app.waitForChange()()
+	changed, ok := msg.(views.ConfigChangedMsg)
+	if !ok || changed.Path != "/tmp/omo.json" {
+		t.Fatalf("expected ConfigChangedMsg for the event, got %#v", msg)
+	}
+
+	_, cmd := app.Update(changed)
+	if cmd == nil {
+		t.Fatal("expected a command re-arming the wait and refreshing the dashboard")
+	}
+
+	close(changes)
+	if msg := app.waitForChange()(); msg != nil {
+		t.Errorf("expected nil once the watcher closes, got %#v", msg)
+	}
+}
+
+func TestWaitForChangeWithoutWatcher(t *testing.T) {
+	if cmd := NewApp().waitForChange(); cmd != nil {
+		t.Error("expected no wait command when not watching")
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
-	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/diogenes/omo-profiler/internal/backup"
 	"github.com/diogenes/omo-profiler/internal/config"
 	"github.com/diogenes/omo-profiler/internal/profile"
 )
@@ -84,15 +84,9 @@ func seedTUIDoc(t *testing.T) {
 
 func countBackups(t *testing.T) int {
 	t.Helper()
-	entries, err := os.ReadDir(config.OmoDir())
+	backups, err := backup.List()
 	if err != nil {
-		t.Fatalf("ReadDir: %v", err)
+		t.Fatalf("List: %v", err)
 	}
-	n := 0
-	for _, e := range entries {
-		if strings.Contains(e.Name(), ".bak") {
-			n++
-		}
-	}
-	return n
+	return len(backups)
 }
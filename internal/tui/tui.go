@@ -1,9 +1,19 @@
 package tui
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/diogenes/omo-profiler/internal/watch"
+)
 
 func Run() error {
+	w := watch.New(watch.ConfigFiles())
+	defer w.Close()
+	changes, cancel := w.Subscribe()
+	defer cancel()
+
 	app := NewApp()
+	app.changes = changes
 	p := tea.NewProgram(app, tea.WithAltScreen(), tea.WithoutSignalHandler())
 	_, err := p.Run()
 	return err
@@ -8,6 +8,7 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/diogenes/omo-profiler/internal/config"
 	"github.com/diogenes/omo-profiler/internal/profile"
 	"github.com/diogenes/omo-profiler/internal/tui/layout"
 )
@@ -21,6 +22,13 @@ type NavToExportMsg struct{}
 type NavToModelsMsg struct{}
 type NavToTemplateSelectMsg struct{}
 
+// ToggleLayerMsg asks the app to edit the other config layer.
+type ToggleLayerMsg struct{}
+
+// ConfigChangedMsg reports that a watched config file changed on disk, so
+// views showing profile state should reload it.
+type ConfigChangedMsg struct{ Path string }
+
 const (
 	menuSwitch = iota
 	menuCreate
@@ -63,6 +71,7 @@ type dashboardKeyMap struct {
 	Enter  key.Binding
 	Import key.Binding
 	Export key.Binding
+	Layer  key.Binding
 }
 
 var (
@@ -124,6 +133,10 @@ func NewDashboard() Dashboard {
 				key.WithKeys("e"),
 				key.WithHelp("e", "export"),
 			),
+			Layer: key.NewBinding(
+				key.WithKeys("L"),
+				key.WithHelp("L", "layer"),
+			),
 		},
 	}
 }
@@ -167,6 +180,9 @@ func (d Dashboard) Update(msg tea.Msg) (Dashboard, tea.Cmd) {
 			d.profileCount = msg.count
 		}
 
+	case ConfigChangedMsg:
+		return d, d.Refresh()
+
 	case tea.WindowSizeMsg:
 		d.width = msg.Width
 		d.height = msg.Height
@@ -187,6 +203,8 @@ func (d Dashboard) Update(msg tea.Msg) (Dashboard, tea.Cmd) {
 			return d, func() tea.Msg { return NavToImportMsg{} }
 		case key.Matches(msg, d.keys.Export):
 			return d, func() tea.Msg { return NavToExportMsg{} }
+		case key.Matches(msg, d.keys.Layer):
+			return d, func() tea.Msg { return ToggleLayerMsg{} }
 		}
 	}
 
@@ -233,6 +251,23 @@ func (d Dashboard) View() string {
 			Render(fmt.Sprintf("Error: %v", d.err))
 	} else if d.activeProfile == nil {
 		profileStatus = grayStyle.Render("Loading...")
+	} else if d.activeProfile.State == profile.ActiveAmbiguous {
+		names := layout.TruncateWithEllipsis(strings.Join(d.activeProfile.Candidates, ", "), d.width-36)
+		profileStatus = warningStyle.Render("Active: ambiguous — matches " + names)
+	} else if d.activeProfile.State == profile.ActiveDrifted {
+		applied := d.activeProfile.AppliedName
+		if len(d.activeProfile.Stack) > 0 {
+			applied = profile.StackLabel(d.activeProfile.Stack)
+		}
+		name := layout.TruncateWithEllipsis(applied, d.width-36)
+		why := "live config edited"
+		if d.activeProfile.ProfileChanged {
+			why = "profile edited"
+		}
+		profileStatus = warningStyle.Render(fmt.Sprintf("Active: %s (drifted — %s)", name, why))
+	} else if len(d.activeProfile.Stack) > 0 {
+		name := layout.TruncateWithEllipsis(profile.StackLabel(d.activeProfile.Stack), d.width-24)
+		profileStatus = fmt.Sprintf("Active: %s", successStyle.Render(name))
 	} else if d.activeProfile.Modified {
 		profileStatus = warningStyle.Render("Active: (custom — matches no profile)")
 	} else if d.activeProfile.ProfileName == "" {
@@ -243,6 +278,13 @@ func (d Dashboard) View() string {
 	}
 
 	statsLine := subtitleStyle.Render(fmt.Sprintf("%d profiles available", d.profileCount))
+	if d.activeProfile != nil {
+		statsLine += subtitleStyle.Render(" · " + string(d.activeProfile.Layer) + " layer")
+		if d.activeProfile.Layer == config.LayerProject {
+			statsLine = lipgloss.JoinVertical(lipgloss.Left, statsLine,
+				grayStyle.Render(layout.TruncateWithEllipsis(d.activeProfile.Path, d.width-4)))
+		}
+	}
 
 	var header string
 	if layout.IsShort(d.height) {
@@ -10,6 +10,7 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/diogenes/omo-profiler/internal/diff"
 	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/redact"
 	"github.com/diogenes/omo-profiler/internal/tui/layout"
 )
 
@@ -95,12 +96,13 @@ func (d Diff) computeDiff() tea.Msg {
 		return diffComputedMsg{result: nil, err: nil}
 	}
 
-	left, err := profile.Load(d.leftProfile)
+	// Compare what each profile applies, inherited fields included.
+	left, err := profile.LoadResolved(d.leftProfile)
 	if err != nil {
 		return diffComputedMsg{err: fmt.Errorf("loading left profile: %w", err)}
 	}
 
-	right, err := profile.Load(d.rightProfile)
+	right, err := profile.LoadResolved(d.rightProfile)
 	if err != nil {
 		return diffComputedMsg{err: fmt.Errorf("loading right profile: %w", err)}
 	}
@@ -115,6 +117,14 @@ func (d Diff) computeDiff() tea.Msg {
 		return diffComputedMsg{err: fmt.Errorf("marshaling right profile: %w", err)}
 	}
 
+	// Secrets show as masks: the diff may be on a shared screen.
+	if json1, err = redact.OpenCode(json1); err != nil {
+		return diffComputedMsg{err: fmt.Errorf("redacting left profile: %w", err)}
+	}
+	if json2, err = redact.OpenCode(json2); err != nil {
+		return diffComputedMsg{err: fmt.Errorf("redacting right profile: %w", err)}
+	}
+
 	result, err := diff.ComputeDiff(json1, json2)
 	return diffComputedMsg{result: result, err: err}
 }
@@ -0,0 +1,264 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+	"github.com/diogenes/omo-profiler/internal/tui/layout"
+)
+
+// ShowHistoryMsg opens the history of a profile.
+type ShowHistoryMsg struct{ Name string }
+
+// HistoryBackMsg leaves the history for the profile list.
+type HistoryBackMsg struct{}
+
+type historyLoadedMsg struct {
+	versions []profile.Version
+	err      error
+}
+
+type historyRestoredMsg struct {
+	version int
+	err     error
+}
+
+type historyKeyMap struct {
+	Up      key.Binding
+	Down    key.Binding
+	Restore key.Binding
+	Back    key.Binding
+}
+
+func newHistoryKeyMap() historyKeyMap {
+	return historyKeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "newer version"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "older version"),
+		),
+		Restore: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "restore version"),
+		),
+		Back: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "back"),
+		),
+	}
+}
+
+// History shows the versions of one profile found in the backups, with the
+// fields each changed, and restores the profile to a selected one.
+type History struct {
+	name       string
+	versions   []profile.Version
+	cursor     int
+	loaded     bool
+	confirming bool
+	status     string
+	err        error
+	keys       historyKeyMap
+	width      int
+	height     int
+}
+
+func NewHistory(name string) History {
+	return History{name: name, keys: newHistoryKeyMap()}
+}
+
+func (h History) Init() tea.Cmd {
+	return h.load
+}
+
+func (h History) load() tea.Msg {
+	versions, err := profile.History(h.name)
+	return historyLoadedMsg{versions: versions, err: err}
+}
+
+func (h *History) SetSize(width, height int) {
+	h.width = width
+	h.height = height
+}
+
+// IsConfirming reports whether a restore is awaiting y/n, so the global
+// router leaves Esc to the view.
+func (h History) IsConfirming() bool {
+	return h.confirming
+}
+
+// restore validates the selected version and makes it the profile's block.
+func (h History) restore() tea.Cmd {
+	name, n, v := h.name, h.cursor+1, h.versions[h.cursor]
+	return func() tea.Msg {
+		if v.Exists {
+			validator, err := schema.GetValidator()
+			if err != nil {
+				return historyRestoredMsg{version: n, err: err}
+			}
+			errs, err := validator.ValidateProfileBlockForSave(name, v.Block)
+			if err != nil {
+				return historyRestoredMsg{version: n, err: err}
+			}
+			if len(errs) > 0 {
+				return historyRestoredMsg{version: n, err: fmt.Errorf("validation failed: %s", errs[0].Error())}
+			}
+		}
+		return historyRestoredMsg{version: n, err: profile.RestoreVersion(name, v)}
+	}
+}
+
+func (h History) Update(msg tea.Msg) (History, tea.Cmd) {
+	switch msg := msg.(type) {
+	case historyLoadedMsg:
+		h.loaded = true
+		h.err = msg.err
+		h.versions = msg.versions
+		h.cursor = min(h.cursor, max(len(h.versions)-1, 0))
+		return h, nil
+
+	case historyRestoredMsg:
+		if !config.Saved(msg.err) {
+			h.status = errorStyle.Render("Restore failed: " + msg.err.Error())
+			return h, nil
+		}
+		h.status = successStyle.Render(fmt.Sprintf("Restored version %d; it is now the live version", msg.version))
+		if msg.err != nil {
+			h.status = warningStyle.Render(fmt.Sprintf("Restored version %d; %v", msg.version, msg.err))
+		}
+		h.cursor = 0
+		return h, h.load
+
+	case tea.KeyMsg:
+		if h.confirming {
+			switch msg.String() {
+			case "y", "Y":
+				h.confirming = false
+				return h, h.restore()
+			case "n", "N", "esc":
+				h.confirming = false
+			}
+			return h, nil
+		}
+		switch {
+		case key.Matches(msg, h.keys.Back):
+			return h, func() tea.Msg { return HistoryBackMsg{} }
+		case key.Matches(msg, h.keys.Up):
+			if h.cursor > 0 {
+				h.cursor--
+			}
+		case key.Matches(msg, h.keys.Down):
+			if h.cursor < len(h.versions)-1 {
+				h.cursor++
+			}
+		case key.Matches(msg, h.keys.Restore):
+			if h.cursor >= len(h.versions) {
+				return h, nil
+			}
+			switch v := h.versions[h.cursor]; {
+			case v.Live:
+				h.status = warningStyle.Render("That is the live version")
+			case !v.Exists:
+				h.status = warningStyle.Render("The profile did not exist in that version")
+			default:
+				h.status = ""
+				h.confirming = true
+			}
+		}
+	}
+	return h, nil
+}
+
+func (h History) View() string {
+	lines := []string{titleStyle.Render("History of " + h.name), ""}
+	switch {
+	case !h.loaded:
+		lines = append(lines, grayStyle.Render("Reading backups…"))
+		return strings.Join(lines, "\n")
+	case h.err != nil:
+		lines = append(lines, errorStyle.Render("Error: "+h.err.Error()))
+		return strings.Join(lines, "\n")
+	}
+
+	// The timeline takes what the selected version's changes leave.
+	changes := h.changeLines()
+	room := max(h.height-len(lines)-len(changes)-4, 3)
+	start := max(0, min(h.cursor-room/2, len(h.versions)-room))
+	for i := start; i < len(h.versions) && i < start+room; i++ {
+		line := layout.TruncateWithEllipsis(historyHeading(i+1, h.versions[i]), max(h.width-2, 10))
+		if i == h.cursor {
+			line = selectedStyle.Render("> " + line)
+		} else {
+			line = "  " + line
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "")
+	lines = append(lines, changes...)
+
+	if h.status != "" {
+		lines = append(lines, "", h.status)
+	}
+	if h.confirming {
+		lines = append(lines, "", layout.RenderConfirmDialog(fmt.Sprintf("version %d of %s", h.cursor+1, h.name), "Restore"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// changeLines describes what the selected version changed.
+func (h History) changeLines() []string {
+	if h.cursor >= len(h.versions) {
+		return nil
+	}
+	v := h.versions[h.cursor]
+	if h.cursor == len(h.versions)-1 {
+		return []string{grayStyle.Render("Oldest version found in the backups")}
+	}
+	lines := []string{accentStyle.Render(fmt.Sprintf("Changed from version %d:", h.cursor+2))}
+	for _, c := range v.Changes {
+		style := removedStyle
+		switch c.Kind {
+		case profile.FieldAdded:
+			style = addedStyle
+		case profile.FieldChanged:
+			style = warningStyle
+		}
+		lines = append(lines, style.Render(layout.TruncateWithEllipsis("  "+c.String(), max(h.width, 10))))
+	}
+	return lines
+}
+
+// historyHeading is a version's line in the timeline.
+func historyHeading(n int, v profile.Version) string {
+	const stamp = "2006-01-02 15:04"
+	when := "live"
+	if v.Backups > 0 {
+		when = v.Until.Format(stamp)
+	}
+	var notes []string
+	switch {
+	case v.Live:
+		notes = append(notes, "(live)")
+	case v.ReplacedBy != "":
+		by := "replaced by " + v.ReplacedBy
+		if v.Source != "" {
+			by += " (" + v.Source + ")"
+		}
+		notes = append(notes, by)
+	}
+	if !v.Exists {
+		notes = append(notes, "(profile absent)")
+	}
+	if len(v.Changes) > 0 {
+		notes = append(notes, fmt.Sprintf("%d change(s)", len(v.Changes)))
+	}
+	return strings.TrimRight(fmt.Sprintf("%2d  %-16s  %s", n, when, strings.Join(notes, "  ")), " ")
+}
@@ -0,0 +1,72 @@
+package views
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+)
+
+func TestHistoryRestoresSelectedVersion(t *testing.T) {
+	cleanup := setupTestEnv(t)
+	defer cleanup()
+
+	if err := profile.Save(&profile.Profile{Name: "work", Config: config.Config{DisabledMCPs: []string{"old"}}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := profile.SetField("work", "disabled_mcps", json.RawMessage(`["new"]`), nil); err != nil {
+		t.Fatalf("SetField: %v", err)
+	}
+
+	h := NewHistory("work")
+	h.SetSize(100, 30)
+	h, _ = h.Update(h.Init()())
+	if len(h.versions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(h.versions))
+	}
+	if view := h.View(); !strings.Contains(view, "(live)") || !strings.Contains(view, "disabled_mcps") {
+		t.Errorf("view lacks the live version or its change:\n%s", view)
+	}
+
+	// The live version cannot be restored.
+	h, _ = h.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	if h.IsConfirming() {
+		t.Fatal("asked to confirm restoring the live version")
+	}
+
+	h, _ = h.Update(tea.KeyMsg{Type: tea.KeyDown})
+	h, _ = h.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	if !h.IsConfirming() {
+		t.Fatal("restore of an older version did not ask to confirm")
+	}
+	h, cmd := h.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if cmd == nil {
+		t.Fatal("confirming returned no command")
+	}
+	h, _ = h.Update(cmd())
+	if !strings.Contains(h.status, "Restored version 2") {
+		t.Errorf("status %q, want the restore reported", h.status)
+	}
+
+	p, err := profile.Load("work")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := p.Config.DisabledMCPs; len(got) != 1 || got[0] != "old" {
+		t.Errorf("disabled_mcps after restore %v, want [old]", got)
+	}
+}
+
+func TestHistoryEscGoesBack(t *testing.T) {
+	h := NewHistory("work")
+	_, cmd := h.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if cmd == nil {
+		t.Fatal("esc returned no command")
+	}
+	if _, ok := cmd().(HistoryBackMsg); !ok {
+		t.Errorf("esc sent %T, want HistoryBackMsg", cmd())
+	}
+}
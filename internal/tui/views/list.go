@@ -2,6 +2,8 @@ package views
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
@@ -22,18 +24,47 @@ type NavigateToListMsg struct{}
 type profileItem struct {
 	name     string
 	isActive bool
+	// state is ActiveAmbiguous for a profile the root matches among others,
+	// ActiveDrifted for the profile last applied when the root left it.
+	state profile.ActiveState
+	// parent is the profile this one extends, if any.
+	parent string
+	// overlay is the position, as "2/3", of a profile in the stack last
+	// applied; state is then ActiveExact or ActiveDrifted for the stack, and
+	// enter switches to the profile alone.
+	overlay string
 }
 
 func (i profileItem) Title() string {
-	if i.isActive {
+	switch {
+	case i.overlay != "" && i.state == profile.ActiveExact:
+		return "* " + i.name + " (active, stack " + i.overlay + ")"
+	case i.overlay != "" && i.state == profile.ActiveDrifted:
+		return "~ " + i.name + " (applied, stack " + i.overlay + ", drifted)"
+	case i.isActive:
 		return "* " + i.name + " (active)"
+	case i.state == profile.ActiveAmbiguous:
+		return "? " + i.name + " (matches, ambiguous)"
+	case i.state == profile.ActiveDrifted:
+		return "~ " + i.name + " (applied, drifted)"
 	}
 	return "  " + i.name
 }
 
 func (i profileItem) Description() string {
-	if i.isActive {
+	switch {
+	case i.overlay != "" && i.state == profile.ActiveExact:
+		return "Overlay of the currently active stack — press enter to switch to it alone"
+	case i.overlay != "" && i.state == profile.ActiveDrifted:
+		return "Overlay of the stack last applied; the live config has changed since"
+	case i.isActive:
 		return "Currently active profile"
+	case i.state == profile.ActiveAmbiguous:
+		return "Matches the live config, as do others — press enter to record it"
+	case i.state == profile.ActiveDrifted:
+		return "Last applied; the live config has changed since"
+	case i.parent != "":
+		return "Extends " + i.parent + " — press enter to switch"
 	}
 	return "Press enter to switch"
 }
@@ -43,13 +74,14 @@ func (i profileItem) FilterValue() string {
 }
 
 type listKeyMap struct {
-	Switch key.Binding
-	Edit   key.Binding
-	Delete key.Binding
-	New    key.Binding
-	Search key.Binding
-	Back   key.Binding
-	Import key.Binding
+	Switch  key.Binding
+	Edit    key.Binding
+	Delete  key.Binding
+	New     key.Binding
+	Search  key.Binding
+	Back    key.Binding
+	Import  key.Binding
+	History key.Binding
 }
 
 func newListKeyMap() listKeyMap {
@@ -82,6 +114,10 @@ func newListKeyMap() listKeyMap {
 			key.WithKeys("i"),
 			key.WithHelp("i", "import"),
 		),
+		History: key.NewBinding(
+			key.WithKeys("v"),
+			key.WithHelp("v", "history"),
+		),
 	}
 }
 
@@ -92,7 +128,10 @@ type List struct {
 	height           int
 	confirmingDelete bool
 	deleteTarget     string
-	err              error
+	// switchPreview is the dry run of the selected profile's apply, shown for
+	// confirmation before SwitchProfileMsg is sent; nil when not confirming.
+	switchPreview *profile.ApplyPreview
+	err           error
 }
 
 func NewList() List {
@@ -144,13 +183,31 @@ func (l *List) LoadProfiles() error {
 		return err
 	}
 
+	settings, err := profile.LoadSettings()
+	if err != nil {
+		l.err = err
+		return err
+	}
+
 	items := make([]list.Item, len(names))
 	for i, name := range names {
-		isActive := active != nil && active.ProfileName == name
-		items[i] = profileItem{
+		item := profileItem{
 			name:     name,
-			isActive: isActive,
+			isActive: active.ProfileName == name,
+			parent:   settings.Profiles[name].Extends,
 		}
+		if pos := slices.Index(active.Stack, name); pos >= 0 {
+			item.overlay = fmt.Sprintf("%d/%d", pos+1, len(active.Stack))
+		}
+		switch {
+		case active.State == profile.ActiveExact && item.overlay != "":
+			item.state = profile.ActiveExact
+		case active.State == profile.ActiveAmbiguous && slices.Contains(active.Candidates, name):
+			item.state = profile.ActiveAmbiguous
+		case active.State == profile.ActiveDrifted && (active.AppliedName == name || item.overlay != ""):
+			item.state = profile.ActiveDrifted
+		}
+		items[i] = item
 	}
 
 	l.list.SetItems(items)
@@ -173,7 +230,7 @@ func (l List) Update(msg tea.Msg) (List, tea.Cmd) {
 	var cmds []tea.Cmd
 
 	switch msg := msg.(type) {
-	case listProfilesLoadedMsg:
+	case listProfilesLoadedMsg, ConfigChangedMsg:
 		_ = l.LoadProfiles()
 		return l, nil
 
@@ -198,6 +255,20 @@ func (l List) Update(msg tea.Msg) (List, tea.Cmd) {
 			return l, nil
 		}
 
+		if l.switchPreview != nil {
+			switch msg.String() {
+			case "y", "Y", "enter":
+				name := l.switchPreview.Name
+				l.switchPreview = nil
+				return l, func() tea.Msg {
+					return SwitchProfileMsg{Name: name}
+				}
+			case "n", "N", "esc":
+				l.switchPreview = nil
+			}
+			return l, nil
+		}
+
 		// During active filtering, delegate all keys to the bubbles list
 		// so it can handle Esc to cancel the filter natively.
 		if l.list.FilterState() == list.Filtering {
@@ -213,9 +284,15 @@ func (l List) Update(msg tea.Msg) (List, tea.Cmd) {
 		case key.Matches(msg, l.keys.Switch):
 			if item, ok := l.list.SelectedItem().(profileItem); ok {
 				if !item.isActive {
-					return l, func() tea.Msg {
-						return SwitchProfileMsg{Name: item.name}
+					preview, err := profile.PreviewApply(item.name)
+					if err != nil {
+						// Let the apply itself fail and report it.
+						return l, func() tea.Msg {
+							return SwitchProfileMsg{Name: item.name}
+						}
 					}
+					l.switchPreview = preview
+					return l, nil
 				}
 			}
 
@@ -242,6 +319,13 @@ func (l List) Update(msg tea.Msg) (List, tea.Cmd) {
 			return l, func() tea.Msg {
 				return NavToImportMsg{}
 			}
+
+		case key.Matches(msg, l.keys.History):
+			if item, ok := l.list.SelectedItem().(profileItem); ok {
+				return l, func() tea.Msg {
+					return ShowHistoryMsg{Name: item.name}
+				}
+			}
 		}
 
 	case ConfirmDeleteMsg:
@@ -276,9 +360,39 @@ func (l List) View() string {
 		return lipgloss.JoinVertical(lipgloss.Left, content, "", confirmText)
 	}
 
+	if l.switchPreview != nil {
+		confirmText := layout.RenderConfirmDialog(l.switchPreview.Name, "Switch to")
+		return lipgloss.JoinVertical(lipgloss.Left, renderSwitchPreview(l.switchPreview), "", confirmText)
+	}
+
 	return content
 }
 
+// renderSwitchPreview lists the root keys the apply would touch and the
+// snapshot it would take. Kept keys are only counted.
+func renderSwitchPreview(p *profile.ApplyPreview) string {
+	lines := []string{fmt.Sprintf("Switching to %q would:", p.Name), ""}
+	for _, c := range p.Changes {
+		switch c.Kind {
+		case profile.RootAdded:
+			lines = append(lines, addedStyle.Render("  + add "+c.Key))
+		case profile.RootReplaced:
+			lines = append(lines, removedStyle.Render("  ~ replace "+c.Key))
+		case profile.RootUnchanged:
+			lines = append(lines, grayStyle.Render("  = keep "+c.Key+" (already equal)"))
+		}
+	}
+	if kept := p.Count(profile.RootKept); kept > 0 {
+		lines = append(lines, grayStyle.Render(fmt.Sprintf("  leave %d other root key(s) untouched", kept)))
+	}
+	if p.Snapshot != "" {
+		lines = append(lines, "", warningStyle.Render(fmt.Sprintf(
+			"The current config matches no profile: %s will be saved as %q first.",
+			strings.Join(p.SnapshotKeys, ", "), p.Snapshot)))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (l List) SelectedProfile() string {
 	if item, ok := l.list.SelectedItem().(profileItem); ok {
 		return item.name
@@ -290,6 +404,12 @@ func (l List) IsConfirmingDelete() bool {
 	return l.confirmingDelete
 }
 
+// IsConfirmingSwitch reports whether the switch preview is awaiting y/n, so
+// the global router leaves Esc to the list.
+func (l List) IsConfirmingSwitch() bool {
+	return l.switchPreview != nil
+}
+
 // IsFiltering reports whether the profile list filter input is actively
 // capturing text. While filtering, the global key router must NOT intercept
 // q, ?, or esc so the bubbles list can handle them as filter input (q/?) or
@@ -1,11 +1,13 @@
 package views
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/diogenes/omo-profiler/internal/profile"
 )
 
 func TestProfileItemTitle(t *testing.T) {
@@ -88,6 +90,7 @@ func TestNewListKeyMap(t *testing.T) {
 		{"Search", keys.Search},
 		{"Back", keys.Back},
 		{"Import", keys.Import},
+		{"History", keys.History},
 	}
 
 	for _, tt := range tests {
@@ -455,3 +458,51 @@ func TestProfileItemActiveMarkingUsesProfileName(t *testing.T) {
 		t.Fatalf("unexpected inactive title: %q", items[1].Title())
 	}
 }
+
+func TestListSwitchPreviewConfirm(t *testing.T) {
+	l := NewList()
+	l.switchPreview = &profile.ApplyPreview{
+		Name:         "dev",
+		Snapshot:     "base",
+		SnapshotKeys: []string{"[opencode]"},
+		Changes: []profile.RootChange{
+			{Key: "[opencode]", Kind: profile.RootReplaced},
+			{Key: "[senpi]", Kind: profile.RootAdded},
+			{Key: "[codex]", Kind: profile.RootKept},
+		},
+	}
+	if !l.IsConfirmingSwitch() {
+		t.Fatal("expected IsConfirmingSwitch with a preview set")
+	}
+
+	view := l.View()
+	for _, want := range []string{"replace [opencode]", "add [senpi]", "1 other root key", `saved as "base"`, "Switch to 'dev'?"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("preview view missing %q:\n%s", want, view)
+		}
+	}
+
+	updated, cmd := l.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if cmd == nil {
+		t.Fatal("expected a command for 'y'")
+	}
+	if msg, ok := cmd().(SwitchProfileMsg); !ok || msg.Name != "dev" {
+		t.Errorf("expected SwitchProfileMsg{dev}, got %#v", cmd())
+	}
+	if updated.IsConfirmingSwitch() {
+		t.Error("expected the preview to close after confirming")
+	}
+}
+
+func TestListSwitchPreviewCancel(t *testing.T) {
+	l := NewList()
+	l.switchPreview = &profile.ApplyPreview{Name: "dev"}
+
+	updated, cmd := l.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if cmd != nil {
+		t.Error("expected nil command for esc")
+	}
+	if updated.IsConfirmingSwitch() {
+		t.Error("expected esc to close the preview")
+	}
+}
@@ -17,13 +17,20 @@ import (
 // Wizard message types
 type WizardNextMsg struct{}
 type WizardBackMsg struct{}
-type WizardSaveMsg struct{ Profile *profile.Profile }
+
+// WizardSaveMsg reports a saved profile. Warning is what failed after the
+// save landed (see config.AfterSaveError), if anything.
+type WizardSaveMsg struct {
+	Profile *profile.Profile
+	Warning error
+}
 type WizardCancelMsg struct{}
 
 // Internal message for async save completion
 type wizardSaveDoneMsg struct {
 	profile *profile.Profile
 	err     error
+	warning error
 }
 
 const (
@@ -230,7 +237,7 @@ func (w Wizard) Update(msg tea.Msg) (Wizard, tea.Cmd) {
 			w.err = msg.err
 			return w, nil
 		}
-		return w, func() tea.Msg { return WizardSaveMsg{Profile: msg.profile} }
+		return w, func() tea.Msg { return WizardSaveMsg{Profile: msg.profile, Warning: msg.warning} }
 
 	case tea.KeyMsg:
 		w.flashMsg = ""
@@ -385,7 +392,7 @@ func (w Wizard) nextStep() (Wizard, tea.Cmd) {
 			// and must not interleave with a concurrent web-server mutation of
 			// the same document.
 			var doc *config.Document
-			if err := config.MutateWithPreSave(backup.CreateOmoIfPresent, func(d *config.Document) error {
+			err = config.MutateWithPreSave("save "+profileName, backup.Before, func(d *config.Document) error {
 				doc = d
 
 				// The name was validated when the user typed it, but the save
@@ -427,9 +434,11 @@ func (w Wizard) nextStep() (Wizard, tea.Cmd) {
 
 				d.EnsureSchema()
 				return nil
-			}); err != nil {
+			})
+			if !config.Saved(err) {
 				return wizardSaveDoneMsg{err: err}
 			}
+			warning := err
 
 			p, err := profile.LoadFromDocument(doc, profileName)
 			if err != nil {
@@ -441,7 +450,7 @@ func (w Wizard) nextStep() (Wizard, tea.Cmd) {
 					PreservedUnknown: preservedUnknown,
 				}
 			}
-			return wizardSaveDoneMsg{profile: p}
+			return wizardSaveDoneMsg{profile: p, warning: warning}
 		}
 	}
 	return w, nil
@@ -0,0 +1,569 @@
+// Package vcs versions the omo document in a git repository beside it,
+// config.HistoryDir, when git versioning is on: every write commits the new
+// document with a message naming the operation and the profiles it changed.
+// Secrets are masked in every commit, so a remote never receives one.
+//
+// It drives the git binary, so the repository is an ordinary one: branches,
+// remotes and pushes work with git itself as well. Commits land on the
+// branch checked out in it, inside the write's lock, and are pushed to its
+// `origin` remote, if any, once the lock is released.
+package vcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/backup"
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+const (
+	// Remote is the remote commits are pushed to when the repository has it.
+	Remote = "origin"
+	// defaultBranch is the branch a new repository starts on.
+	defaultBranch = "main"
+)
+
+// ErrNoRepository is returned when the history repository does not exist.
+var ErrNoRepository = errors.New("no git history for this document (turn it on with 'settings git on')")
+
+// PushError is a commit that landed locally but could not be pushed. The
+// next push sends it along.
+type PushError struct {
+	Err error
+}
+
+func (e *PushError) Error() string {
+	return fmt.Sprintf("push to %s failed: %v", Remote, e.Err)
+}
+
+func (e *PushError) Unwrap() error { return e.Err }
+
+// Commit is one version of the document in the history.
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+	// Profiles are the profiles whose block the commit changed, and Source
+	// the front end that made it; both come from the message's trailers.
+	Profiles []string `json:"profiles,omitempty"`
+	Source   string   `json:"source,omitempty"`
+}
+
+// Short is the commit's abbreviated hash.
+func (c Commit) Short() string {
+	return c.Hash[:min(len(c.Hash), 7)]
+}
+
+// Status describes the repository.
+type Status struct {
+	// Branch is the checked-out branch, "" on a detached HEAD.
+	Branch string
+	// RemoteURL is origin's URL, "" without one; Unpushed counts the
+	// branch's commits origin had none of at the last push.
+	RemoteURL string
+	Unpushed  int
+}
+
+// errNoMasking is returned by Record when no package registered how to mask
+// secrets: committing the document as is would put its credentials in the
+// history, and on the remote.
+var errNoMasking = errors.New("no secret masking registered; the document was not committed")
+
+// masking is what MaskSecretsWith registered.
+var masking struct {
+	mask    func(path string, data []byte) ([]byte, error)
+	restore func(edited, stored []byte) ([]byte, error)
+}
+
+// MaskSecretsWith sets how commits mask secrets: mask masks those of the value
+// at a block path, and restore puts back into a masked value the secrets
+// stored holds at the same paths. Package redact registers its own; vcs sits
+// below the schema it needs.
+func MaskSecretsWith(mask func(path string, data []byte) ([]byte, error), restore func(edited, stored []byte) ([]byte, error)) {
+	masking.mask, masking.restore = mask, restore
+}
+
+// Exists reports whether the history repository has been created.
+func Exists() bool {
+	_, err := os.Stat(filepath.Join(config.HistoryDir(), ".git"))
+	return err == nil
+}
+
+// Init creates the history repository if needed. A non-empty remote becomes
+// its origin, replacing the one it had.
+func Init(remote string) error {
+	dir := config.HistoryDir()
+	if !Exists() {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if _, err := git("init", "-q"); err != nil {
+			return err
+		}
+		if _, err := git("symbolic-ref", "HEAD", "refs/heads/"+defaultBranch); err != nil {
+			return err
+		}
+	}
+	// Commits need an author; one configured for the user wins.
+	if out, _ := git("config", "user.email"); out == "" {
+		if _, err := git("config", "user.name", "omo-profiler"); err != nil {
+			return err
+		}
+		if _, err := git("config", "user.email", "omo-profiler@localhost"); err != nil {
+			return err
+		}
+	}
+	if remote == "" {
+		return nil
+	}
+	if _, err := git("remote", "get-url", Remote); err == nil {
+		_, err = git("remote", "set-url", Remote, remote)
+		return err
+	}
+	_, err := git("remote", "add", Remote, remote)
+	return err
+}
+
+// Record commits the document as it is now, secrets masked, if it differs
+// from the last commit, with a message made of operation ("set work.agents",
+// …; "" for an unnamed write), the profiles whose block changed and the
+// source. It must run under the document lock; Push sends the commit on.
+func Record(operation string) error {
+	if !Exists() {
+		return ErrNoRepository
+	}
+	if masking.mask == nil {
+		return errNoMasking
+	}
+	data, err := os.ReadFile(config.DocumentFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if data, err = masked(data); err != nil {
+		return fmt.Errorf("mask secrets: %w", err)
+	}
+	name := documentName()
+	previous, _ := show("HEAD", name)
+
+	if err := os.WriteFile(filepath.Join(config.HistoryDir(), name), data, 0600); err != nil {
+		return err
+	}
+	if _, err := git("add", "--", name); err != nil {
+		return err
+	}
+	if _, err := git("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	cmd := command("commit", "-q", "-F", "-")
+	cmd.Stdin = strings.NewReader(message(operation, name, previous, data))
+	return run(cmd)
+}
+
+// masked returns data, the document, with every secret masked: the root holds the values `${env:…}` and `${file:…}`
+// references resolved to, and a commit may well be pushed. A change to a
+// secret alone therefore commits nothing. Comments and key order survive.
+func masked(data []byte) ([]byte, error) {
+	doc, err := config.ParseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	err = eachBlock(doc, func(path string, raw json.RawMessage) (json.RawMessage, error) {
+		return masking.mask(path, raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return doc.Bytes()
+}
+
+// unmask puts back into restored, a document from the history, the secrets
+// live holds at the same paths, which the commit only holds masked. A mask
+// live has no value for stays.
+func unmask(restored, live *config.Document) error {
+	return eachBlock(restored, func(path string, raw json.RawMessage) (json.RawMessage, error) {
+		var stored json.RawMessage
+		if name, ok := strings.CutPrefix(path, config.ProfilesKey+"."); ok {
+			stored, _, _ = live.ProfileBlock(name)
+		} else {
+			stored, _ = live.Raw(path)
+		}
+		return unmaskBlock(raw, stored)
+	})
+}
+
+// unmaskBlock puts the secrets stored holds back into edited, a block from
+// the history.
+func unmaskBlock(edited, stored json.RawMessage) (json.RawMessage, error) {
+	if masking.restore == nil {
+		return edited, nil
+	}
+	return masking.restore(edited, stored)
+}
+
+// eachBlock replaces every root key of doc but profiles, and every profile
+// block, with what fn makes of it. fn is given the block's path: the key, or
+// "profiles.<name>".
+func eachBlock(doc *config.Document, fn func(path string, raw json.RawMessage) (json.RawMessage, error)) error {
+	for _, key := range doc.Keys() {
+		if key == config.ProfilesKey {
+			continue
+		}
+		raw, _ := doc.Raw(key)
+		out, err := fn(key, raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if !bytes.Equal(out, raw) {
+			doc.SetRaw(key, out)
+		}
+	}
+	names, err := doc.ProfileNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		block, _, err := doc.ProfileBlock(name)
+		if err != nil {
+			return err
+		}
+		out, err := fn(config.ProfilesKey+"."+name, block)
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+		if !bytes.Equal(out, block) {
+			if err := doc.SetProfileBlock(name, out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// message is a commit's message: the operation as its subject, then a
+// Profile trailer per profile whose block changed from before to after and a
+// Source trailer.
+func message(operation, name string, before, after []byte) string {
+	subject := operation
+	if subject == "" {
+		subject = "update " + name
+	}
+	var trailers []string
+	for _, p := range changedProfiles(before, after) {
+		trailers = append(trailers, "Profile: "+p)
+	}
+	if source := backup.Source(); source != "" {
+		trailers = append(trailers, "Source: "+source)
+	}
+	if len(trailers) == 0 {
+		return subject + "\n"
+	}
+	return subject + "\n\n" + strings.Join(trailers, "\n") + "\n"
+}
+
+// changedProfiles lists, sorted, the profiles added, removed or changed from
+// document before to document after. An unparsable side counts as empty.
+func changedProfiles(before, after []byte) []string {
+	blocks := func(data []byte) map[string]string {
+		out := map[string]string{}
+		doc, err := config.ParseDocument(data)
+		if err != nil {
+			return out
+		}
+		names, err := doc.ProfileNames()
+		if err != nil {
+			return out
+		}
+		for _, n := range names {
+			block, _, err := doc.ProfileBlock(n)
+			if err != nil {
+				continue
+			}
+			// Re-encoding sorts the keys, so only content counts.
+			var v any
+			if json.Unmarshal(block, &v) == nil {
+				block, _ = json.Marshal(v)
+			}
+			out[n] = string(block)
+		}
+		return out
+	}
+	b, a := blocks(before), blocks(after)
+	var changed []string
+	for n, block := range a {
+		if old, ok := b[n]; !ok || old != block {
+			changed = append(changed, n)
+		}
+	}
+	for n := range b {
+		if _, ok := a[n]; !ok {
+			changed = append(changed, n)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// Log returns the commits of the checked-out branch, most recent first: those
+// that changed profile name when it is not "", and at most limit of them when
+// limit is positive.
+func Log(name string, limit int) ([]Commit, error) {
+	if !Exists() {
+		return nil, ErrNoRepository
+	}
+	if _, err := git("rev-parse", "-q", "--verify", "HEAD"); err != nil {
+		return nil, nil // nothing committed yet
+	}
+	const format = "%H%x1f%aI%x1f%s%x1f%(trailers:key=Profile,valueonly,separator=%x2C)%x1f%(trailers:key=Source,valueonly,separator=%x2C)%x1e"
+	out, err := git("log", "--format="+format)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) != 5 {
+			continue
+		}
+		when, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("parse commit time %q: %w", fields[1], err)
+		}
+		c := Commit{Hash: fields[0], Time: when, Subject: fields[2], Source: strings.TrimSpace(fields[4])}
+		for _, p := range strings.Split(fields[3], ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				c.Profiles = append(c.Profiles, p)
+			}
+		}
+		if name != "" && !slices.Contains(c.Profiles, name) {
+			continue
+		}
+		commits = append(commits, c)
+		if limit > 0 && len(commits) == limit {
+			break
+		}
+	}
+	return commits, nil
+}
+
+// Resolve returns the hash of the commit rev names: a hash, a branch, a tag
+// or anything else git accepts, e.g. HEAD~2.
+func Resolve(rev string) (string, error) {
+	if !Exists() {
+		return "", ErrNoRepository
+	}
+	hash, err := git("rev-parse", "-q", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("no commit %q in the history", rev)
+	}
+	return hash, nil
+}
+
+// Show returns the document as commit rev holds it.
+func Show(rev string) ([]byte, error) {
+	hash, err := Resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+	data, err := show(hash, documentName())
+	if err != nil {
+		return nil, fmt.Errorf("commit %s holds no %s", rev, documentName())
+	}
+	return data, nil
+}
+
+// IsBranch reports whether name is a branch of the history.
+func IsBranch(name string) bool {
+	_, err := git("show-ref", "-q", "--verify", "refs/heads/"+name)
+	return err == nil
+}
+
+// Switch checks out branch in the history repository, creating it at start
+// (HEAD when "") with create. The document itself is untouched: restoring it
+// from the branch is the caller's next step.
+func Switch(branch string, create bool, start string) error {
+	if !Exists() {
+		return ErrNoRepository
+	}
+	if _, err := git("check-ref-format", "--branch", branch); err != nil {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	// The work tree only ever holds copies of the document, so anything in
+	// it can go.
+	args := []string{"switch", "-q", "--discard-changes"}
+	if create {
+		args = append(args, "-c", branch)
+		if start != "" {
+			hash, err := Resolve(start)
+			if err != nil {
+				return err
+			}
+			args = append(args, hash)
+		}
+	} else {
+		args = append(args, branch)
+	}
+	_, err := git(args...)
+	return err
+}
+
+// Restore replaces the document with the one commit rev holds, its masked
+// secrets taken from the document it replaces. It is a transaction backed up
+// like any other write, so with versioning on it is committed in turn, and it
+// is undone by checking out the commit before it. Validating the document is
+// the caller's job.
+func Restore(rev string) error {
+	restored, err := revisionDocument(rev)
+	if err != nil {
+		return err
+	}
+	return config.MutateWithPreSave("checkout "+rev, backup.Before, func(doc *config.Document) error {
+		if err := unmask(restored, doc); err != nil {
+			return err
+		}
+		restored.Path, restored.Exists = doc.Path, doc.Exists
+		*doc = *restored
+		return nil
+	})
+}
+
+// RestoreProfile replaces profile name's block with the one commit rev holds,
+// leaving every other key of the document as it is; otherwise like Restore.
+func RestoreProfile(rev, name string) error {
+	restored, err := revisionDocument(rev)
+	if err != nil {
+		return err
+	}
+	block, ok, err := restored.ProfileBlock(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("commit %s holds no profile %q", rev, name)
+	}
+	return config.MutateWithPreSave("checkout "+name+" from "+rev, backup.Before, func(doc *config.Document) error {
+		live, _, err := doc.ProfileBlock(name)
+		if err != nil {
+			return err
+		}
+		if block, err = unmaskBlock(block, live); err != nil {
+			return err
+		}
+		doc.EnsureSchema()
+		return doc.SetProfileBlock(name, block)
+	})
+}
+
+func revisionDocument(rev string) (*config.Document, error) {
+	data, err := Show(rev)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := config.ParseDocument(data)
+	if err != nil {
+		return nil, fmt.Errorf("commit %s does not hold an omo document: %w", rev, err)
+	}
+	return doc, nil
+}
+
+// GetStatus describes the history repository.
+func GetStatus() (Status, error) {
+	if !Exists() {
+		return Status{}, ErrNoRepository
+	}
+	var s Status
+	s.Branch, _ = git("symbolic-ref", "-q", "--short", "HEAD")
+	s.RemoteURL, _ = git("remote", "get-url", Remote)
+	if s.RemoteURL == "" || s.Branch == "" {
+		return s, nil
+	}
+	if _, err := git("rev-parse", "-q", "--verify", "HEAD"); err != nil {
+		return s, nil
+	}
+	// A commit origin has on any branch needs no push.
+	out, err := git("rev-list", "--count", "HEAD", "--not", "--remotes="+Remote)
+	if err != nil {
+		return s, err
+	}
+	s.Unpushed, err = strconv.Atoi(out)
+	return s, err
+}
+
+// pushMu serializes pushes, which run outside the document lock.
+var pushMu sync.Mutex
+
+// Push sends the checked-out branch to origin, when there is one. Writes call
+// it once the document lock is released, so a slow remote holds up no other
+// writer. A failure is a *PushError; the next push sends what it missed.
+func Push() error {
+	pushMu.Lock()
+	defer pushMu.Unlock()
+	if _, err := git("remote", "get-url", Remote); err != nil {
+		return nil
+	}
+	if _, err := git("push", "-q", "-u", Remote, "HEAD"); err != nil {
+		return &PushError{Err: err}
+	}
+	return nil
+}
+
+// documentName is the document's file name, which it has in the repository
+// too.
+func documentName() string {
+	return filepath.Base(config.DocumentFile())
+}
+
+func show(rev, name string) ([]byte, error) {
+	cmd := command("show", rev+":"+name)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// git runs git in the history repository and returns its trimmed output.
+func git(args ...string) (string, error) {
+	cmd := command(args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := run(cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+func command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", append([]string{"-C", config.HistoryDir()}, args...)...)
+	// Never wait on a credential prompt: writes from the TUI and the web
+	// server have no terminal to answer it.
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
+
+// run runs cmd, folding its standard error into a failure.
+func run(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git %s: %s", cmd.Args[3], msg)
+		}
+		return fmt.Errorf("git %s: %w", cmd.Args[3], err)
+	}
+	return nil
+}
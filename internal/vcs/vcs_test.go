@@ -0,0 +1,177 @@
+package vcs
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// setupRepo points the config at a fresh home with a history repository whose
+// origin is a bare repository, which it returns.
+func setupRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	config.SetBaseDir(t.TempDir())
+	t.Cleanup(config.ResetBaseDir)
+	// Package redact masks for real (see the profile package's tests); here
+	// the document holds no secret.
+	MaskSecretsWith(
+		func(path string, data []byte) ([]byte, error) { return data, nil },
+		func(edited, stored []byte) ([]byte, error) { return edited, nil },
+	)
+	t.Cleanup(func() { MaskSecretsWith(nil, nil) })
+	if err := config.EnsureDirs(); err != nil {
+		t.Fatalf("EnsureDirs: %v", err)
+	}
+	bare := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", "--bare", bare).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v: %s", err, out)
+	}
+	if err := Init(bare); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return bare
+}
+
+func setProfile(t *testing.T, name, block string) {
+	t.Helper()
+	err := config.Mutate(func(doc *config.Document) error {
+		doc.EnsureSchema()
+		return doc.SetProfileBlock(name, json.RawMessage(block))
+	})
+	if err != nil {
+		t.Fatalf("set profile %s: %v", name, err)
+	}
+}
+
+func record(t *testing.T, operation string) {
+	t.Helper()
+	if err := Record(operation); err != nil {
+		t.Fatalf("Record(%q): %v", operation, err)
+	}
+}
+
+func TestRecord_RefusesWithoutMasking(t *testing.T) {
+	setupRepo(t)
+	setProfile(t, "work", `{"[opencode]":{}}`)
+	MaskSecretsWith(nil, nil)
+	if err := Record("save work"); !errors.Is(err, errNoMasking) {
+		t.Fatalf("Record without masking = %v, want errNoMasking", err)
+	}
+}
+
+func TestRecord_CommitsAndPushes(t *testing.T) {
+	bare := setupRepo(t)
+
+	setProfile(t, "work", `{"[opencode]":{"disabled_mcps":["a"]}}`)
+	record(t, "start versioning")
+	setProfile(t, "work", `{"[opencode]":{"disabled_mcps":["b"]}}`)
+	record(t, "set work.disabled_mcps")
+	setProfile(t, "other", `{"[opencode]":{}}`)
+	record(t, "create other")
+	// An unchanged document is not committed again.
+	record(t, "save other")
+
+	commits, err := Log("", 0)
+	if err != nil {
+		t.Fatalf("Log: %v", err)
+	}
+	var subjects []string
+	for _, c := range commits {
+		subjects = append(subjects, c.Subject)
+	}
+	if got, want := strings.Join(subjects, " | "), "create other | set work.disabled_mcps | start versioning"; got != want {
+		t.Fatalf("subjects %q, want %q", got, want)
+	}
+	if p := commits[1].Profiles; len(p) != 1 || p[0] != "work" {
+		t.Errorf("profiles of the set %v, want [work]", p)
+	}
+
+	work, err := Log("work", 0)
+	if err != nil {
+		t.Fatalf("Log(work): %v", err)
+	}
+	if len(work) != 2 || work[0].Hash != commits[1].Hash {
+		t.Errorf("Log(work) %+v, want the set and the first commit", work)
+	}
+	if limited, _ := Log("", 1); len(limited) != 1 {
+		t.Errorf("Log with limit 1 returned %d commits", len(limited))
+	}
+
+	if status, err := GetStatus(); err != nil || status.Unpushed != 3 {
+		t.Fatalf("before the push: status %+v, %v; want 3 commits unpushed", status, err)
+	}
+	if err := Push(); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	out, err := exec.Command("git", "--git-dir", bare, "rev-parse", "refs/heads/main").Output()
+	if err != nil {
+		t.Fatalf("rev-parse in the remote: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != commits[0].Hash {
+		t.Errorf("remote main at %s, want %s", got, commits[0].Hash)
+	}
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if status.Branch != "main" || status.RemoteURL != bare || status.Unpushed != 0 {
+		t.Errorf("status %+v, want main, pushed to %s", status, bare)
+	}
+}
+
+func TestRestoreAndSwitch(t *testing.T) {
+	setupRepo(t)
+	setProfile(t, "work", `{"[opencode]":{"disabled_mcps":["a"]}}`)
+	record(t, "start versioning")
+	setProfile(t, "work", `{"[opencode]":{"disabled_mcps":["b"]}}`)
+	setProfile(t, "other", `{"[opencode]":{}}`)
+	record(t, "set work.disabled_mcps")
+
+	if _, err := Resolve("no-such-rev"); err == nil {
+		t.Error("Resolve of an unknown revision succeeded")
+	}
+
+	// A branch started at the first commit, restored: other is gone.
+	if err := Switch("exp", true, "HEAD~1"); err != nil {
+		t.Fatalf("Switch: %v", err)
+	}
+	if err := Restore("exp"); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	if doc.HasProfile("other") {
+		t.Error("document restored from exp still holds other")
+	}
+
+	// Back on main, only other's block is taken from it.
+	if err := Switch("main", false, ""); err != nil {
+		t.Fatalf("Switch: %v", err)
+	}
+	if err := RestoreProfile("main", "other"); err != nil {
+		t.Fatalf("RestoreProfile: %v", err)
+	}
+	doc, err = config.LoadDocument()
+	if err != nil {
+		t.Fatalf("LoadDocument: %v", err)
+	}
+	block, _, _ := doc.ProfileBlock("work")
+	if !doc.HasProfile("other") || !strings.Contains(string(block), `"a"`) {
+		t.Errorf("after restoring other from main: other %v, work %s", doc.HasProfile("other"), block)
+	}
+	if err := RestoreProfile("HEAD~1", "other"); err == nil {
+		t.Error("restoring a profile the commit lacks succeeded")
+	}
+	if err := Switch("-x", true, ""); err == nil {
+		t.Error("Switch accepted an invalid branch name")
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask covers every way a file in the directory can change, including
+// the atomic temp-file-and-rename writes omo-profiler itself performs.
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ATTRIB
+
+// inotifyBackend watches the files' directories rather than the files: an
+// atomic rename replaces the file's inode, which would silently end a per-file
+// watch.
+type inotifyBackend struct {
+	f     *os.File
+	files []string
+	dirs  map[int32]string
+	done  chan struct{}
+}
+
+func newNativeBackend(files []string) (backend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	b := &inotifyBackend{files: files, dirs: map[int32]string{}, done: make(chan struct{})}
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		wd, err := unix.InotifyAddWatch(fd, dir, inotifyMask)
+		if err != nil {
+			_ = unix.Close(fd)
+			return nil, err
+		}
+		b.dirs[int32(wd)] = dir
+	}
+	// A non-blocking descriptor wrapped in os.File goes through the runtime
+	// poller, so close() can interrupt a pending Read.
+	b.f = os.NewFile(uintptr(fd), "inotify")
+	return b, nil
+}
+
+func (b *inotifyBackend) run(changed chan<- string) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := b.f.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			continue
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + unix.SizeofInotifyEvent
+			off = nameStart + int(ev.Len)
+
+			var paths []string
+			switch dir, ok := b.dirs[ev.Wd]; {
+			case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+				// The kernel dropped events; any file may have changed.
+				paths = b.files
+			case ok && ev.Len > 0:
+				paths = []string{filepath.Join(dir, string(bytes.TrimRight(buf[nameStart:off], "\x00")))}
+			}
+			for _, p := range paths {
+				select {
+				case changed <- p:
+				case <-b.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *inotifyBackend) close() error {
+	close(b.done)
+	return b.f.Close()
+}
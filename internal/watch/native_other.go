@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+func newNativeBackend([]string) (backend, error) {
+	return nil, errors.New("native file watching not supported on this platform")
+}
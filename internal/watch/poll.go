@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"os"
+	"time"
+)
+
+// pollBackend detects changes by comparing each file's size and modification
+// time between ticks. It works everywhere, including on network filesystems
+// that deliver no native notifications.
+type pollBackend struct {
+	files    []string
+	interval time.Duration
+	last     map[string]fileState
+	done     chan struct{}
+}
+
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// newPollBackend records the files' current state before returning, so a
+// change made right after New is reported rather than taken as the baseline.
+func newPollBackend(files []string, interval time.Duration) *pollBackend {
+	last := make(map[string]fileState, len(files))
+	for _, f := range files {
+		last[f] = statFile(f)
+	}
+	return &pollBackend{files: files, interval: interval, last: last, done: make(chan struct{})}
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+func (p *pollBackend) run(changed chan<- string) {
+	last := p.last
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			for _, f := range p.files {
+				state := statFile(f)
+				if state == last[f] {
+					continue
+				}
+				last[f] = state
+				select {
+				case changed <- f:
+				case <-p.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *pollBackend) close() error {
+	close(p.done)
+	return nil
+}
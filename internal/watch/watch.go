@@ -0,0 +1,229 @@
+// Package watch notices when omo-profiler's files change on disk — whether the
+// writer is this process, another omo-profiler (`switch` from a script) or a
+// text editor — and fans the news out to subscribers such as the web UI's
+// event stream and the TUI.
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// Event reports that a watched file was written, created, replaced or removed.
+type Event struct {
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+}
+
+// Mode names the mechanism a Watcher uses.
+type Mode string
+
+const (
+	// ModeNative uses OS change notifications (inotify on Linux).
+	ModeNative Mode = "native"
+	// ModePoll stats the files every PollInterval.
+	ModePoll Mode = "poll"
+)
+
+// PollInterval is how often the polling fallback checks the files.
+var PollInterval = 500 * time.Millisecond
+
+// debounce coalesces the burst of events one save produces (temp file
+// created, written, renamed over the target) into a single Event.
+var debounce = 75 * time.Millisecond
+
+// backend delivers the paths of changed files until closed. Native backends
+// may also report other entries of the watched directories; the Watcher
+// filters.
+type backend interface {
+	run(changed chan<- string)
+	close() error
+}
+
+// multiBackend runs several backends into one channel.
+type multiBackend []backend
+
+func (m multiBackend) run(changed chan<- string) {
+	var wg sync.WaitGroup
+	for _, b := range m {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.run(changed)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m multiBackend) close() error {
+	var errs []error
+	for _, b := range m {
+		errs = append(errs, b.close())
+	}
+	return errors.Join(errs...)
+}
+
+// Watcher watches a fixed set of files and publishes an Event for each change.
+type Watcher struct {
+	files   map[string]struct{}
+	backend backend
+	mode    Mode
+
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+	done   chan struct{}
+}
+
+// New starts watching files. The files need not exist yet; creating one is a
+// change like any other.
+//
+// Files in existing directories are watched natively when the platform
+// supports it. The rest — a project `.omo` that has not been created yet, or
+// everything on a platform without native support — fall back to polling file
+// metadata, so New itself cannot fail.
+func New(files []string) *Watcher {
+	w := &Watcher{
+		files: make(map[string]struct{}, len(files)),
+		subs:  map[chan Event]struct{}{},
+		done:  make(chan struct{}),
+	}
+	var native, polled []string
+	for _, f := range files {
+		f = filepath.Clean(f)
+		if _, dup := w.files[f]; dup {
+			continue
+		}
+		w.files[f] = struct{}{}
+		if info, err := os.Stat(filepath.Dir(f)); err == nil && info.IsDir() {
+			native = append(native, f)
+		} else {
+			polled = append(polled, f)
+		}
+	}
+
+	var backends multiBackend
+	w.mode = ModePoll
+	if len(native) > 0 {
+		if b, err := newNativeBackend(native); err == nil {
+			backends = append(backends, b)
+			w.mode = ModeNative
+		} else {
+			polled = append(polled, native...)
+		}
+	}
+	if len(polled) > 0 {
+		backends = append(backends, newPollBackend(polled, PollInterval))
+	}
+	w.backend = backends
+
+	changed := make(chan string, 16)
+	go w.backend.run(changed)
+	go w.loop(changed)
+	return w
+}
+
+// ConfigFiles returns the files whose changes the UIs care about: both
+// spellings of the user and project documents, and the model registry.
+func ConfigFiles() []string {
+	projectDir := config.ProjectOmoDir()
+	if projectDir == "" {
+		projectDir = filepath.Dir(config.LayerFile(config.LayerProject))
+	}
+	var files []string
+	for _, dir := range []string{config.OmoDir(), projectDir} {
+		files = append(files,
+			filepath.Join(dir, config.OmoBasename),
+			filepath.Join(dir, config.OmoBasenameJSONC))
+	}
+	return append(files, config.ModelsFile())
+}
+
+// Mode reports which mechanism the watcher ended up using: ModeNative when at
+// least one file is watched natively.
+func (w *Watcher) Mode() Mode { return w.mode }
+
+// Subscribe returns a channel receiving every subsequent Event and a function
+// that unsubscribes. A subscriber that falls behind misses events rather than
+// stalling the others; events only say "reload", so the next one suffices.
+func (w *Watcher) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 8)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	w.subs[ch] = struct{}{}
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if _, ok := w.subs[ch]; ok {
+			delete(w.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close stops watching and closes every subscriber channel.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	for ch := range w.subs {
+		delete(w.subs, ch)
+		close(ch)
+	}
+	w.mu.Unlock()
+	close(w.done)
+	return w.backend.close()
+}
+
+func (w *Watcher) loop(changed <-chan string) {
+	pending := map[string]struct{}{}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-w.done:
+			timer.Stop()
+			return
+		case path, ok := <-changed:
+			if !ok {
+				return
+			}
+			if _, watched := w.files[filepath.Clean(path)]; !watched {
+				continue
+			}
+			if len(pending) == 0 {
+				timer.Reset(debounce)
+			}
+			pending[path] = struct{}{}
+		case <-timer.C:
+			now := time.Now()
+			for path := range pending {
+				w.publish(Event{Path: path, Time: now})
+			}
+			clear(pending)
+		}
+	}
+}
+
+func (w *Watcher) publish(ev Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+func expectEvent(t *testing.T, ch <-chan Event, path string) {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		if ev.Path != path {
+			t.Fatalf("event for %q, want %q", ev.Path, path)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no event for %s", path)
+	}
+}
+
+func expectQuiet(t *testing.T, ch <-chan Event) {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		t.Fatalf("unexpected event for %s", ev.Path)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWatcher_ReportsAtomicReplaceOnce(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, config.OmoBasename)
+
+	w := New([]string{target})
+	defer w.Close()
+	events, cancel := w.Subscribe()
+	defer cancel()
+
+	// The same temp-file-and-rename write Document.Save performs.
+	if err := config.WriteFileAtomic(target, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, target)
+	expectQuiet(t, events)
+}
+
+func TestWatcher_IgnoresUnwatchedNeighbours(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, config.OmoBasename)
+
+	w := New([]string{target})
+	defer w.Close()
+	events, cancel := w.Subscribe()
+	defer cancel()
+
+	if err := os.WriteFile(filepath.Join(dir, config.OmoLockBasename), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectQuiet(t, events)
+}
+
+func TestWatcher_PollsFilesInMissingDirectories(t *testing.T) {
+	prev := PollInterval
+	PollInterval = 20 * time.Millisecond
+	defer func() { PollInterval = prev }()
+
+	dir := filepath.Join(t.TempDir(), "project", config.OmoDirname)
+	target := filepath.Join(dir, config.OmoBasename)
+
+	w := New([]string{target})
+	defer w.Close()
+	if w.Mode() != ModePoll {
+		t.Fatalf("Mode() = %s, want %s for a missing directory", w.Mode(), ModePoll)
+	}
+	events, cancel := w.Subscribe()
+	defer cancel()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, target)
+}
+
+func TestWatcher_CloseEndsSubscriptions(t *testing.T) {
+	w := New([]string{filepath.Join(t.TempDir(), config.OmoBasename)})
+	events, cancel := w.Subscribe()
+	defer cancel()
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("subscription still open after Close")
+	}
+}
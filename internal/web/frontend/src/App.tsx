@@ -1,5 +1,6 @@
 import { NavLink, Navigate, Route, Routes } from 'react-router-dom'
-import { useQuery } from '@tanstack/react-query'
+import { useEffect } from 'react'
+import { useQuery, useQueryClient } from '@tanstack/react-query'
 import { Boxes, GitCompareArrows, LayoutDashboard, ListChecks, ShieldCheck, Cpu } from 'lucide-react'
 import { api } from './lib/api'
 import { cn } from './lib/utils'
@@ -19,8 +20,26 @@ const NAV = [
   { to: '/schema-check', label: 'Schema', icon: ShieldCheck, end: false },
 ]
 
+// useLiveUpdates refetches server state whenever a config file changes on
+// disk, whether the CLI, the TUI or an editor wrote it. An open editor keeps
+// its working copy: refetching ['profile', name] would discard unsaved edits,
+// and If-Match already catches the conflict when it saves.
+function useLiveUpdates() {
+  const qc = useQueryClient()
+  useEffect(() => {
+    const events = new EventSource('/api/events')
+    events.addEventListener('change', () => {
+      qc.invalidateQueries({
+        predicate: (q) => q.queryKey[0] !== 'profile' && q.queryKey[0] !== 'schema',
+      })
+    })
+    return () => events.close()
+  }, [qc])
+}
+
 export default function App() {
   const { data: active } = useQuery({ queryKey: ['active'], queryFn: api.getActive })
+  useLiveUpdates()
 
   return (
     <div className="flex h-full">
@@ -57,8 +76,14 @@ export default function App() {
           <div className="text-sm text-muted">Profile manager</div>
           <div className="flex items-center gap-2 text-sm">
             <span className="text-muted">Active:</span>
-            {active?.modified ? (
+            {active?.state === 'ambiguous' ? (
+              <Badge tone="warn">ambiguous ({active.candidates.join(', ')})</Badge>
+            ) : active?.state === 'drifted' ? (
+              <Badge tone="warn">{active.stack.length ? active.stack.join(' + ') : active.appliedName} (drifted)</Badge>
+            ) : active?.modified ? (
               <Badge tone="warn">custom (matches no profile)</Badge>
+            ) : active?.state === 'exact' && active.stack.length ? (
+              <Badge tone="success">{active.stack.join(' + ')}</Badge>
             ) : active?.profileName ? (
               <Badge tone="success">{active.profileName}</Badge>
             ) : (
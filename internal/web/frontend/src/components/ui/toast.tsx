@@ -1,5 +1,6 @@
-import { createContext, useCallback, useContext, useState, type ReactNode } from 'react'
+import { createContext, useCallback, useContext, useEffect, useState, type ReactNode } from 'react'
 import { CheckCircle2, XCircle, Info, X } from 'lucide-react'
+import { onApiWarning } from '../../lib/api'
 import { cn } from '../../lib/utils'
 
 type ToastVariant = 'success' | 'error' | 'info'
@@ -42,6 +43,11 @@ export function ToastProvider({ children }: { children: ReactNode }) {
     [remove],
   )
 
+  useEffect(
+    () => onApiWarning((warning) => toast({ title: 'Saved with a warning', description: warning, variant: 'error' })),
+    [toast],
+  )
+
   return (
     <ToastContext.Provider value={{ toast }}>
       {children}
@@ -1,15 +1,29 @@
 import type {
   ActiveResponse,
+  ApplyPreview,
+  CaptureRequest,
+  CaptureResult,
   CatalogResponse,
+  ConfigLayer,
+  ConflictPolicy,
   CreateProfileRequest,
   DiffResponse,
+  EffectiveResponse,
+  HarnessDetail,
+  HarnessesResponse,
+  HistoryResponse,
   ImportResult,
   JSONSchemaNode,
+  JournalEntry,
+  JournalResponse,
+  LayersResponse,
   ModelsResponse,
   ProfileDetail,
   ProfilesResponse,
+  Reference,
   RegisteredModel,
   SchemaCheckResult,
+  SettingsResponse,
   ValidateResult,
   ValidationError,
 } from './types'
@@ -24,10 +38,24 @@ export class ApiError extends Error {
   }
 }
 
-async function request<T>(method: string, path: string, body?: unknown): Promise<T> {
+// A write that landed but whose git commit or push failed answers with a
+// `warning`; listeners (the toast provider) show it.
+const warningListeners = new Set<(warning: string) => void>()
+
+export function onApiWarning(listener: (warning: string) => void): () => void {
+  warningListeners.add(listener)
+  return () => {
+    warningListeners.delete(listener)
+  }
+}
+
+async function request<T>(method: string, path: string, body?: unknown, headers?: Record<string, string>): Promise<T> {
   const res = await fetch(path, {
     method,
-    headers: body !== undefined ? { 'Content-Type': 'application/json' } : undefined,
+    headers: {
+      ...(body !== undefined ? { 'Content-Type': 'application/json' } : {}),
+      ...headers,
+    },
     body: body !== undefined ? JSON.stringify(body) : undefined,
   })
 
@@ -46,35 +74,127 @@ async function request<T>(method: string, path: string, body?: unknown): Promise
     throw new ApiError(res.status, obj.error || `HTTP ${res.status}`, obj.validationErrors)
   }
 
+  const warning = (parsed as { warning?: unknown } | undefined)?.warning
+  if (typeof warning === 'string') {
+    warningListeners.forEach((listener) => listener(warning))
+  }
   return parsed as T
 }
 
 export const api = {
   // Profiles
   listProfiles: () => request<ProfilesResponse>('GET', '/api/profiles'),
-  getProfile: (name: string) => request<ProfileDetail>('GET', `/api/profiles/${encodeURIComponent(name)}`),
-  saveProfile: (name: string, config: unknown) =>
-    request<{ ok: boolean }>('PUT', `/api/profiles/${encodeURIComponent(name)}`, config),
+  // Credentials come back masked as '••••' unless revealed; saving a mask keeps the stored value.
+  getProfile: (name: string, reveal = false) =>
+    request<ProfileDetail>('GET', `/api/profiles/${encodeURIComponent(name)}${reveal ? '?reveal=1' : ''}`),
+  // With a revision the save is refused (412) if the profile changed since it was loaded.
+  saveProfile: (name: string, config: unknown, revision?: string) =>
+    request<{ ok: boolean; revision: string }>(
+      'PUT',
+      `/api/profiles/${encodeURIComponent(name)}`,
+      config,
+      revision ? { 'If-Match': `"${revision}"` } : undefined,
+    ),
+  // Harness blocks other than [opencode]; saving {} removes the block.
+  getHarness: (name: string, harness: string, reveal = false) =>
+    request<HarnessDetail>(
+      'GET',
+      `/api/profiles/${encodeURIComponent(name)}/harness/${encodeURIComponent(harness)}${reveal ? '?reveal=1' : ''}`,
+    ),
+  saveHarness: (name: string, harness: string, config: unknown, revision?: string) =>
+    request<{ ok: boolean; revision: string }>(
+      'PUT',
+      `/api/profiles/${encodeURIComponent(name)}/harness/${encodeURIComponent(harness)}`,
+      config,
+      revision ? { 'If-Match': `"${revision}"` } : undefined,
+    ),
   createProfile: (req: CreateProfileRequest) => request<{ name: string }>('POST', '/api/profiles', req),
   deleteProfile: (name: string) =>
     request<{ ok: boolean }>('DELETE', `/api/profiles/${encodeURIComponent(name)}`),
   renameProfile: (name: string, newName: string) =>
     request<{ name: string }>('POST', `/api/profiles/${encodeURIComponent(name)}/rename`, { newName }),
-  activateProfile: (name: string) =>
-    request<{ ok: boolean; name: string; snapshot: string }>('POST', `/api/profiles/${encodeURIComponent(name)}/activate`),
-  exportProfileUrl: (name: string) => `/api/profiles/${encodeURIComponent(name)}/export`,
+  // strict removes root keys the profile does not declare, whatever its setting.
+  activateProfile: (name: string, strict = false) =>
+    request<{ ok: boolean; name: string; snapshot: string }>(
+      'POST',
+      `/api/profiles/${encodeURIComponent(name)}/activate${strict ? '?strict=1' : ''}`,
+    ),
+  // Computes what activateProfile would change without writing anything.
+  previewActivate: (name: string, strict = false) =>
+    request<ApplyPreview>(
+      'POST',
+      `/api/profiles/${encodeURIComponent(name)}/activate?dryRun=1${strict ? '&strict=1' : ''}`,
+    ),
+  // Applies profiles as ordered overlays, bottom first.
+  activateStack: (profiles: string[], strict = false) =>
+    request<{ ok: boolean; name: string; stack: string[]; snapshot: string }>(
+      'POST',
+      `/api/stack${strict ? '?strict=1' : ''}`,
+      { profiles },
+    ),
+  previewStack: (profiles: string[], strict = false) =>
+    request<ApplyPreview>('POST', `/api/stack?dryRun=1${strict ? '&strict=1' : ''}`, { profiles }),
+  setProfileStrict: (name: string, strict: boolean) =>
+    request<{ name: string; strict: boolean }>('PUT', `/api/profiles/${encodeURIComponent(name)}/settings`, { strict }),
+  // An empty parent removes it. A parent that descends from name is a 409.
+  setProfileExtends: (name: string, parent: string) =>
+    request<{ name: string; extends: string }>('PUT', `/api/profiles/${encodeURIComponent(name)}/settings`, {
+      extends: parent,
+    }),
+  getReferences: (name: string) =>
+    request<{ references: Reference[] }>('GET', `/api/profiles/${encodeURIComponent(name)}/references`),
+  getHistory: (name: string, reveal = false) =>
+    request<HistoryResponse>('GET', `/api/profiles/${encodeURIComponent(name)}/history${reveal ? '?reveal=1' : ''}`),
+  // Restores the version a backup holds; 422 with validationErrors when it no longer validates.
+  restoreVersion: (name: string, backup: string) =>
+    request<{ ok: boolean; name: string; backup: string }>(
+      'POST',
+      `/api/profiles/${encodeURIComponent(name)}/history/restore`,
+      { backup },
+    ),
+  exportProfileUrl: (name: string, harness = 'opencode') =>
+    `/api/profiles/${encodeURIComponent(name)}/export${harness === 'opencode' ? '' : `?harness=${encodeURIComponent(harness)}`}`,
+  // An omo document holding every profile.
+  exportAllUrl: () => '/api/export',
 
   // Active / diff / import / validate / schema
   getActive: () => request<ActiveResponse>('GET', '/api/active'),
-  diff: (left: string, right: string) =>
-    request<DiffResponse>('GET', `/api/diff?left=${encodeURIComponent(left)}&right=${encodeURIComponent(right)}`),
-  import: (config: unknown, name?: string) =>
-    request<ImportResult>('POST', '/api/import', { name: name ?? '', config }),
-  validate: (config: unknown, mode: 'strict' | 'save' = 'save') =>
-    request<ValidateResult>('POST', `/api/validate?mode=${mode}`, config),
-  getSchema: () => request<JSONSchemaNode>('GET', '/api/schema'),
+  getJournal: () => request<JournalResponse>('GET', '/api/journal'),
+  switchBack: () =>
+    request<{ ok: boolean; name: string; stack: string[]; snapshot: string }>('POST', '/api/switch-back'),
+  revert: () => request<{ ok: boolean; reverted: JournalEntry }>('POST', '/api/revert'),
+  // 409 when the profile exists and force is not set.
+  capture: (req: CaptureRequest) => request<CaptureResult>('POST', '/api/capture', req),
+  // A side is a profile name, '__active__', or a stack written 'a+b'.
+  diff: (left: string, right: string, reveal = false, harness = 'opencode') =>
+    request<DiffResponse>(
+      'GET',
+      `/api/diff?left=${encodeURIComponent(left)}&right=${encodeURIComponent(right)}&harness=${encodeURIComponent(harness)}${reveal ? '&reveal=1' : ''}`,
+    ),
+  // config may be a flat harness block, a whole profile block or an omo document.
+  import: (
+    config: unknown,
+    name?: string,
+    opts: { harness?: string; profiles?: string[]; onConflict?: ConflictPolicy } = {},
+  ) => request<ImportResult>('POST', '/api/import', { name: name ?? '', config, ...opts }),
+  // A harness other than opencode is always validated in save mode.
+  validate: (config: unknown, mode: 'strict' | 'save' = 'save', harness = 'opencode') =>
+    request<ValidateResult>('POST', `/api/validate?mode=${mode}&harness=${encodeURIComponent(harness)}`, config),
+  getSchema: (harness = 'opencode') =>
+    request<JSONSchemaNode>('GET', `/api/schema?harness=${encodeURIComponent(harness)}`),
+  listHarnesses: () => request<HarnessesResponse>('GET', '/api/harnesses'),
   schemaCheck: () => request<SchemaCheckResult>('GET', '/api/schema-check'),
 
+  // Config layers
+  getLayers: () => request<LayersResponse>('GET', '/api/layers'),
+  setLayer: (target: ConfigLayer) => request<LayersResponse>('PUT', '/api/layers', { target }),
+  getEffective: () => request<EffectiveResponse>('GET', '/api/effective'),
+
+  // omo-profiler settings
+  getSettings: () => request<SettingsResponse>('GET', '/api/settings'),
+  // null restores the default kept keys.
+  setKeepKeys: (keepKeys: string[] | null) => request<SettingsResponse>('PUT', '/api/settings', { keepKeys }),
+
   // Models
   listModels: () => request<ModelsResponse>('GET', '/api/models'),
   createModel: (m: RegisteredModel) => request<RegisteredModel>('POST', '/api/models', m),
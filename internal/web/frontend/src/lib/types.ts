@@ -1,16 +1,73 @@
 // Types mirroring the Go API responses (see internal/web/handlers*.go).
 
 // The active profile is detected by comparing the root against stored profiles,
-// so the root *is* the effective configuration — no env vars, no hint file.
+// so the root *is* the effective configuration — no env vars, no hint file. The
+// activation record only breaks ties and tells a drifted root from a custom one.
+export type ConfigLayer = 'user' | 'project'
+
+export type ActiveState = 'exact' | 'drifted' | 'ambiguous' | 'none'
+
 export interface ActiveInfo {
   documentExists: boolean
+  // Set for the exact state only.
   profileName: string
+  state: ActiveState
+  // Every profile matching the root, sorted.
+  candidates: string[]
+  // The profile last applied, when it still exists.
+  appliedName: string
+  // The overlays of the stack last applied, bottom first, when it still
+  // exists. With the exact state the root matches it and profileName is ''.
+  stack: string[]
+  // The applied profile was edited after it was applied.
+  profileChanged: boolean
   modified: boolean
+  layer: ConfigLayer
+  path: string
+}
+
+export interface LayerInfo {
+  layer: ConfigLayer
+  path: string
+  exists: boolean
+}
+
+export interface LayersResponse {
+  target: ConfigLayer
+  layers: LayerInfo[]
+}
+
+export interface EffectiveResponse {
+  config: Record<string, unknown>
+  sources: Record<string, ConfigLayer>
+  files: Partial<Record<ConfigLayer, string>>
 }
 
 export interface ProfileListEntry {
   name: string
   active: boolean
+  // Every activation removes root keys the profile does not declare.
+  strict: boolean
+  // The parent profile this one inherits from, when any.
+  extends?: string
+}
+
+// Which document backups pruning keeps; all zero keeps every backup.
+export interface BackupRetention {
+  keepLast?: number
+  keepDaily?: number
+  keepWeekly?: number
+  // Bytes; 0 or absent is no cap.
+  maxTotalSize?: number
+}
+
+export interface SettingsResponse {
+  keepKeys: string[]
+  profiles: Record<string, { strict?: boolean; extends?: string }>
+  backups: BackupRetention
+  pinnedBackups: string[]
+  // Whether every write is committed to the document's git history.
+  git: boolean
 }
 
 export interface ProfilesResponse {
@@ -22,16 +79,138 @@ export type ConfigObject = Record<string, unknown>
 
 export interface ProfileDetail {
   name: string
+  revision: string
   config: ConfigObject
   fieldPresence: Record<string, boolean> | null
   hasLegacyFields: boolean
   legacyFieldsWarning: string
+  // Parents, nearest first. config holds the profile's own fields only;
+  // resolvedConfig is what it applies, inherited fields included.
+  ancestors: string[]
+  resolvedConfig: ConfigObject
+}
+
+// A harness block of the omo document: '[opencode]', '[senpi]', '[codex]'.
+export interface Harness {
+  key: string
+  name: string
+}
+
+export interface HarnessesResponse {
+  harnesses: Harness[]
+}
+
+// One harness block of a profile; config is {} when the profile does not
+// configure that harness.
+export interface HarnessDetail {
+  name: string
+  harness: string
+  revision: string
+  config: ConfigObject
+  ancestors: string[]
+  resolvedConfig: ConfigObject
 }
 
 export interface ActiveResponse extends ActiveInfo {
   config: ConfigObject
 }
 
+export type RootChangeKind = 'added' | 'replaced' | 'unchanged' | 'kept' | 'removed'
+
+export interface RootChange {
+  key: string
+  kind: RootChangeKind
+  before?: unknown
+  after?: unknown
+}
+
+export interface ApplyPreview {
+  // A stack's name is its overlays joined with ' + '.
+  name: string
+  stack?: string[]
+  strict: boolean
+  previous?: string
+  snapshot?: string
+  snapshotKeys?: string[]
+  changes: RootChange[]
+  // References that do not resolve; activating would fail with 422.
+  unresolved?: Reference[]
+}
+
+export interface CaptureRequest {
+  // Empty captures into the profile last applied.
+  name?: string
+  fields?: string[]
+  force?: boolean
+  dryRun?: boolean
+}
+
+export interface CaptureResult {
+  name: string
+  existed: boolean
+  before?: unknown
+  after: unknown
+  changed: boolean
+  written: boolean
+}
+
+// A `${env:NAME}` or `${file:PATH}` reference in a profile. Only activation
+// resolves it; the API never returns the value.
+export interface Reference {
+  path: string
+  ref: string
+  kind: 'env' | 'file'
+  target: string
+  resolved: boolean
+  error?: string
+}
+
+export interface JournalEntry {
+  time: string
+  // For a stack, its overlays joined with ' + '; stack lists them.
+  profile: string
+  stack?: string[]
+  previous?: string
+  previousStack?: string[]
+  snapshot?: string
+  replaced?: Record<string, unknown>
+  added?: string[]
+}
+
+export interface JournalResponse {
+  entries: JournalEntry[]
+  previous: string
+}
+
+export interface FieldChange {
+  // Dotted block path, e.g. '[opencode].agents.oracle.model'; '' when the
+  // profile itself was created or deleted.
+  path: string
+  kind: 'added' | 'removed' | 'changed'
+  before?: unknown
+  after?: unknown
+}
+
+export interface ProfileVersion {
+  live: boolean
+  exists: boolean
+  block?: Record<string, unknown>
+  // The newest backup holding this version; restoring it reads that backup.
+  backup?: string
+  backups: number
+  since?: string
+  until?: string
+  replacedBy?: string
+  source?: string
+  changes?: FieldChange[]
+}
+
+export interface HistoryResponse {
+  name: string
+  // Newest first.
+  versions: ProfileVersion[]
+}
+
 export interface ValidationError {
   path: string
   message: string
@@ -55,9 +234,21 @@ export interface DiffResponse {
   right: DiffLine[]
 }
 
+export type ConflictPolicy = 'rename' | 'skip' | 'overwrite'
+
+export interface ImportOutcome {
+  name: string
+  // The profile it was stored as; absent when skipped.
+  imported?: string
+  action: 'created' | 'renamed' | 'overwritten' | 'skipped'
+}
+
 export interface ImportResult {
+  // name and hadCollision describe the first profile imported.
   name: string
   hadCollision: boolean
+  format: 'flat' | 'block' | 'document'
+  results: ImportOutcome[]
 }
 
 export interface SchemaCheckResult {
@@ -105,6 +296,8 @@ export interface CatalogResponse {
 export interface CreateProfileRequest {
   name: string
   from: string
+  // Creates an empty profile inheriting from this parent; from must be ''.
+  extends?: string
 }
 
 // ---- JSON Schema (draft-07 subset we render) ----
@@ -1,10 +1,16 @@
+import { useState } from 'react'
 import { Link } from 'react-router-dom'
-import { useQuery } from '@tanstack/react-query'
-import { ArrowRight, Cpu, GitCompareArrows, ListChecks, ShieldCheck } from 'lucide-react'
-import { api } from '../lib/api'
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import { ArrowRight, Cpu, GitCompareArrows, ListChecks, RotateCcw, Save, ShieldCheck, Undo2 } from 'lucide-react'
+import { api, ApiError } from '../lib/api'
+import type { ConfigLayer } from '../lib/types'
 import { Card, CardHeader } from '../components/ui/card'
 import { Badge } from '../components/ui/badge'
+import { Button } from '../components/ui/button'
+import { Dialog, DialogContent } from '../components/ui/dialog'
+import { Input } from '../components/ui/input'
 import { Spinner } from '../components/ui/spinner'
+import { useToast } from '../components/ui/toast'
 
 const ACTIONS = [
   { to: '/profiles', title: 'Profiles', desc: 'Switch, create, clone, rename, edit, import & export', icon: ListChecks },
@@ -16,12 +22,51 @@ const ACTIONS = [
 export function DashboardPage() {
   const active = useQuery({ queryKey: ['active'], queryFn: api.getActive })
   const profiles = useQuery({ queryKey: ['profiles'], queryFn: api.listProfiles })
+  const layers = useQuery({ queryKey: ['layers'], queryFn: api.getLayers })
+  const effective = useQuery({ queryKey: ['effective'], queryFn: api.getEffective })
+  const journal = useQuery({ queryKey: ['journal'], queryFn: api.getJournal })
+  const qc = useQueryClient()
+  const { toast } = useToast()
+  const [captureOpen, setCaptureOpen] = useState(false)
+
+  const setLayer = useMutation({
+    mutationFn: (target: ConfigLayer) => api.setLayer(target),
+    onSuccess: (res) => {
+      // Every other endpoint now reads a different file.
+      qc.invalidateQueries()
+      toast({ title: `Editing the ${res.target} layer`, variant: 'success' })
+    },
+    onError: (e: Error) => toast({ title: 'Could not switch layer', description: e.message, variant: 'error' }),
+  })
+
+  const switchBack = useMutation({
+    mutationFn: () => api.switchBack(),
+    onSuccess: (res) => {
+      qc.invalidateQueries()
+      toast({ title: `Switched back to ${res.name}`, variant: 'success' })
+    },
+    onError: (e: Error) => toast({ title: 'Could not switch back', description: e.message, variant: 'error' }),
+  })
+
+  const revert = useMutation({
+    mutationFn: () => api.revert(),
+    onSuccess: (res) => {
+      qc.invalidateQueries()
+      toast({ title: `Reverted the switch to ${res.reverted.profile}`, variant: 'success' })
+    },
+    onError: (e: Error) => toast({ title: 'Could not revert', description: e.message, variant: 'error' }),
+  })
+
+  const lastSwitch = journal.data?.entries[0]
+  const sources = effective.data ? Object.entries(effective.data.sources).sort(([a], [b]) => a.localeCompare(b)) : []
 
   return (
     <div className="mx-auto max-w-4xl space-y-6">
       <div>
         <h1 className="text-xl font-semibold text-text">Dashboard</h1>
-        <p className="mt-1 text-sm text-muted">Manage profiles in your ~/.omo/omo.json document.</p>
+        <p className="mt-1 text-sm text-muted">
+          Manage profiles in {active.data?.path ? <code>{active.data.path}</code> : 'your ~/.omo/omo.json document'}.
+        </p>
       </div>
 
       <div className="grid grid-cols-1 gap-4 sm:grid-cols-2">
@@ -29,10 +74,52 @@ export function DashboardPage() {
           <CardHeader title="Active profile" />
           {active.isLoading ? (
             <Spinner />
+          ) : active.data?.state === 'ambiguous' ? (
+            <div className="space-y-1">
+              <div className="flex items-center gap-2">
+                <span className="text-lg font-medium text-text">{active.data.candidates.join(', ')}</span>
+                <Badge tone="warn">ambiguous</Badge>
+              </div>
+              <p className="text-sm text-muted">
+                The root matches several profiles and none of them was applied here. Switch to one to record it.
+              </p>
+            </div>
+          ) : active.data?.state === 'drifted' ? (
+            <div className="flex items-center justify-between gap-2">
+              <div className="space-y-1">
+                <div className="flex items-center gap-2">
+                  <span className="text-lg font-medium text-text">
+                    {active.data.stack.length ? active.data.stack.join(' + ') : active.data.appliedName}
+                  </span>
+                  <Badge tone="warn">drifted</Badge>
+                </div>
+                <p className="text-sm text-muted">
+                  {active.data.profileChanged
+                    ? `The ${active.data.stack.length ? 'stack' : 'profile'} was edited after it was applied.`
+                    : `The root was edited after this ${active.data.stack.length ? 'stack' : 'profile'} was applied.`}
+                </p>
+              </div>
+              <Button size="sm" variant="secondary" onClick={() => setCaptureOpen(true)}>
+                <Save className="h-4 w-4" /> Capture…
+              </Button>
+            </div>
           ) : active.data?.modified ? (
-            <div className="flex items-center gap-2">
-              <span className="text-lg font-medium text-text">custom</span>
-              <Badge tone="warn">matches no profile</Badge>
+            <div className="flex items-center justify-between gap-2">
+              <div className="flex items-center gap-2">
+                <span className="text-lg font-medium text-text">custom</span>
+                <Badge tone="warn">matches no profile</Badge>
+              </div>
+              <Button size="sm" variant="secondary" onClick={() => setCaptureOpen(true)}>
+                <Save className="h-4 w-4" /> Capture…
+              </Button>
+            </div>
+          ) : active.data?.state === 'exact' && active.data.stack.length ? (
+            <div className="space-y-1">
+              <div className="flex items-center gap-2">
+                <span className="text-lg font-medium text-text">{active.data.stack.join(' + ')}</span>
+                <Badge tone="success">stack</Badge>
+              </div>
+              <p className="text-sm text-muted">Applied as overlays, each over the ones before it.</p>
             </div>
           ) : active.data?.profileName ? (
             <div className="flex items-center gap-2">
@@ -51,6 +138,85 @@ export function DashboardPage() {
         </Card>
       </div>
 
+      {lastSwitch && (
+        <Card>
+          <CardHeader title="Last switch" />
+          <div className="flex flex-wrap items-center justify-between gap-3">
+            <p className="text-sm text-muted">
+              {lastSwitch.previous ? <code>{lastSwitch.previous}</code> : 'a custom configuration'} →{' '}
+              <code>{lastSwitch.profile}</code> at {new Date(lastSwitch.time).toLocaleString()}
+            </p>
+            <div className="flex gap-2">
+              {journal.data?.previous && (
+                <Button
+                  size="sm"
+                  variant="secondary"
+                  disabled={switchBack.isPending || revert.isPending}
+                  onClick={() => switchBack.mutate()}
+                >
+                  <Undo2 className="h-4 w-4" /> Switch back to {journal.data.previous}
+                </Button>
+              )}
+              <Button
+                size="sm"
+                variant="secondary"
+                disabled={switchBack.isPending || revert.isPending}
+                onClick={() => revert.mutate()}
+              >
+                <RotateCcw className="h-4 w-4" /> Revert
+              </Button>
+            </div>
+          </div>
+        </Card>
+      )}
+
+      <Card>
+        <CardHeader title="Config layer" />
+        {layers.isLoading ? (
+          <Spinner />
+        ) : (
+          <div className="space-y-2">
+            {layers.data?.layers.map((l) => (
+              <div key={l.layer} className="flex items-center justify-between gap-3">
+                <div className="min-w-0">
+                  <div className="flex items-center gap-2 text-sm font-medium text-text">
+                    {l.layer}
+                    {!l.exists && <Badge tone="warn">not created</Badge>}
+                  </div>
+                  <div className="truncate text-xs text-muted">{l.path}</div>
+                </div>
+                <Button
+                  size="sm"
+                  variant={layers.data?.target === l.layer ? 'primary' : 'secondary'}
+                  disabled={layers.data?.target === l.layer || setLayer.isPending}
+                  onClick={() => setLayer.mutate(l.layer)}
+                >
+                  {layers.data?.target === l.layer ? 'Editing' : 'Edit'}
+                </Button>
+              </div>
+            ))}
+          </div>
+        )}
+      </Card>
+
+      <Card>
+        <CardHeader title="Effective config" />
+        {effective.isLoading ? (
+          <Spinner />
+        ) : sources.length === 0 ? (
+          <p className="text-sm text-muted">No configuration in either layer.</p>
+        ) : (
+          <div className="max-h-72 space-y-1 overflow-auto font-mono text-xs">
+            {sources.map(([path, layer]) => (
+              <div key={path} className="flex items-center gap-2">
+                <Badge tone={layer === 'project' ? 'accent' : 'muted'}>{layer}</Badge>
+                <span className="truncate text-text">{path}</span>
+              </div>
+            ))}
+          </div>
+        )}
+      </Card>
+
       <div className="grid grid-cols-1 gap-4 sm:grid-cols-2">
         {ACTIONS.map((a) => (
           <Link key={a.to} to={a.to}>
@@ -65,6 +231,87 @@ export function DashboardPage() {
           </Link>
         ))}
       </div>
+
+      {captureOpen && (
+        <CaptureDialog
+          initialName={lastSwitch?.profile ?? ''}
+          onClose={() => setCaptureOpen(false)}
+          onCaptured={(name) => {
+            setCaptureOpen(false)
+            qc.invalidateQueries()
+            toast({ title: `Saved the live configuration as ${name}`, variant: 'success' })
+          }}
+        />
+      )}
     </div>
   )
 }
+
+// CaptureDialog saves the live root into a profile. An existing profile is
+// only overwritten after the server's 409 has been confirmed.
+function CaptureDialog({
+  initialName,
+  onClose,
+  onCaptured,
+}: {
+  initialName: string
+  onClose: () => void
+  onCaptured: (name: string) => void
+}) {
+  const [name, setName] = useState(initialName)
+  const [error, setError] = useState<string | null>(null)
+  const [confirmOverwrite, setConfirmOverwrite] = useState(false)
+  const [busy, setBusy] = useState(false)
+
+  async function submit(force: boolean) {
+    setBusy(true)
+    setError(null)
+    try {
+      const res = await api.capture({ name: name.trim(), force })
+      onCaptured(res.name)
+    } catch (e) {
+      if (e instanceof ApiError && e.status === 409 && !force) {
+        setConfirmOverwrite(true)
+      }
+      setError((e as Error).message)
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  return (
+    <Dialog open onOpenChange={(o) => !o && onClose()}>
+      <DialogContent
+        title="Capture live configuration"
+        description="Save the harness blocks at the document root into a profile."
+      >
+        <div className="space-y-4">
+          <Input
+            value={name}
+            onChange={(e) => {
+              setName(e.target.value)
+              setConfirmOverwrite(false)
+            }}
+            placeholder="Profile name"
+            autoFocus
+          />
+          {error && <p className="text-sm text-danger">{error}</p>}
+          <div className="flex justify-end gap-2">
+            <Button variant="ghost" onClick={onClose}>
+              Cancel
+            </Button>
+            {confirmOverwrite ? (
+              <Button variant="danger" onClick={() => submit(true)} disabled={busy}>
+                {busy ? <Spinner /> : `Overwrite ${name.trim()}`}
+              </Button>
+            ) : (
+              <Button variant="primary" onClick={() => submit(false)} disabled={busy || !name.trim()}>
+                {busy ? <Spinner /> : 'Capture'}
+              </Button>
+            )}
+          </div>
+        </div>
+      </DialogContent>
+    </Dialog>
+  )
+}
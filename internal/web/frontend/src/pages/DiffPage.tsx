@@ -1,6 +1,6 @@
 import { useState } from 'react'
 import { useQuery } from '@tanstack/react-query'
-import { GitCompareArrows } from 'lucide-react'
+import { Eye, EyeOff, GitCompareArrows } from 'lucide-react'
 import { api } from '../lib/api'
 import type { DiffLine } from '../lib/types'
 import { cn } from '../lib/utils'
@@ -11,13 +11,17 @@ import { Spinner } from '../components/ui/spinner'
 
 export function DiffPage() {
   const profilesQ = useQuery({ queryKey: ['profiles'], queryFn: api.listProfiles })
+  const harnessesQ = useQuery({ queryKey: ['harnesses'], queryFn: api.listHarnesses, staleTime: Infinity })
+  const [harness, setHarness] = useState('opencode')
   const [left, setLeft] = useState('__active__')
   const [right, setRight] = useState('')
   const [pair, setPair] = useState<{ left: string; right: string } | null>(null)
+  // Secrets are masked on both sides, so a changed token shows no difference until revealed.
+  const [reveal, setReveal] = useState(false)
 
   const diffQ = useQuery({
-    queryKey: ['diff', pair?.left, pair?.right],
-    queryFn: () => api.diff(pair!.left, pair!.right),
+    queryKey: ['diff', pair?.left, pair?.right, reveal, harness],
+    queryFn: () => api.diff(pair!.left, pair!.right, reveal, harness),
     enabled: !!pair,
   })
 
@@ -40,9 +44,24 @@ export function DiffPage() {
             <label className="mb-1 block text-sm text-muted">Right</label>
             <Select value={right || undefined} onValueChange={setRight} options={options} placeholder="Select…" />
           </div>
+          <div className="w-36">
+            <label className="mb-1 block text-sm text-muted">Harness</label>
+            <Select
+              value={harness}
+              onValueChange={setHarness}
+              options={(harnessesQ.data?.harnesses ?? [{ key: '[opencode]', name: 'opencode' }]).map((h) => ({
+                value: h.name,
+                label: h.key,
+              }))}
+            />
+          </div>
           <Button variant="primary" disabled={!left || !right} onClick={() => setPair({ left, right })}>
             <GitCompareArrows className="h-4 w-4" /> Compare
           </Button>
+          <Button variant="ghost" onClick={() => setReveal(!reveal)}>
+            {reveal ? <EyeOff className="h-4 w-4" /> : <Eye className="h-4 w-4" />}
+            {reveal ? 'Mask secrets' : 'Reveal secrets'}
+          </Button>
         </div>
       </Card>
 
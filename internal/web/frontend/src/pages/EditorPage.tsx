@@ -1,13 +1,14 @@
-import { useEffect, useMemo, useState } from 'react'
+import { type ReactNode, useEffect, useMemo, useState } from 'react'
 import { useNavigate, useParams } from 'react-router-dom'
-import { useQuery } from '@tanstack/react-query'
-import { AlertTriangle, ArrowLeft, Plus, Save } from 'lucide-react'
-import { api } from '../lib/api'
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import { AlertTriangle, ArrowLeft, Eye, EyeOff, Plus, Save } from 'lucide-react'
+import { api, ApiError } from '../lib/api'
 import type { ConfigObject, JSONSchemaNode, ValidationError } from '../lib/types'
 import { cn, humanize } from '../lib/utils'
 import { Button } from '../components/ui/button'
 import { Card } from '../components/ui/card'
 import { Input } from '../components/ui/input'
+import { Select } from '../components/ui/select'
 import { Badge } from '../components/ui/badge'
 import { Spinner } from '../components/ui/spinner'
 import { Tabs, TabsList, TabsTrigger, TabsContent } from '../components/ui/tabs'
@@ -32,19 +33,71 @@ const GENERAL_KEYS = [
   'disabled_providers',
 ]
 
+// Radix Select items cannot have an empty value.
+const NO_PARENT = '__none__'
+
 const CURATED: Record<string, true> = Object.fromEntries(
   ['$schema', 'agents', 'categories', ...GENERAL_KEYS].map((k) => [k, true]),
 )
 
+// EditorPage edits one profile, a tab per harness block of the omo document.
+// [opencode] gets the curated editor; the other harnesses a form driven by
+// their block's schema.
 export function EditorPage() {
   const { name = '' } = useParams()
+  const harnessesQ = useQuery({ queryKey: ['harnesses'], queryFn: api.listHarnesses, staleTime: Infinity })
+  const [harness, setHarness] = useState('opencode')
+
+  const harnesses = harnessesQ.data?.harnesses ?? []
+  const tabs =
+    harnesses.length > 1 ? (
+      <div className="flex gap-1 border-b border-border">
+        {harnesses.map((h) => (
+          <button
+            key={h.key}
+            onClick={() => setHarness(h.name)}
+            className={cn(
+              '-mb-px border-b-2 px-3 py-1.5 font-mono text-sm transition-colors',
+              harness === h.name ? 'border-accent text-text' : 'border-transparent text-muted hover:text-text',
+            )}
+          >
+            {h.key}
+          </button>
+        ))}
+      </div>
+    ) : null
+
+  if (harness === 'opencode') return <OpenCodeEditor name={name} harnessTabs={tabs} />
+  return <HarnessEditor key={harness} name={name} harness={harness} harnessTabs={tabs} />
+}
+
+function OpenCodeEditor({ name, harnessTabs }: { name: string; harnessTabs: ReactNode }) {
   const navigate = useNavigate()
   const { toast } = useToast()
 
-  const profileQ = useQuery({ queryKey: ['profile', name], queryFn: () => api.getProfile(name) })
-  const schemaQ = useQuery({ queryKey: ['schema'], queryFn: api.getSchema, staleTime: Infinity })
+  const [reveal, setReveal] = useState(false)
+  const profileQ = useQuery({
+    queryKey: ['profile', name, reveal ? 'revealed' : 'masked'],
+    queryFn: () => api.getProfile(name, reveal),
+  })
+  const schemaQ = useQuery({ queryKey: ['schema'], queryFn: () => api.getSchema(), staleTime: Infinity })
+  const profilesQ = useQuery({ queryKey: ['profiles'], queryFn: api.listProfiles })
+  const refsQ = useQuery({ queryKey: ['profile', name, 'references'], queryFn: () => api.getReferences(name) })
+  const qc = useQueryClient()
+  const setParent = useMutation({
+    mutationFn: (parent: string) => api.setProfileExtends(name, parent),
+    onSuccess: (res) => {
+      toast({
+        title: res.extends ? `${name} now extends ${res.extends}` : `${name} extends no profile`,
+        variant: 'success',
+      })
+      qc.invalidateQueries()
+    },
+    onError: (e: Error) => toast({ title: 'Could not change the parent', description: e.message, variant: 'error' }),
+  })
 
   const [working, setWorking] = useState<ConfigObject>({})
+  const [revision, setRevision] = useState('')
   const [dirty, setDirty] = useState(false)
   const [errors, setErrors] = useState<ValidationError[]>([])
   const [saving, setSaving] = useState(false)
@@ -53,6 +106,7 @@ export function EditorPage() {
   useEffect(() => {
     if (profileQ.data) {
       setWorking(profileQ.data.config)
+      setRevision(profileQ.data.revision)
       setDirty(false)
     }
   }, [profileQ.data])
@@ -95,11 +149,20 @@ export function EditorPage() {
         toast({ title: 'Validation failed', description: `${res.errors.length} error(s)`, variant: 'error' })
         return
       }
-      await api.saveProfile(name, working)
+      const saved = await api.saveProfile(name, working, revision)
+      setRevision(saved.revision)
       setErrors([])
       setDirty(false)
       toast({ title: 'Saved', description: name, variant: 'success' })
     } catch (e) {
+      if (e instanceof ApiError && e.status === 412) {
+        toast({
+          title: 'Profile changed elsewhere',
+          description: 'Another tab or tool saved this profile since you opened it. Reload to see its changes.',
+          variant: 'error',
+        })
+        return
+      }
       toast({ title: 'Save failed', description: (e as Error).message, variant: 'error' })
     } finally {
       setSaving(false)
@@ -119,6 +182,8 @@ export function EditorPage() {
   }
 
   const sections = ['General', 'Agents', 'Categories', ...otherSections]
+  const ancestors = profileQ.data?.ancestors ?? []
+  const unresolved = (refsQ.data?.references ?? []).filter((r) => !r.resolved)
 
   return (
     <div className="mx-auto max-w-5xl space-y-4">
@@ -129,14 +194,45 @@ export function EditorPage() {
           </Button>
           <div>
             <h1 className="text-xl font-semibold text-text">{name}</h1>
-            {dirty && <span className="text-xs text-warn">Unsaved changes</span>}
+            {ancestors.length > 0 && (
+              <span className="text-xs text-muted">
+                extends {ancestors.join(' → ')} — the form edits this profile's own fields
+              </span>
+            )}
+            {dirty && <span className="ml-2 text-xs text-warn">Unsaved changes</span>}
           </div>
         </div>
-        <Button variant="primary" onClick={save} disabled={saving || !dirty}>
-          {saving ? <Spinner /> : <Save className="h-4 w-4" />} Save
-        </Button>
+        <div className="flex items-center gap-2">
+          <label className="text-sm text-muted">Extends</label>
+          <Select
+            className="w-44"
+            value={ancestors[0] ?? NO_PARENT}
+            onValueChange={(v) => setParent.mutate(v === NO_PARENT ? '' : v)}
+            options={[
+              { value: NO_PARENT, label: '(none)' },
+              ...(profilesQ.data?.profiles ?? [])
+                .filter((p) => p.name !== name)
+                .map((p) => ({ value: p.name, label: p.name })),
+            ]}
+          />
+          <Button
+            variant="ghost"
+            size="icon"
+            onClick={() => setReveal(!reveal)}
+            disabled={dirty}
+            title={dirty ? 'Save or discard your changes first' : reveal ? 'Mask secrets' : 'Reveal secrets'}
+            aria-label={reveal ? 'Mask secrets' : 'Reveal secrets'}
+          >
+            {reveal ? <EyeOff className="h-4 w-4" /> : <Eye className="h-4 w-4" />}
+          </Button>
+          <Button variant="primary" onClick={save} disabled={saving || !dirty}>
+            {saving ? <Spinner /> : <Save className="h-4 w-4" />} Save
+          </Button>
+        </div>
       </div>
 
+      {harnessTabs}
+
       {profileQ.data?.hasLegacyFields && (
         <div className="flex items-start gap-2 rounded-lg border border-warn/40 bg-warn/10 p-3 text-sm text-warn">
           <AlertTriangle className="mt-0.5 h-4 w-4 shrink-0" />
@@ -147,6 +243,22 @@ export function EditorPage() {
         </div>
       )}
 
+      {unresolved.length > 0 && (
+        <div className="flex items-start gap-2 rounded-lg border border-warn/40 bg-warn/10 p-3 text-sm text-warn">
+          <AlertTriangle className="mt-0.5 h-4 w-4 shrink-0" />
+          <div>
+            <div className="font-medium">Unresolved references — activating this profile will fail</div>
+            <ul className="mt-1 space-y-0.5 text-xs opacity-90">
+              {unresolved.map((r) => (
+                <li key={`${r.path}:${r.ref}`}>
+                  <span className="font-mono">{r.path}</span> <code>{r.ref}</code>: {r.error}
+                </li>
+              ))}
+            </ul>
+          </div>
+        </div>
+      )}
+
       {errors.length > 0 && (
         <Card className="border-danger/40 bg-danger/10">
           <div className="text-sm font-medium text-danger">Validation errors</div>
@@ -164,6 +276,7 @@ export function EditorPage() {
         <TabsList>
           <TabsTrigger value="form">Form</TabsTrigger>
           <TabsTrigger value="json">JSON</TabsTrigger>
+          {ancestors.length > 0 && <TabsTrigger value="resolved">Resolved</TabsTrigger>}
         </TabsList>
 
         <TabsContent value="form" className="mt-4">
@@ -221,6 +334,180 @@ export function EditorPage() {
         <TabsContent value="json" className="mt-4">
           <JsonTab working={working} onChange={update} />
         </TabsContent>
+
+        {ancestors.length > 0 && (
+          <TabsContent value="resolved" className="mt-4 space-y-2">
+            <p className="text-sm text-muted">
+              What activating this profile applies: {ancestors.join(' → ')} with this profile's saved fields merged
+              over it. Read-only.
+            </p>
+            <JsonEditor value={JSON.stringify(profileQ.data?.resolvedConfig ?? {}, null, 2)} readOnly />
+          </TabsContent>
+        )}
+      </Tabs>
+    </div>
+  )
+}
+
+// HarnessEditor edits a harness block other than [opencode]. An empty form
+// saves {}, which removes the block from the profile.
+function HarnessEditor({ name, harness, harnessTabs }: { name: string; harness: string; harnessTabs: ReactNode }) {
+  const navigate = useNavigate()
+  const { toast } = useToast()
+
+  const [reveal, setReveal] = useState(false)
+  const harnessQ = useQuery({
+    queryKey: ['profile', name, 'harness', harness, reveal ? 'revealed' : 'masked'],
+    queryFn: () => api.getHarness(name, harness, reveal),
+  })
+  const schemaQ = useQuery({
+    queryKey: ['schema', harness],
+    queryFn: () => api.getSchema(harness),
+    staleTime: Infinity,
+  })
+
+  const [working, setWorking] = useState<ConfigObject>({})
+  const [revision, setRevision] = useState('')
+  const [dirty, setDirty] = useState(false)
+  const [errors, setErrors] = useState<ValidationError[]>([])
+  const [saving, setSaving] = useState(false)
+
+  useEffect(() => {
+    if (harnessQ.data) {
+      setWorking(harnessQ.data.config)
+      setRevision(harnessQ.data.revision)
+      setDirty(false)
+    }
+  }, [harnessQ.data])
+
+  function update(next: ConfigObject) {
+    setWorking(next)
+    setDirty(true)
+    setErrors([])
+  }
+
+  async function save() {
+    setSaving(true)
+    try {
+      const res = await api.validate(working, 'save', harness)
+      if (!res.valid) {
+        setErrors(res.errors)
+        toast({ title: 'Validation failed', description: `${res.errors.length} error(s)`, variant: 'error' })
+        return
+      }
+      const saved = await api.saveHarness(name, harness, working, revision)
+      setRevision(saved.revision)
+      setErrors([])
+      setDirty(false)
+      toast({ title: 'Saved', description: `${name} [${harness}]`, variant: 'success' })
+    } catch (e) {
+      if (e instanceof ApiError && e.status === 412) {
+        toast({
+          title: 'Profile changed elsewhere',
+          description: 'Another tab or tool saved this profile since you opened it. Reload to see its changes.',
+          variant: 'error',
+        })
+        return
+      }
+      if (e instanceof ApiError && e.validationErrors) setErrors(e.validationErrors)
+      toast({ title: 'Save failed', description: (e as Error).message, variant: 'error' })
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  if (harnessQ.isLoading || schemaQ.isLoading) {
+    return (
+      <div className="flex justify-center p-10">
+        <Spinner className="h-6 w-6" />
+      </div>
+    )
+  }
+
+  if (harnessQ.isError || !schemaQ.data) {
+    return <div className="text-danger">Failed to load the [{harness}] block or its schema.</div>
+  }
+
+  const ancestors = harnessQ.data?.ancestors ?? []
+
+  return (
+    <div className="mx-auto max-w-5xl space-y-4">
+      <div className="flex items-center justify-between">
+        <div className="flex items-center gap-3">
+          <Button variant="ghost" size="icon" onClick={() => navigate('/profiles')} aria-label="Back">
+            <ArrowLeft className="h-4 w-4" />
+          </Button>
+          <div>
+            <h1 className="text-xl font-semibold text-text">{name}</h1>
+            {ancestors.length > 0 && (
+              <span className="text-xs text-muted">
+                extends {ancestors.join(' → ')} — the form edits this profile's own fields
+              </span>
+            )}
+            {dirty && <span className="ml-2 text-xs text-warn">Unsaved changes</span>}
+          </div>
+        </div>
+        <div className="flex items-center gap-2">
+          <Button
+            variant="ghost"
+            size="icon"
+            onClick={() => setReveal(!reveal)}
+            disabled={dirty}
+            title={dirty ? 'Save or discard your changes first' : reveal ? 'Mask secrets' : 'Reveal secrets'}
+            aria-label={reveal ? 'Mask secrets' : 'Reveal secrets'}
+          >
+            {reveal ? <EyeOff className="h-4 w-4" /> : <Eye className="h-4 w-4" />}
+          </Button>
+          <Button variant="primary" onClick={save} disabled={saving || !dirty}>
+            {saving ? <Spinner /> : <Save className="h-4 w-4" />} Save
+          </Button>
+        </div>
+      </div>
+
+      {harnessTabs}
+
+      {errors.length > 0 && (
+        <Card className="border-danger/40 bg-danger/10">
+          <div className="text-sm font-medium text-danger">Validation errors</div>
+          <ul className="mt-2 space-y-1 text-xs text-danger">
+            {errors.map((e, i) => (
+              <li key={i}>
+                <span className="font-mono">{e.path}</span>: {e.message}
+              </li>
+            ))}
+          </ul>
+        </Card>
+      )}
+
+      <Tabs defaultValue="form">
+        <TabsList>
+          <TabsTrigger value="form">Form</TabsTrigger>
+          <TabsTrigger value="json">JSON</TabsTrigger>
+          {ancestors.length > 0 && <TabsTrigger value="resolved">Resolved</TabsTrigger>}
+        </TabsList>
+
+        <TabsContent value="form" className="mt-4">
+          <Card>
+            <SchemaForm
+              schema={schemaQ.data}
+              value={working}
+              onChange={(v) => update((v ?? {}) as ConfigObject)}
+            />
+          </Card>
+        </TabsContent>
+
+        <TabsContent value="json" className="mt-4">
+          <JsonTab working={working} onChange={update} harness={harness} />
+        </TabsContent>
+
+        {ancestors.length > 0 && (
+          <TabsContent value="resolved" className="mt-4 space-y-2">
+            <p className="text-sm text-muted">
+              The [{harness}] block activating this profile applies, inherited fields included. Read-only.
+            </p>
+            <JsonEditor value={JSON.stringify(harnessQ.data?.resolvedConfig ?? {}, null, 2)} readOnly />
+          </TabsContent>
+        )}
       </Tabs>
     </div>
   )
@@ -331,7 +618,15 @@ function EntityPanel({
   )
 }
 
-function JsonTab({ working, onChange }: { working: ConfigObject; onChange: (v: ConfigObject) => void }) {
+function JsonTab({
+  working,
+  onChange,
+  harness = 'opencode',
+}: {
+  working: ConfigObject
+  onChange: (v: ConfigObject) => void
+  harness?: string
+}) {
   const [text, setText] = useState(() => JSON.stringify(working, null, 2))
   const [parseError, setParseError] = useState<string | null>(null)
   const [validation, setValidation] = useState<ValidationError[]>([])
@@ -346,14 +641,14 @@ function JsonTab({ working, onChange }: { working: ConfigObject; onChange: (v: C
     const id = setTimeout(async () => {
       try {
         const parsed = JSON.parse(text)
-        const res = await api.validate(parsed, 'save')
+        const res = await api.validate(parsed, 'save', harness)
         setValidation(res.errors)
       } catch {
         /* ignore; parseError handles syntax */
       }
     }, 500)
     return () => clearTimeout(id)
-  }, [text, parseError])
+  }, [text, parseError, harness])
 
   function onEdit(next: string) {
     setText(next)
@@ -1,15 +1,16 @@
 import { useRef, useState } from 'react'
 import { useNavigate } from 'react-router-dom'
 import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
-import { Copy, Download, Pencil, Play, Plus, Tag, Trash2, Upload } from 'lucide-react'
+import { Copy, Download, Layers, Pencil, Play, Plus, Tag, Trash2, Upload } from 'lucide-react'
 import { api, ApiError } from '../lib/api'
-import type { ProfileListEntry } from '../lib/types'
+import type { ConflictPolicy, ProfileListEntry } from '../lib/types'
 import { Card } from '../components/ui/card'
 import { Button } from '../components/ui/button'
 import { Badge } from '../components/ui/badge'
 import { Input } from '../components/ui/input'
 import { Select } from '../components/ui/select'
 import { Spinner } from '../components/ui/spinner'
+import { Switch } from '../components/ui/switch'
 import { Dialog, DialogContent } from '../components/ui/dialog'
 import { useToast } from '../components/ui/toast'
 
@@ -20,10 +21,12 @@ export function ProfilesPage() {
   const { data, isLoading } = useQuery({ queryKey: ['profiles'], queryFn: api.listProfiles })
 
   const [newOpen, setNewOpen] = useState(false)
+  const [stackOpen, setStackOpen] = useState(false)
   const [cloneFrom, setCloneFrom] = useState<string | null>(null)
   const [renameFrom, setRenameFrom] = useState<string | null>(null)
   const [deleteName, setDeleteName] = useState<string | null>(null)
   const fileRef = useRef<HTMLInputElement>(null)
+  const [onConflict, setOnConflict] = useState<ConflictPolicy>('rename')
 
   function refresh() {
     qc.invalidateQueries({ queryKey: ['profiles'] })
@@ -42,18 +45,38 @@ export function ProfilesPage() {
     onError: (e: Error) => toast({ title: 'Activation failed', description: e.message, variant: 'error' }),
   })
 
+  const setStrict = useMutation({
+    mutationFn: ({ name, strict }: { name: string; strict: boolean }) => api.setProfileStrict(name, strict),
+    onSuccess: (res) => {
+      toast({ title: `Strict apply ${res.strict ? 'on' : 'off'} for ${res.name}`, variant: 'success' })
+      refresh()
+    },
+    onError: (e: Error) => toast({ title: 'Could not change strict apply', description: e.message, variant: 'error' }),
+  })
+
   async function onImportFile(e: React.ChangeEvent<HTMLInputElement>) {
     const file = e.target.files?.[0]
     if (!file) return
     try {
       const parsed = JSON.parse(await file.text())
       const name = file.name.replace(/\.json$/i, '')
-      const res = await api.import(parsed, name)
-      toast({
-        title: `Imported as ${res.name}`,
-        description: res.hadCollision ? 'Name collision resolved with suffix' : undefined,
-        variant: 'success',
-      })
+      const res = await api.import(parsed, name, { onConflict })
+      if (res.format === 'document') {
+        const count = (action: string) => res.results.filter((r) => r.action === action).length
+        toast({
+          title: `Imported ${res.results.length - count('skipped')} of ${res.results.length} profiles`,
+          description: `${count('renamed')} renamed, ${count('overwritten')} overwritten, ${count('skipped')} skipped`,
+          variant: 'success',
+        })
+      } else if (res.results[0]?.action === 'skipped') {
+        toast({ title: `${res.results[0].name} exists, skipped`, variant: 'success' })
+      } else {
+        toast({
+          title: `Imported as ${res.name}`,
+          description: res.results[0]?.action === 'renamed' ? 'Name collision resolved with suffix' : undefined,
+          variant: 'success',
+        })
+      }
       refresh()
     } catch (err) {
       const msg = err instanceof ApiError ? err.message : (err as Error).message
@@ -69,9 +92,27 @@ export function ProfilesPage() {
         <h1 className="text-xl font-semibold text-text">Profiles</h1>
         <div className="flex gap-2">
           <input ref={fileRef} type="file" accept="application/json,.json" className="hidden" onChange={onImportFile} />
+          <Select
+            className="w-40"
+            value={onConflict}
+            onValueChange={(v) => setOnConflict(v as ConflictPolicy)}
+            options={[
+              { value: 'rename', label: 'On conflict: rename' },
+              { value: 'skip', label: 'On conflict: skip' },
+              { value: 'overwrite', label: 'On conflict: overwrite' },
+            ]}
+          />
           <Button variant="secondary" onClick={() => fileRef.current?.click()}>
             <Upload className="h-4 w-4" /> Import
           </Button>
+          <a href={api.exportAllUrl()} download>
+            <Button variant="secondary" disabled={!data || data.profiles.length === 0}>
+              <Download className="h-4 w-4" /> Export all
+            </Button>
+          </a>
+          <Button variant="secondary" onClick={() => setStackOpen(true)} disabled={!data || data.profiles.length < 2}>
+            <Layers className="h-4 w-4" /> Apply stack
+          </Button>
           <Button variant="primary" onClick={() => setNewOpen(true)}>
             <Plus className="h-4 w-4" /> New profile
           </Button>
@@ -89,8 +130,11 @@ export function ProfilesPage() {
               <ProfileRow
                 key={p.name}
                 profile={p}
+                overlay={data.active.state === 'exact' ? data.active.stack.indexOf(p.name) : -1}
+                stackSize={data.active.stack.length}
                 onActivate={() => activate.mutate(p.name)}
                 activating={activate.isPending}
+                onStrictChange={(strict) => setStrict.mutate({ name: p.name, strict })}
                 onEdit={() => navigate(`/profiles/${encodeURIComponent(p.name)}/edit`)}
                 onClone={() => setCloneFrom(p.name)}
                 onRename={() => setRenameFrom(p.name)}
@@ -103,6 +147,21 @@ export function ProfilesPage() {
         )}
       </Card>
 
+      {stackOpen && (
+        <StackDialog
+          existing={data?.profiles.map((p) => p.name) ?? []}
+          onClose={() => setStackOpen(false)}
+          onApplied={(res) => {
+            toast({ title: `Applied ${res.name}`, variant: 'success' })
+            if (res.snapshot) {
+              toast({ title: `Previous config saved as ${res.snapshot}`, variant: 'success' })
+            }
+            refresh()
+            setStackOpen(false)
+          }}
+        />
+      )}
+
       {newOpen && (
         <NewProfileDialog
           existing={data?.profiles.map((p) => p.name) ?? []}
@@ -156,16 +215,23 @@ export function ProfilesPage() {
 
 function ProfileRow({
   profile,
+  overlay,
+  stackSize,
   onActivate,
   activating,
+  onStrictChange,
   onEdit,
   onClone,
   onRename,
   onDelete,
 }: {
   profile: ProfileListEntry
+  // Position in the live stack, -1 when the profile is not one of its overlays.
+  overlay: number
+  stackSize: number
   onActivate: () => void
   activating: boolean
+  onStrictChange: (strict: boolean) => void
   onEdit: () => void
   onClone: () => void
   onRename: () => void
@@ -176,8 +242,21 @@ function ProfileRow({
       <div className="flex items-center gap-2">
         <span className="font-medium text-text">{profile.name}</span>
         {profile.active && <Badge tone="success">active</Badge>}
+        {overlay >= 0 && (
+          <Badge tone="success">
+            stack {overlay + 1}/{stackSize}
+          </Badge>
+        )}
+        {profile.extends && <Badge tone="muted">extends {profile.extends}</Badge>}
       </div>
       <div className="flex items-center gap-1">
+        <label
+          className="mr-2 flex items-center gap-1.5 text-xs text-muted"
+          title="Activating removes root keys this profile does not declare"
+        >
+          <Switch checked={profile.strict} onCheckedChange={onStrictChange} />
+          Strict
+        </label>
         <Button size="sm" variant="secondary" onClick={onActivate} disabled={profile.active || activating}>
           <Play className="h-3.5 w-3.5" /> Activate…
         </Button>
@@ -213,7 +292,7 @@ function NewProfileDialog({
   onCreated: (name: string) => void
 }) {
   const [name, setName] = useState('')
-  const [mode, setMode] = useState<'blank' | 'default' | 'clone'>('blank')
+  const [mode, setMode] = useState<'blank' | 'default' | 'clone' | 'extend'>('blank')
   const [from, setFrom] = useState(existing[0] ?? '')
   const [error, setError] = useState<string | null>(null)
   const [busy, setBusy] = useState(false)
@@ -222,8 +301,12 @@ function NewProfileDialog({
     setBusy(true)
     setError(null)
     try {
-      const fromValue = mode === 'blank' ? '' : mode === 'default' ? '__default__' : from
-      await api.createProfile({ name: name.trim(), from: fromValue })
+      if (mode === 'extend') {
+        await api.createProfile({ name: name.trim(), from: '', extends: from })
+      } else {
+        const fromValue = mode === 'blank' ? '' : mode === 'default' ? '__default__' : from
+        await api.createProfile({ name: name.trim(), from: fromValue })
+      }
       onCreated(name.trim())
     } catch (e) {
       setError((e as Error).message)
@@ -234,7 +317,10 @@ function NewProfileDialog({
 
   return (
     <Dialog open onOpenChange={(o) => !o && onClose()}>
-      <DialogContent title="New profile" description="Create a blank profile, seed from the default template, or clone an existing one.">
+      <DialogContent
+        title="New profile"
+        description="Create a blank profile, seed from the default template, clone an existing one, or extend one to store only your overrides."
+      >
         <div className="space-y-4">
           <div>
             <label className="mb-1 block text-sm text-muted">Name</label>
@@ -249,12 +335,15 @@ function NewProfileDialog({
                 { value: 'blank', label: 'Blank' },
                 { value: 'default', label: 'Default template' },
                 { value: 'clone', label: 'Clone existing' },
+                { value: 'extend', label: 'Extend existing' },
               ]}
             />
           </div>
-          {mode === 'clone' && (
+          {(mode === 'clone' || mode === 'extend') && (
             <div>
-              <label className="mb-1 block text-sm text-muted">Source profile</label>
+              <label className="mb-1 block text-sm text-muted">
+                {mode === 'extend' ? 'Parent profile' : 'Source profile'}
+              </label>
               <Select value={from} onValueChange={setFrom} options={existing.map((n) => ({ value: n, label: n }))} />
             </div>
           )}
@@ -263,7 +352,7 @@ function NewProfileDialog({
             <Button variant="ghost" onClick={onClose}>
               Cancel
             </Button>
-            <Button variant="primary" onClick={submit} disabled={busy || !name.trim() || (mode === 'clone' && !from)}>
+            <Button variant="primary" onClick={submit} disabled={busy || !name.trim() || ((mode === 'clone' || mode === 'extend') && !from)}>
               {busy ? <Spinner /> : 'Create'}
             </Button>
           </div>
@@ -273,6 +362,78 @@ function NewProfileDialog({
   )
 }
 
+// StackDialog applies profiles as ordered overlays: the order of selection is
+// the order of application, each profile over the ones before it.
+function StackDialog({
+  existing,
+  onClose,
+  onApplied,
+}: {
+  existing: string[]
+  onClose: () => void
+  onApplied: (res: { name: string; snapshot: string }) => void
+}) {
+  const [stack, setStack] = useState<string[]>([])
+  const [error, setError] = useState<string | null>(null)
+  const [busy, setBusy] = useState(false)
+
+  function toggle(name: string) {
+    setStack((s) => (s.includes(name) ? s.filter((n) => n !== name) : [...s, name]))
+  }
+
+  async function submit() {
+    setBusy(true)
+    setError(null)
+    try {
+      onApplied(await api.activateStack(stack))
+    } catch (e) {
+      setError((e as Error).message)
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  return (
+    <Dialog open onOpenChange={(o) => !o && onClose()}>
+      <DialogContent
+        title="Apply stack"
+        description="Pick profiles in the order to apply them. Objects merge key by key; disabled_* lists are unioned; anything else is replaced by the later profile."
+      >
+        <div className="space-y-4">
+          <ul className="max-h-64 space-y-1 overflow-auto scrollbar-thin">
+            {existing.map((name) => {
+              const pos = stack.indexOf(name)
+              return (
+                <li key={name}>
+                  <label className="flex cursor-pointer items-center gap-2 rounded px-2 py-1 text-sm hover:bg-surface-2">
+                    <input type="checkbox" checked={pos >= 0} onChange={() => toggle(name)} />
+                    <span className="text-text">{name}</span>
+                    {pos >= 0 && <Badge tone="muted">{pos + 1}</Badge>}
+                  </label>
+                </li>
+              )
+            })}
+          </ul>
+          {stack.length > 0 && (
+            <p className="text-sm text-muted">
+              <code>{stack.join(' + ')}</code>
+            </p>
+          )}
+          {error && <p className="text-sm text-danger">{error}</p>}
+          <div className="flex justify-end gap-2">
+            <Button variant="ghost" onClick={onClose}>
+              Cancel
+            </Button>
+            <Button variant="primary" onClick={submit} disabled={busy || stack.length === 0}>
+              {busy ? <Spinner /> : 'Apply'}
+            </Button>
+          </div>
+        </div>
+      </DialogContent>
+    </Dialog>
+  )
+}
+
 function CloneDialog({ from, onClose, onCloned }: { from: string; onClose: () => void; onCloned: (name: string) => void }) {
   const [name, setName] = useState(`${from}-copy`)
   const [error, setError] = useState<string | null>(null)
@@ -1,15 +1,20 @@
 package web
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/diogenes/omo-profiler/internal/config"
 	"github.com/diogenes/omo-profiler/internal/diff"
 	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/redact"
 	"github.com/diogenes/omo-profiler/internal/schema"
 )
 
@@ -37,14 +42,29 @@ func nameError(w http.ResponseWriter, name string) bool {
 	return false
 }
 
+// nonNilNames keeps an empty name list a JSON array.
+func nonNilNames(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
+
 // activeJSON describes the applied profile for API responses. The active
-// profile is detected by comparing the root against stored profiles, so there
-// is no separate "hint" or "source": the root *is* the effective configuration.
+// profile is detected by comparing the root against stored profiles, with the
+// activation record breaking ties; the root *is* the effective configuration.
 func activeJSON(active *profile.ActiveConfig) map[string]any {
 	return map[string]any{
 		"documentExists": active.Exists,
 		"profileName":    active.ProfileName,
+		"state":          active.State,
+		"candidates":     nonNilNames(active.Candidates),
+		"appliedName":    active.AppliedName,
+		"stack":          nonNilNames(active.Stack),
+		"profileChanged": active.ProfileChanged,
 		"modified":       active.Modified,
+		"layer":          active.Layer,
+		"path":           active.Path,
 	}
 }
 
@@ -52,25 +72,35 @@ func activeJSON(active *profile.ActiveConfig) map[string]any {
 func handleListProfiles(w http.ResponseWriter, r *http.Request) {
 	names, err := profile.List()
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
 	active, err := profile.GetActive()
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
+		return
+	}
+
+	settings, err := profile.LoadSettings()
+	if err != nil {
+		writeServerErr(w, err)
 		return
 	}
 
 	type profileEntry struct {
-		Name   string `json:"name"`
-		Active bool   `json:"active"`
+		Name    string `json:"name"`
+		Active  bool   `json:"active"`
+		Strict  bool   `json:"strict"`
+		Extends string `json:"extends,omitempty"`
 	}
 	entries := make([]profileEntry, 0, len(names))
 	for _, n := range names {
 		entries = append(entries, profileEntry{
-			Name:   n,
-			Active: active.ProfileName == n,
+			Name:    n,
+			Active:  active.ProfileName == n,
+			Strict:  settings.Profiles[n].Strict,
+			Extends: settings.Profiles[n].Extends,
 		})
 	}
 
@@ -87,22 +117,57 @@ func handleGetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, err := profile.Load(name)
+	// One read serves the profile, its raw block and its revision, so the ETag
+	// always describes exactly the config returned with it.
+	doc, err := config.LoadDocument()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	p, err := profile.LoadFromDocument(doc, name)
 	if err != nil {
 		writeErr(w, http.StatusNotFound, fmt.Sprintf("profile not found: %s", name))
 		return
 	}
 
 	// Lossless `[opencode]` block (preserves unknown keys).
-	raw, err := profile.ExportOpenCode(name)
+	raw, err := profile.ExportOpenCodeFrom(doc, name)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
+	// The editor edits the profile's own fields; a child also gets the
+	// resolved configuration to show what it inherits.
+	ancestors, err := profile.Ancestors(name)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	resolved := json.RawMessage(raw)
+	if len(ancestors) > 0 {
+		if resolved, err = profile.ExportOpenCode(name); err != nil {
+			writeServerErr(w, err)
+			return
+		}
+	}
+	masked, err := maskAt(r, config.OpenCodeKey, raw)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	if resolved, err = maskAt(r, config.OpenCodeKey, resolved); err != nil {
+		writeServerErr(w, err)
+		return
+	}
+
+	setETag(w, p.Revision)
 	writeJSON(w, http.StatusOK, map[string]any{
 		"name":                name,
-		"config":              json.RawMessage(raw),
+		"revision":            p.Revision,
+		"config":              masked,
+		"ancestors":           nonNilNames(ancestors),
+		"resolvedConfig":      resolved,
 		"fieldPresence":       p.FieldPresence,
 		"hasLegacyFields":     p.HasLegacyFields,
 		"legacyFieldsWarning": p.LegacyFieldsWarning,
@@ -122,15 +187,28 @@ func handleSaveProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The editor was sent masked credentials; whatever it sends back still
+	// masked keeps the stored value.
+	if body, err = restoreSecrets(name, config.OpenCodeKey, body); err != nil {
+		writeServerErr(w, err)
+		return
+	}
+
 	validator, err := schema.GetValidator()
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
-	errs, err := validator.ValidateJSONForSave(body)
+	// A child is valid when what it resolves to is.
+	resolved, err := profile.ResolveOpenCode(name, body)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	errs, err := validator.ValidateJSONForSave(resolved)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 	if len(errs) > 0 {
@@ -149,19 +227,26 @@ func handleSaveProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// One transaction: reading the existing block (for its sibling blocks) and
-	// writing the new one must not be split by a concurrent change.
-	if err := profile.UpdateOpenCodeBlock(name, body); err != nil {
+	// One transaction: reading the existing block (for its sibling blocks),
+	// checking If-Match and writing the new one must not be split by a
+	// concurrent change.
+	revision, err := profile.UpdateOpenCodeBlockIfRevision(name, body, ifMatch(r)...)
+	warning, err := afterSave(err)
+	if err != nil {
 		var notFound *profile.NotFoundError
 		if errors.As(err, &notFound) {
 			writeErr(w, http.StatusNotFound, err.Error())
 			return
 		}
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		if revisionError(w, err) {
+			return
+		}
+		writeServerErr(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	setETag(w, revision)
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{"ok": true, "revision": revision}, warning))
 }
 
 // POST /api/profiles
@@ -169,6 +254,8 @@ func handleCreateProfile(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name string `json:"name"`
 		From string `json:"from"`
+		// Extends creates an empty profile inheriting from this parent.
+		Extends string `json:"extends"`
 	}
 	if err := decodeBody(r, &req); err != nil {
 		writeErr(w, http.StatusBadRequest, err.Error())
@@ -188,6 +275,12 @@ func handleCreateProfile(w http.ResponseWriter, r *http.Request) {
 	// Create re-marshals through config.Config and omitempty would drop them.
 	var err error
 	switch {
+	case req.Extends != "":
+		if req.From != "" {
+			writeErr(w, http.StatusBadRequest, "from and extends are exclusive")
+			return
+		}
+		err = profile.CreateExtending(req.Name, req.Extends)
 	case req.From == "__default__":
 		err = profile.CreateWithOpenCodeBlock(req.Name, DefaultTemplate())
 	case req.From == "":
@@ -195,21 +288,22 @@ func handleCreateProfile(w http.ResponseWriter, r *http.Request) {
 	default:
 		err = profile.CreateFrom(req.Name, req.From)
 	}
+	warning, err := afterSave(err)
 	if err != nil {
 		var notFound *profile.NotFoundError
 		var exists *profile.ExistsError
 		switch {
 		case errors.As(err, &notFound):
-			writeErr(w, http.StatusNotFound, fmt.Sprintf("source profile not found: %s", req.From))
+			writeErr(w, http.StatusNotFound, fmt.Sprintf("source profile not found: %s", notFound.Name))
 		case errors.As(err, &exists):
 			writeErr(w, http.StatusConflict, err.Error())
 		default:
-			writeErr(w, http.StatusInternalServerError, err.Error())
+			writeServerErr(w, err)
 		}
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{"name": req.Name})
+	writeJSON(w, http.StatusCreated, withWarning(map[string]any{"name": req.Name}, warning))
 }
 
 // DELETE /api/profiles/{name}
@@ -218,16 +312,25 @@ func handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
 	if nameError(w, name) {
 		return
 	}
-	if !profile.Exists(name) {
-		writeErr(w, http.StatusNotFound, fmt.Sprintf("profile not found: %s", name))
-		return
-	}
-
-	if err := profile.Delete(name); err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+	warning, err := afterSave(profile.DeleteIfRevision(name, ifMatch(r)...))
+	if err != nil {
+		var notFound *profile.NotFoundError
+		if errors.As(err, &notFound) {
+			writeErr(w, http.StatusNotFound, fmt.Sprintf("profile not found: %s", name))
+			return
+		}
+		if revisionError(w, err) {
+			return
+		}
+		var inUse *profile.ParentInUseError
+		if errors.As(err, &inUse) {
+			writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "children": inUse.Children})
+			return
+		}
+		writeServerErr(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{"ok": true}, warning))
 }
 
 // POST /api/profiles/{name}/rename
@@ -260,7 +363,11 @@ func handleRenameProfile(w http.ResponseWriter, r *http.Request) {
 	// One document write: a failure here leaves the document untouched rather
 	// than stranding both names. The block content is unchanged, so
 	// comparison-based detection follows the new name automatically.
-	if err := profile.Rename(name, req.NewName); err != nil {
+	warning, err := afterSave(profile.RenameIfRevision(name, req.NewName, ifMatch(r)...))
+	if err != nil {
+		if revisionError(w, err) {
+			return
+		}
 		var notFound *profile.NotFoundError
 		var exists *profile.ExistsError
 		switch {
@@ -269,14 +376,18 @@ func handleRenameProfile(w http.ResponseWriter, r *http.Request) {
 		case errors.As(err, &exists):
 			writeErr(w, http.StatusConflict, err.Error())
 		default:
-			writeErr(w, http.StatusInternalServerError, err.Error())
+			writeServerErr(w, err)
 		}
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"name": req.NewName})
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{"name": req.NewName}, warning))
 }
 
 // POST /api/profiles/{name}/activate
+//
+// With ?dryRun=1 nothing is written; the response is the profile.ApplyPreview
+// of the apply: a per-root-key diff and the snapshot decision. ?strict=1
+// applies strictly even when the profile's settings do not ask for it.
 func handleActivateProfile(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	if nameError(w, name) {
@@ -287,34 +398,200 @@ func handleActivateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	applied, err := profile.Apply(name)
+	strict, _ := strconv.ParseBool(r.URL.Query().Get("strict"))
+	opts := profile.ApplyOptions{Strict: strict}
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+		preview, err := profile.PreviewApplyWith(name, opts)
+		if err == nil {
+			err = maskPreview(r, preview)
+		}
+		if err != nil {
+			writeServerErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, preview)
+		return
+	}
+
+	applied, err := profile.ApplyWith(name, opts)
+	warning, err := afterSave(err)
+	if referencesError(w, err) {
+		return
+	}
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{
 		"ok":     true,
 		"name":   applied.Name,
 		"snapshot": applied.Snapshot,
+	}, warning))
+}
+
+// POST /api/stack {"profiles": ["base", "fast-models"]}
+//
+// Applies the profiles as ordered overlays, bottom first. ?dryRun=1 and
+// ?strict=1 work as for a single profile's activate.
+func handleActivateStack(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Profiles []string `json:"profiles"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	strict, _ := strconv.ParseBool(r.URL.Query().Get("strict"))
+	opts := profile.ApplyOptions{Strict: strict}
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+		preview, err := profile.PreviewApplyStack(req.Profiles, opts)
+		if err == nil {
+			err = maskPreview(r, preview)
+		}
+		if stackError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, preview)
+		return
+	}
+
+	applied, err := profile.ApplyStack(req.Profiles, opts)
+	warning, err := afterSave(err)
+	if stackError(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{
+		"ok":       true,
+		"name":     applied.Name,
+		"stack":    nonNilNames(applied.Stack),
+		"snapshot": applied.Snapshot,
+	}, warning))
+}
+
+// stackError writes err and reports whether there was one. A malformed
+// stack is the client's fault, a missing overlay a 404.
+func stackError(w http.ResponseWriter, err error) bool {
+	var notFound *profile.NotFoundError
+	var duplicate *profile.DuplicateOverlayError
+	switch {
+	case err == nil:
+		return false
+	case referencesError(w, err):
+	case errors.As(err, &notFound):
+		writeErr(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &duplicate), errors.Is(err, profile.ErrEmptyName), errors.Is(err, profile.ErrInvalidName):
+		writeErr(w, http.StatusBadRequest, err.Error())
+	default:
+		writeServerErr(w, err)
+	}
+	return true
+}
+
+// referencesError answers an apply refused for references that do not
+// resolve: 422 with the references. It reports whether err was one.
+func referencesError(w http.ResponseWriter, err error) bool {
+	var unresolved *profile.UnresolvedReferencesError
+	if !errors.As(err, &unresolved) {
+		return false
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"error":      err.Error(),
+		"references": unresolved.Refs,
 	})
+	return true
+}
+
+// GET /api/profiles/{name}/references
+//
+// The `${env:…}` and `${file:…}` references of the resolved profile and
+// whether each resolves now. Values are never returned.
+func handleProfileReferences(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if nameError(w, name) {
+		return
+	}
+	refs, err := profile.References(name)
+	var notFound *profile.NotFoundError
+	switch {
+	case errors.As(err, &notFound):
+		writeErr(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		writeServerErr(w, err)
+		return
+	}
+	if refs == nil {
+		refs = []profile.Reference{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"references": refs})
 }
 
 // GET /api/profiles/{name}/export
+//
+// The fields holding credentials are left out, as by `export --redact`,
+// unless ?reveal=1; ?harness=senpi exports that harness block, ?full=1 the
+// whole profile block.
 func handleExportProfile(w http.ResponseWriter, r *http.Request) {
 	name := r.PathValue("name")
 	if nameError(w, name) {
 		return
 	}
+	key, ok := harnessParam(w, r.URL.Query().Get("harness"))
+	if !ok {
+		return
+	}
 
-	data, err := profile.ExportOpenCode(name)
+	var data []byte
+	var err error
+	if full, _ := strconv.ParseBool(r.URL.Query().Get("full")); full {
+		data, err = profile.ExportBlock(name)
+		key = ""
+	} else {
+		data, err = profile.ExportHarness(name, key)
+	}
 	if err != nil {
 		writeErr(w, http.StatusNotFound, fmt.Sprintf("profile not found: %s", name))
 		return
 	}
+	writeExport(w, r, key, name+".json", data)
+}
+
+// GET /api/export — an omo document holding every profile, as
+// `export --all`; ?profiles=a,b limits it to those. Credentials are left out
+// unless ?reveal=1, as for a profile export.
+func handleExportAll(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	if list := r.URL.Query().Get("profiles"); list != "" {
+		names = strings.Split(list, ",")
+	}
+	data, err := profile.ExportDocument(names)
+	if err != nil {
+		var notFound *profile.NotFoundError
+		if errors.As(err, &notFound) {
+			writeErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeServerErr(w, err)
+		return
+	}
+	writeExport(w, r, "", "profiles.json", data)
+}
+
+// writeExport sends data, the value at block path path, as a download named
+// filename, its credential fields left out unless r reveals secrets.
+func writeExport(w http.ResponseWriter, r *http.Request, path, filename string, data []byte) {
+	if !revealSecrets(r) {
+		var err error
+		if data, err = redact.Strip(path, data); err != nil {
+			writeServerErr(w, err)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(data)
 }
@@ -323,15 +600,25 @@ func handleExportProfile(w http.ResponseWriter, r *http.Request) {
 func handleGetActive(w http.ResponseWriter, r *http.Request) {
 	active, err := profile.GetActive()
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 	payload := activeJSON(active)
-	payload["config"] = active.Config
+	cfg, err := json.Marshal(active.Config)
+	if err == nil {
+		payload["config"], err = maskAt(r, config.OpenCodeKey, cfg)
+	}
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
 	writeJSON(w, http.StatusOK, payload)
 }
 
 // GET /api/diff?left=&right=
+//
+// Secrets show as masks on both sides; a changed secret therefore shows no
+// difference unless ?reveal=1. ?harness=senpi compares that harness block.
 func handleDiff(w http.ResponseWriter, r *http.Request) {
 	left := r.URL.Query().Get("left")
 	right := r.URL.Query().Get("right")
@@ -339,21 +626,33 @@ func handleDiff(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusBadRequest, "left and right query params are required")
 		return
 	}
+	key, ok := harnessParam(w, r.URL.Query().Get("harness"))
+	if !ok {
+		return
+	}
 
-	leftBytes, err := resolveDiffSide(left)
+	leftBytes, err := resolveDiffSide(left, key)
 	if err != nil {
 		writeErr(w, http.StatusNotFound, err.Error())
 		return
 	}
-	rightBytes, err := resolveDiffSide(right)
+	rightBytes, err := resolveDiffSide(right, key)
 	if err != nil {
 		writeErr(w, http.StatusNotFound, err.Error())
 		return
 	}
+	if leftBytes, err = maskAt(r, key, leftBytes); err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	if rightBytes, err = maskAt(r, key, rightBytes); err != nil {
+		writeServerErr(w, err)
+		return
+	}
 
 	res, err := diff.ComputeDiff(leftBytes, rightBytes)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
@@ -379,21 +678,41 @@ func marshalDiffLines(lines []diff.DiffLine) []diffLineJSON {
 	return out
 }
 
-// resolveDiffSide returns the JSON bytes for a diff side. "__active__" resolves
-// to the effective OpenCode config; any other value is a profile's `[opencode]` block.
-func resolveDiffSide(label string) ([]byte, error) {
+// resolveDiffSide returns the JSON bytes of harness block key for a diff side.
+// "__active__" resolves to the root's block, for `[opencode]` the effective
+// OpenCode config; "a+b" to the block of that stack; any other value is a
+// profile's block.
+func resolveDiffSide(label, key string) ([]byte, error) {
 	if label == "__active__" {
 		active, err := profile.GetActive()
 		if err != nil {
 			return nil, err
 		}
 		if !active.Exists {
-			return nil, fmt.Errorf("no omo config found at %s", config.OmoFile())
+			return nil, fmt.Errorf("no omo config found at %s", config.DocumentFile())
+		}
+		if key == config.OpenCodeKey {
+			return json.Marshal(active.Config)
+		}
+		doc, err := config.LoadDocument()
+		if err != nil {
+			return nil, err
 		}
-		return json.Marshal(active.Config)
+		raw, ok := doc.Raw(key)
+		if !ok {
+			return []byte("{}"), nil
+		}
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, raw, "", "  "); err != nil {
+			return nil, err
+		}
+		return pretty.Bytes(), nil
 	}
 
-	data, err := profile.ExportOpenCode(label)
+	if strings.Contains(label, profile.StackSeparator) {
+		return profile.ExportStackHarness(profile.ParseStack(label), key)
+	}
+	data, err := profile.ExportHarness(label, key)
 	if err != nil {
 		return nil, fmt.Errorf("profile not found: %s", label)
 	}
@@ -401,10 +720,19 @@ func resolveDiffSide(label string) ([]byte, error) {
 }
 
 // POST /api/import
+//
+// config is a flat harness block, a whole profile block or an omo document,
+// told apart as the import command does. profiles picks profiles of a
+// document; onConflict is rename (the default), skip or overwrite. The
+// response lists what happened to each profile in results; name and
+// hadCollision describe the first.
 func handleImport(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name   string          `json:"name"`
-		Config json.RawMessage `json:"config"`
+		Name       string          `json:"name"`
+		Config     json.RawMessage `json:"config"`
+		Harness    string          `json:"harness"`
+		Profiles   []string        `json:"profiles"`
+		OnConflict string          `json:"onConflict"`
 	}
 	if err := decodeBody(r, &req); err != nil {
 		writeErr(w, http.StatusBadRequest, err.Error())
@@ -414,50 +742,132 @@ func handleImport(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusBadRequest, "config is required")
 		return
 	}
-
-	validator, err := schema.GetValidator()
+	key, ok := harnessParam(w, req.Harness)
+	if !ok {
+		return
+	}
+	policy, err := profile.ParseConflictPolicy(req.OnConflict)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeErr(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	errs, err := validator.ValidateJSONForSave(req.Config)
+	format, err := profile.DetectImport(req.Config)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeErr(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if len(errs) > 0 {
-		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
-			"error":            "validation failed",
-			"validationErrors": mapValidationErrors(errs),
-		})
+	if format != profile.ImportFlat && key != config.OpenCodeKey {
+		writeErr(w, http.StatusBadRequest, fmt.Sprintf("harness applies to a flat config, not a %s", format))
 		return
 	}
 
-	// Type-check the payload before storing it verbatim; schema validation
-	// alone would let a well-shaped but wrongly typed value through.
-	if err := json.Unmarshal(req.Config, &config.Config{}); err != nil {
-		writeErr(w, http.StatusBadRequest, err.Error())
+	validator, err := schema.GetValidator()
+	if err != nil {
+		writeServerErr(w, err)
 		return
 	}
+	if format == profile.ImportFlat {
+		errs, err := validator.ValidateHarnessJSONForSave(key, req.Config)
+		if err != nil {
+			writeServerErr(w, err)
+			return
+		}
+		if len(errs) > 0 {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+				"error":            "validation failed",
+				"validationErrors": mapValidationErrors(errs),
+			})
+			return
+		}
+
+		// Type-check the payload before storing it verbatim; schema
+		// validation alone would let a well-shaped but wrongly typed value
+		// through. Only `[opencode]` has a Go type.
+		var typed any = &map[string]json.RawMessage{}
+		if key == config.OpenCodeKey {
+			typed = &config.Config{}
+		}
+		if err := json.Unmarshal(req.Config, typed); err != nil {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	base := profile.SanitizeName(req.Name)
 	if base == "" {
 		base = "imported"
 	}
+	_, entries, err := profile.ReadImport(req.Config, base, key)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Profiles) > 0 {
+		var selected []profile.ImportEntry
+		for _, name := range req.Profiles {
+			i := slices.IndexFunc(entries, func(e profile.ImportEntry) bool { return e.Name == name })
+			if i < 0 {
+				writeErr(w, http.StatusBadRequest, fmt.Sprintf("the config holds no profile %q", name))
+				return
+			}
+			selected = append(selected, entries[i])
+		}
+		entries = selected
+	}
+	if format != profile.ImportFlat {
+		for _, entry := range entries {
+			errs, err := validator.ValidateProfileBlockForSave(entry.Name, entry.Block)
+			if err != nil {
+				writeServerErr(w, err)
+				return
+			}
+			if len(errs) > 0 {
+				writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+					"error":            "validation failed",
+					"validationErrors": mapValidationErrors(errs),
+				})
+				return
+			}
+			var fields map[string]json.RawMessage
+			_ = json.Unmarshal(entry.Block, &fields)
+			if openCode, ok := fields[config.OpenCodeKey]; ok {
+				if err := json.Unmarshal(openCode, &config.Config{}); err != nil {
+					writeErr(w, http.StatusBadRequest, fmt.Sprintf("profile %q: %v", entry.Name, err))
+					return
+				}
+			}
+		}
+	}
 
-	// The suffix is chosen inside the transaction that claims it, so two
+	// Names are chosen inside the transaction that claims them, so two
 	// concurrent imports of the same name cannot settle on it and overwrite.
-	finalName, hadCollision, err := profile.CreateAvailable(base, req.Config)
+	outcomes, err := profile.Import(entries, policy)
+	warning, err := afterSave(err)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, profile.ErrInvalidName) || errors.Is(err, profile.ErrEmptyName) {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeServerErr(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"name": finalName, "hadCollision": hadCollision})
+	resp := map[string]any{"format": format, "results": outcomes, "name": "", "hadCollision": false}
+	if len(outcomes) > 0 {
+		resp["name"] = outcomes[0].Imported
+		resp["hadCollision"] = outcomes[0].Action != "created"
+	}
+	writeJSON(w, http.StatusOK, withWarning(resp, warning))
 }
 
 // POST /api/validate?mode=strict|save
+//
+// ?harness=senpi validates that harness block's config, in save mode.
 func handleValidate(w http.ResponseWriter, r *http.Request) {
+	key, ok := harnessParam(w, r.URL.Query().Get("harness"))
+	if !ok {
+		return
+	}
 	body, err := readBody(r)
 	if err != nil {
 		writeErr(w, http.StatusBadRequest, err.Error())
@@ -466,18 +876,21 @@ func handleValidate(w http.ResponseWriter, r *http.Request) {
 
 	validator, err := schema.GetValidator()
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
 	var errs []schema.ValidationError
-	if r.URL.Query().Get("mode") == "strict" {
+	switch {
+	case key != config.OpenCodeKey:
+		errs, err = validator.ValidateHarnessJSONForSave(key, body)
+	case r.URL.Query().Get("mode") == "strict":
 		errs, err = validator.ValidateJSON(body)
-	} else {
+	default:
 		errs, err = validator.ValidateJSONForSave(body)
 	}
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
@@ -487,11 +900,16 @@ func handleValidate(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GET /api/schema — the flat `[opencode]` schema that drives the editor form.
+// GET /api/schema — the flat `[opencode]` schema that drives the editor form;
+// ?harness=senpi returns that harness block's schema instead.
 func handleSchema(w http.ResponseWriter, r *http.Request) {
-	data, err := schema.GetOpenCodeSchema()
+	key, ok := harnessParam(w, r.URL.Query().Get("harness"))
+	if !ok {
+		return
+	}
+	data, err := schema.GetHarnessSchema(key)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
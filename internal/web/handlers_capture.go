@@ -0,0 +1,98 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+)
+
+// POST /api/capture
+//
+// Body: {"name": "", "fields": [...], "force": false, "dryRun": false}. Saves
+// the live root configuration into a profile, by default the one last
+// applied. An existing profile is only replaced with force; otherwise the
+// response is 409 with the diff in "result".
+func handleCapture(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string   `json:"name"`
+		Fields []string `json:"fields"`
+		Force  bool     `json:"force"`
+		DryRun bool     `json:"dryRun"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Name == "" {
+		target, err := profile.CaptureTarget()
+		if err != nil {
+			writeErr(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Name = target
+	}
+	if nameError(w, req.Name) {
+		return
+	}
+
+	validator, err := schema.GetValidator()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	var problems []schema.ValidationError
+	opts := profile.CaptureOptions{
+		Force:  req.Force,
+		DryRun: req.DryRun,
+		Validate: func(openCode []byte) ([]string, error) {
+			problems, err = validator.ValidateJSONForSave(openCode)
+			msgs := make([]string, len(problems))
+			for i, p := range problems {
+				msgs[i] = p.Path + ": " + p.Message
+			}
+			return msgs, err
+		},
+	}
+	if len(req.Fields) > 0 {
+		opts.Fields = profile.NewBlankSelection()
+		for _, path := range req.Fields {
+			opts.Fields.SetSelected(path, true)
+		}
+	}
+
+	result, err := profile.Capture(req.Name, opts)
+	warning, err := afterSave(err)
+	var overwrite *profile.CaptureOverwriteError
+	var invalid *profile.FieldValidationError
+	switch {
+	case errors.As(err, &overwrite):
+		if err := maskCapture(r, overwrite.Result); err != nil {
+			writeServerErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error":  err.Error(),
+			"result": overwrite.Result,
+		})
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":            "validation failed",
+			"validationErrors": mapValidationErrors(problems),
+		})
+	case errors.Is(err, profile.ErrNothingToCapture):
+		writeErr(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeServerErr(w, err)
+	default:
+		if err := maskCapture(r, result); err != nil {
+			writeServerErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			*profile.CaptureResult
+			Warning string `json:"warning,omitempty"`
+		}{result, warning})
+	}
+}
@@ -0,0 +1,64 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/diogenes/omo-profiler/internal/watch"
+)
+
+// watcher publishes on-disk changes to /api/events. Serve starts it; it stays
+// nil for muxes built without a server (tests), which disables the stream.
+var watcher *watch.Watcher
+
+// keepAlive is how often an idle event stream sends a comment line, so proxies
+// and the browser do not time the connection out.
+var keepAlive = 25 * time.Second
+
+// GET /api/events
+//
+// A Server-Sent Events stream with one `change` event per modified config
+// file — the omo document of either layer or the model registry — whoever
+// wrote it. Clients refetch on each event; the payload only names the file.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if watcher == nil || !ok {
+		writeErr(w, http.StatusServiceUnavailable, "live updates unavailable")
+		return
+	}
+
+	events, cancel := watcher.Subscribe()
+	defer cancel()
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: 2000\n: watching (%s)\n\n", watcher.Mode())
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
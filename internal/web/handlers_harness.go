@@ -0,0 +1,183 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+)
+
+// harnessParam resolves a harness named by a request ("senpi" or "[senpi]",
+// "" for `[opencode]`) to its block key, writing 404 for a harness the
+// document schema does not define. ok is false when it wrote the error.
+func harnessParam(w http.ResponseWriter, name string) (string, bool) {
+	if name == "" {
+		return config.OpenCodeKey, true
+	}
+	keys, err := schema.HarnessKeys()
+	if err != nil {
+		writeServerErr(w, err)
+		return "", false
+	}
+	key := config.HarnessKey(name)
+	if !slices.Contains(keys, key) {
+		writeErr(w, http.StatusNotFound, fmt.Sprintf("unknown harness: %s", name))
+		return "", false
+	}
+	return key, true
+}
+
+// GET /api/harnesses — the harness blocks of the document schema, `[opencode]`
+// first: {"harnesses": [{"key": "[senpi]", "name": "senpi"}, ...]}.
+func handleListHarnesses(w http.ResponseWriter, r *http.Request) {
+	keys, err := schema.HarnessKeys()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	type harness struct {
+		Key  string `json:"key"`
+		Name string `json:"name"`
+	}
+	harnesses := make([]harness, 0, len(keys))
+	for _, key := range keys {
+		harnesses = append(harnesses, harness{Key: key, Name: config.HarnessName(key)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"harnesses": harnesses})
+}
+
+// GET /api/profiles/{name}/harness/{harness}
+//
+// One harness block of a profile, shaped like GET /api/profiles/{name}:
+// `config` is the profile's own block, `{}` when it does not configure the
+// harness, and `resolvedConfig` adds what it inherits.
+func handleGetHarness(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if nameError(w, name) {
+		return
+	}
+	key, ok := harnessParam(w, r.PathValue("harness"))
+	if !ok {
+		return
+	}
+
+	doc, err := config.LoadDocument()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	revision, found, err := doc.ProfileRevision(name)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	if !found {
+		writeErr(w, http.StatusNotFound, fmt.Sprintf("profile not found: %s", name))
+		return
+	}
+	raw, err := profile.ExportHarnessFrom(doc, name, key)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	resolved, err := profile.ExportHarness(name, key)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	ancestors, err := profile.Ancestors(name)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	masked, err := maskAt(r, key, raw)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	if resolved, err = maskAt(r, key, resolved); err != nil {
+		writeServerErr(w, err)
+		return
+	}
+
+	setETag(w, revision)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":           name,
+		"harness":        key,
+		"revision":       revision,
+		"config":         masked,
+		"ancestors":      nonNilNames(ancestors),
+		"resolvedConfig": resolved,
+	})
+}
+
+// PUT /api/profiles/{name}/harness/{harness}
+//
+// Replaces one harness block of a profile after validating what it resolves
+// to against the block's schema; `{}` removes a block other than
+// `[opencode]`. If-Match works as for PUT /api/profiles/{name}.
+func handleSaveHarness(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if nameError(w, name) {
+		return
+	}
+	key, ok := harnessParam(w, r.PathValue("harness"))
+	if !ok {
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body, err = restoreSecrets(name, key, body); err != nil {
+		writeServerErr(w, err)
+		return
+	}
+
+	validator, err := schema.GetValidator()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	resolved, err := profile.ResolveHarness(name, key, body)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	errs, err := validator.ValidateHarnessJSONForSave(key, resolved)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":            "validation failed",
+			"validationErrors": mapValidationErrors(errs),
+		})
+		return
+	}
+
+	revision, err := profile.UpdateHarnessBlockIfRevision(name, key, body, ifMatch(r)...)
+	warning, err := afterSave(err)
+	if err != nil {
+		var notFound *profile.NotFoundError
+		if errors.As(err, &notFound) {
+			writeErr(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if revisionError(w, err) {
+			return
+		}
+		writeServerErr(w, err)
+		return
+	}
+
+	setETag(w, revision)
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{"ok": true, "revision": revision}, warning))
+}
@@ -0,0 +1,121 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/schema"
+)
+
+// GET /api/profiles/{name}/history
+//
+// The versions of the profile found in the backups and the live document,
+// newest first, each with the field changes from the one before.
+func handleProfileHistory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if nameError(w, name) {
+		return
+	}
+	versions, ok := profileHistory(w, name)
+	if !ok {
+		return
+	}
+	for i := range versions {
+		if err := maskVersion(r, &versions[i]); err != nil {
+			writeServerErr(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":     name,
+		"versions": versions,
+	})
+}
+
+// POST /api/profiles/{name}/history/restore
+//
+// Body: {"backup": "<name>"} restores the version that backup holds, as
+// listed by the history, after validating it. The rest of the document is
+// left as it is.
+func handleRestoreProfileVersion(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if nameError(w, name) {
+		return
+	}
+	var req struct {
+		Backup string `json:"backup"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	versions, ok := profileHistory(w, name)
+	if !ok {
+		return
+	}
+	var version *profile.Version
+	for i, v := range versions {
+		if req.Backup != "" && v.Backup == req.Backup {
+			version = &versions[i]
+			break
+		}
+	}
+	if version == nil {
+		writeErr(w, http.StatusNotFound, fmt.Sprintf("no version of %q is held by backup %q", name, req.Backup))
+		return
+	}
+	switch {
+	case version.Live:
+		writeErr(w, http.StatusConflict, fmt.Sprintf("profile %q is already at that version", name))
+		return
+	case !version.Exists:
+		writeErr(w, http.StatusConflict, fmt.Sprintf("profile %q did not exist in that version", name))
+		return
+	}
+
+	validator, err := schema.GetValidator()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	errs, err := validator.ValidateProfileBlockForSave(name, version.Block)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+			"error":            "validation failed",
+			"validationErrors": mapValidationErrors(errs),
+		})
+		return
+	}
+	warning, err := afterSave(profile.RestoreVersion(name, *version))
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{
+		"ok":     true,
+		"name":   name,
+		"backup": version.Backup,
+	}, warning))
+}
+
+// profileHistory loads the history of profile name, writing the error when
+// it cannot.
+func profileHistory(w http.ResponseWriter, name string) ([]profile.Version, bool) {
+	versions, err := profile.History(name)
+	var notFound *profile.NotFoundError
+	switch {
+	case errors.As(err, &notFound):
+		writeErr(w, http.StatusNotFound, fmt.Sprintf("profile not found: %s", name))
+		return nil, false
+	case err != nil:
+		writeServerErr(w, err)
+		return nil, false
+	}
+	return versions, true
+}
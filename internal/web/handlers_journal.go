@@ -0,0 +1,86 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+)
+
+// GET /api/journal
+//
+// The activation journal, newest first, plus the profile or stack label
+// `switch -` would go back to ("" when there is none).
+func handleGetJournal(w http.ResponseWriter, r *http.Request) {
+	journal, err := profile.Journal()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	entries := make([]profile.JournalEntry, 0, len(journal))
+	for i := len(journal) - 1; i >= 0; i-- {
+		if err := maskJournalEntry(r, &journal[i]); err != nil {
+			writeServerErr(w, err)
+			return
+		}
+		entries = append(entries, journal[i])
+	}
+	previous := ""
+	if len(entries) > 0 {
+		previous = entries[0].Previous
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"entries":  entries,
+		"previous": previous,
+	})
+}
+
+// POST /api/switch-back
+func handleSwitchBack(w http.ResponseWriter, r *http.Request) {
+	applied, err := profile.SwitchBack()
+	warning, err := afterSave(err)
+	if journalError(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{
+		"ok":       true,
+		"name":     applied.Name,
+		"stack":    nonNilNames(applied.Stack),
+		"snapshot": applied.Snapshot,
+	}, warning))
+}
+
+// POST /api/revert
+func handleRevert(w http.ResponseWriter, r *http.Request) {
+	entry, err := profile.Revert()
+	warning, err := afterSave(err)
+	if err == nil {
+		err = maskJournalEntry(r, &entry)
+	}
+	if journalError(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, withWarning(map[string]any{
+		"ok":       true,
+		"reverted": entry,
+	}, warning))
+}
+
+// journalError writes err and reports whether there was one. Having nothing
+// to go back to is a 409, not a server fault.
+func journalError(w http.ResponseWriter, err error) bool {
+	var noPrevious *profile.NoPreviousProfileError
+	switch {
+	case err == nil:
+		return false
+	case referencesError(w, err):
+	case errors.Is(err, profile.ErrJournalEmpty), errors.As(err, &noPrevious):
+		writeErr(w, http.StatusConflict, err.Error())
+	case errors.Is(err, fs.ErrNotExist):
+		writeErr(w, http.StatusNotFound, err.Error())
+	default:
+		writeServerErr(w, err)
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+)
+
+// layersJSON describes every config layer and which one the UI is editing.
+func layersJSON() map[string]any {
+	layers := make([]map[string]any, 0, len(config.Layers))
+	for _, l := range config.Layers {
+		path := config.LayerFile(l)
+		_, err := os.Stat(path)
+		layers = append(layers, map[string]any{
+			"layer":  l,
+			"path":   path,
+			"exists": err == nil,
+		})
+	}
+	return map[string]any{
+		"target": config.TargetLayer(),
+		"layers": layers,
+	}
+}
+
+// GET /api/layers
+func handleGetLayers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, layersJSON())
+}
+
+// PUT /api/layers
+//
+// Switches which layer every other endpoint reads and writes. The choice is
+// server-wide: the web UI is single-user, and a per-request layer would let two
+// tabs silently edit different files under the same profile names.
+func handleSetLayer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	layer, err := config.ParseLayer(req.Target)
+	if err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := config.SetTargetLayer(layer); err != nil {
+		writeErr(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, layersJSON())
+}
+
+// GET /api/effective
+func handleEffective(w http.ResponseWriter, r *http.Request) {
+	eff, err := config.LoadEffective()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	cfg, err := maskRoot(r, eff.Config)
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"config":  cfg,
+		"sources": eff.Sources,
+		"files":   eff.Files,
+	})
+}
@@ -11,7 +11,7 @@ import (
 func handleListModels(w http.ResponseWriter, r *http.Request) {
 	reg, err := models.Load()
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 		return
 	}
 
@@ -152,6 +152,6 @@ func writeModelErr(w http.ResponseWriter, err error) {
 	case errors.As(err, &notFound):
 		writeErr(w, http.StatusNotFound, err.Error())
 	default:
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServerErr(w, err)
 	}
 }
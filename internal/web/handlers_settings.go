@@ -0,0 +1,106 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/diogenes/omo-profiler/internal/profile"
+)
+
+// GET /api/settings
+//
+// omo-profiler's settings for the target document, with keepKeys resolved to
+// the keys a strict apply actually keeps and backups to the retention in
+// effect.
+func handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := profile.LoadSettings()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	profiles := settings.Profiles
+	if profiles == nil {
+		profiles = map[string]profile.ProfileSettings{}
+	}
+	pinned := settings.PinnedBackups
+	if pinned == nil {
+		pinned = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keepKeys":      settings.KeptKeys(),
+		"profiles":      profiles,
+		"backups":       settings.BackupRetention(),
+		"pinnedBackups": pinned,
+		"git":           settings.Git,
+	})
+}
+
+// PUT /api/settings
+//
+// Body: {"keepKeys": [...]} replaces the extra kept keys; null restores the
+// defaults.
+func handleSetSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		KeepKeys []string `json:"keepKeys"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := profile.SetKeepKeys(req.KeepKeys); err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	handleGetSettings(w, r)
+}
+
+// PUT /api/profiles/{name}/settings
+//
+// Body: {"strict": true|false, "extends": "<parent>"|""}. Omitted fields keep
+// their value; an empty extends removes the parent.
+func handleSetProfileSettings(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if nameError(w, name) {
+		return
+	}
+	var req struct {
+		Strict  *bool   `json:"strict"`
+		Extends *string `json:"extends"`
+	}
+	if err := decodeBody(r, &req); err != nil {
+		writeErr(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Extends != nil {
+		if err := profile.SetExtends(name, *req.Extends); err != nil {
+			profileSettingsErr(w, err)
+			return
+		}
+	}
+	if req.Strict != nil {
+		if err := profile.SetStrict(name, *req.Strict); err != nil {
+			profileSettingsErr(w, err)
+			return
+		}
+	}
+	settings, err := profile.LoadSettings()
+	if err != nil {
+		writeServerErr(w, err)
+		return
+	}
+	ps := settings.Profiles[name]
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "strict": ps.Strict, "extends": ps.Extends})
+}
+
+func profileSettingsErr(w http.ResponseWriter, err error) {
+	var cycle *profile.ExtendsCycleError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeErr(w, http.StatusNotFound, err.Error())
+	case errors.As(err, &cycle):
+		writeErr(w, http.StatusConflict, err.Error())
+	default:
+		writeServerErr(w, err)
+	}
+}
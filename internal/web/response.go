@@ -2,7 +2,12 @@ package web
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
 )
 
 // writeJSON encodes v as JSON with the given status code.
@@ -16,3 +21,79 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 func writeErr(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
+
+// writeServerErr reports an unexpected failure. A document held by another
+// omo-profiler process is 503 rather than 500: the request was fine and is
+// worth retrying once the other writer finishes.
+func writeServerErr(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, config.ErrBusy) {
+		w.Header().Set("Retry-After", "1")
+		status = http.StatusServiceUnavailable
+	}
+	writeErr(w, status, err.Error())
+}
+
+// afterSave splits an *config.AfterSaveError off err. Such a write landed, so
+// the handler answers as on success, with the failure as a "warning" field.
+func afterSave(err error) (warning string, rest error) {
+	if err != nil && config.Saved(err) {
+		return err.Error(), nil
+	}
+	return "", err
+}
+
+// withWarning adds warning to a response body when there is one.
+func withWarning(body map[string]any, warning string) map[string]any {
+	if warning != "" {
+		body["warning"] = warning
+	}
+	return body
+}
+
+// setETag publishes a profile revision as a strong entity tag.
+func setETag(w http.ResponseWriter, revision string) {
+	if revision != "" {
+		w.Header().Set("ETag", `"`+revision+`"`)
+	}
+}
+
+// ifMatch returns the revisions a write is conditional on, any of which
+// matches, or nil when the request is unconditional. If-Match is a comma
+// separated list of entity tags (RFC 9110 §13.1.1), possibly over several
+// header lines. `*` only requires the profile to exist, which every profile
+// write already checks. Weak tags are accepted as their opaque value:
+// revisions are content hashes, so weak and strong comparison coincide.
+func ifMatch(r *http.Request) []string {
+	var revisions []string
+	for _, line := range r.Header.Values("If-Match") {
+		for _, tag := range strings.Split(line, ",") {
+			tag = strings.TrimSpace(tag)
+			switch tag {
+			case "":
+				continue
+			case "*":
+				return nil
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+			revisions = append(revisions, strings.Trim(tag, `"`))
+		}
+	}
+	return revisions
+}
+
+// revisionError maps *profile.RevisionMismatchError to 412 Precondition
+// Failed, carrying the current revision so the client can reload. Returns true
+// when it handled (wrote) the error.
+func revisionError(w http.ResponseWriter, err error) bool {
+	var mismatch *profile.RevisionMismatchError
+	if !errors.As(err, &mismatch) {
+		return false
+	}
+	setETag(w, mismatch.Actual)
+	writeJSON(w, http.StatusPreconditionFailed, map[string]any{
+		"error":    mismatch.Error(),
+		"revision": mismatch.Actual,
+	})
+	return true
+}
@@ -0,0 +1,118 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/diogenes/omo-profiler/internal/config"
+	"github.com/diogenes/omo-profiler/internal/profile"
+	"github.com/diogenes/omo-profiler/internal/redact"
+)
+
+// Every response carrying configuration masks its credentials (see package
+// redact) unless the request asks for them with ?reveal=1, so a shared screen
+// does not show them. Saving a profile puts the stored value back wherever
+// the editor sends a mask unchanged.
+
+// revealSecrets reports whether the request asks for credentials verbatim.
+func revealSecrets(r *http.Request) bool {
+	reveal, _ := strconv.ParseBool(r.URL.Query().Get("reveal"))
+	return reveal
+}
+
+// restoreSecrets puts profile name's stored credentials back into body, the
+// config of harness block key sent to be saved, wherever it holds a mask. A
+// missing profile is left for the save to report.
+func restoreSecrets(name, key string, body []byte) ([]byte, error) {
+	if !bytes.Contains(body, []byte(redact.Mask)) || !json.Valid(body) {
+		return body, nil
+	}
+	doc, err := config.LoadDocument()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := profile.ExportHarnessFrom(doc, name, key)
+	var notFound *profile.NotFoundError
+	if errors.As(err, &notFound) {
+		return body, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return redact.Restore(body, stored)
+}
+
+// maskAt masks data, the value at block path path, unless r reveals secrets.
+func maskAt(r *http.Request, path string, data []byte) (json.RawMessage, error) {
+	if revealSecrets(r) || len(data) == 0 {
+		return data, nil
+	}
+	return redact.At(path, data)
+}
+
+// maskRoot masks values, keyed by document root key, into a new map.
+func maskRoot(r *http.Request, values map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	if values == nil {
+		return nil, nil
+	}
+	out := make(map[string]json.RawMessage, len(values))
+	for key, value := range values {
+		masked, err := maskAt(r, key, value)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = masked
+	}
+	return out, nil
+}
+
+// maskPreview masks the before and after values of an apply preview.
+func maskPreview(r *http.Request, preview *profile.ApplyPreview) error {
+	for i, change := range preview.Changes {
+		var err error
+		if preview.Changes[i].Before, err = maskAt(r, change.Key, change.Before); err != nil {
+			return err
+		}
+		if preview.Changes[i].After, err = maskAt(r, change.Key, change.After); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maskJournalEntry masks the root values a journal entry saved.
+func maskJournalEntry(r *http.Request, entry *profile.JournalEntry) error {
+	replaced, err := maskRoot(r, entry.Replaced)
+	entry.Replaced = replaced
+	return err
+}
+
+// maskCapture masks the profile blocks of a capture result.
+func maskCapture(r *http.Request, result *profile.CaptureResult) error {
+	var err error
+	if result.Before, err = maskAt(r, "", result.Before); err != nil {
+		return err
+	}
+	result.After, err = maskAt(r, "", result.After)
+	return err
+}
+
+// maskVersion masks a profile version's block and the values of its changes.
+func maskVersion(r *http.Request, v *profile.Version) error {
+	var err error
+	if v.Block, err = maskAt(r, "", v.Block); err != nil {
+		return err
+	}
+	for i, change := range v.Changes {
+		if v.Changes[i].Before, err = maskAt(r, change.Path, change.Before); err != nil {
+			return err
+		}
+		if v.Changes[i].After, err = maskAt(r, change.Path, change.After); err != nil {
+			return err
+		}
+	}
+	return nil
+}
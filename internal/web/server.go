@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/diogenes/omo-profiler/internal/watch"
 )
 
 // Options configures the web server.
@@ -31,16 +33,39 @@ func newMux() *http.ServeMux {
 	mux.HandleFunc("POST /api/profiles/{name}/rename", handleRenameProfile)
 	mux.HandleFunc("POST /api/profiles/{name}/activate", handleActivateProfile)
 	mux.HandleFunc("GET /api/profiles/{name}/export", handleExportProfile)
+	mux.HandleFunc("PUT /api/profiles/{name}/settings", handleSetProfileSettings)
+	mux.HandleFunc("GET /api/profiles/{name}/references", handleProfileReferences)
+	mux.HandleFunc("GET /api/profiles/{name}/history", handleProfileHistory)
+	mux.HandleFunc("POST /api/profiles/{name}/history/restore", handleRestoreProfileVersion)
+	mux.HandleFunc("GET /api/profiles/{name}/harness/{harness}", handleGetHarness)
+	mux.HandleFunc("PUT /api/profiles/{name}/harness/{harness}", handleSaveHarness)
 
 	// Active / diff / import / validate / schema
 	mux.HandleFunc("GET /api/active", handleGetActive)
+	mux.HandleFunc("POST /api/stack", handleActivateStack)
+	mux.HandleFunc("GET /api/journal", handleGetJournal)
+	mux.HandleFunc("POST /api/switch-back", handleSwitchBack)
+	mux.HandleFunc("POST /api/revert", handleRevert)
+	mux.HandleFunc("POST /api/capture", handleCapture)
+	mux.HandleFunc("GET /api/settings", handleGetSettings)
+	mux.HandleFunc("PUT /api/settings", handleSetSettings)
 	mux.HandleFunc("GET /api/diff", handleDiff)
 	mux.HandleFunc("POST /api/import", handleImport)
 	mux.HandleFunc("POST /api/validate", handleValidate)
 	mux.HandleFunc("GET /api/schema", handleSchema)
+	mux.HandleFunc("GET /api/harnesses", handleListHarnesses)
+	mux.HandleFunc("GET /api/export", handleExportAll)
 	mux.HandleFunc("GET /api/document-schema", handleDocumentSchema)
 	mux.HandleFunc("GET /api/schema-check", handleSchemaCheck)
 
+	// Config layers
+	mux.HandleFunc("GET /api/layers", handleGetLayers)
+	mux.HandleFunc("PUT /api/layers", handleSetLayer)
+	mux.HandleFunc("GET /api/effective", handleEffective)
+
+	// Live updates
+	mux.HandleFunc("GET /api/events", handleEvents)
+
 	// Models (specific catalog route before the wildcard provider route)
 	mux.HandleFunc("GET /api/models", handleListModels)
 	mux.HandleFunc("POST /api/models", handleCreateModel)
@@ -129,5 +154,8 @@ func Serve(opts Options) error {
 		}()
 	}
 
+	watcher = watch.New(watch.ConfigFiles())
+	defer watcher.Close()
+
 	return http.Serve(listener, newMux())
 }
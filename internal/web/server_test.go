@@ -1,17 +1,25 @@
 package web
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/diogenes/omo-profiler/internal/backup"
 	"github.com/diogenes/omo-profiler/internal/config"
 	"github.com/diogenes/omo-profiler/internal/profile"
 	"github.com/diogenes/omo-profiler/internal/schema"
+	"github.com/diogenes/omo-profiler/internal/vcs"
+	"github.com/diogenes/omo-profiler/internal/watch"
 	"github.com/stretchr/testify/require"
 )
 
@@ -64,21 +72,20 @@ func sortedKeys(m map[string]any) []string {
 
 func hasBakInOmoDir(t *testing.T) bool {
 	t.Helper()
-	entries, err := os.ReadDir(config.OmoDir())
+	backups, err := backup.List()
 	require.NoError(t, err)
-	for _, e := range entries {
-		if strings.Contains(e.Name(), ".bak.") {
-			return true
-		}
-	}
-	return false
+	return len(backups) > 0
 }
 
 // activeResponse mirrors the JSON shape of activeJSON in handlers.go.
 type activeResponse struct {
-	DocumentExists bool   `json:"documentExists"`
-	ProfileName    string `json:"profileName"`
-	Modified       bool   `json:"modified"`
+	DocumentExists bool     `json:"documentExists"`
+	ProfileName    string   `json:"profileName"`
+	State          string   `json:"state"`
+	Candidates     []string `json:"candidates"`
+	AppliedName    string   `json:"appliedName"`
+	Stack          []string `json:"stack"`
+	Modified       bool     `json:"modified"`
 }
 
 type profilesResponse struct {
@@ -155,6 +162,181 @@ func TestListProfilesFlagsModifiedRoot(t *testing.T) {
 	}
 }
 
+// Identical profiles are told apart by the activation record; without one
+// the API reports every candidate instead of guessing.
+func TestListProfilesReportsAmbiguousAndDrifted(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry":true}`)
+	seedProfile(t, "b", `{"telemetry":true}`)
+	doc, err := config.LoadDocument()
+	require.NoError(t, err)
+	doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":true}`))
+	require.NoError(t, doc.Save())
+
+	resp := listProfiles(t)
+	require.Equal(t, "ambiguous", resp.Active.State)
+	require.Empty(t, resp.Active.ProfileName)
+	require.Equal(t, []string{"a", "b"}, resp.Active.Candidates)
+
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/b/activate", "").Code)
+	resp = listProfiles(t)
+	require.Equal(t, "exact", resp.Active.State)
+	require.Equal(t, "b", resp.Active.ProfileName)
+	for _, p := range resp.Profiles {
+		require.Equal(t, p.Name == "b", p.Active)
+	}
+
+	doc, err = config.LoadDocument()
+	require.NoError(t, err)
+	doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry":false}`))
+	require.NoError(t, doc.Save())
+	resp = listProfiles(t)
+	require.Equal(t, "drifted", resp.Active.State)
+	require.Equal(t, "b", resp.Active.AppliedName)
+	require.True(t, resp.Active.Modified)
+}
+
+func TestActivateStack(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "base", `{"telemetry":true,"disabled_hooks":["a"]}`)
+	seedProfile(t, "quiet", `{"telemetry":false,"disabled_hooks":["b"]}`)
+
+	rec := do(t, "POST", "/api/stack?dryRun=1", `{"profiles":["base","quiet"]}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var preview struct {
+		Name  string   `json:"name"`
+		Stack []string `json:"stack"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	require.Equal(t, "base + quiet", preview.Name)
+	require.Equal(t, []string{"base", "quiet"}, preview.Stack)
+
+	require.Equal(t, 200, do(t, "POST", "/api/stack", `{"profiles":["base","quiet"]}`).Code)
+	resp := listProfiles(t)
+	require.Equal(t, "exact", resp.Active.State)
+	require.Empty(t, resp.Active.ProfileName)
+	require.Equal(t, []string{"base", "quiet"}, resp.Active.Stack)
+	require.False(t, resp.Active.Modified)
+
+	rec = do(t, "GET", "/api/diff?left=base&right=base%2Bquiet", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `\"b\"`)
+
+	require.Equal(t, 404, do(t, "POST", "/api/stack", `{"profiles":["base","missing"]}`).Code)
+	require.Equal(t, 400, do(t, "POST", "/api/stack", `{"profiles":["base","base"]}`).Code)
+	require.Equal(t, 400, do(t, "POST", "/api/stack", `{"profiles":[]}`).Code)
+}
+
+func TestActivateReportsUnresolvedReferences(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "bot", `{"openclaw":{"replyListener":{"discordBotToken":"${env:OMO_TEST_UNSET_TOKEN}"}}}`)
+
+	rec := do(t, "GET", "/api/profiles/bot/references", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var listed struct {
+		References []profile.Reference `json:"references"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+	require.Len(t, listed.References, 1)
+	require.False(t, listed.References[0].Resolved)
+	require.Equal(t, "[opencode].openclaw.replyListener.discordBotToken", listed.References[0].Path)
+
+	rec = do(t, "POST", "/api/profiles/bot/activate", "")
+	require.Equal(t, 422, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"references"`)
+
+	t.Setenv("OMO_TEST_UNSET_TOKEN", "secret")
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/bot/activate", "").Code)
+	rec = do(t, "GET", "/api/profiles/bot", "")
+	require.NotContains(t, rec.Body.String(), "secret")
+}
+
+func TestSecretsAreMaskedUnlessRevealed(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "bot", `{"openclaw":{"replyListener":{"discordBotToken":"d-secret","discordChannelId":"42"}}}`)
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/bot/activate", "").Code)
+
+	for _, target := range []string{"/api/profiles/bot", "/api/active", "/api/diff?left=bot&right=__active__", "/api/effective"} {
+		rec := do(t, "GET", target, "")
+		require.Equal(t, 200, rec.Code, target)
+		require.NotContains(t, rec.Body.String(), "d-secret", target)
+		require.Contains(t, rec.Body.String(), "••••", target)
+	}
+	require.Contains(t, do(t, "GET", "/api/profiles/bot?reveal=1", "").Body.String(), "d-secret")
+	for _, target := range []string{"/api/profiles/bot/export", "/api/export"} {
+		require.NotContains(t, do(t, "GET", target, "").Body.String(), "discordBotToken", target)
+		require.Contains(t, do(t, "GET", target+"?reveal=1", "").Body.String(), "d-secret", target)
+	}
+
+	// Saving what the editor was shown keeps the stored token.
+	rec := do(t, "PUT", "/api/profiles/bot", `{"openclaw":{"replyListener":{"discordBotToken":"••••","discordChannelId":"43"}}}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	replyListener := readProfileOpenCode(t, "bot")["openclaw"].(map[string]any)["replyListener"].(map[string]any)
+	require.Equal(t, "d-secret", replyListener["discordBotToken"])
+	require.Equal(t, "43", replyListener["discordChannelId"])
+}
+
+func TestHarnessBlocksAreEditable(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry":false}`)
+
+	rec := do(t, "GET", "/api/harnesses", "")
+	require.Equal(t, 200, rec.Code)
+	require.Contains(t, rec.Body.String(), `"[senpi]"`)
+
+	rec = do(t, "GET", "/api/profiles/dev/harness/senpi", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var got struct {
+		Revision string         `json:"revision"`
+		Config   map[string]any `json:"config"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.Empty(t, got.Config)
+
+	rec = do(t, "PUT", "/api/profiles/dev/harness/senpi", `{"categories":{"quick":{"model":42}}}`)
+	require.Equal(t, 422, rec.Code, rec.Body.String())
+
+	rec = do(t, "PUT", "/api/profiles/dev/harness/senpi", `{"categories":{"quick":{"model":"openai/gpt-5"}}}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, do(t, "GET", "/api/profiles/dev/harness/senpi", "").Body.String(), "openai/gpt-5")
+	require.Contains(t, do(t, "GET", "/api/profiles/dev/export?harness=senpi", "").Body.String(), "openai/gpt-5")
+	require.Equal(t, false, readProfileOpenCode(t, "dev")["telemetry"])
+
+	require.Equal(t, 404, do(t, "GET", "/api/profiles/dev/harness/nope", "").Code)
+	require.Equal(t, 404, do(t, "GET", "/api/profiles/ghost/harness/senpi", "").Code)
+}
+
+func TestImportDocumentAndExportAll(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry":false}`)
+	seedProfile(t, "ops", `{"telemetry":true}`)
+
+	rec := do(t, "GET", "/api/export", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	exported := rec.Body.String()
+	require.Contains(t, exported, `"profiles"`)
+
+	rec = do(t, "POST", "/api/import", `{"config":`+exported+`,"profiles":["dev"],"onConflict":"skip"}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var res struct {
+		Format  string `json:"format"`
+		Results []struct {
+			Name   string `json:"name"`
+			Action string `json:"action"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, "document", res.Format)
+	require.Len(t, res.Results, 1)
+	require.Equal(t, "skipped", res.Results[0].Action)
+
+	rec = do(t, "POST", "/api/import", `{"name":"dev","config":{"[opencode]":{"telemetry":"yes"}},"onConflict":"overwrite"}`)
+	require.Equal(t, 422, rec.Code, rec.Body.String())
+	rec = do(t, "POST", "/api/import", `{"config":`+exported+`,"onConflict":"overwrite"}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Equal(t, true, readProfileOpenCode(t, "ops")["telemetry"])
+}
+
 // Cloning must reproduce the whole profile block. Sibling harness blocks
 // ([senpi], [codex]) live next to `[opencode]` and are easy to drop.
 func TestCreateFromProfilePreservesSiblingBlocks(t *testing.T) {
@@ -201,6 +383,28 @@ func TestSaveProfileValidRoundTrips(t *testing.T) {
 	require.Equal(t, false, got.Config["telemetry"])
 }
 
+func TestSaveProfileReportsAFailedPushAsWarning(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{}`)
+	var pushErr *vcs.PushError
+	require.ErrorAs(t, profile.SetVersioning(true, filepath.Join(t.TempDir(), "missing.git")), &pushErr)
+
+	// The save landed, so it answers as one, with the push failure beside.
+	rec := do(t, "PUT", "/api/profiles/dev", `{"telemetry":false}`)
+	require.Equal(t, 200, rec.Code)
+	var got struct {
+		Revision string
+		Warning  string
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	require.NotEmpty(t, got.Revision)
+	require.Contains(t, got.Warning, "push to origin failed")
+	require.Equal(t, false, readProfileOpenCode(t, "dev")["telemetry"])
+}
+
 func TestSaveProfileInvalidTypeReturns422AndDoesNotWrite(t *testing.T) {
 	setupTestEnv(t)
 	good := `{"telemetry":false}`
@@ -381,21 +585,43 @@ func TestMutatingRoutesBackupOmoFile(t *testing.T) {
 	require.Equal(t, 201, do(t, "POST", "/api/profiles", `{"name":"dev","from":""}`).Code)
 	require.False(t, hasBakInOmoDir(t))
 
-	// Subsequent save backs up ~/.omo/omo.json into OmoDir.
+	// Subsequent save backs up ~/.omo/omo.json into OmoDir's store.
 	require.Equal(t, 200, do(t, "PUT", "/api/profiles/dev", `{"telemetry":false}`).Code)
 	require.True(t, hasBakInOmoDir(t))
 
-	entries, err := os.ReadDir(config.OmoDir())
+	backups, err := backup.List()
 	require.NoError(t, err)
-	found := false
-	for _, e := range entries {
-		if strings.HasPrefix(e.Name(), config.OmoBasename+".bak.") {
-			found = true
-			require.Equal(t, config.OmoDir(), filepath.Dir(filepath.Join(config.OmoDir(), e.Name())))
-		}
+	require.Len(t, backups, 1)
+	require.True(t, strings.HasPrefix(backups[0].Name, config.OmoBasename+".bak."))
+	require.Equal(t, filepath.Join(config.OmoDir(), "backups"), filepath.Dir(backups[0].Path))
+	require.Equal(t, "save dev", backups[0].Operation)
+}
+func TestProfileHistoryAndRestore(t *testing.T) {
+	setupTestEnv(t)
+	require.Equal(t, 201, do(t, "POST", "/api/profiles", `{"name":"dev","from":""}`).Code)
+	require.Equal(t, 200, do(t, "PUT", "/api/profiles/dev", `{"disabled_mcps":["a"]}`).Code)
+	require.Equal(t, 200, do(t, "PUT", "/api/profiles/dev", `{"disabled_mcps":["b"]}`).Code)
+
+	rec := do(t, "GET", "/api/profiles/dev/history", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var history struct {
+		Versions []profile.Version `json:"versions"`
 	}
-	require.True(t, found)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &history))
+	require.Len(t, history.Versions, 3)
+	require.True(t, history.Versions[0].Live)
+	require.Equal(t, "save dev", history.Versions[1].ReplacedBy)
+	require.Equal(t, "[opencode].disabled_mcps", history.Versions[0].Changes[0].Path)
+
+	// The version before the last save comes back.
+	body := `{"backup":"` + history.Versions[1].Backup + `"}`
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/dev/history/restore", body).Code)
+	require.Equal(t, []any{"a"}, readProfileOpenCode(t, "dev")["disabled_mcps"])
+
+	require.Equal(t, 404, do(t, "POST", "/api/profiles/dev/history/restore", `{"backup":"nope"}`).Code)
+	require.Equal(t, 404, do(t, "GET", "/api/profiles/ghost/history", "").Code)
 }
+
 func TestRenameUpdatesActiveState(t *testing.T) {
 	setupTestEnv(t)
 	require.Equal(t, 201, do(t, "POST", "/api/profiles", `{"name":"dev","from":""}`).Code)
@@ -520,3 +746,300 @@ func TestModelsUpdateStatusCodes(t *testing.T) {
 	require.Contains(t, rec.Body.String(), `"a"`)
 	require.Contains(t, rec.Body.String(), `"b"`)
 }
+
+// Switching to the project layer routes every other endpoint to the project
+// document, and /api/effective reports which layer each value came from.
+func TestLayersSwitchAndEffective(t *testing.T) {
+	setupTestEnv(t)
+	projectDir := t.TempDir()
+	config.SetWorkDir(projectDir)
+	t.Cleanup(config.ResetWorkDir)
+	t.Cleanup(config.ResetTargetLayer)
+
+	seedProfile(t, "personal", `{"telemetry": false}`)
+
+	require.Equal(t, 400, do(t, "PUT", "/api/layers", `{"target":"team"}`).Code)
+	rec := do(t, "PUT", "/api/layers", `{"target":"project"}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"target":"project"`)
+
+	rec = do(t, "POST", "/api/profiles", `{"name":"repo"}`)
+	require.Equal(t, 201, rec.Code, rec.Body.String())
+	rec = do(t, "PUT", "/api/profiles/repo", `{"telemetry":true}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/repo/activate", "").Code)
+
+	rec = do(t, "GET", "/api/profiles", "")
+	require.Contains(t, rec.Body.String(), `"repo"`)
+	require.NotContains(t, rec.Body.String(), `"personal"`)
+
+	projectFile := filepath.Join(projectDir, config.OmoDirname, config.OmoBasename)
+	rec = do(t, "GET", "/api/active", "")
+	var active map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &active))
+	require.Equal(t, "project", active["layer"])
+	require.Equal(t, projectFile, active["path"])
+
+	rec = do(t, "GET", "/api/effective", "")
+	require.Equal(t, 200, rec.Code)
+	var eff struct {
+		Sources map[string]string `json:"sources"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &eff))
+	require.Equal(t, "project", eff.Sources["[opencode].telemetry"])
+}
+
+// A stale editor tab must get 412 instead of overwriting a newer save.
+func TestSaveProfileIfMatch(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "dev", `{"telemetry": false}`)
+
+	rec := do(t, "GET", "/api/profiles/dev", "")
+	require.Equal(t, 200, rec.Code)
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	var body struct {
+		Revision string `json:"revision"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Equal(t, `"`+body.Revision+`"`, etag)
+
+	put := func(ifMatch, payload string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/profiles/dev", strings.NewReader(payload))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		newMux().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Another tab saves first; its response carries the new tag.
+	first := put(etag, `{"telemetry": true}`)
+	require.Equal(t, 200, first.Code, first.Body.String())
+	require.NotEqual(t, etag, first.Header().Get("ETag"))
+
+	stale := put(etag, `{"default_run_agent": "x"}`)
+	require.Equal(t, 412, stale.Code, stale.Body.String())
+	require.Equal(t, first.Header().Get("ETag"), stale.Header().Get("ETag"))
+	require.Equal(t, true, readProfileOpenCode(t, "dev")["telemetry"])
+
+	latest := put(first.Header().Get("ETag"), `{}`)
+	require.Equal(t, 200, latest.Code)
+	// A list matches when any of its tags does.
+	require.Equal(t, 412, put(etag+`, "nope"`, `{}`).Code)
+	require.Equal(t, 200, put(etag+", W/"+latest.Header().Get("ETag"), `{"telemetry": false}`).Code)
+	require.Equal(t, 200, put("*", `{}`).Code)
+
+	req := httptest.NewRequest("DELETE", "/api/profiles/dev", nil)
+	req.Header.Set("If-Match", etag)
+	rec = httptest.NewRecorder()
+	newMux().ServeHTTP(rec, req)
+	require.Equal(t, 412, rec.Code)
+}
+
+func TestEventsStreamsDocumentChanges(t *testing.T) {
+	setupTestEnv(t)
+	require.Equal(t, 503, do(t, "GET", "/api/events", "").Code)
+
+	watcher = watch.New([]string{config.OmoFile()})
+	t.Cleanup(func() {
+		watcher.Close()
+		watcher = nil
+	})
+	srv := httptest.NewServer(newMux())
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/events", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The handler subscribes before writing its preamble, so once the first
+	// comment arrives any later write is guaranteed to reach this stream.
+	lines := bufio.NewScanner(resp.Body)
+	require.True(t, lines.Scan())
+	seedProfile(t, "dev", `{}`)
+
+	for lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev watch.Event
+		require.NoError(t, json.Unmarshal([]byte(data), &ev))
+		require.Equal(t, config.OmoFile(), ev.Path)
+		return
+	}
+	t.Fatalf("stream ended without a change event: %v", lines.Err())
+}
+
+func TestSwitchBackAndRevert(t *testing.T) {
+	setupTestEnv(t)
+	require.NoError(t, config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry": false, "hand_tuned": 1}`))
+		return nil
+	}))
+	seedProfile(t, "a", `{"telemetry": true}`)
+	seedProfile(t, "b", `{"telemetry": false}`)
+
+	require.Equal(t, 409, do(t, "POST", "/api/switch-back", "").Code)
+	require.Equal(t, 409, do(t, "POST", "/api/revert", "").Code)
+
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/a/activate", "").Code)
+	// The hand-tuned root matched no profile: only revert can bring it back.
+	require.Equal(t, 409, do(t, "POST", "/api/switch-back", "").Code)
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/b/activate", "").Code)
+
+	rec := do(t, "GET", "/api/journal", "")
+	require.Equal(t, 200, rec.Code)
+	var journal struct {
+		Entries  []profile.JournalEntry `json:"entries"`
+		Previous string                 `json:"previous"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &journal))
+	require.Len(t, journal.Entries, 2)
+	require.Equal(t, "b", journal.Entries[0].Profile)
+	require.Equal(t, "a", journal.Previous)
+
+	rec = do(t, "POST", "/api/switch-back", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"name":"a"`)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, 200, do(t, "POST", "/api/revert", "").Code)
+	}
+	doc, err := config.LoadDocument()
+	require.NoError(t, err)
+	root, _ := doc.Raw(config.OpenCodeKey)
+	require.JSONEq(t, `{"telemetry": false, "hand_tuned": 1}`, string(root))
+}
+
+func TestActivateDryRunWritesNothing(t *testing.T) {
+	setupTestEnv(t)
+	require.NoError(t, config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry": true}`))
+		return nil
+	}))
+	seedProfile(t, "a", `{"telemetry": false}`)
+	before, err := os.ReadFile(config.DocumentFile())
+	require.NoError(t, err)
+
+	rec := do(t, "POST", "/api/profiles/a/activate?dryRun=1", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var preview profile.ApplyPreview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	require.Equal(t, "a", preview.Name)
+	require.Equal(t, profile.SnapshotBaseName, preview.Snapshot)
+	require.Len(t, preview.Changes, 1)
+	require.Equal(t, profile.RootReplaced, preview.Changes[0].Kind)
+	require.JSONEq(t, `{"telemetry": true}`, string(preview.Changes[0].Before))
+	require.JSONEq(t, `{"telemetry": false}`, string(preview.Changes[0].After))
+
+	after, err := os.ReadFile(config.DocumentFile())
+	require.NoError(t, err)
+	require.Equal(t, string(before), string(after))
+}
+
+func TestStrictApplyAndProfileSettings(t *testing.T) {
+	setupTestEnv(t)
+	require.NoError(t, config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.CodexKey, json.RawMessage(`{"model": "o3"}`))
+		return nil
+	}))
+	seedProfile(t, "a", `{"telemetry": false}`)
+
+	require.Equal(t, 404, do(t, "PUT", "/api/profiles/missing/settings", `{"strict": true}`).Code)
+	rec := do(t, "PUT", "/api/profiles/a/settings", `{"strict": true}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+
+	rec = do(t, "GET", "/api/profiles", "")
+	require.Equal(t, 200, rec.Code)
+	require.Contains(t, rec.Body.String(), `"strict":true`)
+
+	rec = do(t, "POST", "/api/profiles/a/activate?dryRun=1", "")
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	var preview profile.ApplyPreview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	require.True(t, preview.Strict)
+	require.Equal(t, 1, preview.Count(profile.RootRemoved))
+
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/a/activate", "").Code)
+	doc, err := config.LoadDocument()
+	require.NoError(t, err)
+	_, ok := doc.Raw(config.CodexKey)
+	require.False(t, ok, "strict apply kept [codex]")
+
+	rec = do(t, "PUT", "/api/settings", `{"keepKeys": ["[codex]"]}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"[codex]"`)
+}
+
+func TestCaptureLiveRoot(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "a", `{"telemetry": false}`)
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/a/activate", "").Code)
+	require.NoError(t, config.Mutate(func(doc *config.Document) error {
+		doc.SetRaw(config.OpenCodeKey, json.RawMessage(`{"telemetry": true}`))
+		return nil
+	}))
+
+	rec := do(t, "POST", "/api/capture", `{}`)
+	require.Equal(t, 409, rec.Code, rec.Body.String())
+	var conflict struct {
+		Result profile.CaptureResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &conflict))
+	require.Equal(t, "a", conflict.Result.Name)
+	require.JSONEq(t, `{"[opencode]": {"telemetry": false}}`, string(conflict.Result.Before))
+
+	rec = do(t, "POST", "/api/capture", `{"force": true}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"written":true`)
+
+	rec = do(t, "POST", "/api/capture", `{"name": "b", "dryRun": true}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Contains(t, rec.Body.String(), `"written":false`)
+	require.False(t, profile.Exists("b"))
+
+	rec = do(t, "POST", "/api/capture", `{"name": "telemetry-only", "fields": ["telemetry"]}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+}
+
+func TestProfileExtendsParent(t *testing.T) {
+	setupTestEnv(t)
+	seedProfile(t, "base", `{"telemetry": true, "disabled_mcps": ["a"]}`)
+
+	rec := do(t, "POST", "/api/profiles", `{"name": "child", "extends": "base"}`)
+	require.Equal(t, 201, rec.Code, rec.Body.String())
+	rec = do(t, "PUT", "/api/profiles/child", `{"telemetry": false}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+
+	rec = do(t, "GET", "/api/profiles/child", "")
+	require.Equal(t, 200, rec.Code)
+	var detail struct {
+		Config         json.RawMessage `json:"config"`
+		Ancestors      []string        `json:"ancestors"`
+		ResolvedConfig json.RawMessage `json:"resolvedConfig"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &detail))
+	require.JSONEq(t, `{"telemetry": false}`, string(detail.Config))
+	require.Equal(t, []string{"base"}, detail.Ancestors)
+	require.JSONEq(t, `{"telemetry": false, "disabled_mcps": ["a"]}`, string(detail.ResolvedConfig))
+
+	require.Equal(t, 409, do(t, "DELETE", "/api/profiles/base", "").Code)
+	require.Equal(t, 409, do(t, "PUT", "/api/profiles/base/settings", `{"extends": "child"}`).Code)
+
+	require.Equal(t, 200, do(t, "POST", "/api/profiles/child/activate", "").Code)
+	doc, err := config.LoadDocument()
+	require.NoError(t, err)
+	root, _ := doc.Raw(config.OpenCodeKey)
+	require.JSONEq(t, `{"telemetry": false, "disabled_mcps": ["a"]}`, string(root))
+
+	rec = do(t, "PUT", "/api/profiles/child/settings", `{"extends": ""}`)
+	require.Equal(t, 200, rec.Code, rec.Body.String())
+	require.Equal(t, 200, do(t, "DELETE", "/api/profiles/base", "").Code)
+}